@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -30,16 +31,23 @@ func cmdGenerate(args []string) error {
 }
 
 func generate(dir string, randomSeed int64) error {
-	random := rand.New(rand.NewSource(randomSeed))
-
 	if err := os.MkdirAll(dir, 0o700); err != nil && !os.IsExist(err) {
 		return err
 	}
 
-	config := &irgen.Config{Rand: random}
-	program := irgen.CreateProgram(config)
+	config := irgen.Config{
+		Dialect:         irgen.DialectKPHP,
+		CastProbability: 0.05,
+		MaxArrayDepth:   3,
+		ElseProbability: 0.4,
+		MaxElseIfs:      3,
+	}
+	program := irgen.CreateProgramFromSeed(randomSeed, config)
+	for _, warning := range program.Warnings {
+		log.Printf("warning: %s", warning)
+	}
 	printerConfig := &irprint.Config{
-		Rand: random,
+		Rand: rand.New(rand.NewSource(randomSeed)),
 	}
 
 	for _, f := range program.RuntimeFiles {
@@ -51,20 +59,14 @@ func generate(dir string, randomSeed int64) error {
 
 	for _, f := range program.Files {
 		fullname := filepath.Join(dir, f.Name)
-		fileContents := makeFileContents(f, printerConfig)
-		if err := os.WriteFile(fullname, fileContents, 0o664); err != nil {
+		var buf bytes.Buffer
+		if err := irprint.FprintFile(&buf, f, printerConfig); err != nil {
+			return fmt.Errorf("print %s file: %w", f.Name, err)
+		}
+		if err := os.WriteFile(fullname, buf.Bytes(), 0o664); err != nil {
 			return fmt.Errorf("create %s file: %w", fullname, err)
 		}
 	}
 
 	return nil
 }
-
-func makeFileContents(f *irgen.File, config *irprint.Config) []byte {
-	var buf bytes.Buffer
-	buf.WriteString("<?php\n")
-	for _, n := range f.Nodes {
-		irprint.FprintRootNode(&buf, n, config)
-	}
-	return buf.Bytes()
-}
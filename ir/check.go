@@ -0,0 +1,625 @@
+package ir
+
+import (
+	"fmt"
+)
+
+// Severity tells how bad a Check finding is.
+type Severity int
+
+const (
+	// SeverityError is a malformed IR that can't be printed
+	// or that makes the program behavior unspecified.
+	SeverityError Severity = iota
+
+	// SeverityWarning is a valid, but suspicious construct,
+	// like a continue that targets a switch.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// CheckError is a Check finding.
+type CheckError struct {
+	Node     *Node
+	Severity Severity
+	Message  string
+}
+
+func (e *CheckError) Error() string {
+	return e.Severity.String() + ": " + e.Message
+}
+
+// Check validates the f file nodes and returns the findings as *CheckError list.
+//
+// In addition to the CheckNode validations, it checks that
+// the variables are definitely assigned before they're read
+// and that the declared constants don't use reserved names.
+// Every function body and the file top-level code are checked separately;
+// the definite assignment rules are conservative: the variables assigned
+// inside loops, switch and try statements or inside one of the if branches
+// are not considered assigned after these statements.
+// The variables of the unreachable statements are not checked.
+func Check(f *File) []error {
+	c := &checker{vars: true}
+	topLevel := varSet{}
+	for _, n := range f.Nodes {
+		WalkRoot(n, func(n *Node) bool {
+			c.checkStructure(n)
+			return false
+		})
+		switch n := n.(type) {
+		case *RootConstDecl:
+			if IsReservedName(n.Name) {
+				c.errorf(n.Value, "can't use reserved %s as a constant name", n.Name)
+			}
+		case *RootStmt:
+			if next := c.checkStmt(n.X, topLevel); next != nil {
+				topLevel = next
+			}
+		case *RootFuncDecl:
+			c.checkFunc(n, false)
+		case *RootClassDecl:
+			c.checkMethods(n.Methods)
+		case *RootTraitDecl:
+			c.checkMethods(n.Methods)
+		case *RootEnumDecl:
+			c.checkMethods(n.Methods)
+		}
+	}
+	return c.errs
+}
+
+// CheckNode validates the n tree and returns the findings as *CheckError list.
+//
+// It checks the args count of every node, the placement of the ops
+// that are only valid inside other nodes (like OpCase outside of OpSwitch),
+// the break and continue levels and the assignment type mismatches.
+func CheckNode(n *Node) []error {
+	c := &checker{}
+	c.checkStructure(n)
+	c.checkStmt(n, varSet{})
+	return c.errs
+}
+
+type checker struct {
+	errs []error
+
+	// vars enables the undefined variables checks.
+	vars bool
+
+	// unreachable is set while the statements after
+	// a break, continue, return or throw are checked.
+	unreachable bool
+
+	// breakables are the enclosing loop and switch ops,
+	// the innermost is the last.
+	breakables []Op
+}
+
+// varSet is a set of the definitely assigned variables.
+// A nil set means that the code is unreachable.
+type varSet map[string]bool
+
+func (vars varSet) clone() varSet {
+	if vars == nil {
+		return nil
+	}
+	clone := make(varSet, len(vars))
+	for name := range vars {
+		clone[name] = true
+	}
+	return clone
+}
+
+// intersect returns the variables assigned in both x and y.
+// Unreachable sets are ignored.
+func intersect(x, y varSet) varSet {
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	result := varSet{}
+	for name := range x {
+		if y[name] {
+			result[name] = true
+		}
+	}
+	return result
+}
+
+var superglobals = map[string]bool{
+	"GLOBALS":  true,
+	"_SERVER":  true,
+	"_GET":     true,
+	"_POST":    true,
+	"_FILES":   true,
+	"_COOKIE":  true,
+	"_SESSION": true,
+	"_REQUEST": true,
+	"_ENV":     true,
+}
+
+func (c *checker) errorf(n *Node, format string, args ...interface{}) {
+	c.report(n, SeverityError, format, args...)
+}
+
+func (c *checker) warnf(n *Node, format string, args ...interface{}) {
+	c.report(n, SeverityWarning, format, args...)
+}
+
+func (c *checker) report(n *Node, severity Severity, format string, args ...interface{}) {
+	c.errs = append(c.errs, &CheckError{
+		Node:     n,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkStructure checks the args of every n tree node.
+func (c *checker) checkStructure(root *Node) {
+	Walk(root, func(n *Node) bool {
+		info := GetOpInfo(n.Op)
+		if info.Kind == OpKindInvalid {
+			c.errorf(n, "invalid op %s", n.Op)
+			return false
+		}
+		if len(n.Args) < info.MinArgs || (info.MaxArgs != -1 && len(n.Args) > info.MaxArgs) {
+			want := fmt.Sprintf("%d..%d", info.MinArgs, info.MaxArgs)
+			switch {
+			case info.MinArgs == info.MaxArgs:
+				want = fmt.Sprint(info.MinArgs)
+			case info.MaxArgs == -1:
+				want = fmt.Sprintf("at least %d", info.MinArgs)
+			}
+			c.errorf(n, "%s node has %d args, expected %s", n.Op, len(n.Args), want)
+			return false
+		}
+		for i, arg := range n.Args {
+			if arg == nil {
+				if !canBeNilArg(n.Op, i) {
+					c.errorf(n, "%s node has nil arg %d", n.Op, i)
+				}
+				continue
+			}
+			if reason := checkArgPlacement(n, i, arg); reason != "" {
+				c.errorf(arg, "%s %s", arg.Op, reason)
+			}
+		}
+		return true
+	})
+}
+
+func canBeNilArg(op Op, i int) bool {
+	switch op {
+	case OpForeach, OpTernary:
+		return i == 1
+	case OpCatch:
+		return i == 0
+	case OpList:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkArgPlacement returns a reason why the arg can't be
+// the i-th parent arg or an empty string if it can.
+func checkArgPlacement(parent *Node, i int, arg *Node) string {
+	switch arg.Op {
+	case OpCase, OpDefaultCase:
+		if parent.Op != OpSwitch || i == 0 {
+			return "outside of switch"
+		}
+		return ""
+	case OpCatch, OpFinally:
+		if parent.Op != OpTry || i == 0 {
+			return "outside of try"
+		}
+		return ""
+	case OpExprList:
+		if parent.Op != OpFor || i == 3 {
+			return "outside of for clauses"
+		}
+		return ""
+	case OpKeyedElem:
+		if parent.Op != OpArrayLit && parent.Op != OpList {
+			return "outside of array or list"
+		}
+		return ""
+	case OpByRef:
+		if parent.Op != OpList && parent.Op != OpKeyedElem {
+			return "outside of list"
+		}
+		return ""
+	case OpSpread:
+		if parent.Op == OpArrayLit || (isCallOp(parent.Op) && i != 0) {
+			return ""
+		}
+		return "outside of call args or array"
+	case OpNamedArg:
+		if isCallOp(parent.Op) && i != 0 {
+			return ""
+		}
+		return "outside of call args"
+	}
+
+	switch parent.Op {
+	case OpSwitch:
+		if i != 0 {
+			return "in switch cases list"
+		}
+	case OpTry:
+		if i != 0 {
+			return "in try clauses list"
+		}
+	case OpFor:
+		if i != 3 {
+			return "in for clauses"
+		}
+	}
+
+	if arg.IsStatement() && !isStmtArg(parent.Op, i) {
+		return "statement used as expression"
+	}
+	return ""
+}
+
+// isStmtArg reports whether the i-th op arg can be a statement.
+func isStmtArg(op Op, i int) bool {
+	switch op {
+	case OpBlock, OpDefaultCase:
+		return true
+	case OpIf, OpWhile, OpCatch:
+		return i == 1
+	case OpIfElse, OpCase:
+		return i >= 1
+	case OpDoWhile, OpTry, OpFinally, OpClosure:
+		return i == 0
+	case OpForeach, OpFor:
+		return i == 3
+	default:
+		return false
+	}
+}
+
+func isCallOp(op Op) bool {
+	switch op {
+	case OpCall, OpNew, OpMethodCall, OpNullsafeMethodCall, OpStaticCall:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *checker) checkMethods(methods []*ClassMethod) {
+	for _, m := range methods {
+		if !m.Abstract {
+			c.checkFunc(m.Func, !m.Static)
+		}
+	}
+}
+
+func (c *checker) checkFunc(decl *RootFuncDecl, method bool) {
+	vars := varSet{}
+	if decl.Type != nil {
+		for _, p := range decl.Type.Params {
+			vars[p.Name] = true
+		}
+	}
+	if method {
+		vars["this"] = true
+	}
+	c.checkBody(decl.Body, vars)
+}
+
+// checkBody checks a function or a closure body,
+// break and continue can't leave it.
+func (c *checker) checkBody(body *Node, vars varSet) {
+	breakables := c.breakables
+	c.breakables = nil
+	c.checkStmt(body, vars)
+	c.breakables = breakables
+}
+
+// checkStmt checks the n statement executed with the assigned vars
+// and returns the vars assigned after it.
+func (c *checker) checkStmt(n *Node, vars varSet) varSet {
+	if n == nil {
+		return vars
+	}
+	switch n.Op {
+	case OpBlock:
+		return c.checkStmtList(n.Args, vars)
+
+	case OpIf:
+		c.checkExpr(n.Args[0], vars)
+		c.checkStmt(n.Args[1], vars.clone())
+		return vars
+
+	case OpIfElse:
+		c.checkExpr(n.Args[0], vars)
+		return intersect(c.checkStmt(n.Args[1], vars.clone()), c.checkStmt(n.Args[2], vars.clone()))
+
+	case OpWhile:
+		c.checkExpr(n.Args[0], vars)
+		c.checkLoopBody(n, n.Args[1], vars.clone())
+		return vars
+
+	case OpDoWhile:
+		body := c.checkLoopBody(n, n.Args[0], vars.clone())
+		if body == nil {
+			body = vars.clone()
+		}
+		c.checkExpr(n.Args[1], body)
+		return vars
+
+	case OpFor:
+		for _, init := range n.Args[0].Args {
+			c.checkExpr(init, vars)
+		}
+		body := vars.clone()
+		for _, cond := range n.Args[1].Args {
+			c.checkExpr(cond, body)
+		}
+		after := c.checkLoopBody(n, n.Args[3], body.clone())
+		if after == nil {
+			after = body
+		}
+		for _, post := range n.Args[2].Args {
+			c.checkExpr(post, after)
+		}
+		return vars
+
+	case OpForeach:
+		c.checkExpr(n.Args[0], vars)
+		body := vars.clone()
+		c.assign(n.Args[1], body)
+		c.assign(n.Args[2], body)
+		c.checkLoopBody(n, n.Args[3], body)
+		return vars
+
+	case OpSwitch:
+		c.checkExpr(n.Args[0], vars)
+		c.breakables = append(c.breakables, OpSwitch)
+		for _, clause := range n.Args[1:] {
+			body := clause.Args
+			if clause.Op == OpCase {
+				c.checkExpr(clause.Args[0], vars)
+				body = clause.Args[1:]
+			}
+			c.checkStmtList(body, vars.clone())
+		}
+		c.breakables = c.breakables[:len(c.breakables)-1]
+		return vars
+
+	case OpTry:
+		c.checkStmt(n.Args[0], vars.clone())
+		for _, clause := range n.Args[1:] {
+			clauseVars := vars.clone()
+			body := clause.Args[0]
+			if clause.Op == OpCatch {
+				c.assign(clause.Args[0], clauseVars)
+				body = clause.Args[1]
+			}
+			c.checkStmt(body, clauseVars)
+		}
+		return vars
+
+	case OpBreak, OpContinue:
+		c.checkBreak(n)
+		return nil
+
+	case OpReturn, OpThrow:
+		c.checkExpr(n.Args[0], vars)
+		return nil
+	case OpReturnVoid:
+		return nil
+	case OpExit:
+		c.checkExpr(n, vars)
+		return nil
+
+	case OpStaticVar:
+		for _, decl := range n.Args {
+			if decl.Op == OpAssign {
+				c.checkExpr(decl.Args[1], vars)
+				decl = decl.Args[0]
+			}
+			c.assign(decl, vars)
+		}
+		return vars
+
+	case OpGlobal:
+		for _, v := range n.Args {
+			c.assign(v, vars)
+		}
+		return vars
+
+	case OpUnset:
+		for _, arg := range n.Args {
+			if arg.Op == OpVar {
+				delete(vars, arg.Value.(string))
+			}
+		}
+		return vars
+
+	default:
+		// Echo and expression statements.
+		c.checkExpr(n, vars)
+		return vars
+	}
+}
+
+func (c *checker) checkStmtList(list []*Node, vars varSet) varSet {
+	reachable := true
+	unreachable := c.unreachable
+	for _, stmt := range list {
+		// The unreachable statements are checked with
+		// the variables assigned before the exit,
+		// but their variables are not reported.
+		if next := c.checkStmt(stmt, vars); next != nil {
+			vars = next
+		} else {
+			reachable = false
+			c.unreachable = true
+		}
+	}
+	c.unreachable = unreachable
+	if !reachable {
+		return nil
+	}
+	return vars
+}
+
+func (c *checker) checkLoopBody(loop, body *Node, vars varSet) varSet {
+	c.breakables = append(c.breakables, loop.Op)
+	vars = c.checkStmt(body, vars)
+	c.breakables = c.breakables[:len(c.breakables)-1]
+	return vars
+}
+
+func (c *checker) checkBreak(n *Node) {
+	level := n.Value.(int)
+	if level == 0 {
+		level = 1
+	}
+	if level > len(c.breakables) {
+		c.errorf(n, "%s %d has only %d enclosing loops", n.Op, level, len(c.breakables))
+		return
+	}
+	if n.Op == OpContinue && c.breakables[len(c.breakables)-level] == OpSwitch {
+		c.warnf(n, "continue %d targets a switch, it works like break", level)
+	}
+}
+
+// checkExpr checks the n expression evaluated with the assigned vars.
+// The definitely assigned variables are added to vars.
+func (c *checker) checkExpr(n *Node, vars varSet) {
+	if n == nil {
+		return
+	}
+
+	switch n.Op {
+	case OpVar:
+		name := n.Value.(string)
+		if c.vars && !c.unreachable && !vars[name] && !superglobals[name] {
+			c.errorf(n, "$%s is used before assignment", name)
+		}
+
+	case OpAssign:
+		c.checkExpr(n.Args[1], vars)
+		c.checkAssignType(n)
+		c.assign(n.Args[0], vars)
+
+	case OpAssignModify:
+		if n.Value.(Op) == OpNullCoalesce {
+			c.checkExpr(n.Args[1], vars.clone())
+			c.assign(n.Args[0], vars)
+			return
+		}
+		c.checkExpr(n.Args[1], vars)
+		c.checkExpr(n.Args[0], vars)
+
+	case OpAnd, OpOr, OpAndWord, OpOrWord:
+		// The right operand may not be evaluated.
+		c.checkExpr(n.Args[0], vars)
+		c.checkExpr(n.Args[1], vars.clone())
+
+	case OpNullCoalesce:
+		c.checkIssetArg(n.Args[0], vars)
+		c.checkExpr(n.Args[1], vars.clone())
+
+	case OpTernary:
+		c.checkExpr(n.Args[0], vars)
+		c.checkExpr(n.Args[1], vars.clone())
+		c.checkExpr(n.Args[2], vars.clone())
+
+	case OpIsset, OpEmpty:
+		for _, arg := range n.Args {
+			c.checkIssetArg(arg, vars)
+		}
+
+	case OpClosure:
+		closureVars := varSet{}
+		if typ, ok := n.Type.(*FuncType); ok {
+			for _, p := range typ.Params {
+				closureVars[p.Name] = true
+			}
+		}
+		for _, u := range n.Value.(*ClosureInfo).Uses {
+			if u.ByRef {
+				// Capturing by reference creates the variable.
+				vars[u.Name] = true
+			} else if c.vars && !c.unreachable && !vars[u.Name] {
+				c.errorf(n, "captured $%s is used before assignment", u.Name)
+			}
+			closureVars[u.Name] = true
+		}
+		if vars["this"] {
+			closureVars["this"] = true
+		}
+		c.checkBody(n.Args[0], closureVars)
+
+	default:
+		for _, arg := range n.Args {
+			c.checkExpr(arg, vars)
+		}
+	}
+}
+
+// checkIssetArg checks the isset, empty or ?? operand,
+// its variables may be undefined.
+func (c *checker) checkIssetArg(n *Node, vars varSet) {
+	for n.Op == OpIndex || n.Op == OpProp || n.Op == OpNullsafeProp {
+		for _, key := range n.Args[1:] {
+			c.checkExpr(key, vars)
+		}
+		n = n.Args[0]
+	}
+	if n.Op != OpVar {
+		c.checkExpr(n, vars)
+	}
+}
+
+// assign checks the lhs of an assignment and adds the assigned variables to vars.
+func (c *checker) assign(lhs *Node, vars varSet) {
+	if lhs == nil {
+		return
+	}
+	switch lhs.Op {
+	case OpVar:
+		vars[lhs.Value.(string)] = true
+	case OpList:
+		for _, elem := range lhs.Args {
+			c.assign(elem, vars)
+		}
+	case OpKeyedElem:
+		c.checkExpr(lhs.Args[0], vars)
+		c.assign(lhs.Args[1], vars)
+	case OpByRef:
+		c.assign(lhs.Args[0], vars)
+	case OpIndex:
+		// Array elements assignment creates the array.
+		c.checkExpr(lhs.Args[1], vars)
+		c.assign(lhs.Args[0], vars)
+	default:
+		c.checkExpr(lhs, vars)
+	}
+}
+
+func (c *checker) checkAssignType(assign *Node) {
+	lhs, rhs := assign.Args[0], assign.Args[1]
+	if lhs.Op != OpVar || lhs.Type == nil || rhs.Type == nil {
+		return
+	}
+	if !TypesCompatible(lhs.Type, rhs.Type) {
+		c.errorf(assign, "can't assign %s value to $%s of %s type", TypeDocString(rhs.Type), lhs.Value, TypeDocString(lhs.Type))
+	}
+}
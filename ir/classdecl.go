@@ -0,0 +1,113 @@
+package ir
+
+import (
+	"github.com/quasilyte/phpsmith/phpdoc"
+)
+
+// Attribute is a '#[' $Name ['(' $Args ')'] ']' declaration attribute.
+// Args should be constant expressions, see IsConstExpr.
+type Attribute struct {
+	Name string
+	Args []*Node
+}
+
+// Visibility is a class member visibility modifier.
+// VisibilityNone means that no modifier is printed.
+type Visibility int
+
+const (
+	VisibilityNone Visibility = iota
+	VisibilityPublic
+	VisibilityProtected
+	VisibilityPrivate
+)
+
+func (v Visibility) String() string {
+	switch v {
+	case VisibilityPublic:
+		return "public"
+	case VisibilityProtected:
+		return "protected"
+	case VisibilityPrivate:
+		return "private"
+	default:
+		return ""
+	}
+}
+
+// ClassConst is a $Visibility 'const' $Name '=' $Value member.
+type ClassConst struct {
+	Name       string
+	Visibility Visibility
+	Value      *Node
+}
+
+// ClassProp is a $Visibility ['static'] [$Type] '$'$Name ['=' $Default] member.
+// A nil Type means that the property has no type hint;
+// a nil Default means that the property has no initializer.
+type ClassProp struct {
+	Name       string
+	Type       Type
+	Visibility Visibility
+	Static     bool
+	Default    *Node
+
+	Tags []phpdoc.Tag
+}
+
+// ClassMethod is a ['abstract'] $Visibility ['static'] $Func member.
+// Abstract methods are printed without a body.
+type ClassMethod struct {
+	Visibility Visibility
+	Static     bool
+	Abstract   bool
+	Func       *RootFuncDecl
+}
+
+// TraitUse is a 'use' $Traits member.
+// Non-empty Rules are printed as a '{' $Rules '}' block.
+type TraitUse struct {
+	Traits []string
+	Rules  []TraitRule
+}
+
+// TraitRule is a trait method conflict resolution rule.
+// If Insteadof is not empty, it's a $Trait '::' $Method 'insteadof' $Insteadof rule,
+// otherwise it's a [$Trait '::'] $Method 'as' [$Visibility] [$Alias] rule.
+type TraitRule struct {
+	Trait      string
+	Method     string
+	Insteadof  []string
+	Visibility Visibility
+	Alias      string
+}
+
+// EnumCase is a 'case' $Name ['=' $Value] enum member.
+// Pure enum cases have a nil Value.
+type EnumCase struct {
+	Name  string
+	Value *Node
+}
+
+// RelativeClass is a class reference that depends on the calling context.
+type RelativeClass int
+
+const (
+	// RelativeSelf is the class where the reference is written.
+	RelativeSelf RelativeClass = iota
+	// RelativeStatic is the class that was called at runtime (late static binding).
+	RelativeStatic
+	// RelativeParent is the parent of the self class.
+	RelativeParent
+)
+
+func (c RelativeClass) String() string {
+	switch c {
+	case RelativeStatic:
+		return "static"
+	case RelativeParent:
+		return "parent"
+	default:
+		return "self"
+	}
+}
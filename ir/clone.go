@@ -0,0 +1,240 @@
+package ir
+
+import (
+	"github.com/quasilyte/phpsmith/phpdoc"
+)
+
+// Clone returns a deep copy of the n tree.
+// Modifying the copy nodes or their values doesn't affect n.
+//
+// Types are immutable, so they're shared by the copy.
+// The unknown tags and value types are also shared.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+	clone := &Node{Op: n.Op, Value: cloneValue(n.Value), Type: n.Type}
+	if n.Args != nil {
+		clone.Args = cloneNodes(n.Args)
+	}
+	return clone
+}
+
+func cloneNodes(nodes []*Node) []*Node {
+	if nodes == nil {
+		return nil
+	}
+	clones := make([]*Node, len(nodes))
+	for i, n := range nodes {
+		// Some args, like the foreach key, can be nil.
+		clones[i] = n.Clone()
+	}
+	return clones
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *phpdoc.VarTag:
+		tag := *v
+		return &tag
+	case *ClosureInfo:
+		info := *v
+		info.Uses = append([]ClosureUse(nil), v.Uses...)
+		return &info
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		// Literals, names, ops and other immutable values.
+		return v
+	}
+}
+
+func cloneTags(tags []phpdoc.Tag) []phpdoc.Tag {
+	if tags == nil {
+		return nil
+	}
+	clones := make([]phpdoc.Tag, len(tags))
+	for i, tag := range tags {
+		switch tag := tag.(type) {
+		case *phpdoc.ReturnTag:
+			clone := *tag
+			clones[i] = &clone
+		case *phpdoc.VarTag:
+			clone := *tag
+			clones[i] = &clone
+		case *phpdoc.ParamTag:
+			clone := *tag
+			clones[i] = &clone
+		default:
+			clones[i] = tag
+		}
+	}
+	return clones
+}
+
+func cloneAttributes(attrs []Attribute) []Attribute {
+	if attrs == nil {
+		return nil
+	}
+	clones := make([]Attribute, len(attrs))
+	for i, attr := range attrs {
+		clones[i] = Attribute{Name: attr.Name, Args: cloneNodes(attr.Args)}
+	}
+	return clones
+}
+
+// Clone returns a deep copy of the f file, see Node.Clone.
+func (f *File) Clone() *File {
+	clone := *f
+	clone.Nodes = make([]RootNode, len(f.Nodes))
+	for i, n := range f.Nodes {
+		clone.Nodes[i] = CloneRoot(n)
+	}
+	return &clone
+}
+
+// Clone returns a deep copy of the decl, see Node.Clone.
+// The function type is shared.
+func (decl *RootFuncDecl) Clone() *RootFuncDecl {
+	return &RootFuncDecl{
+		Type:       decl.Type,
+		Tags:       cloneTags(decl.Tags),
+		Attributes: cloneAttributes(decl.Attributes),
+		Body:       decl.Body.Clone(),
+	}
+}
+
+// CloneRoot returns a deep copy of the n root node, see Node.Clone.
+// It panics if n is not a known root node.
+func CloneRoot(n RootNode) RootNode {
+	switch n := n.(type) {
+	case *RootDeclare:
+		return &RootDeclare{Name: n.Name, Value: n.Value.Clone()}
+	case *RootNamespace:
+		clone := *n
+		return &clone
+	case *RootRequire:
+		clone := *n
+		return &clone
+	case *RootStmt:
+		return &RootStmt{X: n.X.Clone()}
+	case *RootConstDecl:
+		return &RootConstDecl{Name: n.Name, Value: n.Value.Clone()}
+	case *RootFuncDecl:
+		return n.Clone()
+	case *RootClassDecl:
+		return &RootClassDecl{
+			Name:       n.Name,
+			Abstract:   n.Abstract,
+			Extends:    n.Extends,
+			Implements: cloneStrings(n.Implements),
+			Tags:       cloneTags(n.Tags),
+			Attributes: cloneAttributes(n.Attributes),
+			Uses:       cloneTraitUses(n.Uses),
+			Consts:     cloneClassConsts(n.Consts),
+			Props:      cloneClassProps(n.Props),
+			Methods:    cloneClassMethods(n.Methods),
+		}
+	case *RootInterfaceDecl:
+		return &RootInterfaceDecl{
+			Name:       n.Name,
+			Extends:    cloneStrings(n.Extends),
+			Tags:       cloneTags(n.Tags),
+			Attributes: cloneAttributes(n.Attributes),
+			Consts:     cloneClassConsts(n.Consts),
+			Methods:    cloneClassMethods(n.Methods),
+		}
+	case *RootTraitDecl:
+		return &RootTraitDecl{
+			Name:       n.Name,
+			Tags:       cloneTags(n.Tags),
+			Attributes: cloneAttributes(n.Attributes),
+			Uses:       cloneTraitUses(n.Uses),
+			Props:      cloneClassProps(n.Props),
+			Methods:    cloneClassMethods(n.Methods),
+		}
+	case *RootEnumDecl:
+		clone := &RootEnumDecl{
+			Name:        n.Name,
+			BackingType: n.BackingType,
+			Implements:  cloneStrings(n.Implements),
+			Tags:        cloneTags(n.Tags),
+			Attributes:  cloneAttributes(n.Attributes),
+			Consts:      cloneClassConsts(n.Consts),
+			Methods:     cloneClassMethods(n.Methods),
+		}
+		if n.Cases != nil {
+			clone.Cases = make([]*EnumCase, len(n.Cases))
+			for i, c := range n.Cases {
+				clone.Cases[i] = &EnumCase{Name: c.Name, Value: c.Value.Clone()}
+			}
+		}
+		return clone
+	default:
+		panic("unexpected root node")
+	}
+}
+
+func cloneStrings(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	return append([]string(nil), list...)
+}
+
+func cloneTraitUses(uses []*TraitUse) []*TraitUse {
+	if uses == nil {
+		return nil
+	}
+	clones := make([]*TraitUse, len(uses))
+	for i, use := range uses {
+		clone := &TraitUse{Traits: cloneStrings(use.Traits)}
+		if use.Rules != nil {
+			clone.Rules = make([]TraitRule, len(use.Rules))
+			for j, rule := range use.Rules {
+				rule.Insteadof = cloneStrings(rule.Insteadof)
+				clone.Rules[j] = rule
+			}
+		}
+		clones[i] = clone
+	}
+	return clones
+}
+
+func cloneClassConsts(consts []*ClassConst) []*ClassConst {
+	if consts == nil {
+		return nil
+	}
+	clones := make([]*ClassConst, len(consts))
+	for i, c := range consts {
+		clones[i] = &ClassConst{Name: c.Name, Visibility: c.Visibility, Value: c.Value.Clone()}
+	}
+	return clones
+}
+
+func cloneClassProps(props []*ClassProp) []*ClassProp {
+	if props == nil {
+		return nil
+	}
+	clones := make([]*ClassProp, len(props))
+	for i, prop := range props {
+		clone := *prop
+		clone.Default = prop.Default.Clone()
+		clone.Tags = cloneTags(prop.Tags)
+		clones[i] = &clone
+	}
+	return clones
+}
+
+func cloneClassMethods(methods []*ClassMethod) []*ClassMethod {
+	if methods == nil {
+		return nil
+	}
+	clones := make([]*ClassMethod, len(methods))
+	for i, m := range methods {
+		clone := *m
+		clone.Func = m.Func.Clone()
+		clones[i] = &clone
+	}
+	return clones
+}
@@ -0,0 +1,47 @@
+package ir
+
+import (
+	"math"
+)
+
+// IsConstExpr reports whether n is a PHP constant expression,
+// the one that can be used as a static variable initializer,
+// a constant value or a default parameter value.
+//
+// Constant expressions consist of literals, named constants
+// and operators applied to other constant expressions.
+// Division and modulo are printed as function calls, so they're excluded.
+func IsConstExpr(n *Node) bool {
+	switch n.Op {
+	case OpBoolLit, OpIntLit, OpStringLit, OpName, OpConstFetch:
+		return true
+
+	case OpFloatLit:
+		// NaN and infinities are printed as function calls.
+		v := n.Value.(float64)
+		return !math.IsNaN(v) && !math.IsInf(v, 0)
+
+	case OpClassConst:
+		// static:: is resolved at runtime, so it's not permitted.
+		class := n.Args[0]
+		return class.Op == OpName || (class.Op == OpRelativeClass && class.Value != RelativeStatic)
+
+	case OpArrayLit, OpKeyedElem, OpParens, OpIndex, OpTernary, OpNullCoalesce,
+		OpNot, OpNegation, OpUnaryPlus, OpBitNot,
+		OpConcat, OpAdd, OpSub, OpMul, OpExp,
+		OpBitAnd, OpBitOr, OpBitXor, OpBitShiftLeft, OpBitShiftRight,
+		OpAnd, OpOr, OpAndWord, OpOrWord, OpXorWord,
+		OpEqual2, OpEqual3, OpNotEqual2, OpNotEqual3, OpSpaceship,
+		OpLess, OpLessOrEqual, OpGreater, OpGreaterOrEqual:
+		for _, arg := range n.Args {
+			// A nil arg is a short ternary middle operand.
+			if arg != nil && !IsConstExpr(arg) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
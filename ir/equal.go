@@ -0,0 +1,293 @@
+package ir
+
+import (
+	"math"
+
+	"github.com/quasilyte/phpsmith/phpdoc"
+)
+
+// Equal reports whether a and b trees are structurally equal:
+// they have the same ops, values, types and args layout.
+//
+// All float NaN values are equal to each other, since they're
+// printed identically; other floats are compared bitwise,
+// so 0.0 and -0.0 are not equal.
+//
+// Types are compared by their string representation,
+// function types are also compared by their params.
+func Equal(a, b *Node) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Op != b.Op || !valuesEqual(a.Value, b.Value) || !typesEqual(a.Type, b.Type) {
+		return false
+	}
+	return nodesEqual(a.Args, b.Args)
+}
+
+// EqualRoot reports whether a and b root nodes are equal, see Equal.
+func EqualRoot(a, b RootNode) bool {
+	switch a := a.(type) {
+	case *RootDeclare:
+		b, ok := b.(*RootDeclare)
+		return ok && a.Name == b.Name && Equal(a.Value, b.Value)
+	case *RootNamespace:
+		b, ok := b.(*RootNamespace)
+		return ok && *a == *b
+	case *RootRequire:
+		b, ok := b.(*RootRequire)
+		return ok && *a == *b
+	case *RootStmt:
+		b, ok := b.(*RootStmt)
+		return ok && Equal(a.X, b.X)
+	case *RootConstDecl:
+		b, ok := b.(*RootConstDecl)
+		return ok && a.Name == b.Name && Equal(a.Value, b.Value)
+	case *RootFuncDecl:
+		b, ok := b.(*RootFuncDecl)
+		return ok && funcDeclsEqual(a, b)
+	case *RootClassDecl:
+		b, ok := b.(*RootClassDecl)
+		return ok && a.Name == b.Name && a.Abstract == b.Abstract && a.Extends == b.Extends &&
+			stringsEqual(a.Implements, b.Implements) &&
+			tagsEqual(a.Tags, b.Tags) && attributesEqual(a.Attributes, b.Attributes) &&
+			traitUsesEqual(a.Uses, b.Uses) && classConstsEqual(a.Consts, b.Consts) &&
+			classPropsEqual(a.Props, b.Props) && classMethodsEqual(a.Methods, b.Methods)
+	case *RootInterfaceDecl:
+		b, ok := b.(*RootInterfaceDecl)
+		return ok && a.Name == b.Name && stringsEqual(a.Extends, b.Extends) &&
+			tagsEqual(a.Tags, b.Tags) && attributesEqual(a.Attributes, b.Attributes) &&
+			classConstsEqual(a.Consts, b.Consts) && classMethodsEqual(a.Methods, b.Methods)
+	case *RootTraitDecl:
+		b, ok := b.(*RootTraitDecl)
+		return ok && a.Name == b.Name &&
+			tagsEqual(a.Tags, b.Tags) && attributesEqual(a.Attributes, b.Attributes) &&
+			traitUsesEqual(a.Uses, b.Uses) && classPropsEqual(a.Props, b.Props) &&
+			classMethodsEqual(a.Methods, b.Methods)
+	case *RootEnumDecl:
+		b, ok := b.(*RootEnumDecl)
+		if !ok || len(a.Cases) != len(b.Cases) {
+			return false
+		}
+		for i, c := range a.Cases {
+			if c.Name != b.Cases[i].Name || !Equal(c.Value, b.Cases[i].Value) {
+				return false
+			}
+		}
+		return a.Name == b.Name && typesEqual(a.BackingType, b.BackingType) &&
+			stringsEqual(a.Implements, b.Implements) &&
+			tagsEqual(a.Tags, b.Tags) && attributesEqual(a.Attributes, b.Attributes) &&
+			classConstsEqual(a.Consts, b.Consts) && classMethodsEqual(a.Methods, b.Methods)
+	default:
+		return false
+	}
+}
+
+// EqualFile reports whether a and b files are equal, see Equal.
+// File names are compared too.
+func EqualFile(a, b *File) bool {
+	if a.Name != b.Name || a.Header != b.Header || a.StrictTypes != b.StrictTypes || a.Namespace != b.Namespace {
+		return false
+	}
+	if len(a.Nodes) != len(b.Nodes) {
+		return false
+	}
+	for i, n := range a.Nodes {
+		if !EqualRoot(n, b.Nodes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func nodesEqual(a, b []*Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, n := range a {
+		if !Equal(n, b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func valuesEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		return ok && floatsEqual(a, b)
+	case *phpdoc.VarTag:
+		b, ok := b.(*phpdoc.VarTag)
+		return ok && *a == *b
+	case *ClosureInfo:
+		b, ok := b.(*ClosureInfo)
+		if !ok || a.ArrowFunc != b.ArrowFunc || len(a.Uses) != len(b.Uses) {
+			return false
+		}
+		for i, u := range a.Uses {
+			if u != b.Uses[i] {
+				return false
+			}
+		}
+		return true
+	case []string:
+		b, ok := b.([]string)
+		return ok && stringsEqual(a, b)
+	default:
+		// Literals, names, ops and other comparable values.
+		return a == b
+	}
+}
+
+func floatsEqual(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Float64bits(a) == math.Float64bits(b)
+}
+
+func typesEqual(a, b Type) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	if a, ok := a.(*FuncType); ok {
+		b, ok := b.(*FuncType)
+		return ok && funcTypesEqual(a, b)
+	}
+	return a.String() == b.String()
+}
+
+func funcTypesEqual(a, b *FuncType) bool {
+	if a.Name != b.Name || a.MinArgsNum != b.MinArgsNum || len(a.Params) != len(b.Params) {
+		return false
+	}
+	if !typesEqual(a.Result, b.Result) {
+		return false
+	}
+	for i, p1 := range a.Params {
+		p2 := b.Params[i]
+		if p1.Name != p2.Name || p1.ByRef != p2.ByRef || p1.Variadic != p2.Variadic || p1.Strict != p2.Strict {
+			return false
+		}
+		if !typesEqual(p1.Type, p2.Type) || !Equal(p1.Default, p2.Default) {
+			return false
+		}
+	}
+	return true
+}
+
+func funcDeclsEqual(a, b *RootFuncDecl) bool {
+	return typesEqual(a.Type, b.Type) &&
+		tagsEqual(a.Tags, b.Tags) &&
+		attributesEqual(a.Attributes, b.Attributes) &&
+		Equal(a.Body, b.Body)
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, s := range a {
+		if s != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func tagsEqual(a, b []phpdoc.Tag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, tag := range a {
+		if tag.Name() != b[i].Name() || tag.Value() != b[i].Value() {
+			return false
+		}
+	}
+	return true
+}
+
+func attributesEqual(a, b []Attribute) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, attr := range a {
+		if attr.Name != b[i].Name || !nodesEqual(attr.Args, b[i].Args) {
+			return false
+		}
+	}
+	return true
+}
+
+func traitUsesEqual(a, b []*TraitUse) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, use := range a {
+		other := b[i]
+		if !stringsEqual(use.Traits, other.Traits) || len(use.Rules) != len(other.Rules) {
+			return false
+		}
+		for j, r1 := range use.Rules {
+			r2 := other.Rules[j]
+			if r1.Trait != r2.Trait || r1.Method != r2.Method || r1.Visibility != r2.Visibility || r1.Alias != r2.Alias {
+				return false
+			}
+			if !stringsEqual(r1.Insteadof, r2.Insteadof) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func classConstsEqual(a, b []*ClassConst) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, c := range a {
+		if c.Name != b[i].Name || c.Visibility != b[i].Visibility || !Equal(c.Value, b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func classPropsEqual(a, b []*ClassProp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, p1 := range a {
+		p2 := b[i]
+		if p1.Name != p2.Name || p1.Visibility != p2.Visibility || p1.Static != p2.Static {
+			return false
+		}
+		if !typesEqual(p1.Type, p2.Type) || !Equal(p1.Default, p2.Default) || !tagsEqual(p1.Tags, p2.Tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func classMethodsEqual(a, b []*ClassMethod) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, m1 := range a {
+		m2 := b[i]
+		if m1.Visibility != m2.Visibility || m1.Static != m2.Static || m1.Abstract != m2.Abstract {
+			return false
+		}
+		if !funcDeclsEqual(m1.Func, m2.Func) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package eval
+
+import (
+	"math"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// builtinFunc computes the builtin function result.
+// The args count is checked by the caller, see builtin.
+type builtinFunc func(e *evaluator, args []interface{}) interface{}
+
+type builtin struct {
+	// numArgs is the required args count,
+	// the variadic functions need at least -numArgs args.
+	numArgs int
+
+	fn builtinFunc
+}
+
+// builtins are the pure functions with the exactly reproducible results.
+//
+// The functions that depend on the C library, like sin or round,
+// are not included: their results can differ in the last digit.
+var builtins = map[string]builtin{
+	"abs": {1, func(e *evaluator, args []interface{}) interface{} {
+		switch x := e.numberArg(args[0]).(type) {
+		case int64:
+			if x == math.MinInt64 {
+				return -float64(x)
+			}
+			if x < 0 {
+				return -x
+			}
+			return x
+		default:
+			return math.Abs(x.(float64))
+		}
+	}},
+	"ceil": {1, func(e *evaluator, args []interface{}) interface{} {
+		return math.Ceil(toFloat(e.numberArg(args[0])))
+	}},
+	"floor": {1, func(e *evaluator, args []interface{}) interface{} {
+		return math.Floor(toFloat(e.numberArg(args[0])))
+	}},
+	"sqrt": {1, func(e *evaluator, args []interface{}) interface{} {
+		return math.Sqrt(toFloat(e.numberArg(args[0])))
+	}},
+	"is_nan": {1, func(e *evaluator, args []interface{}) interface{} {
+		return math.IsNaN(toFloat(e.numberArg(args[0])))
+	}},
+	"is_infinite": {1, func(e *evaluator, args []interface{}) interface{} {
+		return math.IsInf(toFloat(e.numberArg(args[0])), 0)
+	}},
+	"is_finite": {1, func(e *evaluator, args []interface{}) interface{} {
+		x := toFloat(e.numberArg(args[0]))
+		return !math.IsNaN(x) && !math.IsInf(x, 0)
+	}},
+	"intdiv": {2, func(e *evaluator, args []interface{}) interface{} {
+		x, y := e.intArg(args[0]), e.intArg(args[1])
+		if y == 0 || (x == math.MinInt64 && y == -1) {
+			e.unsupported("intdiv error")
+		}
+		return x / y
+	}},
+	"strlen": {1, func(e *evaluator, args []interface{}) interface{} {
+		return int64(len(e.stringArg(args[0])))
+	}},
+	"strrev": {1, func(e *evaluator, args []interface{}) interface{} {
+		s := []byte(e.stringArg(args[0]))
+		for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+			s[i], s[j] = s[j], s[i]
+		}
+		return string(s)
+	}},
+	"ord": {1, func(e *evaluator, args []interface{}) interface{} {
+		s := e.stringArg(args[0])
+		if s == "" {
+			return int64(0)
+		}
+		return int64(s[0])
+	}},
+	"count":  {1, countFunc},
+	"sizeof": {1, countFunc},
+	"max": {-2, func(e *evaluator, args []interface{}) interface{} {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if e.compare(arg, result) > 0 {
+				result = arg
+			}
+		}
+		return result
+	}},
+	"min": {-2, func(e *evaluator, args []interface{}) interface{} {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if e.compare(arg, result) < 0 {
+				result = arg
+			}
+		}
+		return result
+	}},
+	"boolval": {1, func(e *evaluator, args []interface{}) interface{} {
+		return toBool(args[0])
+	}},
+	"intval": {1, func(e *evaluator, args []interface{}) interface{} {
+		return e.castInt(args[0])
+	}},
+	"strval": {1, func(e *evaluator, args []interface{}) interface{} {
+		return e.toString(args[0])
+	}},
+}
+
+func countFunc(e *evaluator, args []interface{}) interface{} {
+	arr, ok := args[0].(*Array)
+	if !ok {
+		e.unsupported("non-array argument")
+	}
+	return int64(len(arr.Keys))
+}
+
+func (e *evaluator) evalCall(n *ir.Node) interface{} {
+	if n.Args[0].Op != ir.OpName {
+		e.unsupported("dynamic call")
+	}
+	// Unqualified names fall back to the global functions.
+	name := strings.TrimPrefix(n.Args[0].Value.(string), `\`)
+	b, ok := builtins[name]
+	if !ok {
+		e.unsupported("%s is not a pure builtin", name)
+	}
+	numArgs := len(n.Args) - 1
+	if numArgs != b.numArgs && (b.numArgs >= 0 || numArgs < -b.numArgs) {
+		e.unsupported("%s called with %d args", name, numArgs)
+	}
+	args := make([]interface{}, numArgs)
+	for i, arg := range n.Args[1:] {
+		if arg.Op == ir.OpSpread || arg.Op == ir.OpNamedArg {
+			e.unsupported("%s arg", arg.Op)
+		}
+		args[i] = e.eval(arg)
+	}
+	return b.fn(e, args)
+}
+
+// numberArg checks that v is an int or float param argument.
+// Other types are not accepted in the strict_types=1 mode.
+func (e *evaluator) numberArg(v interface{}) interface{} {
+	switch v.(type) {
+	case int64, float64:
+		return v
+	default:
+		e.unsupported("non-number argument")
+		return nil
+	}
+}
+
+func (e *evaluator) intArg(v interface{}) int64 {
+	x, ok := v.(int64)
+	if !ok {
+		e.unsupported("non-int argument")
+	}
+	return x
+}
+
+func (e *evaluator) stringArg(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		e.unsupported("non-string argument")
+	}
+	return s
+}
@@ -0,0 +1,205 @@
+package eval
+
+import (
+	"strconv"
+	"strings"
+)
+
+// looseEqual implements the == operator.
+func (e *evaluator) looseEqual(x, y interface{}) bool {
+	switch x := x.(type) {
+	case float64:
+		if y, ok := y.(float64); ok {
+			// NaN is not equal to itself.
+			return x == y
+		}
+	case *Array:
+		y, ok := y.(*Array)
+		if !ok {
+			break
+		}
+		if len(x.Keys) != len(y.Keys) {
+			return false
+		}
+		for i, key := range x.Keys {
+			v, ok := y.Get(key)
+			if !ok || !e.looseEqual(x.Values[i], v) {
+				return false
+			}
+		}
+		return true
+	}
+	return e.compare(x, y) == 0
+}
+
+// strictEqual implements the === operator.
+func strictEqual(x, y interface{}) bool {
+	switch x := x.(type) {
+	case *Array:
+		y, ok := y.(*Array)
+		if !ok || len(x.Keys) != len(y.Keys) {
+			return false
+		}
+		for i, key := range x.Keys {
+			if key != y.Keys[i] || !strictEqual(x.Values[i], y.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case float64:
+		y, ok := y.(float64)
+		return ok && x == y
+	default:
+		return x == y
+	}
+}
+
+// compare implements the <=> operator.
+// The arrays can only be compared for equality, see looseEqual.
+func (e *evaluator) compare(x, y interface{}) int {
+	if _, ok := x.(*Array); ok {
+		e.unsupported("array comparison")
+	}
+	if _, ok := y.(*Array); ok {
+		e.unsupported("array comparison")
+	}
+
+	switch x := x.(type) {
+	case nil:
+		switch y := y.(type) {
+		case nil:
+			return 0
+		case string:
+			if y == "" {
+				return 0
+			}
+			return -1
+		default:
+			return compareBools(false, toBool(y))
+		}
+	case bool:
+		return compareBools(x, toBool(y))
+	}
+
+	switch y := y.(type) {
+	case nil:
+		if x, ok := x.(string); ok {
+			if x == "" {
+				return 0
+			}
+			return 1
+		}
+		return compareBools(toBool(x), false)
+	case bool:
+		return compareBools(toBool(x), y)
+	}
+
+	xs, xString := x.(string)
+	ys, yString := y.(string)
+	switch {
+	case xString && yString:
+		return e.compareStrings(xs, ys)
+	case xString:
+		return -e.compareNumberToString(y, xs)
+	case yString:
+		return e.compareNumberToString(x, ys)
+	default:
+		return compareNumbers(x, y)
+	}
+}
+
+func compareBools(x, y bool) int {
+	switch {
+	case x == y:
+		return 0
+	case x:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// compareNumbers compares int64 and float64 values.
+// Ints are converted to floats when compared with floats.
+func compareNumbers(x, y interface{}) int {
+	if x, ok := x.(int64); ok {
+		if y, ok := y.(int64); ok {
+			switch {
+			case x == y:
+				return 0
+			case x < y:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+	return compareFloats(toFloat(x), toFloat(y))
+}
+
+// compareFloats is a three-way comparison of x and y.
+// Like in PHP, NaN is greater than any other value.
+func compareFloats(x, y float64) int {
+	switch {
+	case x == y:
+		return 0
+	case x < y:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// compareStrings compares two strings as numbers if they're both numeric.
+func (e *evaluator) compareStrings(x, y string) int {
+	xv, xKind := parseNumeric(x, e.env.LegacyComparisons)
+	yv, yKind := parseNumeric(y, e.env.LegacyComparisons)
+	if xKind == numeric && yKind == numeric {
+		if isIntOverflow(x, xv) || isIntOverflow(y, yv) {
+			// PHP compares the overflowing integer strings as strings
+			// if they're equal as floats.
+			e.unsupported("overflowing numeric string comparison")
+		}
+		return compareNumbers(xv, yv)
+	}
+	return normalizeCmp(strings.Compare(x, y))
+}
+
+// isIntOverflow reports whether the s numeric string is an integer
+// that doesn't fit into int64, v is the s value.
+func isIntOverflow(s string, v interface{}) bool {
+	if _, ok := v.(float64); !ok {
+		return false
+	}
+	return !strings.ContainsAny(s, ".eE")
+}
+
+// compareNumberToString compares an int64 or float64 x with the y string.
+//
+// Since PHP 8, x is compared with y as a string unless y is numeric.
+// In the legacy mode, y is always converted to a number.
+func (e *evaluator) compareNumberToString(x interface{}, y string) int {
+	yv, yKind := parseNumeric(y, e.env.LegacyComparisons)
+	if e.env.LegacyComparisons || yKind == numeric {
+		return compareNumbers(x, yv)
+	}
+	var xs string
+	switch x := x.(type) {
+	case int64:
+		xs = strconv.FormatInt(x, 10)
+	case float64:
+		xs = FormatFloat(x, 14)
+	}
+	return normalizeCmp(strings.Compare(xs, y))
+}
+
+func normalizeCmp(cmp int) int {
+	switch {
+	case cmp < 0:
+		return -1
+	case cmp > 0:
+		return 1
+	default:
+		return 0
+	}
+}
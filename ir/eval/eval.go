@@ -0,0 +1,731 @@
+// Package eval computes the values of pure PHP expressions.
+//
+// It's used as an oracle: the values computed here are compared
+// with the values computed by the PHP interpreter.
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// Env describes the expression evaluation environment.
+type Env struct {
+	// Vars contains the known variable values.
+	// Reading any other variable is unsupported.
+	Vars map[string]interface{}
+
+	// LegacyComparisons selects the PHP 7 string to number comparison rules:
+	// strings are converted to numbers instead of numbers being converted to strings,
+	// numeric strings can't have a trailing whitespace.
+	LegacyComparisons bool
+}
+
+// UnsupportedError is returned for the expressions that can't be evaluated.
+//
+// Apart from the side effects and the unknown functions, the operations that
+// emit PHP warnings, deprecations or throw errors are unsupported too,
+// like the string offsets that are out of range or the division by zero.
+type UnsupportedError struct {
+	Node   *ir.Node
+	Reason string
+}
+
+func (e *UnsupportedError) Error() string {
+	return "eval: unsupported " + e.Node.Op.String() + ": " + e.Reason
+}
+
+// Eval computes the n expression value, it's one of:
+// nil (PHP null), bool, int64, float64, string or *Array.
+//
+// The semantics match the default runtime configuration of PHP 8
+// on a 64-bit platform: ints overflow to floats, floats are converted
+// to strings with the precision of 14 digits and so on.
+// The ops that are printed as the runtime helper calls, like OpDiv,
+// are evaluated like these helpers.
+//
+// An *UnsupportedError is returned when n can't be evaluated;
+// note that the operands that are not evaluated due to short-circuiting
+// are not checked, so false && f() is false.
+func Eval(n *ir.Node, env *Env) (v interface{}, err error) {
+	if env == nil {
+		env = &Env{}
+	}
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if r, ok := r.(*UnsupportedError); ok {
+			err = r
+			return
+		}
+		panic(r)
+	}()
+
+	e := &evaluator{env: env}
+	return e.eval(n), nil
+}
+
+type evaluator struct {
+	env *Env
+
+	// node is the node being evaluated, it's reported by unsupported.
+	node *ir.Node
+}
+
+func (e *evaluator) unsupported(format string, args ...interface{}) {
+	panic(&UnsupportedError{Node: e.node, Reason: fmt.Sprintf(format, args...)})
+}
+
+// constants are the predefined constants with the platform independent values.
+var constants = map[string]interface{}{
+	"PHP_INT_MAX":       int64(math.MaxInt64),
+	"PHP_INT_MIN":       int64(math.MinInt64),
+	"PHP_INT_SIZE":      int64(8),
+	"PHP_FLOAT_EPSILON": math.Nextafter(1, 2) - 1,
+	"PHP_FLOAT_MAX":     math.MaxFloat64,
+	"PHP_FLOAT_MIN":     2.2250738585072014e-308,
+	"PHP_FLOAT_DIG":     int64(15),
+	"M_PI":              math.Pi,
+	"M_E":               math.E,
+	"NAN":               math.NaN(),
+	"INF":               math.Inf(1),
+}
+
+func (e *evaluator) eval(n *ir.Node) interface{} {
+	prev := e.node
+	e.node = n
+	v := e.evalNode(n)
+	e.node = prev
+	return v
+}
+
+func (e *evaluator) evalNode(n *ir.Node) interface{} {
+	switch n.Op {
+	case ir.OpBoolLit, ir.OpIntLit, ir.OpFloatLit, ir.OpStringLit:
+		return n.Value
+
+	case ir.OpParens, ir.OpErrorSuppress:
+		// The supported expressions don't emit warnings,
+		// so the @ operator has no effect.
+		return e.eval(n.Args[0])
+
+	case ir.OpVar:
+		v, ok := e.env.Vars[n.Value.(string)]
+		if !ok {
+			e.unsupported("unknown $%s value", n.Value)
+		}
+		return v
+
+	case ir.OpConstFetch:
+		name := strings.TrimPrefix(n.Value.(string), `\`)
+		v, ok := constants[name]
+		if !ok {
+			e.unsupported("unknown %s constant", name)
+		}
+		return v
+
+	case ir.OpInterpolatedString:
+		var buf strings.Builder
+		for _, part := range n.Args {
+			buf.WriteString(e.toString(e.eval(part)))
+		}
+		return buf.String()
+
+	case ir.OpArrayLit:
+		return e.evalArrayLit(n)
+
+	case ir.OpIndex:
+		return e.index(e.eval(n.Args[0]), e.eval(n.Args[1]), false)
+
+	case ir.OpCast:
+		return e.cast(e.eval(n.Args[0]), n.Type)
+
+	case ir.OpNot:
+		return !toBool(e.eval(n.Args[0]))
+
+	case ir.OpAnd, ir.OpAndWord:
+		return toBool(e.eval(n.Args[0])) && toBool(e.eval(n.Args[1]))
+	case ir.OpOr, ir.OpOrWord:
+		return toBool(e.eval(n.Args[0])) || toBool(e.eval(n.Args[1]))
+	case ir.OpXorWord:
+		return toBool(e.eval(n.Args[0])) != toBool(e.eval(n.Args[1]))
+
+	case ir.OpTernary:
+		cond := e.eval(n.Args[0])
+		switch {
+		case n.Args[1] == nil && toBool(cond):
+			return cond
+		case toBool(cond):
+			return e.eval(n.Args[1])
+		default:
+			return e.eval(n.Args[2])
+		}
+
+	case ir.OpNullCoalesce:
+		if v := e.evalIsset(n.Args[0]); v != nil {
+			return v
+		}
+		return e.eval(n.Args[1])
+
+	case ir.OpIsset:
+		for _, arg := range n.Args {
+			if e.evalIsset(arg) == nil {
+				return false
+			}
+		}
+		return true
+
+	case ir.OpEmpty:
+		return !toBool(e.evalIsset(n.Args[0]))
+
+	case ir.OpEqual2, ir.OpFloatEqual2:
+		return e.looseEqual(e.eval(n.Args[0]), e.eval(n.Args[1]))
+	case ir.OpNotEqual2, ir.OpNotFloatEqual2:
+		return !e.looseEqual(e.eval(n.Args[0]), e.eval(n.Args[1]))
+	case ir.OpEqual3, ir.OpFloatEqual3:
+		return strictEqual(e.eval(n.Args[0]), e.eval(n.Args[1]))
+	case ir.OpNotEqual3, ir.OpNotFloatEqual3:
+		return !strictEqual(e.eval(n.Args[0]), e.eval(n.Args[1]))
+
+	case ir.OpLess:
+		return e.compare(e.eval(n.Args[0]), e.eval(n.Args[1])) < 0
+	case ir.OpLessOrEqual:
+		return e.compare(e.eval(n.Args[0]), e.eval(n.Args[1])) <= 0
+	case ir.OpGreater:
+		// PHP evaluates x > y as y < x, it matters for NaN.
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.compare(y, x) < 0
+	case ir.OpGreaterOrEqual:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.compare(y, x) <= 0
+	case ir.OpSpaceship:
+		return int64(e.compare(e.eval(n.Args[0]), e.eval(n.Args[1])))
+
+	case ir.OpConcat:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.toString(x) + e.toString(y)
+
+	case ir.OpNegation:
+		// PHP compiles -x as x * -1.
+		return e.mul(e.toNumber(e.eval(n.Args[0])), int64(-1))
+	case ir.OpUnaryPlus:
+		return e.mul(e.toNumber(e.eval(n.Args[0])), int64(1))
+
+	case ir.OpAdd:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.add(e.toNumber(x), e.toNumber(y))
+	case ir.OpSub:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.sub(e.toNumber(x), e.toNumber(y))
+	case ir.OpMul:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.mul(e.toNumber(x), e.toNumber(y))
+	case ir.OpDiv:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.div(e.toNumber(x), e.toNumber(y))
+	case ir.OpMod:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		if n.Type == ir.FloatType {
+			return e.fmod(x, y)
+		}
+		return e.mod(e.toInt(x), e.toInt(y))
+	case ir.OpExp:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.pow(e.toNumber(x), e.toNumber(y))
+
+	case ir.OpBitAnd, ir.OpBitOr, ir.OpBitXor:
+		return e.bitwise(n.Op, e.eval(n.Args[0]), e.eval(n.Args[1]))
+	case ir.OpBitNot:
+		return e.bitNot(e.eval(n.Args[0]))
+	case ir.OpBitShiftLeft, ir.OpBitShiftRight:
+		x, y := e.eval(n.Args[0]), e.eval(n.Args[1])
+		return e.shift(n.Op, e.toInt(x), e.toInt(y))
+
+	case ir.OpCall:
+		return e.evalCall(n)
+
+	default:
+		e.unsupported("not a pure expression")
+		return nil
+	}
+}
+
+// evalIsset evaluates n as an isset operand: the missing
+// array elements and string offsets are null.
+func (e *evaluator) evalIsset(n *ir.Node) interface{} {
+	for n.Op == ir.OpParens {
+		n = n.Args[0]
+	}
+	if n.Op != ir.OpIndex {
+		return e.eval(n)
+	}
+	prev := e.node
+	e.node = n
+	v := e.index(e.evalIsset(n.Args[0]), e.eval(n.Args[1]), true)
+	e.node = prev
+	return v
+}
+
+func (e *evaluator) evalArrayLit(n *ir.Node) *Array {
+	arr := &Array{}
+	nextIndex := int64(0)
+	negativeKeys := false
+	for _, elem := range n.Args {
+		if elem.Op == ir.OpSpread {
+			e.unsupported("array unpacking")
+		}
+		if elem.Op != ir.OpKeyedElem {
+			if negativeKeys {
+				// PHP 8.3 changed the next key after the negative keys.
+				e.unsupported("implicit key after a negative key")
+			}
+			if nextIndex == math.MaxInt64 {
+				e.unsupported("next array key is out of range")
+			}
+			arr.set(nextIndex, e.eval(elem))
+			nextIndex++
+			continue
+		}
+		key := e.arrayKey(e.eval(elem.Args[0]))
+		arr.set(key, e.eval(elem.Args[1]))
+		if key, ok := key.(int64); ok {
+			if key < 0 && nextIndex == 0 {
+				negativeKeys = true
+			}
+			if key >= nextIndex {
+				nextIndex = key + 1
+			}
+		}
+	}
+	return arr
+}
+
+// arrayKey converts v to an int64 or string array key.
+func (e *evaluator) arrayKey(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case int64:
+		return v
+	case float64:
+		return e.floatToInt(v)
+	case string:
+		// Decimal integer strings in canonical form are int keys.
+		if x, err := strconv.ParseInt(v, 10, 64); err == nil && strconv.FormatInt(x, 10) == v {
+			return x
+		}
+		return v
+	default:
+		e.unsupported("illegal array key type")
+		return nil
+	}
+}
+
+func (e *evaluator) index(x, key interface{}, isset bool) interface{} {
+	switch x := x.(type) {
+	case *Array:
+		if v, ok := x.Get(e.arrayKey(key)); ok {
+			return v
+		}
+		if !isset {
+			e.unsupported("undefined array key")
+		}
+		return nil
+
+	case string:
+		offset, ok := e.stringOffset(key, isset)
+		if !ok {
+			return nil
+		}
+		if offset < 0 {
+			offset += int64(len(x))
+		}
+		if offset < 0 || offset >= int64(len(x)) {
+			if !isset {
+				e.unsupported("uninitialized string offset")
+			}
+			return nil
+		}
+		return x[offset : offset+1]
+
+	default:
+		if !isset {
+			e.unsupported("index of a non-array value")
+		}
+		return nil
+	}
+}
+
+// stringOffset converts the key to a string offset.
+// It returns false if the key is not a valid isset offset.
+func (e *evaluator) stringOffset(key interface{}, isset bool) (int64, bool) {
+	if s, ok := key.(string); ok {
+		// Integer numeric strings are valid offsets.
+		if x, kind := parseNumeric(s, e.env.LegacyComparisons); kind == numeric {
+			if x, ok := x.(int64); ok {
+				return x, true
+			}
+		}
+		if !isset {
+			e.unsupported("illegal string offset")
+		}
+		return 0, false
+	}
+	if offset, ok := key.(int64); ok {
+		return offset, true
+	}
+	if !isset {
+		// Other offset types emit warnings.
+		e.unsupported("non-int string offset")
+	}
+	switch key := key.(type) {
+	case nil, bool:
+		return e.toNumber(key).(int64), true
+	case float64:
+		return floatToInt(key), true
+	default:
+		return 0, false
+	}
+}
+
+func (e *evaluator) cast(v interface{}, typ ir.Type) interface{} {
+	scalar, ok := typ.(*ir.ScalarType)
+	if !ok {
+		e.unsupported("cast to %v", typ)
+	}
+	switch scalar.Kind {
+	case ir.ScalarBool:
+		return toBool(v)
+	case ir.ScalarInt:
+		return e.castInt(v)
+	case ir.ScalarFloat:
+		if s, ok := v.(string); ok {
+			x, _ := parseNumeric(s, false)
+			return toFloat(x)
+		}
+		return toFloat(e.toNumber(v))
+	case ir.ScalarString:
+		return e.toString(v)
+	default:
+		e.unsupported("cast to %v", typ)
+		return nil
+	}
+}
+
+// castInt implements the (int) cast.
+func (e *evaluator) castInt(v interface{}) int64 {
+	switch v := v.(type) {
+	case float64:
+		return floatToInt(v)
+	case string:
+		x, _ := parseNumeric(v, false)
+		if f, ok := x.(float64); ok {
+			return floatToIntCap(f)
+		}
+		return x.(int64)
+	case *Array:
+		if len(v.Keys) != 0 {
+			return 1
+		}
+		return 0
+	default:
+		return e.toNumber(v).(int64)
+	}
+}
+
+// toNumber converts v to an int64 or float64 arithmetic operand.
+func (e *evaluator) toNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return int64(0)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case int64, float64:
+		return v
+	case string:
+		x, kind := parseNumeric(v, false)
+		if kind != numeric {
+			e.unsupported("non-numeric string operand")
+		}
+		return x
+	default:
+		e.unsupported("array operand")
+		return nil
+	}
+}
+
+// toInt converts v to an int64 operand of a bitwise or a modulo operator.
+func (e *evaluator) toInt(v interface{}) int64 {
+	switch x := e.toNumber(v).(type) {
+	case float64:
+		return e.floatToInt(x)
+	default:
+		return x.(int64)
+	}
+}
+
+// floatToInt converts f to int64 implicitly. The float values with
+// a fractional part emit a deprecation warning since PHP 8.1.
+func (e *evaluator) floatToInt(f float64) int64 {
+	if f != math.Trunc(f) || !fitsInt(f) {
+		e.unsupported("implicit conversion of %s to int", FormatFloat(f, -1))
+	}
+	return int64(f)
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
+
+// toString converts v to string, like a (string) cast.
+func (e *evaluator) toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "1"
+		}
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return FormatFloat(v, 14)
+	case string:
+		return v
+	default:
+		e.unsupported("array to string conversion")
+		return ""
+	}
+}
+
+func (e *evaluator) add(x, y interface{}) interface{} {
+	if x, ok := x.(int64); ok {
+		if y, ok := y.(int64); ok {
+			sum := x + y
+			if (sum > x) == (y > 0) {
+				return sum
+			}
+			return float64(x) + float64(y)
+		}
+	}
+	return toFloat(x) + toFloat(y)
+}
+
+func (e *evaluator) sub(x, y interface{}) interface{} {
+	if x, ok := x.(int64); ok {
+		if y, ok := y.(int64); ok {
+			diff := x - y
+			if (diff < x) == (y > 0) {
+				return diff
+			}
+			return float64(x) - float64(y)
+		}
+	}
+	return toFloat(x) - toFloat(y)
+}
+
+func (e *evaluator) mul(x, y interface{}) interface{} {
+	if x, ok := x.(int64); ok {
+		if y, ok := y.(int64); ok {
+			if product, ok := mulInt(x, y); ok {
+				return product
+			}
+			return float64(x) * float64(y)
+		}
+	}
+	return toFloat(x) * toFloat(y)
+}
+
+// mulInt returns x*y and whether it doesn't overflow.
+func mulInt(x, y int64) (int64, bool) {
+	if x == 0 || y == 0 {
+		return 0, true
+	}
+	product := x * y
+	if product/y != x || (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) {
+		return 0, false
+	}
+	return product, true
+}
+
+// div implements the runtime library division helpers.
+// They print a message instead of dividing by zero.
+func (e *evaluator) div(x, y interface{}) interface{} {
+	if !(toFloat(y) > 0 || toFloat(y) < 0) {
+		e.unsupported("division by zero")
+	}
+	if x, ok := x.(int64); ok {
+		if y, ok := y.(int64); ok {
+			if x == math.MinInt64 && y == -1 {
+				return -float64(x)
+			}
+			if x%y == 0 {
+				return x / y
+			}
+			return float64(x) / float64(y)
+		}
+	}
+	return toFloat(x) / toFloat(y)
+}
+
+func (e *evaluator) mod(x, y int64) int64 {
+	switch y {
+	case 0:
+		e.unsupported("modulo by zero")
+	case -1:
+		// Avoid the math.MinInt64 % -1 overflow.
+		return 0
+	}
+	return x % y
+}
+
+// fmod implements the runtime library float modulo helper.
+func (e *evaluator) fmod(x, y interface{}) float64 {
+	for _, v := range []interface{}{x, y} {
+		switch v.(type) {
+		case int64, float64:
+		default:
+			e.unsupported("non-number fmod operand")
+		}
+	}
+	if !(toFloat(y) > 0 || toFloat(y) < 0) {
+		e.unsupported("modulo by zero")
+	}
+	return math.Mod(toFloat(x), toFloat(y))
+}
+
+// pow implements the ** operator. Only the int results are supported,
+// the float exponentiation results depend on the C library.
+func (e *evaluator) pow(x, y interface{}) interface{} {
+	base, intBase := x.(int64)
+	exp, intExp := y.(int64)
+	switch {
+	case intExp && exp == 0:
+		if intBase {
+			return int64(1)
+		}
+		return 1.0
+	case !intBase || !intExp || exp < 0:
+		e.unsupported("float exponentiation")
+	case base == 0 || base == 1:
+		return base
+	case base == -1:
+		if exp%2 == 0 {
+			return int64(1)
+		}
+		return int64(-1)
+	}
+	// Other bases overflow in less than 64 steps.
+	result := int64(1)
+	for i := int64(0); i < exp; i++ {
+		var ok bool
+		result, ok = mulInt(result, base)
+		if !ok {
+			e.unsupported("float exponentiation")
+		}
+	}
+	return result
+}
+
+func (e *evaluator) bitwise(op ir.Op, x, y interface{}) interface{} {
+	if xs, ok := x.(string); ok {
+		if ys, ok := y.(string); ok {
+			return bitwiseStrings(op, xs, ys)
+		}
+	}
+	a, b := e.toInt(x), e.toInt(y)
+	switch op {
+	case ir.OpBitAnd:
+		return a & b
+	case ir.OpBitOr:
+		return a | b
+	default:
+		return a ^ b
+	}
+}
+
+// bitwiseStrings applies the op to the x and y bytes.
+// The | result is as long as the longest operand,
+// the shorter operand is padded with zero bytes.
+// Other results are as long as the shortest operand.
+func bitwiseStrings(op ir.Op, x, y string) string {
+	if len(x) < len(y) {
+		x, y = y, x
+	}
+	n := len(y)
+	if op == ir.OpBitOr {
+		n = len(x)
+	}
+	result := make([]byte, n)
+	for i := range result {
+		var b byte
+		if i < len(y) {
+			b = y[i]
+		}
+		switch op {
+		case ir.OpBitAnd:
+			result[i] = x[i] & b
+		case ir.OpBitOr:
+			result[i] = x[i] | b
+		default:
+			result[i] = x[i] ^ b
+		}
+	}
+	return string(result)
+}
+
+func (e *evaluator) bitNot(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return ^v
+	case float64:
+		return ^e.floatToInt(v)
+	case string:
+		result := []byte(v)
+		for i := range result {
+			result[i] = ^result[i]
+		}
+		return string(result)
+	default:
+		e.unsupported("~ operand type")
+		return nil
+	}
+}
+
+func (e *evaluator) shift(op ir.Op, x, y int64) int64 {
+	if y < 0 {
+		e.unsupported("bit shift by negative number")
+	}
+	if op == ir.OpBitShiftLeft {
+		if y >= 64 {
+			return 0
+		}
+		return x << uint(y)
+	}
+	if y >= 64 {
+		y = 63
+	}
+	return x >> uint(y)
+}
@@ -0,0 +1,245 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+func TestEval(t *testing.T) {
+	intLit := func(v int64) *ir.Node { return ir.NewIntLit(v) }
+	floatLit := func(v float64) *ir.Node { return ir.NewFloatLit(v) }
+	str := func(v string) *ir.Node { return ir.NewStringLit(v) }
+	cast := func(typ ir.Type, x *ir.Node) *ir.Node { return &ir.Node{Op: ir.OpCast, Args: []*ir.Node{x}, Type: typ} }
+	array := func(elems ...*ir.Node) *ir.Node { return &ir.Node{Op: ir.OpArrayLit, Args: elems} }
+	call := func(name string, args ...*ir.Node) *ir.Node { return ir.NewCall(ir.NewName(name), args...) }
+	intMax := ir.NewConstFetch("PHP_INT_MAX")
+	intMin := ir.NewConstFetch("PHP_INT_MIN")
+	nan := ir.NewConstFetch("NAN")
+
+	env := &Env{Vars: map[string]interface{}{"i": int64(5), "f": 1.5, "s": "abc", "null": nil}}
+
+	tests := []struct {
+		n    *ir.Node
+		want interface{}
+	}{
+		// Int overflow.
+		{ir.NewAdd(intMax, intLit(1)), 9223372036854775808.0},
+		{ir.NewSub(intMin, intLit(1)), -9223372036854775808.0},
+		{ir.NewMul(intMax, intLit(2)), 18446744073709551614.0},
+		{ir.NewMul(intLit(-1), intMin), 9223372036854775808.0},
+		{ir.NewNegation(intMin), 9223372036854775808.0},
+		{ir.NewNegation(floatLit(0)), math.Copysign(0, -1)},
+		{ir.NewAdd(intLit(2), intLit(3)), int64(5)},
+
+		// Division and modulo.
+		{ir.NewDiv(intLit(7), intLit(2)), 3.5},
+		{ir.NewDiv(intLit(6), intLit(3)), int64(2)},
+		{ir.NewDiv(intMin, intLit(-1)), 9223372036854775808.0},
+		{ir.NewMod(intLit(7), intLit(-3)), int64(1)},
+		{ir.NewMod(intLit(-7), intLit(3)), int64(-1)},
+		{ir.NewMod(intMin, intLit(-1)), int64(0)},
+		{&ir.Node{Op: ir.OpMod, Args: []*ir.Node{floatLit(5.5), intLit(2)}, Type: ir.FloatType}, 1.5},
+		{ir.NewDiv(intLit(1), intLit(0)), nil},
+		{ir.NewMod(intLit(1), intLit(0)), nil},
+		{ir.NewMod(floatLit(5.5), intLit(2)), nil},
+		{call("intdiv", intLit(-7), intLit(2)), int64(-3)},
+		{call("intdiv", intMin, intLit(-1)), nil},
+
+		// Exponentiation.
+		{ir.NewExp(intLit(2), intLit(62)), int64(1 << 62)},
+		{ir.NewExp(intLit(-1), intMax), int64(-1)},
+		{ir.NewExp(floatLit(2), intLit(0)), 1.0},
+		{ir.NewExp(intLit(2), intLit(63)), nil},
+		{ir.NewExp(intLit(2), intLit(-1)), nil},
+
+		// Bitwise ops.
+		{ir.NewBitShiftLeft(intLit(1), intLit(64)), int64(0)},
+		{ir.NewBitShiftRight(intLit(-8), intLit(100)), int64(-1)},
+		{ir.NewBitShiftLeft(intLit(1), intLit(-1)), nil},
+		{ir.NewBitNot(intLit(5)), int64(-6)},
+		{ir.NewBitNot(str("a")), "\x9e"},
+		{ir.NewBitOr(str("a"), str("bb")), "cb"},
+		{ir.NewBitAnd(str("ab"), str("c")), "a"},
+		{ir.NewBitXor(str("12"), intLit(3)), int64(15)},
+		{ir.NewBitAnd(floatLit(3.5), intLit(1)), nil},
+
+		// Number conversions.
+		{ir.NewAdd(str("5"), str(" 5 ")), int64(10)},
+		{ir.NewAdd(str("1.5"), intLit(1)), 2.5},
+		{ir.NewAdd(str("1e3"), intLit(1)), 1001.0},
+		{ir.NewAdd(ir.NewVar("null", nil), ir.NewBoolLit(true)), int64(1)},
+		{ir.NewAdd(str("abc"), intLit(1)), nil},
+		{ir.NewAdd(str("5abc"), intLit(1)), nil},
+		{cast(ir.IntType, str("12abc")), int64(12)},
+		{cast(ir.IntType, str("1e3")), int64(1000)},
+		{cast(ir.IntType, str("abc")), int64(0)},
+		{cast(ir.IntType, str("1e19")), int64(math.MaxInt64)},
+		{cast(ir.IntType, floatLit(1e19)), int64(-8446744073709551616)},
+		{cast(ir.IntType, floatLit(-1.9)), int64(-1)},
+		{cast(ir.IntType, nan), int64(0)},
+		{cast(ir.FloatType, str("1.5abc")), 1.5},
+		{cast(ir.BoolType, str("0")), false},
+		{cast(ir.BoolType, str("0.0")), true},
+		{cast(ir.BoolType, nan), true},
+		{cast(ir.BoolType, array()), false},
+
+		// String conversions.
+		{cast(ir.StringType, ir.NewAdd(floatLit(0.1), floatLit(0.2))), "0.3"},
+		{cast(ir.StringType, floatLit(1e14)), "1.0E+14"},
+		{cast(ir.StringType, floatLit(123456789012.5)), "123456789012.5"},
+		{cast(ir.StringType, floatLit(0.0001)), "0.0001"},
+		{cast(ir.StringType, floatLit(0.00001)), "1.0E-5"},
+		{cast(ir.StringType, floatLit(-1.25e-30)), "-1.25E-30"},
+		{cast(ir.StringType, floatLit(math.Copysign(0, -1))), "-0"},
+		{cast(ir.StringType, floatLit(2)), "2"},
+		{cast(ir.StringType, ir.NewAdd(intMax, intLit(1))), "9.2233720368548E+18"},
+		{cast(ir.StringType, nan), "NAN"},
+		{ir.NewConcat(ir.NewBoolLit(true), ir.NewBoolLit(false)), "1"},
+		{ir.NewInterpolatedString(str("a"), ir.NewVar("f", nil), ir.NewVar("i", nil)), "a1.55"},
+		{ir.NewConcat(array(), str("")), nil},
+
+		// Comparisons.
+		{ir.NewEqual2(str("abc"), intLit(0)), false},
+		{ir.NewEqual2(str("1e3"), str("1000")), true},
+		{ir.NewEqual2(intLit(100), str("1e2")), true},
+		{ir.NewEqual2(str("1 "), str("1")), true},
+		{ir.NewEqual2(ir.NewVar("null", nil), str("0")), false},
+		{ir.NewEqual2(ir.NewVar("null", nil), ir.NewBoolLit(false)), true},
+		{ir.NewEqual2(str("0"), ir.NewBoolLit(false)), true},
+		{ir.NewEqual2(floatLit(1.5), str("1.5")), true},
+		{ir.NewEqual2(ir.NewAdd(floatLit(0.1), floatLit(0.2)), floatLit(0.3)), false},
+		{ir.NewEqual2(nan, nan), false},
+		{ir.NewEqual2(array(intLit(1), str("2")), array(str("1"), intLit(2))), true},
+		{ir.NewEqual3(array(intLit(1), str("2")), array(str("1"), intLit(2))), false},
+		{ir.NewEqual3(floatLit(0), floatLit(math.Copysign(0, -1))), true},
+		{ir.NewEqual3(intLit(1), floatLit(1)), false},
+		{ir.NewLess(nan, floatLit(1)), false},
+		{ir.NewGreater(nan, floatLit(1)), false},
+		{ir.NewSpaceship(nan, floatLit(1)), int64(1)},
+		{ir.NewSpaceship(floatLit(1), nan), int64(1)},
+		{ir.NewSpaceship(str("1"), str("01")), int64(0)},
+		{ir.NewSpaceship(str("abc"), str("b")), int64(-1)},
+		{ir.NewLess(intLit(5), str("abc")), true},
+		{ir.NewLess(ir.NewVar("null", nil), intLit(-1)), true},
+		{ir.NewLess(array(), array()), nil},
+		{call("max", intLit(1), floatLit(2.5), str("3")), "3"},
+		{call("min", intLit(1), floatLit(0.5)), 0.5},
+
+		// Indexing.
+		{ir.NewIndex(str("abc"), intLit(1)), "b"},
+		{ir.NewIndex(str("abc"), intLit(-1)), "c"},
+		{ir.NewIndex(str("abc"), intLit(3)), nil},
+		{ir.NewIsset(ir.NewIndex(ir.NewVar("s", nil), str("1"))), true},
+		{ir.NewIsset(ir.NewIndex(ir.NewVar("s", nil), intLit(3))), false},
+		{ir.NewNullCoalesce(ir.NewIndex(str("abc"), intLit(3)), str("x")), "x"},
+		{ir.NewIndex(array(intLit(1), intLit(2)), intLit(1)), int64(2)},
+		{ir.NewIndex(array(ir.NewKeyedElem(str("1"), str("x"))), intLit(1)), "x"},
+		{ir.NewIndex(array(ir.NewKeyedElem(intLit(5), str("a")), str("b")), intLit(6)), "b"},
+		{ir.NewIndex(array(ir.NewKeyedElem(str("a"), intLit(1))), str("b")), nil},
+		{ir.NewNullCoalesce(ir.NewIndex(array(ir.NewKeyedElem(str("a"), intLit(1))), str("b")), intLit(5)), int64(5)},
+		{ir.NewEmpty(ir.NewIndex(array(), intLit(0))), true},
+		{array(ir.NewKeyedElem(intLit(-5), str("a")), str("b")), nil},
+		{call("count", array(intLit(1), intLit(2))), int64(2)},
+
+		// Short-circuiting.
+		{ir.NewAnd(ir.NewBoolLit(false), call("f")), false},
+		{ir.NewOr(ir.NewBoolLit(true), call("f")), true},
+		{ir.NewAnd(ir.NewBoolLit(true), call("f")), nil},
+		{ir.NewTernary(ir.NewBoolLit(true), intLit(1), call("f")), int64(1)},
+		{ir.NewShortTernary(intLit(0), intLit(5)), int64(5)},
+		{ir.NewNullCoalesce(ir.NewVar("null", nil), intLit(1)), int64(1)},
+		{ir.NewXorWord(ir.NewBoolLit(true), ir.NewBoolLit(true)), false},
+
+		// Builtins and variables.
+		{call("abs", intMin), 9223372036854775808.0},
+		{call(`\strlen`, ir.NewVar("s", nil)), int64(3)},
+		{call("strrev", ir.NewVar("s", nil)), "cba"},
+		{call("floor", floatLit(-0.5)), -1.0},
+		{call("sqrt", intLit(16)), 4.0},
+		{call("is_nan", nan), true},
+		{call("strlen", intLit(1)), nil},
+		{ir.NewAdd(ir.NewVar("i", nil), ir.NewVar("f", nil)), 6.5},
+		{ir.NewVar("undefined", nil), nil},
+		{ir.NewPostInc(ir.NewVar("i", nil)), nil},
+	}
+
+	for _, test := range tests {
+		have, err := Eval(test.n, env)
+		if test.want == nil {
+			if _, ok := err.(*UnsupportedError); !ok {
+				t.Errorf("Eval(%s): have %#v, %v; want an unsupported error", test.n.Op, have, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Eval(%s): unexpected error: %v", test.n.Op, err)
+			continue
+		}
+		if !valuesEqual(have, test.want) {
+			t.Errorf("Eval(%s): have %#v, want %#v", test.n.Op, have, test.want)
+		}
+	}
+}
+
+func TestEvalLegacyComparisons(t *testing.T) {
+	tests := []struct {
+		x, y *ir.Node
+		want bool
+	}{
+		{ir.NewStringLit("abc"), ir.NewIntLit(0), true},
+		{ir.NewStringLit("1abc"), ir.NewIntLit(1), true},
+		{ir.NewStringLit("1 "), ir.NewStringLit("1"), false},
+		{ir.NewStringLit("1e3"), ir.NewStringLit("1000"), true},
+	}
+	for _, test := range tests {
+		have, err := Eval(ir.NewEqual2(test.x, test.y), &Env{LegacyComparisons: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != test.want {
+			t.Errorf("%v == %v: have %v, want %v", test.x.Value, test.y.Value, have, test.want)
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		f         float64
+		precision int
+		want      string
+	}{
+		{0, 14, "0"},
+		{1.5, 14, "1.5"},
+		{1.0 / 3, 14, "0.33333333333333"},
+		{2.0 / 3, 14, "0.66666666666667"},
+		{0.30000000000000004, -1, "0.30000000000000004"},
+		{0.3, -1, "0.3"},
+		{1e100, -1, "1.0E+100"},
+		{1e17, -1, "1.0E+17"},
+		{123456789012345678, -1, "1.2345678901234568E+17"},
+		{-1.5e-7, -1, "-1.5E-7"},
+		{1e-4, -1, "0.0001"},
+		{math.Inf(-1), 14, "-INF"},
+		{math.MaxFloat64, 14, "1.7976931348623E+308"},
+		{5e-324, 14, "4.9406564584125E-324"},
+		{100, 1, "1.0E+2"},
+	}
+	for _, test := range tests {
+		if have := FormatFloat(test.f, test.precision); have != test.want {
+			t.Errorf("FormatFloat(%v, %d): have %q, want %q", test.f, test.precision, have, test.want)
+		}
+	}
+}
+
+func valuesEqual(x, y interface{}) bool {
+	switch x := x.(type) {
+	case float64:
+		y, ok := y.(float64)
+		// Zero signs matter.
+		return ok && math.Float64bits(x) == math.Float64bits(y)
+	default:
+		return x == y
+	}
+}
@@ -0,0 +1,276 @@
+package eval
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Array is a PHP array value.
+// Keys are int64 or string values, they're stored in the insertion order.
+type Array struct {
+	Keys   []interface{}
+	Values []interface{}
+}
+
+// Get returns the key element value.
+// The key should be normalized, see arrayKey.
+func (a *Array) Get(key interface{}) (interface{}, bool) {
+	for i, k := range a.Keys {
+		if k == key {
+			return a.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+func (a *Array) set(key, v interface{}) {
+	for i, k := range a.Keys {
+		if k == key {
+			a.Values[i] = v
+			return
+		}
+	}
+	a.Keys = append(a.Keys, key)
+	a.Values = append(a.Values, v)
+}
+
+// numericKind tells how much of a string is a number.
+type numericKind int
+
+const (
+	// nonNumeric strings don't start with a number, like "abc".
+	nonNumeric numericKind = iota
+
+	// leadingNumeric strings have a trailing garbage, like "10abc".
+	leadingNumeric
+
+	// numeric strings are numbers with optional whitespace, like " 10".
+	numeric
+)
+
+// parseNumeric parses the s numeric prefix the way PHP does
+// and returns its int64 or float64 value.
+//
+// Hex, octal and binary prefixes are not recognized.
+// The trailing whitespace is permitted since PHP 8,
+// the legacy mode treats such strings as leading-numeric.
+func parseNumeric(s string, legacy bool) (interface{}, numericKind) {
+	i := 0
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	start := i
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	intDigits := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+		intDigits++
+	}
+	isFloat := false
+	if i < len(s) && s[i] == '.' {
+		fracDigits := 0
+		for j := i + 1; j < len(s) && isDigit(s[j]); j++ {
+			fracDigits++
+		}
+		if intDigits+fracDigits != 0 {
+			isFloat = true
+			i += fracDigits + 1
+		}
+	}
+	if intDigits == 0 && !isFloat {
+		return int64(0), nonNumeric
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			isFloat = true
+			i = j
+		}
+	}
+
+	var v interface{}
+	number := s[start:i]
+	if !isFloat {
+		if x, err := strconv.ParseInt(number, 10, 64); err == nil {
+			v = x
+		} else {
+			// Integers that don't fit into int64 become floats.
+			isFloat = true
+		}
+	}
+	if isFloat {
+		// Out of range errors are ignored, the result is an infinity.
+		x, _ := strconv.ParseFloat(number, 64)
+		v = x
+	}
+
+	if !legacy {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+	}
+	if i == len(s) {
+		return v, numeric
+	}
+	return v, leadingNumeric
+}
+
+func isSpace(ch byte) bool {
+	switch ch {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	default:
+		return false
+	}
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// toBool converts v to bool, like a (bool) cast.
+func toBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		// NaN is true.
+		return v != 0
+	case string:
+		return v != "" && v != "0"
+	case *Array:
+		return len(v.Keys) != 0
+	default:
+		return false
+	}
+}
+
+// FormatFloat formats f the way PHP converts floats to strings.
+//
+// The precision is the number of significant digits, like the precision
+// ini setting that is used by the string conversions; the default is 14.
+// A precision of -1 selects the shortest representation that is parsed
+// back to the same value, like the default serialize_precision that is
+// used by var_dump and var_export.
+func FormatFloat(f float64, precision int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NAN"
+	case math.IsInf(f, 1):
+		return "INF"
+	case math.IsInf(f, -1):
+		return "-INF"
+	}
+
+	// The digits and decpt are the zend_dtoa results:
+	// f = 0.digits * 10^decpt.
+	var mantissa string
+	if precision < 0 {
+		mantissa = strconv.FormatFloat(f, 'e', -1, 64)
+		precision = 17
+	} else {
+		if precision == 0 {
+			precision = 1
+		}
+		mantissa = strconv.FormatFloat(f, 'e', precision-1, 64)
+	}
+	var buf strings.Builder
+	if mantissa[0] == '-' {
+		buf.WriteByte('-')
+		mantissa = mantissa[1:]
+	}
+	exp := strings.IndexByte(mantissa, 'e')
+	decpt, _ := strconv.Atoi(mantissa[exp+1:])
+	decpt++
+	digits := strings.TrimRight(strings.Replace(mantissa[:exp], ".", "", 1), "0")
+	if digits == "" {
+		// Zero is formatted as "0", it has the decpt of 1.
+		digits = "0"
+		decpt = 1
+	}
+
+	switch {
+	case decpt < -3 || decpt > precision:
+		// The exponential format, like 1.0E+25.
+		buf.WriteByte(digits[0])
+		buf.WriteByte('.')
+		if len(digits) == 1 {
+			buf.WriteByte('0')
+		} else {
+			buf.WriteString(digits[1:])
+		}
+		buf.WriteByte('E')
+		decpt--
+		if decpt < 0 {
+			buf.WriteByte('-')
+			decpt = -decpt
+		} else {
+			buf.WriteByte('+')
+		}
+		buf.WriteString(strconv.Itoa(decpt))
+	case decpt <= 0:
+		buf.WriteString("0.")
+		buf.WriteString(strings.Repeat("0", -decpt))
+		buf.WriteString(digits)
+	default:
+		if len(digits) <= decpt {
+			buf.WriteString(digits)
+			buf.WriteString(strings.Repeat("0", decpt-len(digits)))
+		} else {
+			buf.WriteString(digits[:decpt])
+			buf.WriteByte('.')
+			buf.WriteString(digits[decpt:])
+		}
+	}
+	return buf.String()
+}
+
+// floatToInt converts f to int64 like a PHP (int) cast.
+// Out of range values wrap around, non-finite values become 0.
+func floatToInt(f float64) int64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	if fitsInt(f) {
+		return int64(f)
+	}
+	const twoPow64 = 1 << 64
+	dmod := math.Mod(f, twoPow64)
+	if dmod < 0 {
+		dmod += twoPow64
+	}
+	if dmod >= 1<<63 {
+		dmod -= twoPow64
+	}
+	return int64(dmod)
+}
+
+// floatToIntCap converts f to int64 like a PHP numeric string to int conversion.
+// Out of range values are saturated, non-finite values become 0.
+func floatToIntCap(f float64) int64 {
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		return 0
+	case fitsInt(f):
+		return int64(f)
+	case f > 0:
+		return math.MaxInt64
+	default:
+		return math.MinInt64
+	}
+}
+
+func fitsInt(f float64) bool {
+	return f >= math.MinInt64 && f < math.MaxInt64
+}
@@ -8,10 +8,52 @@ type RootNode interface {
 	rootNode()
 }
 
+// File is a PHP source file.
+type File struct {
+	Name string
+
+	// Header is an optional comment printed after the open tag,
+	// like the generation seed.
+	Header string
+
+	// StrictTypes makes the file start with declare(strict_types=1).
+	StrictTypes bool
+
+	// Namespace is a file namespace name.
+	// An empty name means the global namespace.
+	Namespace string
+
+	// Nodes are the file contents.
+	// They should not contain RootDeclare and RootNamespace nodes,
+	// these are described by StrictTypes and Namespace.
+	Nodes []RootNode
+}
+
+// RootDeclare is a 'declare' '(' $Name '=' $Value ')' directive.
+// It should be placed before any other file nodes.
+type RootDeclare struct {
+	Name  string
+	Value *Node
+}
+
+// RootNamespace is a 'namespace' $Name declaration.
+// It should be placed before any other file nodes except RootDeclare.
+type RootNamespace struct {
+	Name string
+}
+
 type RootRequire struct {
 	Path string
 }
 
+// RootConstDecl is a 'const' $Name '=' $Value declaration.
+// It can also be printed as a 'define' '(' $Name ',' $Value ')' call.
+// Name should not be a reserved word, see IsReservedName.
+type RootConstDecl struct {
+	Name  string
+	Value *Node
+}
+
 type RootStmt struct {
 	X *Node
 }
@@ -19,11 +61,83 @@ type RootStmt struct {
 type RootFuncDecl struct {
 	Type *FuncType
 
-	Tags []phpdoc.Tag
+	Tags       []phpdoc.Tag
+	Attributes []Attribute
 
 	Body *Node
 }
 
-func (n *RootRequire) rootNode()  {}
-func (n *RootStmt) rootNode()     {}
-func (n *RootFuncDecl) rootNode() {}
+// RootClassDecl is a ['abstract'] 'class' $Name ['extends' $Extends]
+// ['implements' $Implements] '{' $Uses $Consts $Props $Methods '}' declaration.
+// An empty Extends means that the class has no parent.
+type RootClassDecl struct {
+	Name       string
+	Abstract   bool
+	Extends    string
+	Implements []string
+
+	Tags       []phpdoc.Tag
+	Attributes []Attribute
+
+	Uses    []*TraitUse
+	Consts  []*ClassConst
+	Props   []*ClassProp
+	Methods []*ClassMethod
+}
+
+// RootInterfaceDecl is an 'interface' $Name ['extends' $Extends] '{' $Consts $Methods '}' declaration.
+// Methods are printed as signatures, their bodies are ignored.
+type RootInterfaceDecl struct {
+	Name    string
+	Extends []string
+
+	Tags       []phpdoc.Tag
+	Attributes []Attribute
+
+	Consts  []*ClassConst
+	Methods []*ClassMethod
+}
+
+// RootTraitDecl is a 'trait' $Name '{' $Uses $Props $Methods '}' declaration.
+type RootTraitDecl struct {
+	Name string
+
+	Tags       []phpdoc.Tag
+	Attributes []Attribute
+
+	Uses    []*TraitUse
+	Props   []*ClassProp
+	Methods []*ClassMethod
+}
+
+// RootEnumDecl is an 'enum' $Name [':' $BackingType] ['implements' $Implements]
+// '{' $Cases $Consts $Methods '}' declaration.
+// A nil BackingType means a pure enum.
+type RootEnumDecl struct {
+	Name        string
+	BackingType Type
+	Implements  []string
+
+	Tags       []phpdoc.Tag
+	Attributes []Attribute
+
+	Cases   []*EnumCase
+	Consts  []*ClassConst
+	Methods []*ClassMethod
+}
+
+// IsGenerator reports whether the function body contains a yield.
+func (decl *RootFuncDecl) IsGenerator() bool {
+	return ContainsYield(decl.Body)
+}
+
+func (n *RootDeclare) rootNode()       {}
+func (n *RootNamespace) rootNode()     {}
+func (n *RootRequire) rootNode()       {}
+func (n *RootStmt) rootNode()          {}
+func (n *RootConstDecl) rootNode()     {}
+func (n *RootFuncDecl) rootNode()      {}
+func (n *RootClassDecl) rootNode()     {}
+func (n *RootInterfaceDecl) rootNode() {}
+func (n *RootTraitDecl) rootNode()     {}
+func (n *RootEnumDecl) rootNode()      {}
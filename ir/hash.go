@@ -0,0 +1,227 @@
+package ir
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/quasilyte/phpsmith/phpdoc"
+)
+
+// Hash returns the n tree FNV-1a hash.
+// Equal trees have equal hashes, see Equal.
+//
+// Types are not hashed: trees that differ only in types
+// have equal hashes, but they're not Equal.
+func Hash(n *Node) uint64 {
+	h := newHasher()
+	h.writeNode(n)
+	return h.Sum64()
+}
+
+// HashRoot returns the n root node hash, see Hash.
+func HashRoot(n RootNode) uint64 {
+	h := newHasher()
+	h.writeRoot(n)
+	return h.Sum64()
+}
+
+// HashFile returns the f file hash, see Hash.
+func HashFile(f *File) uint64 {
+	h := newHasher()
+	h.writeString(f.Name)
+	h.writeString(f.Header)
+	h.writeString(f.Namespace)
+	h.writeBool(f.StrictTypes)
+	h.writeInt(len(f.Nodes))
+	for _, n := range f.Nodes {
+		h.writeRoot(n)
+	}
+	return h.Sum64()
+}
+
+// hasher writes the tree parts into the FNV-1a hash with
+// their lengths and tags, so different trees can't be
+// serialized into the same bytes sequence.
+//
+// It's implemented inline instead of using hash/fnv to
+// avoid the per-write interface calls and allocations.
+type hasher struct {
+	sum uint64
+}
+
+func newHasher() *hasher {
+	return &hasher{sum: fnvOffset}
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+func (h *hasher) Sum64() uint64 { return h.sum }
+
+func (h *hasher) writeByte(b byte) {
+	h.sum ^= uint64(b)
+	h.sum *= fnvPrime
+}
+
+func (h *hasher) writeUint(v uint64) {
+	// Values are written as varints, most of them fit into one byte.
+	for v >= 0x80 {
+		h.writeByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	h.writeByte(byte(v))
+}
+
+func (h *hasher) writeInt(v int) { h.writeUint(uint64(v)) }
+
+func (h *hasher) writeBool(v bool) {
+	if v {
+		h.writeByte(1)
+	} else {
+		h.writeByte(0)
+	}
+}
+
+func (h *hasher) writeString(s string) {
+	h.writeInt(len(s))
+	for i := 0; i < len(s); i++ {
+		h.writeByte(s[i])
+	}
+}
+
+func (h *hasher) writeStrings(list []string) {
+	h.writeInt(len(list))
+	for _, s := range list {
+		h.writeString(s)
+	}
+}
+
+func (h *hasher) writeNode(n *Node) {
+	if n == nil {
+		h.writeInt(int(OpInvalid))
+		return
+	}
+	h.writeInt(int(n.Op))
+	h.writeValue(n.Value)
+	h.writeInt(len(n.Args))
+	for _, arg := range n.Args {
+		h.writeNode(arg)
+	}
+}
+
+func (h *hasher) writeValue(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		h.writeByte(0)
+	case bool:
+		h.writeByte(1)
+		h.writeBool(v)
+	case int:
+		h.writeByte(2)
+		h.writeInt(v)
+	case int64:
+		h.writeByte(3)
+		h.writeUint(uint64(v))
+	case float64:
+		h.writeByte(4)
+		if math.IsNaN(v) {
+			// All NaNs are equal, see Equal.
+			v = math.NaN()
+		}
+		h.writeUint(math.Float64bits(v))
+	case string:
+		h.writeByte(5)
+		h.writeString(v)
+	case Op:
+		h.writeByte(6)
+		h.writeInt(int(v))
+	case *phpdoc.VarTag:
+		h.writeByte(7)
+		h.writeString(v.Type)
+		h.writeString(v.VarName)
+	case *ClosureInfo:
+		h.writeByte(8)
+		h.writeBool(v.ArrowFunc)
+		h.writeInt(len(v.Uses))
+		for _, u := range v.Uses {
+			h.writeString(u.Name)
+			h.writeBool(u.ByRef)
+		}
+	case []string:
+		h.writeByte(9)
+		h.writeStrings(v)
+	default:
+		// Other comparable values, like RelativeClass.
+		h.writeByte(10)
+		h.writeString(fmt.Sprintf("%T:%v", v, v))
+	}
+}
+
+func (h *hasher) writeTags(tags []phpdoc.Tag) {
+	h.writeInt(len(tags))
+	for _, tag := range tags {
+		h.writeString(tag.Name())
+		h.writeString(tag.Value())
+	}
+}
+
+func (h *hasher) writeRoot(n RootNode) {
+	// The root kind and its names are hashed,
+	// other members are covered by the node trees.
+	h.writeString(fmt.Sprintf("%T", n))
+	switch n := n.(type) {
+	case *RootDeclare:
+		h.writeString(n.Name)
+	case *RootNamespace:
+		h.writeString(n.Name)
+	case *RootRequire:
+		h.writeString(n.Path)
+	case *RootConstDecl:
+		h.writeString(n.Name)
+	case *RootFuncDecl:
+		h.writeFunc(n)
+	case *RootClassDecl:
+		h.writeString(n.Name)
+		h.writeString(n.Extends)
+		h.writeStrings(n.Implements)
+		h.writeTags(n.Tags)
+		h.writeMethods(n.Methods)
+	case *RootInterfaceDecl:
+		h.writeString(n.Name)
+		h.writeStrings(n.Extends)
+		h.writeTags(n.Tags)
+		h.writeMethods(n.Methods)
+	case *RootTraitDecl:
+		h.writeString(n.Name)
+		h.writeTags(n.Tags)
+		h.writeMethods(n.Methods)
+	case *RootEnumDecl:
+		h.writeString(n.Name)
+		h.writeStrings(n.Implements)
+		h.writeTags(n.Tags)
+		for _, c := range n.Cases {
+			h.writeString(c.Name)
+		}
+		h.writeMethods(n.Methods)
+	}
+	WalkRoot(n, func(n *Node) bool {
+		h.writeNode(n)
+		return false
+	})
+}
+
+func (h *hasher) writeFunc(decl *RootFuncDecl) {
+	if decl.Type != nil {
+		h.writeString(decl.Type.Name)
+	}
+	h.writeTags(decl.Tags)
+}
+
+func (h *hasher) writeMethods(methods []*ClassMethod) {
+	h.writeInt(len(methods))
+	for _, m := range methods {
+		h.writeFunc(m.Func)
+	}
+}
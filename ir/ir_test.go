@@ -0,0 +1,707 @@
+package ir
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/quasilyte/phpsmith/phpdoc"
+)
+
+func TestNodeClone(t *testing.T) {
+	intType := &ScalarType{Kind: ScalarInt}
+	funcType := &FuncType{Result: intType}
+
+	varTag := &phpdoc.VarTag{Type: "int", VarName: "x"}
+	assign := NewAssign(NewVar("x", intType), NewAdd(NewVar("y", intType), NewIntLit(1)))
+	assign.Value = varTag
+	closure := NewClosure(funcType, []ClosureUse{{Name: "y"}}, NewBlock(NewReturn(NewVar("y", intType))))
+	catch := NewCatch([]string{"Exception"}, NewVar("e", nil), NewBlock())
+	foreach := NewForeach(NewVar("arr", nil), nil, NewVar("v", nil), NewBlock(), false)
+	n := NewBlock(assign, NewCall(NewName("f"), closure), NewTry(NewBlock(), catch), foreach)
+
+	clone := n.Clone()
+	if clone == n || clone.Args[0] == assign {
+		t.Fatal("clone shares the nodes with the original")
+	}
+	if clone.Args[0].Args[0].Type != intType || clone.Args[1].Args[1].Type != funcType {
+		t.Fatal("clone types are not preserved")
+	}
+	if clone.Args[3].Args[1] != nil {
+		t.Fatal("nil args are not preserved")
+	}
+
+	clone.Args[0].Args[1].Args[1].Value = int64(2)
+	clone.Args[0].Args[1].Args = append(clone.Args[0].Args[1].Args, NewIntLit(3))
+	clone.Args[0].Value.(*phpdoc.VarTag).VarName = "z"
+	clone.Args[1].Args[1].Value.(*ClosureInfo).Uses[0].ByRef = true
+	clone.Args[2].Args[1].Value.([]string)[0] = "Error"
+
+	if assign.Args[1].Args[1].Value.(int64) != 1 || len(assign.Args[1].Args) != 2 {
+		t.Fatal("clone args modification affected the original")
+	}
+	if varTag.VarName != "x" || assign.Value != varTag {
+		t.Fatal("clone var tag modification affected the original")
+	}
+	if closure.Value.(*ClosureInfo).Uses[0].ByRef {
+		t.Fatal("clone closure uses modification affected the original")
+	}
+	if catch.Value.([]string)[0] != "Exception" {
+		t.Fatal("clone catch classes modification affected the original")
+	}
+
+	if (*Node)(nil).Clone() != nil {
+		t.Fatal("nil node clone is not nil")
+	}
+}
+
+func TestFileClone(t *testing.T) {
+	intType := &ScalarType{Kind: ScalarInt}
+	funcType := &FuncType{Name: "f", Result: intType}
+	fn := &RootFuncDecl{
+		Type:       funcType,
+		Tags:       []phpdoc.Tag{&phpdoc.ReturnTag{Type: "int"}},
+		Attributes: []Attribute{{Name: "Pure", Args: []*Node{NewIntLit(1)}}},
+		Body:       NewBlock(NewReturn(NewIntLit(10))),
+	}
+	class := &RootClassDecl{
+		Name:       "Foo",
+		Implements: []string{"Bar"},
+		Uses: []*TraitUse{{
+			Traits: []string{"T1", "T2"},
+			Rules:  []TraitRule{{Trait: "T1", Method: "m", Insteadof: []string{"T2"}}},
+		}},
+		Consts:  []*ClassConst{{Name: "C", Value: NewIntLit(1)}},
+		Props:   []*ClassProp{{Name: "p", Type: intType, Default: NewIntLit(2)}},
+		Methods: []*ClassMethod{{Visibility: VisibilityPublic, Func: fn}},
+	}
+	f := &File{
+		Name:   "main.php",
+		Header: "header",
+		Nodes: []RootNode{
+			&RootConstDecl{Name: "X", Value: NewIntLit(1)},
+			fn,
+			class,
+			&RootStmt{X: NewEcho(NewStringLit("ok"))},
+		},
+	}
+
+	clone := f.Clone()
+	if clone.Name != f.Name || clone.Header != f.Header || len(clone.Nodes) != len(f.Nodes) {
+		t.Fatal("clone file fields are not preserved")
+	}
+	cloneFn := clone.Nodes[1].(*RootFuncDecl)
+	if cloneFn == fn || cloneFn.Type != funcType {
+		t.Fatal("clone func decl is not copied properly")
+	}
+	cloneClass := clone.Nodes[2].(*RootClassDecl)
+	if cloneClass.Props[0].Type != intType {
+		t.Fatal("clone prop type is not preserved")
+	}
+
+	clone.Nodes[0].(*RootConstDecl).Value.Value = int64(5)
+	clone.Nodes[3].(*RootStmt).X.Args[0].Value = "fail"
+	cloneFn.Tags[0].(*phpdoc.ReturnTag).Type = "string"
+	cloneFn.Attributes[0].Args[0].Value = int64(5)
+	cloneFn.Body.Args[0].Args[0].Value = int64(5)
+	cloneClass.Implements[0] = "Baz"
+	cloneClass.Uses[0].Rules[0].Insteadof[0] = "T3"
+	cloneClass.Consts[0].Value.Value = int64(5)
+	cloneClass.Props[0].Default.Value = int64(5)
+	cloneClass.Methods[0].Visibility = VisibilityPrivate
+	cloneClass.Methods[0].Func.Body.Args[0].Args[0].Value = int64(5)
+	clone.Nodes[0] = &RootStmt{X: NewReturnVoid()}
+
+	if f.Nodes[0].(*RootConstDecl).Value.Value.(int64) != 1 {
+		t.Fatal("clone const modification affected the original")
+	}
+	if f.Nodes[3].(*RootStmt).X.Args[0].Value.(string) != "ok" {
+		t.Fatal("clone stmt modification affected the original")
+	}
+	if fn.Tags[0].(*phpdoc.ReturnTag).Type != "int" {
+		t.Fatal("clone tags modification affected the original")
+	}
+	if fn.Attributes[0].Args[0].Value.(int64) != 1 {
+		t.Fatal("clone attributes modification affected the original")
+	}
+	if fn.Body.Args[0].Args[0].Value.(int64) != 10 {
+		t.Fatal("clone func body modification affected the original")
+	}
+	if class.Implements[0] != "Bar" || class.Uses[0].Rules[0].Insteadof[0] != "T2" {
+		t.Fatal("clone class names modification affected the original")
+	}
+	if class.Consts[0].Value.Value.(int64) != 1 || class.Props[0].Default.Value.(int64) != 2 {
+		t.Fatal("clone class members modification affected the original")
+	}
+	if class.Methods[0].Visibility != VisibilityPublic {
+		t.Fatal("clone method modification affected the original")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	intType := &ScalarType{Kind: ScalarInt}
+
+	// 17 nodes, the foreach key and the short ternary middle operand are nil.
+	n := NewBlock(
+		NewForeach(NewVar("arr", nil), nil, NewVar("v", intType), NewBlock(
+			NewEcho(NewShortTernary(NewVar("v", intType), NewIntLit(1))),
+		), false),
+		NewIf(NewBoolLit(true), NewBlock(
+			NewAssign(NewVar("x", intType), NewAdd(NewIntLit(1), NewIntLit(2))),
+		)),
+	)
+
+	var ops []Op
+	Inspect(n, func(n *Node) {
+		ops = append(ops, n.Op)
+	})
+	if len(ops) != 17 {
+		t.Fatalf("Inspect: visited %d nodes, want 17", len(ops))
+	}
+	if ops[0] != OpBlock || ops[1] != OpForeach || ops[2] != OpVar {
+		t.Fatalf("Inspect: unexpected visit order %v", ops)
+	}
+
+	visited := 0
+	Walk(n, func(n *Node) bool {
+		visited++
+		return n.Op != OpIf && n.Op != OpForeach
+	})
+	if visited != 3 {
+		t.Fatalf("Walk: visited %d nodes, want 3", visited)
+	}
+
+	fn := &RootFuncDecl{
+		Attributes: []Attribute{{Name: "A", Args: []*Node{NewIntLit(1)}}},
+		Type: &FuncType{Name: "f", Params: []TypeField{
+			{Name: "x", Default: NewNegation(NewIntLit(1))},
+			{Name: "y"},
+		}},
+		Body: NewBlock(NewReturn(NewIntLit(2))),
+	}
+	roots := []struct {
+		n    RootNode
+		want int
+	}{
+		{&RootRequire{Path: "lib.php"}, 0},
+		{&RootStmt{X: n}, 17},
+		{&RootConstDecl{Name: "C", Value: NewAdd(NewIntLit(1), NewIntLit(2))}, 3},
+		{fn, 6},
+		{&RootClassDecl{
+			Name:    "Foo",
+			Consts:  []*ClassConst{{Name: "C", Value: NewIntLit(1)}},
+			Props:   []*ClassProp{{Name: "a", Default: NewIntLit(1)}, {Name: "b"}},
+			Methods: []*ClassMethod{{Func: fn}},
+		}, 8},
+		{&RootEnumDecl{
+			Name:  "E",
+			Cases: []*EnumCase{{Name: "A", Value: NewIntLit(1)}, {Name: "B"}},
+		}, 1},
+	}
+	for _, test := range roots {
+		visited := 0
+		WalkRoot(test.n, func(n *Node) bool {
+			visited++
+			return true
+		})
+		if visited != test.want {
+			t.Errorf("WalkRoot(%T): visited %d nodes, want %d", test.n, visited, test.want)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	intType := &ScalarType{Kind: ScalarInt}
+	n := NewBlock(
+		NewForeach(NewVar("arr", nil), nil, NewVar("v", intType), NewBlock(
+			NewEcho(NewAdd(NewVar("v", intType), NewIntLit(1))),
+		), false),
+		NewReturn(NewIntLit(2)),
+	)
+	orig := n.Clone()
+
+	identity := Rewrite(n, func(n *Node) *Node { return n })
+	if identity == n {
+		t.Fatal("identity rewrite returned the original tree")
+	}
+	if !reflect.DeepEqual(identity, orig) {
+		t.Fatal("identity rewrite changed the tree")
+	}
+
+	incremented := Rewrite(n, func(n *Node) *Node {
+		if n.Op == OpIntLit {
+			return NewIntLit(n.Value.(int64) + 10)
+		}
+		return n
+	})
+	if !reflect.DeepEqual(n, orig) {
+		t.Fatal("rewrite modified the original tree")
+	}
+	var lits []int64
+	Inspect(incremented, func(n *Node) {
+		if n.Op == OpIntLit {
+			lits = append(lits, n.Value.(int64))
+		}
+	})
+	if !reflect.DeepEqual(lits, []int64{11, 12}) {
+		t.Fatalf("rewritten literals are %v, want [11 12]", lits)
+	}
+}
+
+func TestEqualHash(t *testing.T) {
+	intType := &ScalarType{Kind: ScalarInt}
+	floatType := &ScalarType{Kind: ScalarFloat}
+
+	tests := []struct {
+		a, b  *Node
+		equal bool
+	}{
+		{NewIntLit(1), NewIntLit(1), true},
+		{NewIntLit(1), NewIntLit(2), false},
+		{NewFloatLit(math.NaN()), NewFloatLit(-math.NaN()), true},
+		{NewFloatLit(0), NewFloatLit(math.Copysign(0, -1)), false},
+		{NewStringLit("a"), NewName("a"), false},
+		{NewVar("x", intType), NewVar("x", intType), true},
+		{NewVar("x", intType), NewVar("x", floatType), false},
+		{NewAdd(NewIntLit(1), NewIntLit(2)), NewAdd(NewIntLit(2), NewIntLit(1)), false},
+		{NewShortTernary(NewVar("x", nil), NewIntLit(1)), NewShortTernary(NewVar("x", nil), NewIntLit(1)), true},
+		{NewBreak(1), NewContinue(1), false},
+		{NewBlock(NewEcho()), NewBlock(NewEcho(), NewEcho()), false},
+		{
+			NewClosure(&FuncType{Result: intType}, []ClosureUse{{Name: "x"}}, NewBlock()),
+			NewClosure(&FuncType{Result: intType}, []ClosureUse{{Name: "x", ByRef: true}}, NewBlock()),
+			false,
+		},
+		{
+			NewClosure(&FuncType{Params: []TypeField{{Name: "a", Type: intType}}}, nil, NewBlock()),
+			NewClosure(&FuncType{Params: []TypeField{{Name: "a", Type: floatType}}}, nil, NewBlock()),
+			false,
+		},
+	}
+	for i, test := range tests {
+		if have := Equal(test.a, test.b); have != test.equal {
+			t.Errorf("test %d: Equal is %v, want %v", i, have, test.equal)
+		}
+		if test.equal && Hash(test.a) != Hash(test.b) {
+			t.Errorf("test %d: equal trees have different hashes", i)
+		}
+		if !Equal(test.a, test.a.Clone()) || Hash(test.a) != Hash(test.a.Clone()) {
+			t.Errorf("test %d: clone is not equal", i)
+		}
+	}
+
+	roots := []RootNode{
+		&RootRequire{Path: "a.php"},
+		&RootRequire{Path: "b.php"},
+		&RootConstDecl{Name: "A", Value: NewIntLit(1)},
+		&RootConstDecl{Name: "A", Value: NewIntLit(2)},
+		&RootFuncDecl{Type: &FuncType{Name: "f"}, Body: NewBlock()},
+		&RootFuncDecl{Type: &FuncType{Name: "g"}, Body: NewBlock()},
+		&RootEnumDecl{Name: "E", Cases: []*EnumCase{{Name: "A"}}},
+		&RootEnumDecl{Name: "E", Cases: []*EnumCase{{Name: "B"}}},
+	}
+	for i, a := range roots {
+		for j, b := range roots {
+			if EqualRoot(a, b) != (i == j) {
+				t.Errorf("roots %d and %d: EqualRoot is %v", i, j, !(i == j))
+			}
+			if i != j && HashRoot(a) == HashRoot(b) {
+				t.Errorf("roots %d and %d: hashes are equal", i, j)
+			}
+		}
+		if clone := CloneRoot(a); !EqualRoot(a, clone) || HashRoot(a) != HashRoot(clone) {
+			t.Errorf("root %d: clone is not equal", i)
+		}
+	}
+}
+
+func TestOpInfo(t *testing.T) {
+	if len(opInfoTable) != int(OpNullCoalesce)+1 {
+		t.Fatalf("op info table has %d entries, want %d", len(opInfoTable), OpNullCoalesce+1)
+	}
+	for op := OpBad; op <= OpNullCoalesce; op++ {
+		info := GetOpInfo(op)
+		if info.Kind == OpKindInvalid {
+			t.Errorf("%s: no op info", op)
+			continue
+		}
+		n := &Node{Op: op}
+		if n.IsStatement() != (info.Kind == OpKindStmt) || n.IsExpression() != (info.Kind == OpKindExpr) {
+			t.Errorf("%s: IsStatement and IsExpression don't match the op kind", op)
+		}
+		if info.MaxArgs != -1 && info.MaxArgs < info.MinArgs {
+			t.Errorf("%s: invalid args range %d..%d", op, info.MinArgs, info.MaxArgs)
+		}
+		if info.Kind == OpKindExpr && info.Precedence == PrecNone {
+			t.Errorf("%s: expression without precedence", op)
+		}
+		if info.Kind != OpKindExpr && (info.Precedence != PrecNone || info.Result != ResultNone) {
+			t.Errorf("%s: non-expression with precedence or result", op)
+		}
+		switch info.Notation {
+		case NotationBinary:
+			if info.MinArgs != 2 || info.MaxArgs != 2 {
+				t.Errorf("%s: binary operator with %d..%d args", op, info.MinArgs, info.MaxArgs)
+			}
+		case NotationPrefix, NotationPostfix:
+			if info.MinArgs != 1 || info.MaxArgs != 1 {
+				t.Errorf("%s: unary operator with %d..%d args", op, info.MinArgs, info.MaxArgs)
+			}
+		}
+		if info.CompoundAssign && (info.Notation != NotationBinary || info.Symbol == "") {
+			t.Errorf("%s: compound assignment op is not a binary operator", op)
+		}
+	}
+	if info := GetOpInfo(OpNullCoalesce + 1); info.Kind != OpKindInvalid {
+		t.Errorf("unknown op has info: %+v", info)
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	intEnum := &EnumType{ValueType: IntType, Values: []interface{}{int64(1), int64(2)}}
+	tests := []struct {
+		typ  Type
+		want string
+	}{
+		{VoidType, "void"},
+		{BoolType, "bool"},
+		{IntType, "int"},
+		{FloatType, "float"},
+		{StringType, "string"},
+		{MixedType, "mixed"},
+		{NullType, "null"},
+		{&ScalarType{}, "?"},
+		{&ObjectType{}, "object"},
+		{&ClassType{Name: "Foo"}, "Foo"},
+		{&FuncType{Params: []TypeField{{Name: "x", Type: IntType}}, Result: IntType}, "callable"},
+		{intEnum, "int"},
+		{&NullableType{X: IntType}, "?int"},
+		{&UnionType{Types: []Type{IntType, StringType, NullType}}, "int|string|null"},
+		{&ArrayType{}, "array"},
+		{&ArrayType{Elem: IntType}, "array"},
+		{&ArrayType{Key: StringType, Elem: FloatType}, "array"},
+		{&NullableType{X: &ArrayType{Elem: IntType}}, "?array"},
+		{&TupleType{Elems: []Type{IntType, &ArrayType{Elem: BoolType}}}, "array"},
+	}
+	for _, test := range tests {
+		if have := test.typ.String(); have != test.want {
+			t.Errorf("%T String:\nhave: %s\nwant: %s", test.typ, have, test.want)
+		}
+	}
+
+	docTests := []struct {
+		typ  Type
+		want string
+	}{
+		{IntType, "int"},
+		{intEnum, "int"},
+		{&ClassType{Name: "Foo"}, "Foo"},
+		{&ArrayType{}, "array"},
+		{&ArrayType{Elem: IntType}, "(int[])"},
+		{&ArrayType{Elem: &ArrayType{Elem: MixedType}}, "((mixed[])[])"},
+		{&ArrayType{Key: StringType, Elem: FloatType}, "array<string, float>"},
+		{&ArrayType{Key: StringType, Elem: &ArrayType{Elem: IntType}}, "array<string, (int[])>"},
+		{&NullableType{X: &ArrayType{Elem: IntType}}, "?(int[])"},
+		{&UnionType{Types: []Type{&ArrayType{Elem: IntType}, StringType}}, "(int[])|string"},
+		{&TupleType{Elems: []Type{IntType, &ArrayType{Elem: BoolType}}}, "tuple(int,(bool[]))"},
+	}
+	for _, test := range docTests {
+		if have := TypeDocString(test.typ); have != test.want {
+			t.Errorf("%T TypeDocString:\nhave: %s\nwant: %s", test.typ, have, test.want)
+		}
+	}
+
+	for _, name := range []string{"bool", "int", "float", "string", "mixed", "void", "null", "object", "array", "callable"} {
+		typ, ok := LookupType(name)
+		if !ok {
+			t.Errorf("LookupType(%q) failed", name)
+			continue
+		}
+		if typ.String() != name {
+			t.Errorf("LookupType(%q) returned %s type", name, typ)
+		}
+	}
+	if typ, ok := LookupType("array"); !ok || !TypesIdentical(typ, &ArrayType{}) {
+		t.Errorf("LookupType(\"array\") returned %v", typ)
+	}
+	if _, ok := LookupType("integer"); ok {
+		t.Errorf("LookupType(\"integer\") succeeded")
+	}
+}
+
+func TestTypesCompatible(t *testing.T) {
+	intEnum := &EnumType{ValueType: IntType, Values: []interface{}{int64(1), int64(2)}}
+	intEnum1 := &EnumType{ValueType: IntType, Values: []interface{}{int64(1)}}
+	nanEnum := &EnumType{ValueType: FloatType, Values: []interface{}{math.NaN(), 1.5}}
+	nanEnum1 := &EnumType{ValueType: FloatType, Values: []interface{}{math.NaN()}}
+	intList := &ArrayType{Elem: IntType}
+	floatList := &ArrayType{Elem: FloatType}
+	stringMap := &ArrayType{Key: StringType, Elem: IntType}
+	anyArray := &ArrayType{}
+	intFunc := &FuncType{Params: []TypeField{{Name: "x", Type: IntType}}, Result: IntType}
+	voidFunc := &FuncType{Params: []TypeField{{Name: "y", Type: IntType}}}
+	callable := &FuncType{}
+	classFoo := &ClassType{Name: "Foo"}
+	object := &ObjectType{}
+	nullableInt := &NullableType{X: IntType}
+	intOrString := &UnionType{Types: []Type{IntType, StringType}}
+	tuple := &TupleType{Elems: []Type{IntType, StringType}}
+
+	types := []Type{
+		IntType, FloatType, StringType, BoolType, MixedType, NullType, VoidType,
+		intEnum, intEnum1, nanEnum, nanEnum1, intList, floatList, stringMap, anyArray, intFunc, voidFunc,
+		callable, classFoo, object, nullableInt, intOrString, tuple,
+	}
+
+	// compatible lists the src types for every dst type,
+	// all other pairs are incompatible.
+	compatible := map[Type][]Type{
+		IntType:     {IntType, intEnum, intEnum1},
+		FloatType:   {FloatType, IntType, intEnum, intEnum1, nanEnum, nanEnum1},
+		StringType:  {StringType},
+		BoolType:    {BoolType},
+		NullType:    {NullType},
+		VoidType:    {VoidType},
+		intEnum:     {intEnum, intEnum1},
+		intEnum1:    {intEnum1},
+		nanEnum:     {nanEnum, nanEnum1},
+		nanEnum1:    {nanEnum1},
+		intList:     {intList, stringMap},
+		floatList:   {floatList, intList, stringMap},
+		stringMap:   {stringMap},
+		anyArray:    {anyArray, intList, floatList, stringMap},
+		intFunc:     {intFunc},
+		voidFunc:    {voidFunc, intFunc},
+		callable:    {callable, intFunc, voidFunc},
+		classFoo:    {classFoo},
+		object:      {object, classFoo, intFunc, voidFunc, callable},
+		nullableInt: {nullableInt, IntType, NullType, intEnum, intEnum1},
+		intOrString: {intOrString, IntType, StringType, intEnum, intEnum1},
+		tuple:       {tuple},
+	}
+	for _, typ := range types {
+		if typ != VoidType {
+			compatible[MixedType] = append(compatible[MixedType], typ)
+		}
+	}
+
+	for _, dst := range types {
+		for _, src := range types {
+			want := false
+			for _, x := range compatible[dst] {
+				if x == src {
+					want = true
+				}
+			}
+			if have := TypesCompatible(dst, src); have != want {
+				t.Errorf("TypesCompatible(%s, %s) is %v, want %v", dst, src, have, want)
+			}
+			if have := TypesIdentical(dst, src); have != (dst == src) {
+				t.Errorf("TypesIdentical(%s, %s) is %v", dst, src, have)
+			}
+		}
+	}
+}
+
+func TestIsConstExpr(t *testing.T) {
+	tests := []struct {
+		n    *Node
+		want bool
+	}{
+		{NewAdd(NewIntLit(1), NewConstFetch("PHP_INT_MAX")), true},
+		{NewClassConst(NewName("Foo"), "X"), true},
+		{NewClassConst(NewRelativeClass(RelativeSelf), "X"), true},
+		{NewClassConst(NewRelativeClass(RelativeParent), "X"), true},
+		{NewClassConst(NewRelativeClass(RelativeStatic), "X"), false},
+		{NewConcat(NewStringLit("a"), NewClassConst(NewRelativeClass(RelativeStatic), "X")), false},
+		{NewDiv(NewIntLit(1), NewIntLit(2)), false},
+		{NewVar("x", nil), false},
+	}
+	for _, test := range tests {
+		if have := IsConstExpr(test.n); have != test.want {
+			t.Errorf("IsConstExpr(%s): have %v, want %v", test.n.Op, have, test.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	intType := &ScalarType{Kind: ScalarInt}
+	stringType := &ScalarType{Kind: ScalarString}
+	x := func() *Node { return NewVar("x", intType) }
+	switchNode := func(clauses ...*Node) *Node {
+		return &Node{Op: OpSwitch, Args: append([]*Node{x()}, clauses...)}
+	}
+	defaultCase := func(body ...*Node) *Node {
+		return &Node{Op: OpDefaultCase, Args: body}
+	}
+
+	tests := []struct {
+		body *Node
+		want []string
+	}{
+		{
+			body: NewBlock(NewEcho(x())),
+		},
+		{
+			body: NewBlock(&Node{Op: OpAdd, Args: []*Node{x()}}),
+			want: []string{"error: Add node has 1 args, expected 2"},
+		},
+		{
+			body: NewBlock(NewEcho(&Node{Op: OpIf, Args: []*Node{x(), nil}})),
+			want: []string{"error: If statement used as expression", "error: If node has nil arg 1"},
+		},
+		{
+			body: NewBlock(defaultCase(NewEcho(x()))),
+			want: []string{"error: DefaultCase outside of switch"},
+		},
+		{
+			body: NewBlock(switchNode(NewEcho(x()))),
+			want: []string{"error: Echo in switch cases list"},
+		},
+		{
+			body: NewBlock(NewEcho(NewCall(NewName("f"), NewKeyedElem(x(), x())))),
+			want: []string{"error: KeyedElem outside of array or list"},
+		},
+		{
+			body: NewBlock(NewWhile(x(), NewBlock(NewBreak(2)))),
+			want: []string{"error: Break 2 has only 1 enclosing loops"},
+		},
+		{
+			body: NewBlock(NewWhile(x(), NewBlock(switchNode(defaultCase(NewContinue(2)))))),
+		},
+		{
+			body: NewBlock(NewWhile(x(), NewBlock(switchNode(defaultCase(NewContinue(0)))))),
+			want: []string{"warning: continue 1 targets a switch, it works like break"},
+		},
+		{
+			// Closure body can't break the outer loop.
+			body: NewBlock(NewWhile(x(), NewBlock(
+				NewEcho(NewClosure(&FuncType{}, nil, NewBlock(NewBreak(0)))),
+			))),
+			want: []string{"error: Break 1 has only 0 enclosing loops"},
+		},
+		{
+			body: NewBlock(NewAssign(x(), NewVar("s", stringType))),
+			want: []string{"error: can't assign string value to $x of int type"},
+		},
+		{
+			body: NewBlock(NewAssign(x(), NewVar("undefined", stringType))),
+			want: []string{
+				"error: $undefined is used before assignment",
+				"error: can't assign string value to $x of int type",
+			},
+		},
+		{
+			body: NewBlock(
+				NewIf(x(), NewBlock(NewAssign(NewVar("a", nil), x()))),
+				NewEcho(NewVar("a", nil)),
+			),
+			want: []string{"error: $a is used before assignment"},
+		},
+		{
+			body: NewBlock(
+				NewIfElse(x(),
+					NewBlock(NewAssign(NewVar("a", nil), x())),
+					NewBlock(NewReturnVoid())),
+				NewEcho(NewVar("a", nil)),
+			),
+		},
+		{
+			body: NewBlock(
+				NewForeach(x(), nil, NewVar("v", nil), NewBlock(NewEcho(NewVar("v", nil))), false),
+				NewEcho(NewVar("v", nil)),
+			),
+			want: []string{"error: $v is used before assignment"},
+		},
+		{
+			body: NewBlock(
+				NewAssign(NewVar("a", nil), x()),
+				NewUnset(NewVar("a", nil)),
+				NewEcho(NewIsset(NewVar("a", nil)), NewNullCoalesce(NewVar("b", nil), x())),
+				NewEcho(NewVar("a", nil)),
+			),
+			want: []string{"error: $a is used before assignment"},
+		},
+		{
+			body: NewBlock(
+				NewAssign(NewList(NewVar("a", nil), nil, NewVar("b", nil)), x()),
+				NewAssign(NewIndex(NewVar("c", nil), NewIntLit(0)), NewVar("a", nil)),
+				NewEcho(NewVar("b", nil), NewVar("c", nil)),
+			),
+		},
+		{
+			body: NewBlock(
+				NewEcho(NewClosure(&FuncType{}, []ClosureUse{{Name: "a"}, {Name: "b", ByRef: true}}, NewBlock(
+					NewEcho(NewVar("a", nil), NewVar("b", nil), NewVar("c", nil)),
+				))),
+				NewEcho(NewVar("b", nil)),
+			),
+			want: []string{
+				"error: captured $a is used before assignment",
+				"error: $c is used before assignment",
+			},
+		},
+		{
+			// Unreachable code is checked too, except for its variables.
+			body: NewBlock(
+				NewWhile(x(), NewBlock(NewBreak(0), NewEcho(NewVar("a", nil)), NewBreak(2))),
+			),
+			want: []string{"error: Break 2 has only 1 enclosing loops"},
+		},
+		{
+			// The code after a block that ends with a break is unreachable.
+			body: NewBlock(
+				NewWhile(x(), NewBlock(
+					NewBlock(NewEcho(x()), NewBreak(0)),
+					NewEcho(NewVar("a", nil)),
+				)),
+				NewEcho(NewVar("b", nil)),
+			),
+			want: []string{"error: $b is used before assignment"},
+		},
+	}
+
+	for _, test := range tests {
+		decl := &RootFuncDecl{
+			Type: &FuncType{Name: "f", Params: []TypeField{{Name: "x", Type: intType}, {Name: "s", Type: stringType}}},
+			Body: test.body,
+		}
+		var have []string
+		for _, err := range Check(&File{Nodes: []RootNode{decl}}) {
+			have = append(have, err.Error())
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("Check:\nhave: %q\nwant: %q", have, test.want)
+		}
+	}
+}
+
+func TestCheckConstDecl(t *testing.T) {
+	f := &File{Nodes: []RootNode{
+		&RootConstDecl{Name: "FOO", Value: NewIntLit(1)},
+		&RootConstDecl{Name: "True", Value: NewIntLit(2)},
+	}}
+	var have []string
+	for _, err := range Check(f) {
+		have = append(have, err.Error())
+	}
+	want := []string{"error: can't use reserved True as a constant name"}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("Check:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestCheckNode(t *testing.T) {
+	n := NewBlock(
+		NewEcho(NewVar("undefined", nil)),
+		NewIf(NewBoolLit(true), NewContinue(0)),
+	)
+	errs := CheckNode(n)
+	if len(errs) != 1 {
+		t.Fatalf("CheckNode: have %d findings, want 1: %v", len(errs), errs)
+	}
+	err := errs[0].(*CheckError)
+	if err.Severity != SeverityError || err.Node != n.Args[1].Args[1] {
+		t.Fatalf("CheckNode: unexpected finding %v", err)
+	}
+}
@@ -11,11 +11,11 @@ type Node struct {
 }
 
 func (n *Node) IsStatement() bool {
-	return !miscOpsMap[n.Op] && statementOpsMap[n.Op]
+	return GetOpInfo(n.Op).Kind == OpKindStmt
 }
 
 func (n *Node) IsExpression() bool {
-	return !miscOpsMap[n.Op] && !statementOpsMap[n.Op]
+	return GetOpInfo(n.Op).Kind == OpKindExpr
 }
 
 //go:generate stringer -type Op -trimprefix Op
@@ -41,6 +41,7 @@ const (
 	OpIf
 
 	// 'if' '(' $Args[0] ')' $Args[1] 'else' $Args[2]
+	// If $Args[2] is OpIf or OpIfElse, it's printed as 'elseif'
 	OpIfElse
 
 	// 'switch' '(' $Args[0] ')' '{' $Args[1:]... '}'
@@ -56,12 +57,41 @@ const (
 	// 'while' '(' $Args[0] ')' $Args[1]
 	OpWhile
 
-	// 'do' $Args[0] 'while' $Args[1]
+	// 'do' $Args[0] 'while' '(' $Args[1] ')'
 	OpDoWhile
 
+	// 'foreach' '(' $Args[0] 'as' $Args[1] '=>' $Args[2] ')' $Args[3]
+	// $Args[1] is nil if there is no key variable
+	// $Value.(bool) tells whether $Args[2] is bound by reference
+	OpForeach
+
+	// 'for' '(' $Args[0] ';' $Args[1] ';' $Args[2] ')' $Args[3]
+	// Note: $Args[0:3] are OpExprList
+	OpFor
+
+	// $Args[:] separated by ','
+	// Only valid inside OpFor clauses
+	OpExprList
+
 	// '{' $Args[:]... '}'
 	OpBlock
 
+	// 'try' $Args[0] $Args[1:]...
+	// Note: $Args[1:] are OpCatch followed by optional OpFinally
+	OpTry
+
+	// 'catch' '(' $Value.([]string) $Args[0] ')' $Args[1]
+	// $Value.([]string) contains caught class names, they're printed separated by '|'
+	// $Args[0] is nil if the exception is not bound to a variable
+	OpCatch
+
+	// 'finally' $Args[0]
+	OpFinally
+
+	// 'throw' $Args[0]
+	// Can be used as both statement and expression (PHP 8+)
+	OpThrow
+
 	// 'return' $Args[0]
 	OpReturn
 
@@ -71,15 +101,28 @@ const (
 	// 'echo' $Args[:]...
 	OpEcho
 
+	// 'static' $Args[:]...
+	// Note: args are OpVar or OpAssign with OpVar and a constant expression
+	OpStaticVar
+
+	// 'global' $Args[:]...
+	// Note: args are OpVar
+	OpGlobal
+
+	// 'unset' '(' $Args[:]... ')'
+	// Note: args are variables, see IsVariable
+	OpUnset
+
 	// '(' $Args[0] ')'
 	OpParens
 
 	// $Args[0] '=' $Args[1]
 	// $Value.(*phpdoc.VarTag) may contain a type specifier
+	// Note: $Args[0] is a variable (see IsVariable) or OpList
 	OpAssign
 
 	// $Args[0] <op>'=' $Args[1]
-	// $Value.(Op) contains the operation (like OpAdd)
+	// $Value.(Op) contains the operation (like OpAdd or OpNullCoalesce)
 	OpAssignModify
 
 	// $Value.(bool)
@@ -91,26 +134,106 @@ const (
 	// $Value.(string)
 	OpStringLit
 
-	// $Args hold string part (OpStringLit with OpVar)
+	// $Args hold string parts: OpStringLit and variables (see IsVariable)
+	// Note: variable parts are OpVar, OpIndex and OpProp
 	OpInterpolatedString
 
 	// $Args holds array elements
+	// Keyed elements are represented by OpKeyedElem
 	OpArrayLit
 
+	// $Args[0] '=>' $Args[1]
+	// Only valid inside OpArrayLit and OpList
+	OpKeyedElem
+
+	// 'list' '(' $Args[:]... ')'
+	// nil args are skipped elements, like in list($a, , $c)
+	// Keyed elements are represented by OpKeyedElem
+	// Note: only valid as the OpAssign LHS or inside another OpList
+	OpList
+
+	// 'function' '(' $Type.Params ')' 'use' '(' $Value ')' ':' $Type.Result $Args[0]
+	// $Type.(*FuncType) contains the closure signature, nil Result means no return type hint
+	// $Value.(*ClosureInfo) contains captured variables
+	OpClosure
+
 	// $Value.(string) contains a variable name
 	// $Type contains a variable type
 	OpVar
 
 	// $Value.(string) contains a symbol name
+	// Fully qualified names start with '\'
 	OpName
 
+	// $Value.(string) contains a constant name
+	OpConstFetch
+
 	// '!' $Args[0]
 	OpNot
 
 	// $Args[0] '->' $Value.(string)
+	// A dynamic property is $Args[0] '->' '{' $Args[1] '}'
 	OpProp
 
+	// $Args[0] '?->' $Value.(string)
+	// A dynamic property is $Args[0] '?->' '{' $Args[1] '}'
+	OpNullsafeProp
+
+	// $Args[0] '->' $Value.(string) '(' $Args[1:]... ')'
+	// Note: arguments follow the OpCall rules
+	OpMethodCall
+
+	// $Args[0] '?->' $Value.(string) '(' $Args[1:]... ')'
+	// Note: arguments follow the OpCall rules
+	OpNullsafeMethodCall
+
+	// $Args[0] '::' $Value.(string)
+	// $Args[0] is a class reference: OpName, OpRelativeClass or an expression
+	OpClassConst
+
+	// $Args[0] '::' '$'$Value.(string)
+	// $Args[0] is a class reference, like in OpClassConst
+	OpStaticProp
+
+	// $Args[0] '::' $Value.(string) '(' $Args[1:]... ')'
+	// $Args[0] is a class reference, like in OpClassConst
+	// Note: arguments follow the OpCall rules
+	OpStaticCall
+
+	// $Value.(RelativeClass) is printed as 'self', 'static' or 'parent'
+	OpRelativeClass
+
+	// 'new' $Args[0] '(' $Args[1:]... ')'
+	// $Args[0] is a class reference: OpName, OpRelativeClass, a variable or an expression
+	// Note: arguments follow the OpCall rules
+	OpNew
+
+	// 'clone' $Args[0]
+	OpClone
+
+	// $Args[0] 'instanceof' $Args[1]
+	// $Args[1] is a class reference, like in OpNew
+	OpInstanceOf
+
+	// 'exit' '(' $Args[0] ')'
+	// $Args is empty for the argument-less 'exit'
+	// Note: can be printed as 'die' as well
+	OpExit
+
+	// 'print' $Args[0]
+	// Unlike echo, it's an expression that always evaluates to 1
+	OpPrint
+
+	// 'yield' $Args[0] '=>' $Args[1]
+	// $Args can be empty ('yield') or contain only a value ('yield' $Args[0])
+	OpYield
+
+	// 'yield' 'from' $Args[0]
+	OpYieldFrom
+
 	// $Args[0] '[' $Args[1] ']'
+	// $Value.(bool) tells whether the legacy $Args[0] '{' $Args[1] '}' syntax
+	// is used, it was removed in PHP 8
 	OpIndex
 
 	// '-' $Args[0]
@@ -156,11 +279,33 @@ const (
 	OpXorWord
 
 	// $Args[0] '?' $Args[1] ':' $Args[2]
+	// $Args[1] is nil for the short '?:' form
 	OpTernary
 
 	// $Args[0] '(' $Args[1:]... ')'
+	// Note: argument unpacking (OpSpread) should follow the positional arguments
+	// and named arguments (OpNamedArg) should follow both of them
 	OpCall
 
+	// $Value.(string) ':' $Args[0]
+	// Only valid inside OpCall
+	OpNamedArg
+
+	// '...' $Args[0]
+	// Only valid inside OpCall and OpArrayLit
+	OpSpread
+
+	// '&' $Args[0]
+	// Only valid inside OpList
+	OpByRef
+
+	// 'isset' '(' $Args[:]... ')'
+	// Note: args are variables or their elements, see IsVariable
+	OpIsset
+
+	// 'empty' '(' $Args[0] ')'
+	OpEmpty
+
 	// $Args[0] '<' $Args[1]
 	OpLess
 
@@ -215,6 +360,9 @@ const (
 	// ($Type)$Args[0]
 	OpCast
 
+	// '@' $Args[0]
+	OpErrorSuppress
+
 	// $Args[0] & $Args[1]
 	OpBitAnd
 
@@ -237,24 +385,21 @@ const (
 	OpNullCoalesce
 )
 
-var statementOpsMap = [...]bool{
-	OpBreak:      true,
-	OpContinue:   true,
-	OpIf:         true,
-	OpIfElse:     true,
-	OpWhile:      true,
-	OpDoWhile:    true,
-	OpSwitch:     true,
-	OpBlock:      true,
-	OpReturn:     true,
-	OpReturnVoid: true,
-	OpEcho:       true,
+// ClosureInfo describes the closure captures.
+type ClosureInfo struct {
+	Uses []ClosureUse
+
+	// ArrowFunc permits printing the closure as an arrow function.
+	// The body of such closure is a single return statement
+	// and all captures are by value, so the implicit capturing
+	// of an arrow function does the same thing as the use clause.
+	ArrowFunc bool
 }
 
-var miscOpsMap = [...]bool{
-	OpInvalid:     true,
-	OpCase:        true,
-	OpDefaultCase: true,
+// ClosureUse is a variable captured by a closure.
+type ClosureUse struct {
+	Name  string
+	ByRef bool
 }
 
 func NewBreak(value int) *Node {
@@ -281,10 +426,49 @@ func NewDoWhile(body, cond *Node) *Node {
 	return &Node{Op: OpDoWhile, Args: []*Node{body, cond}}
 }
 
+func NewForeach(x, key, value, body *Node, byRef bool) *Node {
+	return &Node{Op: OpForeach, Args: []*Node{x, key, value, body}, Value: byRef}
+}
+
+func NewFor(init, cond, post []*Node, body *Node) *Node {
+	return &Node{
+		Op: OpFor,
+		Args: []*Node{
+			NewExprList(init...),
+			NewExprList(cond...),
+			NewExprList(post...),
+			body,
+		},
+	}
+}
+
+func NewExprList(list ...*Node) *Node {
+	return &Node{Op: OpExprList, Args: list}
+}
+
 func NewBlock(statements ...*Node) *Node {
 	return &Node{Op: OpBlock, Args: statements}
 }
 
+func NewTry(body *Node, clauses ...*Node) *Node {
+	allArgs := make([]*Node, len(clauses)+1)
+	allArgs[0] = body
+	copy(allArgs[1:], clauses)
+	return &Node{Op: OpTry, Args: allArgs}
+}
+
+func NewCatch(classNames []string, v, body *Node) *Node {
+	return &Node{Op: OpCatch, Value: classNames, Args: []*Node{v, body}}
+}
+
+func NewFinally(body *Node) *Node {
+	return &Node{Op: OpFinally, Args: []*Node{body}}
+}
+
+func NewThrow(x *Node) *Node {
+	return &Node{Op: OpThrow, Args: []*Node{x}}
+}
+
 func NewReturn(x *Node) *Node {
 	return &Node{Op: OpReturn, Args: []*Node{x}}
 }
@@ -297,6 +481,55 @@ func NewEcho(args ...*Node) *Node {
 	return &Node{Op: OpEcho, Args: args}
 }
 
+// NewStaticVar creates a static variables declaration.
+// Every decl is either OpVar or OpAssign that binds OpVar to a constant
+// expression (see IsConstExpr); NewStaticVar panics if it's not the case.
+func NewStaticVar(decls ...*Node) *Node {
+	if len(decls) == 0 {
+		panic("static declaration without variables")
+	}
+	for _, decl := range decls {
+		switch {
+		case decl.Op == OpVar:
+		case decl.Op == OpAssign && decl.Args[0].Op == OpVar:
+			if !IsConstExpr(decl.Args[1]) {
+				panic("static $" + decl.Args[0].Value.(string) + " initializer is not a constant expression")
+			}
+		default:
+			panic("unexpected " + decl.Op.String() + " in static declaration")
+		}
+	}
+	return &Node{Op: OpStaticVar, Args: decls}
+}
+
+// NewGlobal creates a global variables import statement.
+// It panics if any of vars is not OpVar.
+func NewGlobal(vars ...*Node) *Node {
+	if len(vars) == 0 {
+		panic("global statement without variables")
+	}
+	for _, v := range vars {
+		if v.Op != OpVar {
+			panic("unexpected " + v.Op.String() + " in global statement")
+		}
+	}
+	return &Node{Op: OpGlobal, Args: vars}
+}
+
+// NewUnset creates an unset statement.
+// It panics if any of args is not a variable, see IsVariable.
+func NewUnset(args ...*Node) *Node {
+	if len(args) == 0 {
+		panic("unset without arguments")
+	}
+	for _, arg := range args {
+		if !IsVariable(arg) {
+			panic("can't unset " + arg.Op.String())
+		}
+	}
+	return &Node{Op: OpUnset, Args: args}
+}
+
 func NewParens(x *Node) *Node {
 	return &Node{Op: OpParens, Args: []*Node{x}}
 }
@@ -305,7 +538,16 @@ func NewAssign(lhs, rhs *Node) *Node {
 	return &Node{Op: OpAssign, Args: []*Node{lhs, rhs}}
 }
 
+// NewAssignModify creates a compound assignment, like $x += $y.
+// It panics if op has no compound assignment form.
 func NewAssignModify(op Op, lhs, rhs *Node) *Node {
+	switch op {
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpExp, OpConcat,
+		OpBitAnd, OpBitOr, OpBitXor, OpBitShiftLeft, OpBitShiftRight,
+		OpNullCoalesce:
+	default:
+		panic("no compound assignment for " + op.String())
+	}
 	return &Node{Op: OpAssignModify, Value: op, Args: []*Node{lhs, rhs}}
 }
 
@@ -325,6 +567,77 @@ func NewStringLit(value string) *Node {
 	return &Node{Op: OpStringLit, Value: value}
 }
 
+func NewKeyedElem(key, value *Node) *Node {
+	return &Node{Op: OpKeyedElem, Args: []*Node{key, value}}
+}
+
+// NewList creates a destructuring assignment target.
+// Every elem is nil (a skipped element), a variable (see IsVariable),
+// a nested OpList or OpByRef of a variable, optionally wrapped
+// into OpKeyedElem. Keyed and positional elements can't be mixed,
+// keyed lists can't skip elements; NewList panics in these cases.
+func NewList(elems ...*Node) *Node {
+	numKeyed := 0
+	numSkipped := 0
+	for _, elem := range elems {
+		switch {
+		case elem == nil:
+			numSkipped++
+			continue
+		case elem.Op == OpKeyedElem:
+			numKeyed++
+			elem = elem.Args[1]
+		}
+		if !isListTarget(elem) {
+			panic("can't destructure into " + elem.Op.String())
+		}
+	}
+	switch {
+	case numSkipped == len(elems):
+		panic("list without elements")
+	case numKeyed != 0 && numKeyed+numSkipped != len(elems):
+		panic("list mixes keyed and positional elements")
+	case numKeyed != 0 && numSkipped != 0:
+		panic("keyed list with skipped elements")
+	}
+	return &Node{Op: OpList, Args: elems}
+}
+
+func isListTarget(n *Node) bool {
+	switch n.Op {
+	case OpList:
+		return true
+	case OpByRef:
+		return IsVariable(n.Args[0])
+	default:
+		return IsVariable(n)
+	}
+}
+
+// NewByRef creates a by-reference list element.
+func NewByRef(x *Node) *Node {
+	return &Node{Op: OpByRef, Args: []*Node{x}}
+}
+
+func NewClosure(typ *FuncType, uses []ClosureUse, body *Node) *Node {
+	info := &ClosureInfo{Uses: uses}
+	return &Node{Op: OpClosure, Type: typ, Value: info, Args: []*Node{body}}
+}
+
+// NewArrowClosure creates a closure that returns the result expression.
+// It's marked as arrow-eligible, so it can be printed as 'fn' '=>' expression.
+// All captures must be by value.
+func NewArrowClosure(typ *FuncType, uses []ClosureUse, result *Node) *Node {
+	for _, u := range uses {
+		if u.ByRef {
+			panic("arrow function can't capture $" + u.Name + " by reference")
+		}
+	}
+	info := &ClosureInfo{Uses: uses, ArrowFunc: true}
+	body := NewBlock(NewReturn(result))
+	return &Node{Op: OpClosure, Type: typ, Value: info, Args: []*Node{body}}
+}
+
 func NewVar(name string, typ Type) *Node {
 	return &Node{Op: OpVar, Value: name, Type: typ}
 }
@@ -333,6 +646,20 @@ func NewName(name string) *Node {
 	return &Node{Op: OpName, Value: name}
 }
 
+// NewConstFetch creates a named constant reference.
+// It panics if name is a reserved word, see IsReservedName.
+func NewConstFetch(name string) *Node {
+	if IsReservedName(name) {
+		panic("can't use reserved " + name + " as a constant name")
+	}
+	return &Node{Op: OpConstFetch, Value: name}
+}
+
+// NewFullyQualifiedName creates a global namespace name, like \strlen.
+func NewFullyQualifiedName(name string) *Node {
+	return &Node{Op: OpName, Value: `\` + name}
+}
+
 func NewNot(x *Node) *Node {
 	return &Node{Op: OpNot, Args: []*Node{x}}
 }
@@ -341,6 +668,120 @@ func NewProp(obj *Node, propName string) *Node {
 	return &Node{Op: OpProp, Value: propName, Args: []*Node{obj}}
 }
 
+// NewDynamicProp creates a property fetch with a computed name, like $obj->{$name}.
+func NewDynamicProp(obj, propName *Node) *Node {
+	return &Node{Op: OpProp, Value: "", Args: []*Node{obj, propName}}
+}
+
+func NewNullsafeProp(obj *Node, propName string) *Node {
+	return &Node{Op: OpNullsafeProp, Value: propName, Args: []*Node{obj}}
+}
+
+// NewNullsafeDynamicProp is a nullsafe NewDynamicProp, like $obj?->{$name}.
+func NewNullsafeDynamicProp(obj, propName *Node) *Node {
+	return &Node{Op: OpNullsafeProp, Value: "", Args: []*Node{obj, propName}}
+}
+
+// NewMethodCall creates a method call.
+// It panics if args violate the NewCall order rules.
+func NewMethodCall(obj *Node, methodName string, args ...*Node) *Node {
+	checkCallArgs(args)
+	return &Node{Op: OpMethodCall, Value: methodName, Args: append([]*Node{obj}, args...)}
+}
+
+// NewNullsafeMethodCall creates a nullsafe method call.
+// It panics if args violate the NewCall order rules.
+func NewNullsafeMethodCall(obj *Node, methodName string, args ...*Node) *Node {
+	checkCallArgs(args)
+	return &Node{Op: OpNullsafeMethodCall, Value: methodName, Args: append([]*Node{obj}, args...)}
+}
+
+func NewClassConst(class *Node, constName string) *Node {
+	return &Node{Op: OpClassConst, Value: constName, Args: []*Node{class}}
+}
+
+func NewStaticProp(class *Node, propName string) *Node {
+	return &Node{Op: OpStaticProp, Value: propName, Args: []*Node{class}}
+}
+
+// NewStaticCall creates a static method call.
+// It panics if args violate the NewCall order rules.
+func NewStaticCall(class *Node, methodName string, args ...*Node) *Node {
+	checkCallArgs(args)
+	return &Node{Op: OpStaticCall, Value: methodName, Args: append([]*Node{class}, args...)}
+}
+
+func NewRelativeClass(class RelativeClass) *Node {
+	return &Node{Op: OpRelativeClass, Value: class}
+}
+
+// NewNew creates an object instantiation expression.
+// It panics if args violate the NewCall order rules.
+func NewNew(class *Node, args ...*Node) *Node {
+	checkCallArgs(args)
+	return &Node{Op: OpNew, Args: append([]*Node{class}, args...)}
+}
+
+func NewClone(x *Node) *Node {
+	return &Node{Op: OpClone, Args: []*Node{x}}
+}
+
+func NewInstanceOf(x, class *Node) *Node {
+	return &Node{Op: OpInstanceOf, Args: []*Node{x, class}, Type: BoolType}
+}
+
+// NewExit creates an exit expression.
+// The status is optional: without it, exit is printed without parentheses.
+func NewExit(status ...*Node) *Node {
+	if len(status) > 1 {
+		panic("exit accepts at most 1 argument")
+	}
+	return &Node{Op: OpExit, Args: status}
+}
+
+func NewPrint(x *Node) *Node {
+	return &Node{Op: OpPrint, Args: []*Node{x}, Type: IntType}
+}
+
+// NewYield creates a yield expression.
+// The args are either empty, a value or a key followed by a value.
+func NewYield(args ...*Node) *Node {
+	if len(args) > 2 {
+		panic("yield accepts at most 2 arguments")
+	}
+	return &Node{Op: OpYield, Args: args}
+}
+
+func NewYieldFrom(x *Node) *Node {
+	return &Node{Op: OpYieldFrom, Args: []*Node{x}}
+}
+
+// ContainsYield reports whether n contains a yield expression,
+// which makes the enclosing function a generator.
+// Closures are not inspected as they're separate functions.
+func ContainsYield(n *Node) bool {
+	if n == nil {
+		return false
+	}
+	switch n.Op {
+	case OpYield, OpYieldFrom:
+		return true
+	case OpClosure:
+		return false
+	}
+	for _, arg := range n.Args {
+		if ContainsYield(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewGlobalsIndex creates a $GLOBALS[$name] global variable reference.
+func NewGlobalsIndex(name string, typ Type) *Node {
+	return &Node{Op: OpIndex, Args: []*Node{NewVar("GLOBALS", nil), NewStringLit(name)}, Type: typ}
+}
+
 func NewIndex(array, key *Node) *Node {
 	return &Node{Op: OpIndex, Args: []*Node{array, key}}
 }
@@ -369,7 +810,85 @@ func NewTernary(cond, trueExpr, falseExpr *Node) *Node {
 	return &Node{Op: OpTernary, Args: []*Node{cond, trueExpr, falseExpr}}
 }
 
+// NewShortTernary creates a cond '?:' falseExpr expression.
+func NewShortTernary(cond, falseExpr *Node) *Node {
+	return &Node{Op: OpTernary, Args: []*Node{cond, nil, falseExpr}}
+}
+
+func checkCallArgs(args []*Node) {
+	named := false
+	spread := false
+	for _, arg := range args {
+		switch {
+		case arg.Op == OpNamedArg:
+			named = true
+		case named:
+			panic("positional argument or unpacking after named argument")
+		case arg.Op == OpSpread:
+			spread = true
+		case spread:
+			panic("positional argument after argument unpacking")
+		}
+	}
+}
+
+func NewNamedArg(name string, x *Node) *Node {
+	return &Node{Op: OpNamedArg, Value: name, Args: []*Node{x}}
+}
+
+func NewSpread(x *Node) *Node {
+	return &Node{Op: OpSpread, Args: []*Node{x}}
+}
+
+// NewIsset creates an isset check.
+// It panics if any of args is not a variable or an element
+// of a call result, since isset can't be used on expressions.
+func NewIsset(args ...*Node) *Node {
+	if len(args) == 0 {
+		panic("isset without arguments")
+	}
+	for _, arg := range args {
+		isCallElem := (arg.Op == OpIndex || arg.Op == OpProp) && arg.Args[0].Op == OpCall
+		if !IsVariable(arg) && !isCallElem {
+			panic("can't use isset on " + arg.Op.String())
+		}
+	}
+	return &Node{Op: OpIsset, Args: args, Type: BoolType}
+}
+
+func NewEmpty(x *Node) *Node {
+	return &Node{Op: OpEmpty, Args: []*Node{x}, Type: BoolType}
+}
+
+// NewInterpolatedString creates a double-quoted string with interpolations.
+// It panics if a part is neither OpStringLit nor a variable (see IsVariable).
+func NewInterpolatedString(parts ...*Node) *Node {
+	for _, part := range parts {
+		if part.Op != OpStringLit && !IsVariable(part) {
+			panic("can't interpolate " + part.Op.String())
+		}
+	}
+	return &Node{Op: OpInterpolatedString, Args: parts, Type: StringType}
+}
+
+// IsVariable reports whether n is a variable, an array element
+// or a property of a variable; these can be unset.
+func IsVariable(n *Node) bool {
+	switch n.Op {
+	case OpVar:
+		return true
+	case OpIndex, OpProp:
+		return IsVariable(n.Args[0])
+	default:
+		return false
+	}
+}
+
+// NewCall creates a function call.
+// It panics if the arguments order is not positional,
+// unpacked and then named arguments.
 func NewCall(fn *Node, args ...*Node) *Node {
+	checkCallArgs(args)
 	allArgs := make([]*Node, len(args)+1)
 	allArgs[0] = fn
 	copy(allArgs[1:], args)
@@ -416,6 +935,10 @@ func NewPreDec(x *Node) *Node {
 	return &Node{Op: OpPreDec, Args: []*Node{x}}
 }
 
+func NewErrorSuppress(x *Node) *Node {
+	return &Node{Op: OpErrorSuppress, Args: []*Node{x}}
+}
+
 func NewAndWord(x, y *Node) *Node {
 	return &Node{Op: OpAndWord, Args: []*Node{x, y}}
 }
@@ -19,70 +19,104 @@ func _() {
 	_ = x[OpDefaultCase-8]
 	_ = x[OpWhile-9]
 	_ = x[OpDoWhile-10]
-	_ = x[OpBlock-11]
-	_ = x[OpReturn-12]
-	_ = x[OpReturnVoid-13]
-	_ = x[OpEcho-14]
-	_ = x[OpParens-15]
-	_ = x[OpAssign-16]
-	_ = x[OpAssignModify-17]
-	_ = x[OpBoolLit-18]
-	_ = x[OpIntLit-19]
-	_ = x[OpFloatLit-20]
-	_ = x[OpStringLit-21]
-	_ = x[OpInterpolatedString-22]
-	_ = x[OpArrayLit-23]
-	_ = x[OpVar-24]
-	_ = x[OpName-25]
-	_ = x[OpNot-26]
-	_ = x[OpProp-27]
-	_ = x[OpIndex-28]
-	_ = x[OpNegation-29]
-	_ = x[OpUnaryPlus-30]
-	_ = x[OpConcat-31]
-	_ = x[OpAdd-32]
-	_ = x[OpSub-33]
-	_ = x[OpDiv-34]
-	_ = x[OpMul-35]
-	_ = x[OpMod-36]
-	_ = x[OpExp-37]
-	_ = x[OpAnd-38]
-	_ = x[OpAndWord-39]
-	_ = x[OpOr-40]
-	_ = x[OpOrWord-41]
-	_ = x[OpXorWord-42]
-	_ = x[OpTernary-43]
-	_ = x[OpCall-44]
-	_ = x[OpLess-45]
-	_ = x[OpLessOrEqual-46]
-	_ = x[OpGreater-47]
-	_ = x[OpGreaterOrEqual-48]
-	_ = x[OpEqual2-49]
-	_ = x[OpFloatEqual2-50]
-	_ = x[OpEqual3-51]
-	_ = x[OpFloatEqual3-52]
-	_ = x[OpNotEqual2-53]
-	_ = x[OpNotFloatEqual2-54]
-	_ = x[OpNotEqual3-55]
-	_ = x[OpNotFloatEqual3-56]
-	_ = x[OpSpaceship-57]
-	_ = x[OpPostInc-58]
-	_ = x[OpPreInc-59]
-	_ = x[OpPostDec-60]
-	_ = x[OpPreDec-61]
-	_ = x[OpCast-62]
-	_ = x[OpBitAnd-63]
-	_ = x[OpBitOr-64]
-	_ = x[OpBitXor-65]
-	_ = x[OpBitNot-66]
-	_ = x[OpBitShiftLeft-67]
-	_ = x[OpBitShiftRight-68]
-	_ = x[OpNullCoalesce-69]
+	_ = x[OpForeach-11]
+	_ = x[OpFor-12]
+	_ = x[OpExprList-13]
+	_ = x[OpBlock-14]
+	_ = x[OpTry-15]
+	_ = x[OpCatch-16]
+	_ = x[OpFinally-17]
+	_ = x[OpThrow-18]
+	_ = x[OpReturn-19]
+	_ = x[OpReturnVoid-20]
+	_ = x[OpEcho-21]
+	_ = x[OpStaticVar-22]
+	_ = x[OpGlobal-23]
+	_ = x[OpUnset-24]
+	_ = x[OpParens-25]
+	_ = x[OpAssign-26]
+	_ = x[OpAssignModify-27]
+	_ = x[OpBoolLit-28]
+	_ = x[OpIntLit-29]
+	_ = x[OpFloatLit-30]
+	_ = x[OpStringLit-31]
+	_ = x[OpInterpolatedString-32]
+	_ = x[OpArrayLit-33]
+	_ = x[OpKeyedElem-34]
+	_ = x[OpList-35]
+	_ = x[OpClosure-36]
+	_ = x[OpVar-37]
+	_ = x[OpName-38]
+	_ = x[OpConstFetch-39]
+	_ = x[OpNot-40]
+	_ = x[OpProp-41]
+	_ = x[OpNullsafeProp-42]
+	_ = x[OpMethodCall-43]
+	_ = x[OpNullsafeMethodCall-44]
+	_ = x[OpClassConst-45]
+	_ = x[OpStaticProp-46]
+	_ = x[OpStaticCall-47]
+	_ = x[OpRelativeClass-48]
+	_ = x[OpNew-49]
+	_ = x[OpClone-50]
+	_ = x[OpInstanceOf-51]
+	_ = x[OpExit-52]
+	_ = x[OpPrint-53]
+	_ = x[OpYield-54]
+	_ = x[OpYieldFrom-55]
+	_ = x[OpIndex-56]
+	_ = x[OpNegation-57]
+	_ = x[OpUnaryPlus-58]
+	_ = x[OpConcat-59]
+	_ = x[OpAdd-60]
+	_ = x[OpSub-61]
+	_ = x[OpDiv-62]
+	_ = x[OpMul-63]
+	_ = x[OpMod-64]
+	_ = x[OpExp-65]
+	_ = x[OpAnd-66]
+	_ = x[OpAndWord-67]
+	_ = x[OpOr-68]
+	_ = x[OpOrWord-69]
+	_ = x[OpXorWord-70]
+	_ = x[OpTernary-71]
+	_ = x[OpCall-72]
+	_ = x[OpNamedArg-73]
+	_ = x[OpSpread-74]
+	_ = x[OpByRef-75]
+	_ = x[OpIsset-76]
+	_ = x[OpEmpty-77]
+	_ = x[OpLess-78]
+	_ = x[OpLessOrEqual-79]
+	_ = x[OpGreater-80]
+	_ = x[OpGreaterOrEqual-81]
+	_ = x[OpEqual2-82]
+	_ = x[OpFloatEqual2-83]
+	_ = x[OpEqual3-84]
+	_ = x[OpFloatEqual3-85]
+	_ = x[OpNotEqual2-86]
+	_ = x[OpNotFloatEqual2-87]
+	_ = x[OpNotEqual3-88]
+	_ = x[OpNotFloatEqual3-89]
+	_ = x[OpSpaceship-90]
+	_ = x[OpPostInc-91]
+	_ = x[OpPreInc-92]
+	_ = x[OpPostDec-93]
+	_ = x[OpPreDec-94]
+	_ = x[OpCast-95]
+	_ = x[OpErrorSuppress-96]
+	_ = x[OpBitAnd-97]
+	_ = x[OpBitOr-98]
+	_ = x[OpBitXor-99]
+	_ = x[OpBitNot-100]
+	_ = x[OpBitShiftLeft-101]
+	_ = x[OpBitShiftRight-102]
+	_ = x[OpNullCoalesce-103]
 }
 
-const _Op_name = "InvalidBadBreakContinueIfIfElseSwitchCaseDefaultCaseWhileDoWhileBlockReturnReturnVoidEchoParensAssignAssignModifyBoolLitIntLitFloatLitStringLitInterpolatedStringArrayLitVarNameNotPropIndexNegationUnaryPlusConcatAddSubDivMulModExpAndAndWordOrOrWordXorWordTernaryCallLessLessOrEqualGreaterGreaterOrEqualEqual2FloatEqual2Equal3FloatEqual3NotEqual2NotFloatEqual2NotEqual3NotFloatEqual3SpaceshipPostIncPreIncPostDecPreDecCastBitAndBitOrBitXorBitNotBitShiftLeftBitShiftRightNullCoalesce"
+const _Op_name = "InvalidBadBreakContinueIfIfElseSwitchCaseDefaultCaseWhileDoWhileForeachForExprListBlockTryCatchFinallyThrowReturnReturnVoidEchoStaticVarGlobalUnsetParensAssignAssignModifyBoolLitIntLitFloatLitStringLitInterpolatedStringArrayLitKeyedElemListClosureVarNameConstFetchNotPropNullsafePropMethodCallNullsafeMethodCallClassConstStaticPropStaticCallRelativeClassNewCloneInstanceOfExitPrintYieldYieldFromIndexNegationUnaryPlusConcatAddSubDivMulModExpAndAndWordOrOrWordXorWordTernaryCallNamedArgSpreadByRefIssetEmptyLessLessOrEqualGreaterGreaterOrEqualEqual2FloatEqual2Equal3FloatEqual3NotEqual2NotFloatEqual2NotEqual3NotFloatEqual3SpaceshipPostIncPreIncPostDecPreDecCastErrorSuppressBitAndBitOrBitXorBitNotBitShiftLeftBitShiftRightNullCoalesce"
 
-var _Op_index = [...]uint16{0, 7, 10, 15, 23, 25, 31, 37, 41, 52, 57, 64, 69, 75, 85, 89, 95, 101, 113, 120, 126, 134, 143, 161, 169, 172, 176, 179, 183, 188, 196, 205, 211, 214, 217, 220, 223, 226, 229, 232, 239, 241, 247, 254, 261, 265, 269, 280, 287, 301, 307, 318, 324, 335, 344, 358, 367, 381, 390, 397, 403, 410, 416, 420, 426, 431, 437, 443, 455, 468, 480}
+var _Op_index = [...]uint16{0, 7, 10, 15, 23, 25, 31, 37, 41, 52, 57, 64, 71, 74, 82, 87, 90, 95, 102, 107, 113, 123, 127, 136, 142, 147, 153, 159, 171, 178, 184, 192, 201, 219, 227, 236, 240, 247, 250, 254, 264, 267, 271, 283, 293, 311, 321, 331, 341, 354, 357, 362, 372, 376, 381, 386, 395, 400, 408, 417, 423, 426, 429, 432, 435, 438, 441, 444, 451, 453, 459, 466, 473, 477, 485, 491, 496, 501, 506, 510, 521, 528, 542, 548, 559, 565, 576, 585, 599, 608, 622, 631, 638, 644, 651, 657, 661, 674, 680, 685, 691, 697, 709, 722, 734}
 
 func (i Op) String() string {
 	if i < 0 || i >= Op(len(_Op_index)-1) {
@@ -0,0 +1,335 @@
+package ir
+
+// OpInfo describes the op syntax and semantics, see GetOpInfo.
+type OpInfo struct {
+	Kind OpKind
+
+	// Symbol is the operator token, like "+" or "instanceof".
+	// It's empty for ops that are not printed as operators.
+	Symbol string
+
+	// Notation tells how the operator Symbol and args are printed.
+	Notation Notation
+
+	// Precedence and Assoc describe the operator binding.
+	// Non-operator expressions have PrecAtom precedence.
+	Precedence Precedence
+	Assoc      Assoc
+
+	// MinArgs and MaxArgs are the permitted range of args count.
+	// The MaxArgs of -1 means that there is no upper limit.
+	MinArgs int
+	MaxArgs int
+
+	// Result is the expression result category.
+	Result ResultKind
+
+	// CompoundAssign permits the op to be used in OpAssignModify,
+	// like the '+=' operator.
+	CompoundAssign bool
+}
+
+// OpKind is an op category.
+type OpKind int
+
+const (
+	// OpKindInvalid is only used for OpInvalid.
+	OpKindInvalid OpKind = iota
+
+	// OpKindExpr is an expression, it's also valid as a statement.
+	OpKindExpr
+
+	// OpKindStmt is a statement, it can't be used as an expression.
+	OpKindStmt
+
+	// OpKindAux is a part of other nodes, like OpCase or OpNamedArg.
+	// It's neither a statement nor an expression.
+	OpKindAux
+)
+
+// Notation is an operator printing form.
+type Notation int
+
+const (
+	// NotationNone is a special syntax, like a call or a statement.
+	NotationNone Notation = iota
+
+	// NotationPrefix is a Symbol $Args[0] form.
+	// Words, like 'clone', are separated from the operand by a space.
+	NotationPrefix
+
+	// NotationPostfix is a $Args[0] Symbol form.
+	NotationPostfix
+
+	// NotationBinary is a $Args[0] Symbol $Args[1] form.
+	NotationBinary
+)
+
+// Precedence is a PHP operator precedence level.
+// Levels are ordered from the loosest binding to the tightest.
+// See https://www.php.net/manual/en/language.operators.precedence.php
+type Precedence int
+
+const (
+	PrecNone Precedence = iota
+	PrecThrow
+	PrecOrWord
+	PrecXorWord
+	PrecAndWord
+	PrecPrint
+	PrecYield
+	PrecYieldFrom
+	PrecAssign
+	PrecTernary
+	PrecNullCoalesce
+	PrecOr
+	PrecAnd
+	PrecBitOr
+	PrecBitXor
+	PrecBitAnd
+	PrecEquality
+	PrecComparison
+	PrecConcat
+	PrecShift
+	PrecAdditive
+	PrecMultiplicative
+	PrecNot
+	PrecInstanceOf
+	PrecUnary
+	PrecExp
+	PrecNew
+	PrecAtom
+)
+
+// Assoc is an operator associativity.
+type Assoc int
+
+const (
+	AssocNone Assoc = iota
+	AssocLeft
+	AssocRight
+)
+
+// ResultKind is an expression result category.
+type ResultKind int
+
+const (
+	// ResultNone is used for the statements and the aux ops.
+	ResultNone ResultKind = iota
+
+	// ResultMixed means that the result depends on the node type
+	// or the operand types.
+	ResultMixed
+
+	ResultBool
+	ResultInt
+	ResultFloat
+
+	// ResultNumber is either int or float, depending on the operands.
+	ResultNumber
+
+	ResultString
+	ResultArray
+	ResultObject
+
+	// ResultNever is a result of expressions that don't return, like throw.
+	ResultNever
+)
+
+// GetOpInfo returns the op description.
+// It returns a zero OpInfo for unknown ops.
+func GetOpInfo(op Op) OpInfo {
+	if op < 0 || int(op) >= len(opInfoTable) {
+		return OpInfo{}
+	}
+	return opInfoTable[op]
+}
+
+func stmtOp(minArgs, maxArgs int) OpInfo {
+	return OpInfo{Kind: OpKindStmt, MinArgs: minArgs, MaxArgs: maxArgs}
+}
+
+func auxOp(symbol string, minArgs, maxArgs int) OpInfo {
+	return OpInfo{Kind: OpKindAux, Symbol: symbol, MinArgs: minArgs, MaxArgs: maxArgs}
+}
+
+func atomOp(minArgs, maxArgs int, result ResultKind) OpInfo {
+	return OpInfo{Kind: OpKindExpr, Precedence: PrecAtom, MinArgs: minArgs, MaxArgs: maxArgs, Result: result}
+}
+
+func prefixOp(symbol string, prec Precedence, result ResultKind) OpInfo {
+	return OpInfo{
+		Kind:       OpKindExpr,
+		Symbol:     symbol,
+		Notation:   NotationPrefix,
+		Precedence: prec,
+		Assoc:      AssocRight,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Result:     result,
+	}
+}
+
+func postfixOp(symbol string, prec Precedence, result ResultKind) OpInfo {
+	info := prefixOp(symbol, prec, result)
+	info.Notation = NotationPostfix
+	info.Assoc = AssocLeft
+	return info
+}
+
+func binaryOp(symbol string, prec Precedence, assoc Assoc, result ResultKind) OpInfo {
+	return OpInfo{
+		Kind:       OpKindExpr,
+		Symbol:     symbol,
+		Notation:   NotationBinary,
+		Precedence: prec,
+		Assoc:      assoc,
+		MinArgs:    2,
+		MaxArgs:    2,
+		Result:     result,
+	}
+}
+
+func compoundOp(info OpInfo) OpInfo {
+	info.CompoundAssign = true
+	return info
+}
+
+func withSymbol(info OpInfo, symbol string) OpInfo {
+	info.Symbol = symbol
+	return info
+}
+
+var opInfoTable = [...]OpInfo{
+	OpInvalid: {},
+
+	OpBad: atomOp(0, -1, ResultMixed),
+
+	OpBreak:       stmtOp(0, 0),
+	OpContinue:    stmtOp(0, 0),
+	OpIf:          stmtOp(2, 2),
+	OpIfElse:      stmtOp(3, 3),
+	OpSwitch:      stmtOp(1, -1),
+	OpCase:        auxOp("case", 1, -1),
+	OpDefaultCase: auxOp("default", 0, -1),
+	OpWhile:       stmtOp(2, 2),
+	OpDoWhile:     stmtOp(2, 2),
+	OpForeach:     stmtOp(4, 4),
+	OpFor:         stmtOp(4, 4),
+	OpExprList:    auxOp(",", 0, -1),
+	OpBlock:       stmtOp(0, -1),
+	OpTry:         stmtOp(1, -1),
+	OpCatch:       auxOp("catch", 2, 2),
+	OpFinally:     auxOp("finally", 1, 1),
+	OpReturn:      stmtOp(1, 1),
+	OpReturnVoid:  stmtOp(0, 0),
+	OpEcho:        stmtOp(0, -1),
+	OpStaticVar:   stmtOp(1, -1),
+	OpGlobal:      stmtOp(1, -1),
+	OpUnset:       stmtOp(1, -1),
+
+	// Throw is an expression since PHP 8.
+	OpThrow: prefixOp("throw", PrecThrow, ResultNever),
+
+	OpParens: atomOp(1, 1, ResultMixed),
+
+	OpAssign:       binaryOp("=", PrecAssign, AssocRight, ResultMixed),
+	OpAssignModify: binaryOp("", PrecAssign, AssocRight, ResultMixed),
+
+	OpBoolLit:            atomOp(0, 0, ResultBool),
+	OpIntLit:             atomOp(0, 0, ResultInt),
+	OpFloatLit:           atomOp(0, 0, ResultFloat),
+	OpStringLit:          atomOp(0, 0, ResultString),
+	OpInterpolatedString: atomOp(0, -1, ResultString),
+	OpArrayLit:           atomOp(0, -1, ResultArray),
+	OpKeyedElem:          auxOp("=>", 2, 2),
+	OpList:               atomOp(0, -1, ResultArray),
+	OpClosure:            atomOp(1, 1, ResultObject),
+
+	OpVar:        atomOp(0, 0, ResultMixed),
+	OpName:       atomOp(0, 0, ResultMixed),
+	OpConstFetch: atomOp(0, 0, ResultMixed),
+
+	OpProp:               withSymbol(atomOp(1, 2, ResultMixed), "->"),
+	OpNullsafeProp:       withSymbol(atomOp(1, 2, ResultMixed), "?->"),
+	OpMethodCall:         withSymbol(atomOp(1, -1, ResultMixed), "->"),
+	OpNullsafeMethodCall: withSymbol(atomOp(1, -1, ResultMixed), "?->"),
+	OpClassConst:         withSymbol(atomOp(1, 1, ResultMixed), "::"),
+	OpStaticProp:         withSymbol(atomOp(1, 1, ResultMixed), "::"),
+	OpStaticCall:         withSymbol(atomOp(1, -1, ResultMixed), "::"),
+	OpRelativeClass:      atomOp(0, 0, ResultNone),
+
+	// new and clone bind the tightest, but they still can't
+	// be dereferenced without parentheses, like (new Foo)->x.
+	OpNew:   {Kind: OpKindExpr, Symbol: "new", Precedence: PrecNew, Assoc: AssocRight, MinArgs: 1, MaxArgs: -1, Result: ResultObject},
+	OpClone: prefixOp("clone", PrecNew, ResultObject),
+
+	OpInstanceOf: binaryOp("instanceof", PrecInstanceOf, AssocNone, ResultBool),
+
+	OpExit:      atomOp(0, 1, ResultNever),
+	OpPrint:     prefixOp("print", PrecPrint, ResultInt),
+	OpYield:     {Kind: OpKindExpr, Symbol: "yield", Precedence: PrecYield, Assoc: AssocRight, MinArgs: 0, MaxArgs: 2, Result: ResultMixed},
+	OpYieldFrom: prefixOp("yield from", PrecYieldFrom, ResultMixed),
+
+	OpIndex: atomOp(2, 2, ResultMixed),
+
+	OpNegation:  prefixOp("-", PrecUnary, ResultNumber),
+	OpUnaryPlus: prefixOp("+", PrecUnary, ResultNumber),
+
+	OpConcat: compoundOp(binaryOp(".", PrecConcat, AssocLeft, ResultString)),
+	OpAdd:    compoundOp(binaryOp("+", PrecAdditive, AssocLeft, ResultNumber)),
+	OpSub:    compoundOp(binaryOp("-", PrecAdditive, AssocLeft, ResultNumber)),
+	OpDiv:    compoundOp(binaryOp("/", PrecMultiplicative, AssocLeft, ResultNumber)),
+	OpMul:    compoundOp(binaryOp("*", PrecMultiplicative, AssocLeft, ResultNumber)),
+	OpMod:    compoundOp(binaryOp("%", PrecMultiplicative, AssocLeft, ResultNumber)),
+	OpExp:    compoundOp(binaryOp("**", PrecExp, AssocRight, ResultNumber)),
+
+	OpAnd:     binaryOp("&&", PrecAnd, AssocLeft, ResultBool),
+	OpAndWord: binaryOp("and", PrecAndWord, AssocLeft, ResultBool),
+	OpOr:      binaryOp("||", PrecOr, AssocLeft, ResultBool),
+	OpOrWord:  binaryOp("or", PrecOrWord, AssocLeft, ResultBool),
+	OpXorWord: binaryOp("xor", PrecXorWord, AssocLeft, ResultBool),
+
+	OpTernary: {Kind: OpKindExpr, Symbol: "?", Precedence: PrecTernary, Assoc: AssocNone, MinArgs: 3, MaxArgs: 3, Result: ResultMixed},
+
+	OpCall:     atomOp(1, -1, ResultMixed),
+	OpNamedArg: auxOp(":", 1, 1),
+	OpSpread:   auxOp("...", 1, 1),
+	OpByRef:    auxOp("&", 1, 1),
+	OpIsset:    atomOp(1, -1, ResultBool),
+	OpEmpty:    atomOp(1, 1, ResultBool),
+
+	OpLess:           binaryOp("<", PrecComparison, AssocNone, ResultBool),
+	OpLessOrEqual:    binaryOp("<=", PrecComparison, AssocNone, ResultBool),
+	OpGreater:        binaryOp(">", PrecComparison, AssocNone, ResultBool),
+	OpGreaterOrEqual: binaryOp(">=", PrecComparison, AssocNone, ResultBool),
+	OpEqual2:         binaryOp("==", PrecEquality, AssocNone, ResultBool),
+	OpFloatEqual2:    binaryOp("==", PrecEquality, AssocNone, ResultBool),
+	OpEqual3:         binaryOp("===", PrecEquality, AssocNone, ResultBool),
+	OpFloatEqual3:    binaryOp("===", PrecEquality, AssocNone, ResultBool),
+	OpNotEqual2:      binaryOp("!=", PrecEquality, AssocNone, ResultBool),
+	OpNotFloatEqual2: binaryOp("!=", PrecEquality, AssocNone, ResultBool),
+	OpNotEqual3:      binaryOp("!==", PrecEquality, AssocNone, ResultBool),
+	OpNotFloatEqual3: binaryOp("!==", PrecEquality, AssocNone, ResultBool),
+	OpSpaceship:      binaryOp("<=>", PrecEquality, AssocNone, ResultInt),
+
+	// Increments of strings and nulls don't give numbers.
+	OpPostInc: postfixOp("++", PrecUnary, ResultMixed),
+	OpPreInc:  prefixOp("++", PrecUnary, ResultMixed),
+	OpPostDec: postfixOp("--", PrecUnary, ResultMixed),
+	OpPreDec:  prefixOp("--", PrecUnary, ResultMixed),
+
+	// The cast type is printed as the operator.
+	OpCast: prefixOp("", PrecUnary, ResultMixed),
+
+	OpErrorSuppress: prefixOp("@", PrecUnary, ResultMixed),
+	OpNot:           prefixOp("!", PrecNot, ResultBool),
+
+	OpBitAnd:        compoundOp(binaryOp("&", PrecBitAnd, AssocLeft, ResultInt)),
+	OpBitOr:         compoundOp(binaryOp("|", PrecBitOr, AssocLeft, ResultInt)),
+	OpBitXor:        compoundOp(binaryOp("^", PrecBitXor, AssocLeft, ResultInt)),
+	OpBitNot:        prefixOp("~", PrecUnary, ResultInt),
+	OpBitShiftLeft:  compoundOp(binaryOp("<<", PrecShift, AssocLeft, ResultInt)),
+	OpBitShiftRight: compoundOp(binaryOp(">>", PrecShift, AssocLeft, ResultInt)),
+	OpNullCoalesce:  compoundOp(binaryOp("??", PrecNullCoalesce, AssocRight, ResultMixed)),
+}
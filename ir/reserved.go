@@ -0,0 +1,113 @@
+package ir
+
+import (
+	"strings"
+)
+
+// reservedNames contains lowercased PHP keywords, magic constants
+// and reserved type names that can't be used as identifiers.
+var reservedNames = map[string]struct{}{
+	"__halt_compiler": {},
+	"abstract":        {},
+	"and":             {},
+	"array":           {},
+	"as":              {},
+	"break":           {},
+	"callable":        {},
+	"case":            {},
+	"catch":           {},
+	"class":           {},
+	"clone":           {},
+	"const":           {},
+	"continue":        {},
+	"declare":         {},
+	"default":         {},
+	"die":             {},
+	"do":              {},
+	"echo":            {},
+	"else":            {},
+	"elseif":          {},
+	"empty":           {},
+	"enddeclare":      {},
+	"endfor":          {},
+	"endforeach":      {},
+	"endif":           {},
+	"endswitch":       {},
+	"endwhile":        {},
+	"enum":            {},
+	"eval":            {},
+	"exit":            {},
+	"extends":         {},
+	"final":           {},
+	"finally":         {},
+	"fn":              {},
+	"for":             {},
+	"foreach":         {},
+	"function":        {},
+	"global":          {},
+	"goto":            {},
+	"if":              {},
+	"implements":      {},
+	"include":         {},
+	"include_once":    {},
+	"instanceof":      {},
+	"insteadof":       {},
+	"interface":       {},
+	"isset":           {},
+	"list":            {},
+	"match":           {},
+	"namespace":       {},
+	"new":             {},
+	"or":              {},
+	"print":           {},
+	"private":         {},
+	"protected":       {},
+	"public":          {},
+	"readonly":        {},
+	"require":         {},
+	"require_once":    {},
+	"return":          {},
+	"static":          {},
+	"switch":          {},
+	"throw":           {},
+	"trait":           {},
+	"try":             {},
+	"unset":           {},
+	"use":             {},
+	"var":             {},
+	"while":           {},
+	"xor":             {},
+	"yield":           {},
+
+	"__class__":     {},
+	"__dir__":       {},
+	"__file__":      {},
+	"__function__":  {},
+	"__line__":      {},
+	"__method__":    {},
+	"__namespace__": {},
+	"__trait__":     {},
+
+	"bool":     {},
+	"false":    {},
+	"float":    {},
+	"int":      {},
+	"iterable": {},
+	"mixed":    {},
+	"never":    {},
+	"null":     {},
+	"object":   {},
+	"parent":   {},
+	"self":     {},
+	"string":   {},
+	"true":     {},
+	"void":     {},
+}
+
+// IsReservedName reports whether name can't be used
+// as a constant, function or class name.
+// PHP keywords are case-insensitive, so is this check.
+func IsReservedName(name string) bool {
+	_, ok := reservedNames[strings.ToLower(name)]
+	return ok
+}
@@ -1,6 +1,9 @@
 package ir
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type Type interface {
 	String() string
@@ -13,13 +16,28 @@ var (
 	FloatType  = &ScalarType{Kind: ScalarFloat}
 	StringType = &ScalarType{Kind: ScalarString}
 	MixedType  = &ScalarType{Kind: ScalarMixed}
+	NullType   = &ScalarType{Kind: ScalarNull}
 )
 
 type TypeField struct {
 	Name   string
 	Type   Type
 	Strict bool
-	Init   interface{}
+
+	// ByRef marks a parameter that is passed by reference, like &$x.
+	ByRef bool
+
+	// Variadic marks a parameter that collects the rest arguments, like ...$xs.
+	// Type is the element type of a variadic parameter.
+	Variadic bool
+
+	// Default is an optional parameter default value, like $x = 10.
+	// It should be a constant expression, see IsConstExpr.
+	Default *Node
+
+	// Min and Max limit the int argument values if Max is not zero,
+	// like the str_repeat count.
+	Min, Max int64
 }
 
 type ScalarKind int
@@ -32,6 +50,7 @@ const (
 	ScalarFloat
 	ScalarString
 	ScalarMixed
+	ScalarNull
 )
 
 func (k ScalarKind) String() string {
@@ -46,6 +65,10 @@ func (k ScalarKind) String() string {
 		return "float"
 	case ScalarString:
 		return "string"
+	case ScalarMixed:
+		return "mixed"
+	case ScalarNull:
+		return "null"
 	default:
 		return "?"
 	}
@@ -59,16 +82,27 @@ type ClassType struct {
 	Name string
 }
 
+// ObjectType is a type of any object, including closures.
+type ObjectType struct{}
+
+// UnionType is a type that permits values of any of its member types.
+// Types are listed in the order they should be printed.
 type UnionType struct {
-	X Type
-	Y Type
+	Types []Type
 }
 
+// NullableType is a type that permits null in addition to X values.
 type NullableType struct {
 	X Type
 }
 
+// ArrayType is a type of arrays with Elem values.
+// Key is nil for lists, otherwise it's the keys type, like string
+// for the associative arrays.
+// As the TypesCompatible dst, nil Key accepts any keys
+// and nil Elem accepts any values, like the array type hint.
 type ArrayType struct {
+	Key  Type
 	Elem Type
 }
 
@@ -82,6 +116,51 @@ type FuncType struct {
 	MinArgsNum int
 	Result     Type
 	NeedCast   bool
+
+	// Impure marks the functions with results that depend
+	// on the environment, like file_exists.
+	Impure bool
+
+	// MinPHPVersion is the PHP version that introduced the function,
+	// in the PHP_VERSION_ID format; zero means any version.
+	MinPHPVersion int
+}
+
+// CheckParams reports an error if function params can't be declared in PHP:
+//   - only the last param can be variadic and it can't have a default value;
+//   - defaults should be constant expressions;
+//   - params with defaults can't be followed by the required params,
+//     unless the default is null (it's an implicitly nullable param).
+func (typ *FuncType) CheckParams() error {
+	optional := ""
+	for i, param := range typ.Params {
+		if param.Variadic {
+			if i != len(typ.Params)-1 {
+				return fmt.Errorf("%s: variadic $%s is not the last param", typ.Name, param.Name)
+			}
+			if param.Default != nil {
+				return fmt.Errorf("%s: variadic $%s has a default value", typ.Name, param.Name)
+			}
+			continue
+		}
+		if param.Default == nil {
+			if optional != "" {
+				return fmt.Errorf("%s: required $%s follows optional $%s", typ.Name, param.Name, optional)
+			}
+			continue
+		}
+		if !IsConstExpr(param.Default) {
+			return fmt.Errorf("%s: $%s default is not a constant expression", typ.Name, param.Name)
+		}
+		if !isNullLit(param.Default) && optional == "" {
+			optional = param.Name
+		}
+	}
+	return nil
+}
+
+func isNullLit(n *Node) bool {
+	return n.Op == OpName && strings.EqualFold(n.Value.(string), "null")
 }
 
 type EnumType struct {
@@ -97,16 +176,28 @@ func (typ *ClassType) String() string {
 	return typ.Name
 }
 
+func (typ *ObjectType) String() string {
+	return "object"
+}
+
 func (typ *UnionType) String() string {
-	return "(" + typ.X.String() + "|" + typ.Y.String() + ")"
+	parts := make([]string, len(typ.Types))
+	for i, x := range typ.Types {
+		parts[i] = x.String()
+	}
+	return strings.Join(parts, "|")
 }
 
 func (typ *NullableType) String() string {
-	return "(?" + typ.X.String() + ")"
+	return "?" + typ.X.String()
 }
 
 func (typ *ArrayType) String() string {
-	return "(" + typ.Elem.String() + "[])"
+	return "array"
+}
+
+func (typ *FuncType) String() string {
+	return "callable"
 }
 
 func (typ *EnumType) String() string {
@@ -114,9 +205,37 @@ func (typ *EnumType) String() string {
 }
 
 func (typ *TupleType) String() string {
-	parts := make([]string, len(typ.Elems))
-	for i, e := range typ.Elems {
-		parts[i] = e.String()
+	return "array"
+}
+
+// TypeDocString returns a phpdoc type for typ, like int[] or array<string, float>.
+// Unlike the String methods that use the PHP type declaration syntax,
+// it describes the array keys and elems.
+func TypeDocString(typ Type) string {
+	switch typ := typ.(type) {
+	case *ArrayType:
+		if typ.Elem == nil {
+			return "array"
+		}
+		if typ.Key != nil {
+			return "array<" + TypeDocString(typ.Key) + ", " + TypeDocString(typ.Elem) + ">"
+		}
+		return "(" + TypeDocString(typ.Elem) + "[])"
+	case *TupleType:
+		parts := make([]string, len(typ.Elems))
+		for i, e := range typ.Elems {
+			parts[i] = TypeDocString(e)
+		}
+		return "tuple(" + strings.Join(parts, ",") + ")"
+	case *NullableType:
+		return "?" + TypeDocString(typ.X)
+	case *UnionType:
+		parts := make([]string, len(typ.Types))
+		for i, x := range typ.Types {
+			parts[i] = TypeDocString(x)
+		}
+		return strings.Join(parts, "|")
+	default:
+		return typ.String()
 	}
-	return "tuple(" + strings.Join(parts, ",") + ")"
 }
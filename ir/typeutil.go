@@ -0,0 +1,253 @@
+package ir
+
+// TypesIdentical reports whether t1 and t2 describe the same type.
+// Two nil types are identical.
+func TypesIdentical(t1, t2 Type) bool {
+	if t1 == nil || t2 == nil {
+		return t1 == nil && t2 == nil
+	}
+
+	switch t1 := t1.(type) {
+	case *ScalarType:
+		t2, ok := t2.(*ScalarType)
+		return ok && t1.Kind == t2.Kind
+
+	case *ClassType:
+		t2, ok := t2.(*ClassType)
+		return ok && t1.Name == t2.Name
+
+	case *ObjectType:
+		_, ok := t2.(*ObjectType)
+		return ok
+
+	case *EnumType:
+		t2, ok := t2.(*EnumType)
+		if !ok || len(t1.Values) != len(t2.Values) || !TypesIdentical(t1.ValueType, t2.ValueType) {
+			return false
+		}
+		for i, v1 := range t1.Values {
+			// Float values can be NaN, see valuesEqual.
+			if !valuesEqual(v1, t2.Values[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *NullableType:
+		t2, ok := t2.(*NullableType)
+		return ok && TypesIdentical(t1.X, t2.X)
+
+	case *ArrayType:
+		t2, ok := t2.(*ArrayType)
+		return ok && TypesIdentical(t1.Key, t2.Key) && TypesIdentical(t1.Elem, t2.Elem)
+
+	case *TupleType:
+		t2, ok := t2.(*TupleType)
+		return ok && typeListsIdentical(t1.Elems, t2.Elems)
+
+	case *UnionType:
+		t2, ok := t2.(*UnionType)
+		return ok && typeListsIdentical(t1.Types, t2.Types)
+
+	case *FuncType:
+		t2, ok := t2.(*FuncType)
+		if !ok || len(t1.Params) != len(t2.Params) || !TypesIdentical(t1.Result, t2.Result) {
+			return false
+		}
+		for i, p1 := range t1.Params {
+			p2 := t2.Params[i]
+			if p1.ByRef != p2.ByRef || p1.Variadic != p2.Variadic || !TypesIdentical(p1.Type, p2.Type) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+func typeListsIdentical(list1, list2 []Type) bool {
+	if len(list1) != len(list2) {
+		return false
+	}
+	for i, x := range list1 {
+		if !TypesIdentical(x, list2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TypesCompatible reports whether a value of the src type can be
+// used where the dst type is expected, like a dst param argument,
+// in the strict_types=1 mode.
+//
+// Classes are only compatible with themselves, since the class
+// hierarchy is not known here.
+func TypesCompatible(dst, src Type) bool {
+	if TypesIdentical(dst, src) {
+		return true
+	}
+	if dst == nil || src == nil {
+		return false
+	}
+
+	if src, ok := src.(*UnionType); ok {
+		for _, x := range src.Types {
+			if !TypesCompatible(dst, x) {
+				return false
+			}
+		}
+		return len(src.Types) != 0
+	}
+
+	switch dst := dst.(type) {
+	case *ScalarType:
+		switch dst.Kind {
+		case ScalarMixed:
+			return !isScalarKind(src, ScalarVoid)
+		case ScalarFloat:
+			// Int to float is the only permitted strict mode coercion.
+			return isScalarKind(src, ScalarInt) || isEnumOf(src, ScalarInt) || isEnumOf(src, ScalarFloat)
+		case ScalarVoid:
+			return false
+		default:
+			return isEnumOf(src, dst.Kind)
+		}
+
+	case *NullableType:
+		if isScalarKind(src, ScalarNull) {
+			return true
+		}
+		if src, ok := src.(*NullableType); ok {
+			return TypesCompatible(dst.X, src.X)
+		}
+		return TypesCompatible(dst.X, src)
+
+	case *UnionType:
+		for _, x := range dst.Types {
+			if TypesCompatible(x, src) {
+				return true
+			}
+		}
+		return false
+
+	case *EnumType:
+		src, ok := src.(*EnumType)
+		if !ok || !TypesIdentical(dst.ValueType, src.ValueType) {
+			return false
+		}
+		for _, v := range src.Values {
+			if !containsValue(dst.Values, v) {
+				return false
+			}
+		}
+		return true
+
+	case *ArrayType:
+		src, ok := src.(*ArrayType)
+		if !ok {
+			return false
+		}
+		// A nil dst key or elem accepts any keys or elems.
+		if dst.Key != nil {
+			// Lists have int keys.
+			srcKey := src.Key
+			if srcKey == nil {
+				srcKey = IntType
+			}
+			if !TypesCompatible(dst.Key, srcKey) {
+				return false
+			}
+		}
+		return dst.Elem == nil || TypesCompatible(dst.Elem, src.Elem)
+
+	case *TupleType:
+		src, ok := src.(*TupleType)
+		if !ok || len(dst.Elems) != len(src.Elems) {
+			return false
+		}
+		for i, x := range dst.Elems {
+			if !TypesCompatible(x, src.Elems[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *ObjectType:
+		switch src.(type) {
+		case *ClassType, *FuncType:
+			return true
+		default:
+			return false
+		}
+
+	case *FuncType:
+		src, ok := src.(*FuncType)
+		if !ok {
+			return false
+		}
+		if len(dst.Params) == 0 && dst.Result == nil {
+			// This is a callable that accepts any function, see LookupType.
+			return true
+		}
+		if len(dst.Params) != len(src.Params) {
+			return false
+		}
+		for i, p := range dst.Params {
+			q := src.Params[i]
+			if p.ByRef != q.ByRef || p.Variadic != q.Variadic || !TypesIdentical(p.Type, q.Type) {
+				return false
+			}
+		}
+		// A nil dst result means that any result is accepted.
+		return dst.Result == nil || TypesCompatible(dst.Result, src.Result)
+
+	default:
+		return false
+	}
+}
+
+func isScalarKind(typ Type, kind ScalarKind) bool {
+	scalar, ok := typ.(*ScalarType)
+	return ok && scalar.Kind == kind
+}
+
+// isEnumOf reports whether typ is an enum of the kind values.
+func isEnumOf(typ Type, kind ScalarKind) bool {
+	enum, ok := typ.(*EnumType)
+	return ok && enum.ValueType.Kind == kind
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, x := range values {
+		if valuesEqual(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeNames maps the PHP type declaration keywords to the types.
+// The scalar type names match their ScalarKind spelling.
+var typeNames = map[string]Type{
+	"bool":     BoolType,
+	"int":      IntType,
+	"float":    FloatType,
+	"string":   StringType,
+	"mixed":    MixedType,
+	"void":     VoidType,
+	"null":     NullType,
+	"object":   &ObjectType{},
+	"array":    &ArrayType{},
+	"callable": &FuncType{},
+}
+
+// LookupType returns a type for the PHP type declaration keyword,
+// like "int" or "callable".
+// The returned types are shared and should not be modified.
+func LookupType(name string) (Type, bool) {
+	typ, ok := typeNames[name]
+	return typ, ok
+}
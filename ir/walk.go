@@ -0,0 +1,124 @@
+package ir
+
+// Walk traverses the n tree in pre-order.
+// If fn returns false, the node children are not visited.
+//
+// All node children are stored in Args, so the traversal doesn't
+// depend on the node op. Nil args (like a foreach without a key
+// or a short ternary middle operand) are skipped.
+func Walk(n *Node, fn func(*Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	for _, arg := range n.Args {
+		Walk(arg, fn)
+	}
+}
+
+// Inspect calls fn for every node of the n tree in pre-order.
+// Unlike Walk, it always visits the node children.
+func Inspect(n *Node, fn func(*Node)) {
+	Walk(n, func(n *Node) bool {
+		fn(n)
+		return true
+	})
+}
+
+// WalkRoot calls Walk for every node tree of the n root node:
+// declaration values, statements, function param defaults and bodies,
+// attribute args, class constants, property defaults, methods and enum cases.
+// Roots that have no node trees, like RootRequire, are ignored.
+func WalkRoot(n RootNode, fn func(*Node) bool) {
+	switch n := n.(type) {
+	case *RootDeclare:
+		Walk(n.Value, fn)
+	case *RootStmt:
+		Walk(n.X, fn)
+	case *RootConstDecl:
+		Walk(n.Value, fn)
+	case *RootFuncDecl:
+		walkFunc(n, fn)
+	case *RootClassDecl:
+		walkAttributes(n.Attributes, fn)
+		walkClassConsts(n.Consts, fn)
+		for _, prop := range n.Props {
+			Walk(prop.Default, fn)
+		}
+		walkClassMethods(n.Methods, fn)
+	case *RootInterfaceDecl:
+		walkAttributes(n.Attributes, fn)
+		walkClassConsts(n.Consts, fn)
+		walkClassMethods(n.Methods, fn)
+	case *RootTraitDecl:
+		walkAttributes(n.Attributes, fn)
+		for _, prop := range n.Props {
+			Walk(prop.Default, fn)
+		}
+		walkClassMethods(n.Methods, fn)
+	case *RootEnumDecl:
+		walkAttributes(n.Attributes, fn)
+		for _, c := range n.Cases {
+			Walk(c.Value, fn)
+		}
+		walkClassConsts(n.Consts, fn)
+		walkClassMethods(n.Methods, fn)
+	}
+}
+
+// WalkFile calls WalkRoot for every f root node.
+func WalkFile(f *File, fn func(*Node) bool) {
+	for _, n := range f.Nodes {
+		WalkRoot(n, fn)
+	}
+}
+
+func walkFunc(decl *RootFuncDecl, fn func(*Node) bool) {
+	walkAttributes(decl.Attributes, fn)
+	if decl.Type != nil {
+		for _, param := range decl.Type.Params {
+			Walk(param.Default, fn)
+		}
+	}
+	Walk(decl.Body, fn)
+}
+
+func walkAttributes(attrs []Attribute, fn func(*Node) bool) {
+	for _, attr := range attrs {
+		for _, arg := range attr.Args {
+			Walk(arg, fn)
+		}
+	}
+}
+
+func walkClassConsts(consts []*ClassConst, fn func(*Node) bool) {
+	for _, c := range consts {
+		Walk(c.Value, fn)
+	}
+}
+
+func walkClassMethods(methods []*ClassMethod, fn func(*Node) bool) {
+	for _, m := range methods {
+		walkFunc(m.Func, fn)
+	}
+}
+
+// Rewrite rebuilds the n tree bottom-up, replacing every node with
+// the fn result. The fn argument is a shallow copy of the original
+// node with its args already rewritten, so fn can either modify and
+// return it or return a different node.
+//
+// The n tree is not modified; values and types are shared
+// with the result, see Node.Clone for a deep copy.
+func Rewrite(n *Node, fn func(*Node) *Node) *Node {
+	if n == nil {
+		return nil
+	}
+	rebuilt := &Node{Op: n.Op, Value: n.Value, Type: n.Type}
+	if n.Args != nil {
+		rebuilt.Args = make([]*Node, len(n.Args))
+		for i, arg := range n.Args {
+			rebuilt.Args[i] = Rewrite(arg, fn)
+		}
+	}
+	return fn(rebuilt)
+}
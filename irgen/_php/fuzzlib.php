@@ -1,25 +1,106 @@
 <?php
 
+/** @var string */
+$observe_mode = 'full';
+
+/** @var string */
+$observed_values = '';
+
+// The float division by zero throws in PHP 8,
+// so the special values are produced by math functions.
 function make_positive_inf(): float {
-    $x = 1.0;
-    $y = 0.0;
-    return $x / $y;
+    return -log(0.0);
 }
 
 function make_negative_inf(): float {
-    $x = -1.0;
-    $y = 0.0;
-    return $x / $y;
+    return log(0.0);
 }
 
 function make_nan(): float {
-    $x = 0.0;
-    $y = 0.0;
-    return $x / $y;
+    return acos(2.0);
 }
 
 function dump_with_pos($file, $line, $v) {
+    global $observe_mode;
+    if ($observe_mode === 'full') {
+        var_dump(["$file:$line" => $v]);
+        return;
+    }
+    // The file path depends on the output dir, so it's not hashed.
+    $file = basename($file);
+    ob_start();
     var_dump(["$file:$line" => $v]);
+    observe(ob_get_clean());
+}
+
+/**
+ * The mode is "full", "hash" or "both". The "full" mode prints
+ * the observed values, the "hash" mode collects them to print
+ * only their hash with observe_finish.
+ *
+ * @param string $mode
+ */
+function observe_start($mode) {
+    global $observe_mode;
+    $observe_mode = $mode;
+}
+
+/**
+ * @param int $seed
+ */
+function observe_finish($seed) {
+    global $observe_mode, $observed_values;
+    if ($observe_mode !== 'full') {
+        echo "seed $seed: " . md5($observed_values) . "\n";
+    }
+}
+
+/**
+ * @param string $s
+ */
+function observe($s) {
+    global $observe_mode, $observed_values;
+    if ($observe_mode !== 'hash') {
+        echo $s;
+    }
+    if ($observe_mode !== 'full') {
+        $observed_values .= $s;
+    }
+}
+
+/**
+ * @param string $name
+ * @param bool $v
+ */
+function observe_bool($name, $v) {
+    observe("$name = " . ($v ? 'bool(true)' : 'bool(false)') . "\n");
+}
+
+/**
+ * @param string $name
+ * @param int $v
+ */
+function observe_int($name, $v) {
+    observe("$name = int($v)\n");
+}
+
+/**
+ * @param string $name
+ * @param float $v
+ */
+function observe_float($name, $v) {
+    observe(sprintf("%s = float(%.17g)\n", $name, $v));
+}
+
+/**
+ * The string length is printed as a delimiter, so
+ * the strings with newlines can't be confused.
+ *
+ * @param string $name
+ * @param string $v
+ */
+function observe_string($name, $v) {
+    observe("$name = string(" . strlen($v) . ") $v\n");
 }
 
 /**
@@ -66,7 +147,7 @@ function _safe_float_div($x, $y) {
         } catch (\Throwable $e) {
         }
     }
-    echo "invalid argument in /\n";
+    observe("invalid argument in /\n");
     return 0.0;
 }
 
@@ -81,7 +162,7 @@ function _safe_int_div($x, $y) {
         } catch (\Throwable $e) {
         }
     }
-    echo "invalid argument in /\n";
+    observe("invalid argument in /\n");
     return 0;
 }
 
@@ -93,11 +174,11 @@ function _safe_int_div($x, $y) {
 function _safe_float_mod($x, $y) {
     if ($y > 0.0 || $y < 0.0) {
         try {
-            return $x % $y;
+            return fmod($x, $y);
         } catch (\Throwable $e) {
         }
     }
-    echo "invalid argument in %\n";
+    observe("invalid argument in %\n");
     return 0.0;
 }
 
@@ -112,6 +193,21 @@ function _safe_int_mod($x, $y) {
         } catch (\Throwable $e) {
         }
     }
-    echo "invalid argument in %\n";
+    observe("invalid argument in %\n");
     return 0;
-}
\ No newline at end of file
+}
+
+/**
+ * The $want value is computed by the generator,
+ * a mismatch means that either the generator or
+ * the PHP implementation is wrong.
+ *
+ * @param string $name
+ * @param mixed $v
+ * @param mixed $want
+ */
+function self_check($name, $v, $want) {
+    if ($v !== $want) {
+        observe("$name: self-check failed\n");
+    }
+}
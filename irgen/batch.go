@@ -0,0 +1,44 @@
+package irgen
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// GenerateBatch creates n programs from the baseSeed+i seeds
+// like CreateProgramFromSeed, the i-th program uses the baseSeed+i seed.
+// The programs are generated in parallel by up to GOMAXPROCS goroutines.
+//
+// Every program has its own generator and Rand, the config Rand is
+// ignored. The config itself and the builtins it refers to are only
+// read, so it can be shared by the concurrent GenerateBatch calls too.
+//
+// If the ctx is done, the unfinished programs are completed
+// like in CreateProgramContext and the ctx error is returned.
+func GenerateBatch(ctx context.Context, baseSeed int64, n int, config *Config) ([]*Program, error) {
+	programs := make([]*Program, n)
+	numWorkers := runtime.GOMAXPROCS(0)
+	if numWorkers > n {
+		numWorkers = n
+	}
+
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				programs[i], _ = createSeededProgram(ctx, baseSeed+int64(i), *config)
+			}
+		}()
+	}
+	for i := range programs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return programs, ctx.Err()
+}
@@ -1,8 +1,10 @@
 package irgen
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"sort"
 
 	"github.com/quasilyte/phpsmith/ir"
 	"github.com/quasilyte/phpsmith/randutil"
@@ -11,6 +13,8 @@ import (
 type exprGenerator struct {
 	config *Config
 
+	features *phpFeatures
+
 	rand *rand.Rand
 
 	valueGenerator *valueGenerator
@@ -19,7 +23,29 @@ type exprGenerator struct {
 
 	symtab *symbolTable
 
+	// exprDepth is the current expression nesting level.
+	// exprNodes is the number of subexpressions generated
+	// since the outermost expression was entered.
 	exprDepth int
+	exprNodes int
+
+	// totalExprs is the number of subexpressions generated so far.
+	// The stopped flag is set when it reaches MaxTotalExprs or the
+	// ctx is done, only the leaf expressions are generated after that.
+	ctx        context.Context
+	totalExprs int
+	stopped    bool
+
+	// exprVars are the variables referenced by the current outermost
+	// expression, the mapped value tells whether it was modified.
+	// A variable is either modified once or only read inside
+	// a single expression since PHP doesn't guarantee
+	// the operands evaluation order.
+	exprVars map[string]bool
+
+	// recursionDepth generates the depth argument of the recursive
+	// function calls; these calls are not generated if it's nil.
+	recursionDepth func() *ir.Node
 
 	condChoices   exprChoiceList
 	boolChoices   exprChoiceList
@@ -35,41 +61,63 @@ type exprChoiceList struct {
 }
 
 type exprChoice struct {
+	name     string
 	freq     int
 	generate func() *ir.Node
 	fallback func() *ir.Node
 }
 
-func newExprGenerator(config *Config, s *scope, symtab *symbolTable) *exprGenerator {
+// maxChoiceAttempts is the number of options chooseExpr tries
+// before resorting to the choice list fallback.
+const maxChoiceAttempts = 10
+
+// makeChoicesList creates a choice list from the options.
+// The fallback must always succeed, it's used when the options
+// can't produce a value; makeChoicesList panics if it's nil.
+//
+// The weights override the options freq for the typ choice list,
+// makeChoicesList panics if they disable all of its options.
+func makeChoicesList(typ string, weights map[ExprChoice]int, fallback func() *ir.Node, options []exprChoice) exprChoiceList {
+	if fallback == nil {
+		panic("choice list without a fallback")
+	}
+	indexes := make([]uint16, 0, len(options)*4)
+	for i, o := range options {
+		freq := o.freq
+		if w, ok := weights[ExprChoice{Type: typ, Name: o.name}]; ok {
+			freq = w
+		}
+		for j := 0; j < freq; j++ {
+			indexes = append(indexes, uint16(i))
+		}
+	}
+	if len(options) != 0 && len(indexes) == 0 {
+		panic(fmt.Sprintf("all %s expression choices are disabled", typ))
+	}
+	return exprChoiceList{
+		indexMap: indexes,
+		options:  options,
+		fallback: fallback,
+	}
+}
+
+func newExprGenerator(config *Config, features *phpFeatures, s *scope, symtab *symbolTable) *exprGenerator {
 	g := &exprGenerator{
 		config:         config,
+		ctx:            context.Background(),
+		features:       features,
 		scope:          s,
 		symtab:         symtab,
 		rand:           config.Rand,
-		valueGenerator: newValueGenerator(config.Rand),
-	}
-
-	makeChoicesList := func(fallback func() *ir.Node, options []exprChoice) exprChoiceList {
-		indexes := make([]uint16, 0, len(options)*4)
-		for i, o := range options {
-			for j := 0; j < o.freq; j++ {
-				indexes = append(indexes, uint16(i))
-			}
-		}
-		return exprChoiceList{
-			indexMap: indexes,
-			options:  options,
-			fallback: fallback,
-		}
+		valueGenerator: newValueGenerator(config),
+		exprVars:       make(map[string]bool),
 	}
 
 	cmpOpGenerator := func(op ir.Op) func() *ir.Node {
 		return func() *ir.Node {
-			typ := g.PickScalarType()
-			x := g.GenerateValueOfType(typ)
-			y := g.GenerateValueOfType(typ)
+			x, y, isFloat := g.cmpOperands()
 			resultOp := op
-			if scalarType, ok := typ.(*ir.ScalarType); ok && scalarType.Kind == ir.ScalarFloat {
+			if isFloat {
 				switch resultOp {
 				case ir.OpEqual2:
 					resultOp = ir.OpFloatEqual2
@@ -81,7 +129,7 @@ func newExprGenerator(config *Config, s *scope, symtab *symbolTable) *exprGenera
 					resultOp = ir.OpNotFloatEqual3
 				}
 			}
-			return &ir.Node{Op: resultOp, Args: []*ir.Node{g.maybeAddParens(x), g.maybeAddParens(y)}}
+			return &ir.Node{Op: resultOp, Args: []*ir.Node{x, y}}
 		}
 	}
 
@@ -107,86 +155,165 @@ func newExprGenerator(config *Config, s *scope, symtab *symbolTable) *exprGenera
 		}
 	}
 
-	g.condChoices = makeChoicesList(g.boolLit, []exprChoice{
-		{freq: 3, generate: cmpOpGenerator(ir.OpEqual2)},
-		{freq: 3, generate: cmpOpGenerator(ir.OpEqual3)},
-		{freq: 4, generate: binaryOpGenerator(ir.OpAnd, nil, g.boolValue)},
-		{freq: 4, generate: binaryOpGenerator(ir.OpOr, nil, g.boolValue)},
-		{freq: 4, generate: unaryOpGenerator(ir.OpNot, g.condValue)},
-		{freq: 5, generate: g.boolVar, fallback: g.boolLit},
-		{freq: 6, generate: g.boolCall},
-		{freq: 1, generate: g.boolLit},
+	g.condChoices = makeChoicesList("cond", config.ExprWeights, g.boolLit, []exprChoice{
+		{name: "equal2", freq: 3, generate: cmpOpGenerator(ir.OpEqual2)},
+		{name: "equal3", freq: 3, generate: cmpOpGenerator(ir.OpEqual3)},
+		{name: "not_equal2", freq: 1, generate: cmpOpGenerator(ir.OpNotEqual2)},
+		{name: "not_equal3", freq: 1, generate: cmpOpGenerator(ir.OpNotEqual3)},
+		{name: "less", freq: 2, generate: cmpOpGenerator(ir.OpLess)},
+		{name: "less_or_equal", freq: 1, generate: cmpOpGenerator(ir.OpLessOrEqual)},
+		{name: "greater", freq: 2, generate: cmpOpGenerator(ir.OpGreater)},
+		{name: "greater_or_equal", freq: 1, generate: cmpOpGenerator(ir.OpGreaterOrEqual)},
+		{name: "spaceship", freq: 1, generate: g.spaceshipCmp},
+		{name: "and", freq: 4, generate: binaryOpGenerator(ir.OpAnd, nil, g.boolValue)},
+		{name: "or", freq: 4, generate: binaryOpGenerator(ir.OpOr, nil, g.boolValue)},
+		{name: "not", freq: 4, generate: unaryOpGenerator(ir.OpNot, g.condValue)},
+		{name: "var", freq: 5, generate: g.boolVar, fallback: g.boolLit},
+		{name: "call", freq: 6, generate: g.boolCall},
+		{name: "lit", freq: 1, generate: g.boolLit},
+	})
+
+	g.boolChoices = makeChoicesList("bool", config.ExprWeights, g.boolLit, []exprChoice{
+		{name: "equal2", freq: 1, generate: cmpOpGenerator(ir.OpEqual2)},
+		{name: "equal3", freq: 1, generate: cmpOpGenerator(ir.OpEqual3)},
+		{name: "not_equal3", freq: 1, generate: cmpOpGenerator(ir.OpNotEqual3)},
+		{name: "less", freq: 1, generate: cmpOpGenerator(ir.OpLess)},
+		{name: "greater_or_equal", freq: 1, generate: cmpOpGenerator(ir.OpGreaterOrEqual)},
+		{name: "spaceship", freq: 1, generate: g.spaceshipCmp},
+		{name: "ternary", freq: 1, generate: g.boolTernary},
+		{name: "short_ternary", freq: 1, generate: func() *ir.Node { return g.shortTernary(ir.BoolType) }},
+		{name: "and", freq: 3, generate: binaryOpGenerator(ir.OpAnd, nil, g.boolValue)},
+		{name: "or", freq: 3, generate: binaryOpGenerator(ir.OpOr, nil, g.boolValue)},
+		{name: "not", freq: 4, generate: unaryOpGenerator(ir.OpNot, g.condValue)},
+		{name: "var", freq: 6, generate: g.boolVar, fallback: g.boolLit},
+		{name: "array_index", freq: 1, generate: func() *ir.Node { return g.arrayIndex(ir.BoolType) }},
+		{name: "closure_call", freq: 1, generate: func() *ir.Node { return g.closureCall(ir.BoolType) }},
+		{name: "lit", freq: 3, generate: g.boolLit},
+		{name: "call", freq: 4, generate: g.boolCall},
 	})
 
-	g.boolChoices = makeChoicesList(g.boolLit, []exprChoice{
-		{freq: 1, generate: cmpOpGenerator(ir.OpEqual2)},
-		{freq: 1, generate: cmpOpGenerator(ir.OpEqual3)},
-		{freq: 3, generate: binaryOpGenerator(ir.OpAnd, nil, g.boolValue)},
-		{freq: 3, generate: binaryOpGenerator(ir.OpOr, nil, g.boolValue)},
-		{freq: 4, generate: unaryOpGenerator(ir.OpNot, g.condValue)},
-		{freq: 6, generate: g.boolVar, fallback: g.boolLit},
-		{freq: 3, generate: g.boolLit},
-		{freq: 4, generate: g.boolCall},
+	g.intChoices = makeChoicesList("int", config.ExprWeights, g.intLit, []exprChoice{
+		{name: "ternary", freq: 1, generate: g.intTernary},
+		{name: "short_ternary", freq: 1, generate: func() *ir.Node { return g.shortTernary(ir.IntType) }},
+		{name: "add", freq: 2, generate: withCast(binaryOpGenerator(ir.OpAdd, ir.IntType, g.intValue), ir.IntType)},
+		{name: "sub", freq: 2, generate: binaryOpGenerator(ir.OpSub, ir.IntType, g.intValue)},
+		{name: "mul", freq: 1, generate: withCast(binaryOpGenerator(ir.OpMul, ir.IntType, g.intValue), ir.IntType)},
+		{name: "bit_and", freq: 1, generate: binaryOpGenerator(ir.OpBitAnd, ir.IntType, g.intValue)},
+		{name: "bit_or", freq: 1, generate: binaryOpGenerator(ir.OpBitOr, ir.IntType, g.intValue)},
+		{name: "bit_xor", freq: 1, generate: binaryOpGenerator(ir.OpBitXor, ir.IntType, g.intValue)},
+		{name: "bit_not", freq: 1, generate: g.intBitNot},
+		{name: "shift_left", freq: 1, generate: func() *ir.Node { return g.intShift(ir.OpBitShiftLeft) }},
+		{name: "shift_right", freq: 1, generate: func() *ir.Node { return g.intShift(ir.OpBitShiftRight) }},
+		{name: "exp", freq: 1, generate: withCast(binaryOpGenerator(ir.OpExp, ir.IntType, g.intValue), ir.IntType)},
+		{name: "div", freq: 1, generate: withCast(binaryOpGenerator(ir.OpDiv, ir.IntType, g.intValue), ir.IntType)},
+		{name: "mod", freq: 1, generate: withCast(binaryOpGenerator(ir.OpMod, ir.IntType, g.intValue), ir.IntType)},
+		{name: "negation", freq: 2, generate: g.intNegation},
+		{name: "inc_dec", freq: 1, generate: g.intIncDec},
+		{name: "cast", freq: 2, generate: g.intCast},
+		{name: "call", freq: 7, generate: g.intCall},
+		{name: "lit", freq: 4, generate: g.intLit},
+		{name: "var", freq: 6, generate: g.intVar, fallback: g.intLit},
+		{name: "array_index", freq: 1, generate: func() *ir.Node { return g.arrayIndex(ir.IntType) }},
+		{name: "closure_call", freq: 1, generate: func() *ir.Node { return g.closureCall(ir.IntType) }},
+		{name: "print", freq: 1, generate: g.intPrint},
 	})
 
-	g.intChoices = makeChoicesList(g.intLit, []exprChoice{
-		{freq: 1, generate: g.intTernary},
-		{freq: 2, generate: withCast(binaryOpGenerator(ir.OpAdd, ir.IntType, g.intValue), ir.IntType)},
-		{freq: 2, generate: binaryOpGenerator(ir.OpSub, ir.IntType, g.intValue)},
-		{freq: 1, generate: withCast(binaryOpGenerator(ir.OpMul, ir.IntType, g.intValue), ir.IntType)},
-		{freq: 1, generate: binaryOpGenerator(ir.OpBitAnd, ir.IntType, g.intValue)},
-		{freq: 1, generate: binaryOpGenerator(ir.OpBitOr, ir.IntType, g.intValue)},
-		{freq: 1, generate: binaryOpGenerator(ir.OpBitXor, ir.IntType, g.intValue)},
-		{freq: 1, generate: withCast(binaryOpGenerator(ir.OpExp, ir.IntType, g.intValue), ir.IntType)},
-		{freq: 1, generate: withCast(binaryOpGenerator(ir.OpDiv, ir.IntType, g.intValue), ir.IntType)},
-		{freq: 1, generate: withCast(binaryOpGenerator(ir.OpMod, ir.IntType, g.intValue), ir.IntType)},
-		{freq: 2, generate: g.intNegation},
-		{freq: 2, generate: g.intCast},
-		{freq: 7, generate: g.intCall},
-		{freq: 4, generate: g.intLit},
-		{freq: 6, generate: g.intVar, fallback: g.intLit},
+	g.floatChoices = makeChoicesList("float", config.ExprWeights, g.floatLit, []exprChoice{
+		{name: "ternary", freq: 1, generate: g.floatTernary},
+		{name: "short_ternary", freq: 1, generate: func() *ir.Node { return g.shortTernary(ir.FloatType) }},
+		{name: "add", freq: 2, generate: binaryOpGenerator(ir.OpAdd, ir.FloatType, g.floatValue)},
+		{name: "sub", freq: 2, generate: binaryOpGenerator(ir.OpSub, ir.FloatType, g.floatValue)},
+		{name: "div", freq: 1, generate: binaryOpGenerator(ir.OpDiv, ir.FloatType, g.floatValue)},
+		{name: "mul", freq: 1, generate: binaryOpGenerator(ir.OpMul, ir.FloatType, g.floatValue)},
+		{name: "negation", freq: 1, generate: g.floatNegation},
+		{name: "math_call", freq: 2, generate: g.floatMathCall},
+		{name: "call", freq: 5, generate: g.floatCall},
+		{name: "var", freq: 6, generate: g.floatVar, fallback: g.floatLit},
+		{name: "array_index", freq: 1, generate: func() *ir.Node { return g.arrayIndex(ir.FloatType) }},
+		{name: "closure_call", freq: 1, generate: func() *ir.Node { return g.closureCall(ir.FloatType) }},
+		{name: "lit", freq: 5, generate: g.floatLit},
 	})
 
-	g.floatChoices = makeChoicesList(g.floatLit, []exprChoice{
-		{freq: 1, generate: g.floatTernary},
-		{freq: 2, generate: binaryOpGenerator(ir.OpAdd, ir.FloatType, g.floatValue)},
-		{freq: 2, generate: binaryOpGenerator(ir.OpSub, ir.FloatType, g.floatValue)},
-		{freq: 1, generate: binaryOpGenerator(ir.OpDiv, ir.FloatType, g.floatValue)},
-		{freq: 1, generate: binaryOpGenerator(ir.OpMul, ir.FloatType, g.floatValue)},
-		{freq: 5, generate: g.floatCall},
-		{freq: 6, generate: g.floatVar, fallback: g.floatLit},
-		{freq: 5, generate: g.floatLit},
+	g.stringChoices = makeChoicesList("string", config.ExprWeights, g.stringLit, []exprChoice{
+		{name: "ternary", freq: 1, generate: g.stringTernary},
+		{name: "short_ternary", freq: 1, generate: func() *ir.Node { return g.shortTernary(ir.StringType) }},
+		{name: "cast", freq: 2, generate: g.stringCast},
+		{name: "call", freq: 5, generate: g.stringCall},
+		{name: "concat", freq: 4, generate: binaryOpGenerator(ir.OpConcat, ir.StringType, g.stringValue)},
+		{name: "lit", freq: 5, generate: g.stringLit},
+		{name: "interpolated", freq: 5, generate: g.interpolatedString},
+		{name: "var", freq: 6, generate: g.stringVar, fallback: g.stringLit},
+		{name: "array_index", freq: 1, generate: func() *ir.Node { return g.arrayIndex(ir.StringType) }},
+		{name: "closure_call", freq: 1, generate: func() *ir.Node { return g.closureCall(ir.StringType) }},
+		{name: "index", freq: 2, generate: g.stringIndex, fallback: g.interpolatedString},
 	})
 
-	g.stringChoices = makeChoicesList(g.stringLit, []exprChoice{
-		{freq: 2, generate: g.stringCast},
-		{freq: 5, generate: g.stringCall},
-		{freq: 4, generate: binaryOpGenerator(ir.OpConcat, ir.StringType, g.stringValue)},
-		{freq: 5, generate: g.stringLit},
-		{freq: 5, generate: g.interpolatedString},
-		{freq: 6, generate: g.stringVar, fallback: g.stringLit},
-		{freq: 2, generate: g.stringIndex, fallback: g.interpolatedString},
+	keys := make([]ExprChoice, 0, len(config.ExprWeights))
+	for key := range config.ExprWeights {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Name < keys[j].Name
 	})
+	for _, key := range keys {
+		if !g.hasExprChoice(key) {
+			panic(fmt.Sprintf("unknown %s expression choice %q", key.Type, key.Name))
+		}
+	}
 
 	return g
 }
 
+func (g *exprGenerator) hasExprChoice(key ExprChoice) bool {
+	lists := map[string]*exprChoiceList{
+		"cond":   &g.condChoices,
+		"bool":   &g.boolChoices,
+		"int":    &g.intChoices,
+		"float":  &g.floatChoices,
+		"string": &g.stringChoices,
+	}
+	list := lists[key.Type]
+	if list == nil {
+		return false
+	}
+	for _, o := range list.options {
+		if o.name == key.Name {
+			return true
+		}
+	}
+	return false
+}
+
 func (g *exprGenerator) PickType() ir.Type {
-	return g.pickType(0)
+	return g.pickType(0, 0)
 }
 
-func (g *exprGenerator) pickType(depth int) ir.Type {
+// pickType picks a random type; arrayDepth is the number
+// of array types the picked type is nested into.
+func (g *exprGenerator) pickType(depth, arrayDepth int) ir.Type {
 	if depth >= 5 {
 		return g.PickScalarType()
 	}
 
 	switch g.rand.Intn(8 + depth*3) {
 	case 0:
-		elemType := g.pickType(depth + 1)
+		if arrayDepth != 0 && arrayDepth >= g.config.MaxArrayDepth {
+			return g.PickScalarType()
+		}
+		elemType := g.pickType(depth+1, arrayDepth+1)
+		if randutil.Chance(g.rand, 0.3) {
+			return &ir.ArrayType{Key: ir.StringType, Elem: elemType}
+		}
 		return &ir.ArrayType{Elem: elemType}
 
 	case 1:
-		return g.pickTupleType(depth + 2)
+		if !g.features.tuples {
+			return g.PickScalarType()
+		}
+		return g.pickTupleType(depth+2, arrayDepth)
 
 	case 2:
 		return g.PickEnumType()
@@ -196,13 +323,13 @@ func (g *exprGenerator) pickType(depth int) ir.Type {
 	}
 }
 
-func (g *exprGenerator) pickTupleType(depth int) ir.Type {
+func (g *exprGenerator) pickTupleType(depth, arrayDepth int) ir.Type {
 	numElems := randutil.IntRange(g.rand, 1, 12)
 	tuple := &ir.TupleType{
 		Elems: make([]ir.Type, 0, numElems),
 	}
 	for i := 0; i < numElems; i++ {
-		tuple.Elems = append(tuple.Elems, g.pickType(depth))
+		tuple.Elems = append(tuple.Elems, g.pickType(depth, arrayDepth))
 	}
 	return tuple
 }
@@ -251,6 +378,8 @@ func (g *exprGenerator) GenerateValueOfType(typ ir.Type) *ir.Node {
 			return g.stringValue()
 		case ir.ScalarMixed:
 			return g.mixedValue(true)
+		case ir.ScalarNull:
+			return g.nullLit()
 		default:
 			panic(fmt.Sprintf("unexpected %s scalar type", typ.Kind))
 		}
@@ -262,6 +391,11 @@ func (g *exprGenerator) GenerateValueOfType(typ ir.Type) *ir.Node {
 				return v
 			}
 		}
+		if roll < 0.7 {
+			if call := g.userCallOfType(typ); call != nil {
+				return call
+			}
+		}
 		switch typ.ValueType.Kind {
 		case ir.ScalarInt:
 			return ir.NewIntLit(randutil.Elem(g.rand, typ.Values).(int64))
@@ -273,10 +407,29 @@ func (g *exprGenerator) GenerateValueOfType(typ ir.Type) *ir.Node {
 			panic(fmt.Sprintf("unexpected %s enum type", typ.ValueType))
 		}
 
+	case *ir.NullableType:
+		if randutil.Chance(g.rand, 0.3) {
+			return g.nullLit()
+		}
+		return g.GenerateValueOfType(typ.X)
+
+	case *ir.UnionType:
+		return g.GenerateValueOfType(randutil.Elem(g.rand, typ.Types))
+
 	case *ir.ArrayType:
-		return g.arrayValue(typ.Elem)
+		if randutil.Chance(g.rand, 0.1) {
+			if call := g.userCallOfType(typ); call != nil {
+				return call
+			}
+		}
+		return g.arrayValue(typ)
 
 	case *ir.TupleType:
+		if randutil.Chance(g.rand, 0.1) {
+			if call := g.userCallOfType(typ); call != nil {
+				return call
+			}
+		}
 		return g.tupleValue(typ)
 
 	default:
@@ -284,28 +437,98 @@ func (g *exprGenerator) GenerateValueOfType(typ ir.Type) *ir.Node {
 	}
 }
 
+// GenerateStrictValueOfType is like GenerateValueOfType, but it also
+// guarantees that the value has the exact typ type when StrictTypes is set.
+// It should be used at typed boundaries like function arguments
+// and return statements.
+func (g *exprGenerator) GenerateStrictValueOfType(typ ir.Type) *ir.Node {
+	x := g.GenerateValueOfType(typ)
+	if g.config.StrictTypes && needsStrictCast(typ) {
+		// Some int expressions can overflow into float,
+		// so the explicit conversion is required.
+		x = &ir.Node{Op: ir.OpCast, Args: []*ir.Node{g.maybeAddParens(x)}, Type: typ}
+	}
+	return x
+}
+
+func (g *exprGenerator) enterExpr() {
+	if g.exprDepth == 0 {
+		g.exprNodes = 0
+		for name := range g.exprVars {
+			delete(g.exprVars, name)
+		}
+	}
+	g.exprDepth++
+	g.exprNodes++
+
+	if g.stopped {
+		// The budget is already spent.
+		return
+	}
+	g.totalExprs++
+	if g.config.MaxTotalExprs != 0 && g.totalExprs >= g.config.MaxTotalExprs {
+		g.stopped = true
+	}
+	if g.totalExprs%ctxCheckInterval == 0 {
+		g.checkContext()
+	}
+}
+
+// ctxCheckInterval is the number of generated
+// subexpressions between the ctx checks.
+const ctxCheckInterval = 64
+
+// checkContext sets the stopped flag if the ctx is done.
+func (g *exprGenerator) checkContext() {
+	if !g.stopped && g.ctx.Err() != nil {
+		g.stopped = true
+	}
+}
+
+func (g *exprGenerator) leaveExpr() {
+	g.exprDepth--
+}
+
+// exprLimitExceeded reports whether the current expression
+// is too deep or too big, so only the leaves should be generated.
+func (g *exprGenerator) exprLimitExceeded() bool {
+	if g.stopped {
+		return true
+	}
+	maxDepth := g.config.MaxExprDepth
+	if maxDepth == 0 {
+		maxDepth = 10
+	}
+	if g.exprDepth >= maxDepth {
+		return true
+	}
+	return g.config.MaxExprNodes != 0 && g.exprNodes >= g.config.MaxExprNodes
+}
+
 func (g *exprGenerator) chooseExpr(list *exprChoiceList) *ir.Node {
-	if g.exprDepth > 10 {
+	if g.exprLimitExceeded() {
 		return list.fallback()
 	}
-	g.exprDepth++
-	defer func() { g.exprDepth-- }()
+	g.enterExpr()
+	defer g.leaveExpr()
 
-	for {
+	var n *ir.Node
+	for i := 0; i < maxChoiceAttempts && n == nil && len(list.indexMap) != 0; i++ {
 		probe := g.rand.Intn(len(list.indexMap))
 		option := list.options[list.indexMap[probe]]
-		n := option.generate()
+		n = option.generate()
 		if n == nil && option.fallback != nil {
 			n = option.fallback()
 		}
-		if n != nil {
-			addParens := g.rand.Intn(10) <= 3
-			if addParens {
-				n = ir.NewParens(n)
-			}
-			return n
-		}
 	}
+	if n == nil {
+		n = list.fallback()
+	}
+	addParens := g.rand.Intn(10) <= 3
+	if addParens {
+		n = ir.NewParens(n)
+	}
+	return n
 }
 
 func (g *exprGenerator) condValue() *ir.Node {
@@ -313,24 +536,49 @@ func (g *exprGenerator) condValue() *ir.Node {
 }
 
 func (g *exprGenerator) boolValue() *ir.Node {
+	if g.useCast() {
+		return g.castValue(g.boolCast)
+	}
 	return g.chooseExpr(&g.boolChoices)
 }
 
 func (g *exprGenerator) intValue() *ir.Node {
+	if g.useCast() {
+		return g.castValue(g.intCast)
+	}
 	return g.chooseExpr(&g.intChoices)
 }
 
 func (g *exprGenerator) floatValue() *ir.Node {
+	if g.useCast() {
+		return g.castValue(g.floatCast)
+	}
 	return g.chooseExpr(&g.floatChoices)
 }
 
 func (g *exprGenerator) stringValue() *ir.Node {
+	if g.useCast() {
+		return g.castValue(g.stringCast)
+	}
 	return g.chooseExpr(&g.stringChoices)
 }
 
+func (g *exprGenerator) useCast() bool {
+	return !g.exprLimitExceeded() && randutil.Chance(g.rand, g.config.CastProbability)
+}
+
+// castValue generates a CastProbability conversion.
+// It's a subexpression like the chooseExpr results,
+// so the nested casts are limited by MaxExprDepth.
+func (g *exprGenerator) castValue(cast func() *ir.Node) *ir.Node {
+	g.enterExpr()
+	defer g.leaveExpr()
+	return cast()
+}
+
 func (g *exprGenerator) mixedValue(permitArray bool) *ir.Node {
 	maxRoll := 4
-	if g.exprDepth >= 10 || !permitArray {
+	if g.exprLimitExceeded() || !permitArray {
 		maxRoll = 3
 	}
 	switch randutil.IntRange(g.rand, 0, maxRoll) {
@@ -343,7 +591,7 @@ func (g *exprGenerator) mixedValue(permitArray bool) *ir.Node {
 	case 3:
 		return g.stringValue()
 	case 4:
-		return g.arrayValue(g.PickScalarType())
+		return g.arrayValue(&ir.ArrayType{Elem: g.PickScalarType()})
 	}
 	panic("unreachable")
 }
@@ -359,6 +607,39 @@ func (g *exprGenerator) newTernary(cond, x, y *ir.Node) *ir.Node {
 	return ir.NewParens(ternary)
 }
 
+// cmpOperands generates a pair of comparison operands.
+// They have the same scalar type unless MixedTypeComparisons is set.
+// The isFloat result tells whether any of them is float.
+func (g *exprGenerator) cmpOperands() (x, y *ir.Node, isFloat bool) {
+	xType := g.PickScalarType()
+	yType := xType
+	if g.config.MixedTypeComparisons && g.features.typeJuggling && randutil.Bool(g.rand) {
+		yType = g.PickScalarType()
+		if !g.features.stringNumberComparisons && isStringNumberPair(xType, yType) {
+			yType = xType
+		}
+	}
+	x = g.maybeAddParens(g.GenerateValueOfType(xType))
+	y = g.maybeAddParens(g.GenerateValueOfType(yType))
+	isFloat = xType == ir.FloatType || yType == ir.FloatType
+	return x, y, isFloat
+}
+
+func isStringNumberPair(x, y ir.Type) bool {
+	isNumber := func(typ ir.Type) bool {
+		return typ == ir.IntType || typ == ir.FloatType
+	}
+	return (x == ir.StringType && isNumber(y)) || (y == ir.StringType && isNumber(x))
+}
+
+// spaceshipCmp generates a comparison of the <=> result with 0.
+func (g *exprGenerator) spaceshipCmp() *ir.Node {
+	x, y, _ := g.cmpOperands()
+	op := randutil.Elem(g.rand, []ir.Op{ir.OpEqual3, ir.OpNotEqual3, ir.OpLess, ir.OpGreater})
+	cmp := ir.NewParens(ir.NewSpaceship(x, y))
+	return &ir.Node{Op: op, Args: []*ir.Node{cmp, ir.NewIntLit(0)}}
+}
+
 func (g *exprGenerator) intTernary() *ir.Node {
 	return g.newTernary(g.condValue(), g.intValue(), g.intValue())
 }
@@ -367,10 +648,32 @@ func (g *exprGenerator) floatTernary() *ir.Node {
 	return g.newTernary(g.condValue(), g.floatValue(), g.floatValue())
 }
 
+func (g *exprGenerator) boolTernary() *ir.Node {
+	return g.newTernary(g.condValue(), g.boolValue(), g.boolValue())
+}
+
+func (g *exprGenerator) stringTernary() *ir.Node {
+	return g.newTernary(g.condValue(), g.stringValue(), g.stringValue())
+}
+
+// shortTernary generates x ?: y, x is both the condition
+// and the true branch, so its truthiness selects the result.
+func (g *exprGenerator) shortTernary(typ ir.Type) *ir.Node {
+	x := g.maybeAddParens(g.GenerateValueOfType(typ))
+	y := g.maybeAddParens(g.GenerateValueOfType(typ))
+	ternary := ir.NewShortTernary(x, y)
+	ternary.Type = typ
+	return ir.NewParens(ternary)
+}
+
 func (g *exprGenerator) boolLit() *ir.Node {
 	return ir.NewBoolLit(g.valueGenerator.BoolValue())
 }
 
+func (g *exprGenerator) nullLit() *ir.Node {
+	return ir.NewName("null")
+}
+
 func (g *exprGenerator) intLit() *ir.Node {
 	return ir.NewIntLit(g.valueGenerator.IntValue())
 }
@@ -379,27 +682,41 @@ func (g *exprGenerator) floatLit() *ir.Node {
 	return ir.NewFloatLit(g.valueGenerator.FloatValue())
 }
 
+// interpolatedString generates a string with 1-4 parts
+// alternating literal fragments and scalar variables.
+// It's a string literal if there are no variables in scope.
 func (g *exprGenerator) interpolatedString() *ir.Node {
-	numParts := randutil.IntRange(g.rand, 3, 8)
-	n := &ir.Node{
-		Op:   ir.OpInterpolatedString,
-		Args: make([]*ir.Node, 0, numParts),
-	}
+	numParts := randutil.IntRange(g.rand, 1, 4)
+	parts := make([]*ir.Node, 0, numParts)
+	hasVars := false
+	isVar := randutil.Bool(g.rand)
 	for i := 0; i < numParts; i++ {
 		var part *ir.Node
-		if randutil.Bool(g.rand) {
-			v := g.varOfType(g.PickScalarType())
-			if v != nil {
-				part = v
-			} else {
-				part = g.stringLit()
-			}
-		} else {
-			part = g.stringLit()
+		if isVar {
+			part = g.varOfType(g.PickScalarType())
+			hasVars = hasVars || part != nil
+		}
+		if part == nil {
+			part = ir.NewStringLit(g.interpolationFragment())
 		}
-		n.Args = append(n.Args, part)
+		parts = append(parts, part)
+		isVar = !isVar
 	}
-	return n
+	if !hasVars {
+		return g.stringLit()
+	}
+	return ir.NewInterpolatedString(parts...)
+}
+
+// interpolationFragments stress the interpolated string escaping.
+var interpolationFragments = []string{"$", "{", "}", "{$", "${", `"`, "'", "\\", "\n", "$x"}
+
+func (g *exprGenerator) interpolationFragment() string {
+	s := g.valueGenerator.StringValue()
+	if randutil.Chance(g.rand, 0.3) {
+		s += randutil.Elem(g.rand, interpolationFragments)
+	}
+	return s
 }
 
 func (g *exprGenerator) stringLit() *ir.Node {
@@ -407,10 +724,13 @@ func (g *exprGenerator) stringLit() *ir.Node {
 }
 
 func (g *exprGenerator) varOfType(typ ir.Type) *ir.Node {
-	v := g.scope.FindVarOfType(typ)
+	v := g.scope.PickVar(func(v *scopeVar) bool {
+		return !g.exprVars[v.name] && ir.TypesIdentical(typ, v.typ)
+	})
 	if v == nil {
 		return nil
 	}
+	g.exprVars[v.name] = false
 	return ir.NewVar(v.name, v.typ)
 }
 
@@ -419,13 +739,63 @@ func (g *exprGenerator) intVar() *ir.Node    { return g.varOfType(ir.IntType) }
 func (g *exprGenerator) floatVar() *ir.Node  { return g.varOfType(ir.FloatType) }
 func (g *exprGenerator) stringVar() *ir.Node { return g.varOfType(ir.StringType) }
 
+// userCallOfType generates a call of a previously generated
+// function with the typ result, it returns nil if there is none.
+// The scalar type calls are generated by the call choices.
+func (g *exprGenerator) userCallOfType(typ ir.Type) *ir.Node {
+	funcs := g.symtab.UserFuncsOfType(typ)
+	if len(funcs) == 0 {
+		return nil
+	}
+	return g.callOfType(randutil.Elem(g.rand, funcs))
+}
+
+// closureCall generates a call of a closure variable
+// with the typ result, it returns nil if there is none.
+func (g *exprGenerator) closureCall(typ ir.Type) *ir.Node {
+	v := g.scope.PickVar(func(v *scopeVar) bool {
+		fn, ok := v.typ.(*ir.FuncType)
+		return ok && ir.TypesIdentical(typ, fn.Result)
+	})
+	if v == nil {
+		return nil
+	}
+
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	fn := v.typ.(*ir.FuncType)
+	args := make([]*ir.Node, len(fn.Params))
+	for i, param := range fn.Params {
+		args[i] = g.GenerateStrictValueOfType(param.Type)
+	}
+	return ir.NewCall(ir.NewVar(v.name, fn), args...)
+}
+
 func (g *exprGenerator) callOfType(fn *ir.FuncType) *ir.Node {
-	g.exprDepth++
-	defer func() { g.exprDepth-- }()
+	recursive := g.symtab.IsRecursiveFunc(fn.Name)
+	if recursive && g.recursionDepth == nil {
+		return nil
+	}
+
+	g.enterExpr()
+	defer g.leaveExpr()
 
 	numArgs := randutil.IntRange(g.rand, fn.MinArgsNum, len(fn.Params))
 	callArgs := make([]*ir.Node, numArgs)
 	for i := range callArgs {
+		if i == 0 && recursive {
+			callArgs[i] = g.recursionDepth()
+			continue
+		}
+		if p := fn.Params[i]; p.Max != 0 {
+			callArgs[i] = g.intInRange(p.Min, p.Max)
+			continue
+		}
+		if g.config.StrictTypes {
+			callArgs[i] = g.GenerateStrictValueOfType(fn.Params[i].Type)
+			continue
+		}
 		arg := g.GenerateValueOfType(fn.Params[i].Type)
 		if fn.Params[i].Strict {
 			arg = &ir.Node{Op: ir.OpCast, Args: []*ir.Node{g.maybeAddParens(arg)}, Type: fn.Params[i].Type}
@@ -433,6 +803,9 @@ func (g *exprGenerator) callOfType(fn *ir.FuncType) *ir.Node {
 		callArgs[i] = arg
 	}
 	funcExpr := ir.NewName(fn.Name)
+	if g.symtab.IsBuiltinFunc(fn.Name) {
+		funcExpr = g.builtinFuncName(fn.Name)
+	}
 	result := ir.NewCall(funcExpr, callArgs...)
 	if fn.NeedCast {
 		result = &ir.Node{Op: ir.OpCast, Args: []*ir.Node{result}, Type: fn.Result}
@@ -440,19 +813,47 @@ func (g *exprGenerator) callOfType(fn *ir.FuncType) *ir.Node {
 	return result
 }
 
+// builtinFuncName returns a builtin function name expression.
+// It's sometimes fully qualified, see QualifiedCallProbability.
+func (g *exprGenerator) builtinFuncName(name string) *ir.Node {
+	if g.config.QualifiedCallProbability != 0 && randutil.Chance(g.rand, g.config.QualifiedCallProbability) {
+		return ir.NewFullyQualifiedName(name)
+	}
+	return ir.NewName(name)
+}
+
 func (g *exprGenerator) boolCall() *ir.Node {
+	if len(g.symtab.boolFuncs) == 0 {
+		return nil
+	}
 	return g.callOfType(g.symtab.boolFuncs[g.rand.Intn(len(g.symtab.boolFuncs))])
 }
 
 func (g *exprGenerator) intCall() *ir.Node {
+	if len(g.symtab.intFuncs) == 0 {
+		return nil
+	}
 	return g.callOfType(g.symtab.intFuncs[g.rand.Intn(len(g.symtab.intFuncs))])
 }
 
 func (g *exprGenerator) floatCall() *ir.Node {
-	return g.callOfType(g.symtab.floatFuncs[g.rand.Intn(len(g.symtab.floatFuncs))])
+	if len(g.symtab.floatFuncs) == 0 {
+		return nil
+	}
+	fn := g.symtab.floatFuncs[g.rand.Intn(len(g.symtab.floatFuncs))]
+	switch {
+	case fn.Name == "sqrt":
+		return g.sqrtCall()
+	case fn.Name == "fmod" && !g.config.AllowNaN:
+		return g.floatMathCall()
+	}
+	return g.callOfType(fn)
 }
 
 func (g *exprGenerator) stringCall() *ir.Node {
+	if len(g.symtab.stringFuncs) == 0 {
+		return nil
+	}
 	return g.callOfType(g.symtab.stringFuncs[g.rand.Intn(len(g.symtab.stringFuncs))])
 }
 
@@ -467,17 +868,140 @@ func (g *exprGenerator) intNegation() *ir.Node {
 	return ir.NewNegation(g.maybeAddParens(g.intValue()))
 }
 
-func (g *exprGenerator) castToType(typ ir.Type) *ir.Node {
-	arg := g.maybeAddParens(g.mixedValue(false))
+func (g *exprGenerator) floatNegation() *ir.Node {
+	return ir.NewNegation(g.maybeAddParens(g.floatValue()))
+}
+
+func (g *exprGenerator) sqrtCall() *ir.Node {
+	if !g.config.AllowNaN && !g.symtab.IsBuiltinFunc("abs") {
+		return nil
+	}
+
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	x := g.floatValue()
+	if !g.config.AllowNaN {
+		// The square root of a negative number is NaN.
+		x = ir.NewCall(g.builtinFuncName("abs"), x)
+	}
+	return ir.NewCall(g.builtinFuncName("sqrt"), x)
+}
+
+// floatMathCall generates a math builtin call.
+// Unless AllowNaN is set, the call can't produce NaN from the non-NaN arguments.
+// floatMathFuncs are the float math builtins, fmod should be the last.
+var floatMathFuncs = []string{"sqrt", "abs", "floor", "ceil", "round", "fmod"}
+
+func (g *exprGenerator) floatMathCall() *ir.Node {
+	// fmod returns NaN for the zero divisor and the infinite dividend.
+	numFuncs := len(floatMathFuncs) - 1
+	if g.config.AllowNaN {
+		numFuncs++
+	}
+	name := floatMathFuncs[g.rand.Intn(numFuncs)]
+	if !g.symtab.IsBuiltinFunc(name) {
+		return nil
+	}
+	if name == "sqrt" {
+		return g.sqrtCall()
+	}
+
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	x := g.floatValue()
+	if name == "fmod" {
+		return ir.NewCall(g.builtinFuncName(name), x, g.floatValue())
+	}
+	return ir.NewCall(g.builtinFuncName(name), x)
+}
+
+// intIncDec generates an int variable increment or decrement.
+func (g *exprGenerator) intIncDec() *ir.Node {
+	v := g.scope.PickVar(func(v *scopeVar) bool {
+		_, used := g.exprVars[v.name]
+		return !used && ir.TypesIdentical(ir.IntType, v.typ)
+	})
+	if v == nil {
+		return nil
+	}
+	g.exprVars[v.name] = true
+	g.scope.MarkMutated(v.name)
+	op := randutil.Elem(g.rand, incDecOps)
+	return &ir.Node{Op: op, Args: []*ir.Node{ir.NewVar(v.name, v.typ)}, Type: ir.IntType}
+}
+
+var incDecOps = []ir.Op{ir.OpPreInc, ir.OpPreDec, ir.OpPostInc, ir.OpPostDec}
+
+func (g *exprGenerator) intBitNot() *ir.Node {
+	return ir.NewBitNot(g.maybeAddParens(g.intValue()))
+}
+
+// intShift generates a bit shift by 0..63 bits.
+// Negative shift counts throw ArithmeticError.
+func (g *exprGenerator) intShift(op ir.Op) *ir.Node {
+	x := g.maybeAddParens(g.intValue())
+	var count *ir.Node
+	if randutil.Bool(g.rand) {
+		count = ir.NewIntLit(int64(g.rand.Intn(64)))
+	} else {
+		count = g.maybeAddParens(ir.NewBitAnd(g.maybeAddParens(g.intValue()), ir.NewIntLit(63)))
+	}
+	return &ir.Node{Op: op, Args: []*ir.Node{x, count}, Type: ir.IntType}
+}
+
+// intInRange generates an int expression with a min..max value.
+func (g *exprGenerator) intInRange(min, max int64) *ir.Node {
+	if randutil.Bool(g.rand) {
+		return ir.NewIntLit(min + g.rand.Int63n(max-min+1))
+	}
+	x := &ir.Node{Op: ir.OpCast, Args: []*ir.Node{g.maybeAddParens(g.intValue())}, Type: ir.IntType}
+	x = ir.NewCall(g.builtinFuncName("max"), x, ir.NewIntLit(min))
+	return ir.NewCall(g.builtinFuncName("min"), x, ir.NewIntLit(max))
+}
+
+func (g *exprGenerator) intPrint() *ir.Node {
+	if !g.config.NoObserve && g.config.OutputMode != OutputFull {
+		// Like echo, the printed output is not hashed.
+		return nil
+	}
+	return ir.NewPrint(g.maybeAddParens(g.stringValue()))
+}
+
+// castToType generates an explicit conversion of a value
+// of one of the from types to typ.
+func (g *exprGenerator) castToType(typ ir.Type, from ...ir.Type) *ir.Node {
+	arg := g.maybeAddParens(g.GenerateValueOfType(randutil.Elem(g.rand, from)))
 	return &ir.Node{Op: ir.OpCast, Args: []*ir.Node{arg}, Type: typ}
 }
 
-func (g *exprGenerator) intCast() *ir.Node    { return g.castToType(ir.IntType) }
-func (g *exprGenerator) stringCast() *ir.Node { return g.castToType(ir.StringType) }
+func (g *exprGenerator) intCast() *ir.Node {
+	if !g.features.typeJuggling {
+		return g.castToType(ir.IntType, ir.FloatType, ir.BoolType)
+	}
+	return g.castToType(ir.IntType, ir.FloatType, ir.StringType, ir.BoolType)
+}
+
+func (g *exprGenerator) floatCast() *ir.Node {
+	if !g.features.typeJuggling {
+		return g.castToType(ir.FloatType, ir.IntType)
+	}
+	return g.castToType(ir.FloatType, ir.IntType, ir.StringType)
+}
+
+func (g *exprGenerator) stringCast() *ir.Node {
+	return g.castToType(ir.StringType, ir.IntType, ir.FloatType, ir.BoolType)
+}
+
+func (g *exprGenerator) boolCast() *ir.Node {
+	arg := g.maybeAddParens(g.mixedValue(true))
+	return &ir.Node{Op: ir.OpCast, Args: []*ir.Node{arg}, Type: ir.BoolType}
+}
 
 func (g *exprGenerator) tupleValue(typ *ir.TupleType) *ir.Node {
-	g.exprDepth++
-	defer func() { g.exprDepth-- }()
+	g.enterExpr()
+	defer g.leaveExpr()
 
 	numElems := len(typ.Elems)
 	elems := make([]*ir.Node, numElems)
@@ -487,20 +1011,109 @@ func (g *exprGenerator) tupleValue(typ *ir.TupleType) *ir.Node {
 	return ir.NewCall(ir.NewName("tuple"), elems...)
 }
 
-func (g *exprGenerator) arrayValue(elemType ir.Type) *ir.Node {
-	g.exprDepth++
-	defer func() { g.exprDepth-- }()
+func (g *exprGenerator) arrayValue(typ *ir.ArrayType) *ir.Node {
+	if randutil.Chance(g.rand, 0.4) {
+		if v := g.varOfType(typ); v != nil {
+			return v
+		}
+	}
 
-	maxNumElems := 4
-	if g.exprDepth >= 10 {
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	if typ.Key != nil {
+		return g.assocArrayLit(typ, g.arrayKeys(randutil.IntRange(g.rand, 2, 6)))
+	}
+	maxNumElems := 8
+	if g.exprLimitExceeded() {
 		maxNumElems = 2
 	}
-	numElems := randutil.IntRange(g.rand, 1, maxNumElems)
+	return g.arrayLit(typ, randutil.IntRange(g.rand, 0, maxNumElems))
+}
+
+// arrayKeyValues are the associative array keys.
+// Numeric strings like "0" are converted to int keys by PHP,
+// while "01" and "-0" are not.
+var arrayKeyValues = []string{"a", "b", "c", "id", "key", "name", "value", "", "0", "01", "-0", "10"}
+
+// arrayKeys picks numKeys associative array keys.
+// The keys are distinct unless DuplicateArrayKeys is set.
+func (g *exprGenerator) arrayKeys(numKeys int) []string {
+	keys := make([]string, 0, numKeys)
+	for len(keys) < numKeys {
+		if g.config.DuplicateArrayKeys && len(keys) != 0 && randutil.Chance(g.rand, 0.1) {
+			keys = append(keys, randutil.Elem(g.rand, keys))
+			continue
+		}
+		key := randutil.Elem(g.rand, arrayKeyValues)
+		if !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (g *exprGenerator) assocArrayLit(typ *ir.ArrayType, keys []string) *ir.Node {
+	elems := make([]*ir.Node, len(keys))
+	for i, key := range keys {
+		elems[i] = ir.NewKeyedElem(ir.NewStringLit(key), g.GenerateStrictValueOfType(typ.Elem))
+	}
+	return &ir.Node{Op: ir.OpArrayLit, Args: elems, Type: typ}
+}
+
+func (g *exprGenerator) arrayLit(typ *ir.ArrayType, numElems int) *ir.Node {
 	elems := make([]*ir.Node, numElems)
 	for i := 0; i < numElems; i++ {
-		elems[i] = g.GenerateValueOfType(elemType)
+		elems[i] = g.GenerateStrictValueOfType(typ.Elem)
+	}
+	return &ir.Node{Op: ir.OpArrayLit, Args: elems, Type: typ}
+}
+
+// arrayIndex generates an elemType array element read.
+// Literals are indexed within their bounds while variables
+// can be empty, so their element reads have a ?? default.
+func (g *exprGenerator) arrayIndex(elemType ir.Type) *ir.Node {
+	if randutil.Chance(g.rand, 0.3) {
+		return g.assocArrayIndex(elemType)
+	}
+
+	typ := &ir.ArrayType{Elem: elemType}
+	if randutil.Bool(g.rand) {
+		if v := g.varOfType(typ); v != nil {
+			return g.elemOrDefault(v, ir.NewIntLit(int64(g.rand.Intn(8))), elemType)
+		}
+	}
+
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	numElems := randutil.IntRange(g.rand, 1, 4)
+	key := ir.NewIntLit(int64(g.rand.Intn(numElems)))
+	return &ir.Node{Op: ir.OpIndex, Args: []*ir.Node{g.arrayLit(typ, numElems), key}, Type: elemType}
+}
+
+// elemOrDefault generates an arr[key] ?? default read.
+func (g *exprGenerator) elemOrDefault(arr, key *ir.Node, elemType ir.Type) *ir.Node {
+	elem := &ir.Node{Op: ir.OpIndex, Args: []*ir.Node{arr, key}, Type: elemType}
+	defaultValue := g.maybeAddParens(g.GenerateValueOfType(elemType))
+	return &ir.Node{Op: ir.OpNullCoalesce, Args: []*ir.Node{elem, defaultValue}, Type: elemType}
+}
+
+// assocArrayIndex is like arrayIndex, but for the associative arrays.
+func (g *exprGenerator) assocArrayIndex(elemType ir.Type) *ir.Node {
+	typ := &ir.ArrayType{Key: ir.StringType, Elem: elemType}
+	if randutil.Bool(g.rand) {
+		if v := g.varOfType(typ); v != nil {
+			return g.elemOrDefault(v, ir.NewStringLit(randutil.Elem(g.rand, arrayKeyValues)), elemType)
+		}
 	}
-	return &ir.Node{Op: ir.OpArrayLit, Args: elems}
+
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	keys := g.arrayKeys(randutil.IntRange(g.rand, 2, 4))
+	key := ir.NewStringLit(randutil.Elem(g.rand, keys))
+	return &ir.Node{Op: ir.OpIndex, Args: []*ir.Node{g.assocArrayLit(typ, keys), key}, Type: elemType}
 }
 
 func (g *exprGenerator) lvalueOfType(typ ir.Type) *ir.Node {
@@ -510,23 +1123,75 @@ func (g *exprGenerator) lvalueOfType(typ ir.Type) *ir.Node {
 	return nil
 }
 
+// stringIndex generates a single character read, like $s[$i].
+//
+// Unless AllowWarnings is set, a string literal is indexed within its
+// bounds, while the variable index is clamped by the string length
+// if the strlen and max builtins are available.
+// Since the string variable can be empty, the read is defaulted with ??.
 func (g *exprGenerator) stringIndex() *ir.Node {
-	lvalue := g.lvalueOfType(ir.StringType)
-	if lvalue == nil {
+	g.enterExpr()
+	defer g.leaveExpr()
+
+	negativeOffsets := g.features.negativeStringOffsets
+	curlyOffsets := g.features.curlyStringOffsets
+
+	if randutil.Chance(g.rand, 0.3) {
+		s := g.stringLit()
+		n := int64(len(s.Value.(string)))
+		if n == 0 {
+			return nil
+		}
+		offset := g.rand.Int63n(n)
+		if negativeOffsets && randutil.Bool(g.rand) {
+			offset -= n
+		}
+		return &ir.Node{Op: ir.OpIndex, Args: []*ir.Node{s, ir.NewIntLit(offset)}, Type: ir.StringType}
+	}
+
+	s := g.varOfType(ir.StringType)
+	if s == nil {
 		return nil
 	}
-	s := g.maybeAddParens(lvalue)
 	var key *ir.Node
-	if randutil.IntRange(g.rand, 0, 10) > 2 {
-		key = g.intValue()
-	} else {
+	switch {
+	case negativeOffsets && randutil.Chance(g.rand, 0.2):
 		key = ir.NewIntLit(-1)
+	case randutil.Chance(g.rand, 0.3):
+		key = ir.NewIntLit(0)
+	case !g.config.AllowWarnings && !g.canUseStringLength():
+		// The read is defaulted with ??, so a literal offset doesn't
+		// need to be clamped.
+		key = ir.NewIntLit(int64(randutil.IntRange(g.rand, 0, 3)))
+	default:
+		key = g.intValue()
+		if !g.config.AllowWarnings {
+			// The % result has the sign of its left operand,
+			// so it's wrapped once again for the older PHP versions.
+			n := g.stringLength(s)
+			key = &ir.Node{Op: ir.OpMod, Args: []*ir.Node{key, n}, Type: ir.IntType}
+			if !negativeOffsets {
+				key = &ir.Node{Op: ir.OpMod, Args: []*ir.Node{ir.NewAdd(key, n), n}, Type: ir.IntType}
+			}
+		}
 	}
-	return &ir.Node{
-		Op:   ir.OpCast,
-		Args: []*ir.Node{ir.NewIndex(s, key)},
-		Type: ir.StringType,
+	elem := &ir.Node{Op: ir.OpIndex, Args: []*ir.Node{s, key}, Value: curlyOffsets && randutil.Bool(g.rand), Type: ir.StringType}
+	if g.config.AllowWarnings {
+		return elem
 	}
+	return &ir.Node{Op: ir.OpNullCoalesce, Args: []*ir.Node{elem, ir.NewStringLit("")}, Type: ir.StringType}
+}
+
+// canUseStringLength reports whether the stringLength builtins are available.
+func (g *exprGenerator) canUseStringLength() bool {
+	return g.symtab.IsBuiltinFunc("strlen") && g.symtab.IsBuiltinFunc("max")
+}
+
+// stringLength returns the max(1, strlen(s)) expression.
+// It should only be used if canUseStringLength is true.
+func (g *exprGenerator) stringLength(s *ir.Node) *ir.Node {
+	strlen := ir.NewCall(g.builtinFuncName("strlen"), ir.NewVar(s.Value.(string), s.Type))
+	return ir.NewCall(g.builtinFuncName("max"), ir.NewIntLit(1), strlen)
 }
 
 var scalarTypes = []ir.Type{
@@ -536,6 +1201,11 @@ var scalarTypes = []ir.Type{
 	ir.StringType,
 }
 
+var switchTagTypes = []ir.Type{
+	ir.IntType,
+	ir.StringType,
+}
+
 var scalarTypesNoBool = []ir.Type{
 	ir.IntType,
 	ir.FloatType,
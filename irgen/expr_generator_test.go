@@ -0,0 +1,2898 @@
+package irgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/ir/eval"
+	"github.com/quasilyte/phpsmith/irprint"
+	"github.com/quasilyte/phpsmith/phpfunc"
+)
+
+func TestIntExprOps(t *testing.T) {
+	counts := map[ir.Op]int{}
+	var walk func(n *ir.Node)
+	walk = func(n *ir.Node) {
+		if n == nil {
+			return
+		}
+		counts[n.Op]++
+		switch n.Op {
+		case ir.OpBitShiftLeft, ir.OpBitShiftRight:
+			if !isShiftCount(n.Args[1]) {
+				t.Fatalf("%s count is not limited: %s", n.Op, n.Args[1].Op)
+			}
+		case ir.OpDiv, ir.OpMod:
+			if n.Type != ir.IntType && n.Type != ir.FloatType {
+				t.Fatalf("%s node has %v type", n.Op, n.Type)
+			}
+		}
+		for _, arg := range n.Args {
+			walk(arg)
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		for i := 0; i < 20; i++ {
+			walk(g.expr.GenerateValueOfType(ir.IntType))
+		}
+	}
+
+	ops := []ir.Op{
+		ir.OpMul,
+		ir.OpBitAnd,
+		ir.OpBitOr,
+		ir.OpBitXor,
+		ir.OpBitNot,
+		ir.OpBitShiftLeft,
+		ir.OpBitShiftRight,
+		ir.OpDiv,
+		ir.OpMod,
+	}
+	for _, op := range ops {
+		if counts[op] == 0 {
+			t.Errorf("%s is never generated", op)
+		}
+	}
+}
+
+// isShiftCount reports whether n is guaranteed to be in 0..63 range.
+func isShiftCount(n *ir.Node) bool {
+	for n.Op == ir.OpParens {
+		n = n.Args[0]
+	}
+	switch n.Op {
+	case ir.OpIntLit:
+		v := n.Value.(int64)
+		return v >= 0 && v <= 63
+	case ir.OpBitAnd:
+		return isShiftCount(n.Args[1])
+	default:
+		return false
+	}
+}
+
+func TestFloatExprs(t *testing.T) {
+	// mathFuncs are the builtins used by floatMathCall.
+	mathFuncs := map[string]bool{"abs": true, "floor": true, "ceil": true, "round": true, "sqrt": true, "fmod": true}
+
+	for _, allowNaN := range []bool{false, true} {
+		calls := map[string]int{}
+		negations := 0
+		for seed := int64(0); seed < 50; seed++ {
+			config := &Config{Rand: rand.New(rand.NewSource(seed)), AllowNaN: allowNaN}
+			g := newGenerator(config)
+			g.scope.Enter()
+			g.scope.PushVar("f", ir.FloatType)
+
+			var isFloat func(n *ir.Node) bool
+			isFloat = func(n *ir.Node) bool {
+				switch n.Op {
+				case ir.OpFloatLit:
+					return true
+				case ir.OpVar, ir.OpCast, ir.OpIndex, ir.OpNullCoalesce:
+					return n.Type == ir.FloatType
+				case ir.OpParens:
+					return isFloat(n.Args[0])
+				case ir.OpNegation:
+					negations++
+					return isFloat(n.Args[0])
+				case ir.OpTernary:
+					if n.Args[1] == nil {
+						// x ?: y
+						return isFloat(n.Args[0]) && isFloat(n.Args[2])
+					}
+					return isFloat(n.Args[1]) && isFloat(n.Args[2])
+				case ir.OpAdd, ir.OpSub, ir.OpMul, ir.OpDiv:
+					return n.Type == ir.FloatType && isFloat(n.Args[0]) && isFloat(n.Args[1])
+				case ir.OpCall:
+					name := n.Args[0].Value.(string)
+					if name[0] == '\\' {
+						name = name[1:]
+					}
+					if !mathFuncs[name] {
+						fn := g.symtab.funcs[name]
+						return fn != nil && fn.Result == ir.FloatType
+					}
+					calls[name]++
+					if name == "sqrt" && !allowNaN && n.Args[1].Op != ir.OpCall {
+						t.Fatalf("sqrt argument is not wrapped into abs()")
+					}
+					// The round precision argument is int.
+					return isFloat(n.Args[1])
+				default:
+					return false
+				}
+			}
+
+			for i := 0; i < 20; i++ {
+				n := g.expr.GenerateValueOfType(ir.FloatType)
+				if !isFloat(n) {
+					t.Fatalf("seed %d: not a float expression:\n%s", seed, irprint.SprintNode(n))
+				}
+				var buf bytes.Buffer
+				if err := irprint.FprintNode(&buf, n, &irprint.Config{Rand: config.Rand, Strict: true}); err != nil {
+					t.Fatalf("seed %d: print: %v", seed, err)
+				}
+			}
+		}
+
+		if negations == 0 {
+			t.Errorf("allowNaN=%v: negation is never generated", allowNaN)
+		}
+		for name := range mathFuncs {
+			if generated := calls[name] != 0; generated != (name != "fmod" || allowNaN) {
+				t.Errorf("allowNaN=%v: %s generated: %v", allowNaN, name, generated)
+			}
+		}
+	}
+}
+
+func TestBoolExprComparisons(t *testing.T) {
+	isFloatLit := func(n *ir.Node) bool {
+		for n.Op == ir.OpParens {
+			n = n.Args[0]
+		}
+		return n.Op == ir.OpFloatLit
+	}
+
+	counts := map[ir.Op]int{}
+	spaceships := 0
+	var walk func(n *ir.Node)
+	walk = func(n *ir.Node) {
+		counts[n.Op]++
+		switch n.Op {
+		case ir.OpEqual2, ir.OpEqual3, ir.OpNotEqual2, ir.OpNotEqual3:
+			if isFloatLit(n.Args[0]) || isFloatLit(n.Args[1]) {
+				t.Fatalf("float operands are compared with %s", n.Op)
+			}
+		case ir.OpSpaceship:
+			spaceships++
+		}
+		for _, arg := range n.Args {
+			if arg != nil {
+				walk(arg)
+			}
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		for i := 0; i < 20; i++ {
+			walk(g.expr.condValue())
+			walk(g.expr.GenerateValueOfType(ir.BoolType))
+		}
+	}
+
+	ops := []ir.Op{
+		ir.OpLess,
+		ir.OpLessOrEqual,
+		ir.OpGreater,
+		ir.OpGreaterOrEqual,
+		ir.OpEqual2,
+		ir.OpEqual3,
+		ir.OpNotEqual2,
+		ir.OpNotEqual3,
+		ir.OpFloatEqual2,
+		ir.OpFloatEqual3,
+		ir.OpNotFloatEqual2,
+		ir.OpNotFloatEqual3,
+		ir.OpSpaceship,
+	}
+	for _, op := range ops {
+		if counts[op] == 0 {
+			t.Errorf("%s is never generated", op)
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		g.scope.Enter()
+		if n := g.expr.interpolatedString(); n.Op != ir.OpStringLit {
+			t.Fatalf("seed %d: %s is generated without variables in scope", seed, n.Op)
+		}
+
+		g.scope.PushVar("i", ir.IntType)
+		g.scope.PushVar("f", ir.FloatType)
+		g.scope.PushVar("s", ir.StringType)
+		g.scope.PushVar("b", ir.BoolType)
+		for i := 0; i < 20; i++ {
+			n := g.expr.interpolatedString()
+			if n.Op != ir.OpInterpolatedString {
+				continue
+			}
+			if len(n.Args) < 1 || len(n.Args) > 4 {
+				t.Fatalf("seed %d: unexpected number of parts: %d", seed, len(n.Args))
+			}
+			for j := 1; j < len(n.Args); j++ {
+				if n.Args[j].Op == ir.OpVar && n.Args[j-1].Op == ir.OpVar {
+					t.Fatalf("seed %d: variable parts are not separated", seed)
+				}
+			}
+			var buf bytes.Buffer
+			if err := irprint.FprintNode(&buf, n, &irprint.Config{Strict: true}); err != nil {
+				t.Fatalf("seed %d: print: %v", seed, err)
+			}
+			s := buf.String()
+			if s[0] != '"' || s[len(s)-1] != '"' || !strings.Contains(s, "{$") {
+				t.Fatalf("seed %d: unexpected interpolated string: %s", seed, s)
+			}
+		}
+	}
+}
+
+func TestCastExprs(t *testing.T) {
+	types := []ir.Type{ir.BoolType, ir.IntType, ir.FloatType, ir.StringType}
+	counts := map[ir.Type]int{}
+	var walk func(n *ir.Node)
+	walk = func(n *ir.Node) {
+		if n == nil {
+			return
+		}
+		if n.Op == ir.OpCast {
+			if n.Type == nil {
+				t.Fatalf("cast node type is not set")
+			}
+			counts[n.Type]++
+		}
+		for _, arg := range n.Args {
+			walk(arg)
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed)), CastProbability: 0.2})
+		for i := 0; i < 20; i++ {
+			for _, typ := range types {
+				n := g.expr.GenerateValueOfType(typ)
+				if n.Op == ir.OpCast && n.Type != typ {
+					t.Fatalf("seed %d: %s value is converted to %s", seed, typ, n.Type)
+				}
+				walk(n)
+			}
+		}
+	}
+
+	for _, typ := range types {
+		if counts[typ] == 0 {
+			t.Errorf("%s cast is never generated", typ)
+		}
+	}
+
+	// The casts are generated with the default config too.
+	numStringCasts := 0
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		for i := 0; i < 20; i++ {
+			ir.Inspect(g.expr.GenerateValueOfType(ir.StringType), func(n *ir.Node) {
+				if n.Op == ir.OpCast && n.Type == ir.StringType {
+					numStringCasts++
+				}
+			})
+		}
+	}
+	if numStringCasts == 0 {
+		t.Errorf("string casts are not generated with the default config")
+	}
+
+	// The nested casts are limited by the expression depth.
+	for seed := int64(0); seed < 5; seed++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := CreateProgramContext(ctx, &Config{Rand: rand.New(rand.NewSource(seed)), CastProbability: 1})
+		cancel()
+		if err != nil {
+			t.Fatalf("seed %d: CastProbability=1: %v", seed, err)
+		}
+	}
+}
+
+func TestArrayValues(t *testing.T) {
+	intArray := &ir.ArrayType{Elem: ir.IntType}
+	tests := []ir.Type{
+		intArray,
+		&ir.ArrayType{Elem: ir.StringType},
+		&ir.ArrayType{Elem: intArray},
+	}
+
+	var checkArray func(n *ir.Node, typ *ir.ArrayType) bool
+	checkArray = func(n *ir.Node, typ *ir.ArrayType) bool {
+		switch n.Op {
+		case ir.OpVar:
+			return ir.TypesIdentical(n.Type, typ)
+		case ir.OpArrayLit:
+			if len(n.Args) > 8 {
+				return false
+			}
+			elemType, ok := typ.Elem.(*ir.ArrayType)
+			if !ok {
+				return true
+			}
+			for _, elem := range n.Args {
+				if !checkArray(elem, elemType) {
+					return false
+				}
+			}
+			return true
+		default:
+			return false
+		}
+	}
+
+	for _, typ := range tests {
+		for seed := int64(0); seed < 20; seed++ {
+			g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+			g.scope.Enter()
+			g.scope.PushVar("arr", typ)
+			for i := 0; i < 10; i++ {
+				n := g.expr.GenerateValueOfType(typ)
+				if !checkArray(n, typ.(*ir.ArrayType)) {
+					t.Fatalf("%s: seed %d: unexpected array value:\n%s", typ, seed, irprint.SprintNode(n))
+				}
+			}
+		}
+	}
+}
+
+func TestArrayIndex(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		g.scope.Enter()
+		g.scope.PushVar("arr", &ir.ArrayType{Elem: ir.IntType})
+		for i := 0; i < 10; i++ {
+			n := g.expr.arrayIndex(ir.IntType)
+			if n.Type != ir.IntType {
+				t.Fatalf("seed %d: array index has %v type", seed, n.Type)
+			}
+			switch n.Op {
+			case ir.OpNullCoalesce:
+				if n.Args[0].Op != ir.OpIndex || n.Args[0].Args[0].Op != ir.OpVar {
+					t.Fatalf("seed %d: unexpected variable element read:\n%s", seed, irprint.SprintNode(n))
+				}
+			case ir.OpIndex:
+				if !isLiteralElem(n.Args[0], n.Args[1]) {
+					t.Fatalf("seed %d: out of bounds literal read:\n%s", seed, irprint.SprintNode(n))
+				}
+			default:
+				t.Fatalf("seed %d: unexpected %s array index", seed, n.Op)
+			}
+		}
+	}
+}
+
+// isLiteralElem reports whether arr is an array literal with a key element.
+func isLiteralElem(arr, key *ir.Node) bool {
+	if arr.Op != ir.OpArrayLit {
+		return false
+	}
+	if key.Op == ir.OpIntLit {
+		i := key.Value.(int64)
+		return i >= 0 && i < int64(len(arr.Args)) && arr.Args[i].Op != ir.OpKeyedElem
+	}
+	for _, elem := range arr.Args {
+		if elem.Op == ir.OpKeyedElem && elem.Args[0].Value == key.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAssocArrays(t *testing.T) {
+	typ := &ir.ArrayType{Key: ir.StringType, Elem: ir.IntType}
+	for _, duplicateKeys := range []bool{false, true} {
+		numDuplicates := 0
+		numVarReads := 0
+		for seed := int64(0); seed < 50; seed++ {
+			g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed)), DuplicateArrayKeys: duplicateKeys})
+			g.scope.Enter()
+			g.scope.PushVar("arr", typ)
+			g.scope.PushVar("list", &ir.ArrayType{Elem: ir.IntType})
+			for i := 0; i < 10; i++ {
+				n := g.expr.arrayValue(typ)
+				if n.Op == ir.OpVar {
+					if n.Value != "arr" {
+						t.Fatalf("seed %d: unexpected $%s variable", seed, n.Value)
+					}
+					continue
+				}
+				if len(n.Args) < 2 || len(n.Args) > 6 {
+					t.Fatalf("seed %d: unexpected number of elements: %d", seed, len(n.Args))
+				}
+				keys := map[string]bool{}
+				for _, elem := range n.Args {
+					key := elem.Args[0].Value.(string)
+					if keys[key] {
+						numDuplicates++
+					}
+					keys[key] = true
+				}
+
+				n = g.expr.assocArrayIndex(ir.IntType)
+				switch n.Op {
+				case ir.OpNullCoalesce:
+					numVarReads++
+					if v := n.Args[0].Args[0]; v.Value != "arr" || n.Args[0].Args[1].Op != ir.OpStringLit {
+						t.Fatalf("seed %d: unexpected element read:\n%s", seed, irprint.SprintNode(n))
+					}
+				case ir.OpIndex:
+					if !isLiteralElem(n.Args[0], n.Args[1]) {
+						t.Fatalf("seed %d: missing literal key read:\n%s", seed, irprint.SprintNode(n))
+					}
+				}
+			}
+		}
+		if (numDuplicates != 0) != duplicateKeys {
+			t.Errorf("duplicateKeys=%v: %d duplicated keys", duplicateKeys, numDuplicates)
+		}
+		if numVarReads == 0 {
+			t.Errorf("duplicateKeys=%v: variable elements are never read", duplicateKeys)
+		}
+	}
+}
+
+func TestMaxArrayDepth(t *testing.T) {
+	var arrayDepth func(typ ir.Type) int
+	arrayDepth = func(typ ir.Type) int {
+		switch typ := typ.(type) {
+		case *ir.ArrayType:
+			return arrayDepth(typ.Elem) + 1
+		case *ir.TupleType:
+			depth := 0
+			for _, elem := range typ.Elems {
+				if d := arrayDepth(elem); d > depth {
+					depth = d
+				}
+			}
+			return depth
+		default:
+			return 0
+		}
+	}
+
+	for _, maxDepth := range []int{0, 1, 2, 3} {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(1)), MaxArrayDepth: maxDepth})
+		for i := 0; i < 1000; i++ {
+			typ := g.expr.PickType()
+			if depth := arrayDepth(typ); depth > maxDepth && depth > 1 {
+				t.Fatalf("max depth %d: picked a %s type", maxDepth, typ)
+			}
+		}
+	}
+}
+
+func TestExprLimits(t *testing.T) {
+	// exprDepth is the tree depth without the parentheses and casts.
+	var exprDepth func(n *ir.Node) int
+	exprDepth = func(n *ir.Node) int {
+		depth := 0
+		for _, arg := range n.Args {
+			if arg == nil {
+				continue
+			}
+			if d := exprDepth(arg); d > depth {
+				depth = d
+			}
+		}
+		if n.Op == ir.OpParens || n.Op == ir.OpCast {
+			return depth
+		}
+		return depth + 1
+	}
+
+	for _, maxDepth := range []int{1, 2, 3} {
+		config := &Config{
+			Rand:            rand.New(rand.NewSource(1)),
+			MaxExprDepth:    maxDepth,
+			MaxExprNodes:    10,
+			CastProbability: 0.1,
+		}
+		g := newGenerator(config)
+		g.scope.Enter()
+		g.scope.PushVar("arr", &ir.ArrayType{Elem: ir.IntType})
+		for i := 0; i < 5000; i++ {
+			n := g.expr.GenerateValueOfType(g.expr.PickScalarType())
+			// A single subexpression can take up to 2 tree levels,
+			// like in (x <=> y) !== 0, and an array literal element
+			// read adds up to 3 more, like in array('k' => true)['k'].
+			if depth := exprDepth(n); depth > 2*maxDepth+3 {
+				t.Fatalf("max depth %d: generated a %d levels expression:\n%s", maxDepth, depth, irprint.SprintNode(n))
+			}
+		}
+	}
+}
+
+func TestChooseExprFallback(t *testing.T) {
+	g := newGenerator(&Config{Rand: rand.New(rand.NewSource(1))})
+	g.scope.Enter()
+
+	// Both options always fail in an empty scope.
+	list := makeChoicesList("int", nil, g.expr.intLit, []exprChoice{
+		{freq: 3, generate: g.expr.intVar},
+		{freq: 1, generate: func() *ir.Node { return nil }},
+	})
+	for i := 0; i < 100; i++ {
+		n := g.expr.chooseExpr(&list)
+		for n.Op == ir.OpParens {
+			n = n.Args[0]
+		}
+		if n.Op != ir.OpIntLit {
+			t.Fatalf("unexpected %s fallback result", n.Op)
+		}
+	}
+
+	empty := makeChoicesList("int", nil, g.expr.intLit, nil)
+	if n := g.expr.chooseExpr(&empty); n == nil {
+		t.Fatalf("empty choice list produced nil")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("choice list without a fallback is accepted")
+		}
+	}()
+	makeChoicesList("int", nil, nil, list.options)
+}
+
+func TestBuiltinCalls(t *testing.T) {
+	isInRange := func(n *ir.Node, param ir.TypeField) bool {
+		if n.Op == ir.OpIntLit {
+			v := n.Value.(int64)
+			return v >= param.Min && v <= param.Max
+		}
+		// min(max(x, $Min), $Max)
+		return n.Op == ir.OpCall && n.Args[0].Value == "min" && n.Args[2].Value == param.Max &&
+			n.Args[1].Args[0].Value == "max" && n.Args[1].Args[2].Value == param.Min
+	}
+
+	called := map[string]int{}
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed)), StrictTypes: true})
+		var walk func(n *ir.Node)
+		walk = func(n *ir.Node) {
+			children := n.Args
+			if n.Op == ir.OpCall && n.Args[0].Op == ir.OpName && g.symtab.IsBuiltinFunc(n.Args[0].Value.(string)) {
+				fn := g.symtab.funcs[n.Args[0].Value.(string)]
+				called[fn.Name]++
+				args := n.Args[1:]
+				if len(args) < fn.MinArgsNum || len(args) > len(fn.Params) {
+					t.Fatalf("seed %d: %s called with %d args", seed, fn.Name, len(args))
+				}
+				children = nil
+				for i, arg := range args {
+					param := fn.Params[i]
+					switch {
+					case param.Max != 0:
+						if !isInRange(arg, param) {
+							t.Fatalf("seed %d: %s $%s is not limited:\n%s", seed, fn.Name, param.Name, irprint.SprintNode(n))
+						}
+						if arg.Op == ir.OpCall {
+							// Skip the min and max calls.
+							arg = arg.Args[1].Args[1]
+						}
+					case needsStrictCast(param.Type) && !containsString(floatMathFuncs, fn.Name):
+						// Math calls only take the float expressions.
+						if arg.Op != ir.OpCast || arg.Type != param.Type {
+							t.Fatalf("seed %d: %s $%s is not a %s:\n%s", seed, fn.Name, param.Name, param.Type, irprint.SprintNode(n))
+						}
+					}
+					children = append(children, arg)
+				}
+			}
+			for _, arg := range children {
+				if arg != nil {
+					walk(arg)
+				}
+			}
+		}
+		for i := 0; i < 20; i++ {
+			walk(g.expr.GenerateValueOfType(g.expr.PickScalarType()))
+		}
+	}
+
+	for _, name := range []string{"strlen", "str_repeat", "str_pad", "intdiv", "max", "min", "number_format"} {
+		if called[name] == 0 {
+			t.Errorf("%s is never called", name)
+		}
+	}
+}
+
+func TestBuiltinsConfig(t *testing.T) {
+	custom := []*ir.FuncType{
+		{Name: "strlen", Params: []ir.TypeField{{Name: "s", Type: ir.StringType}}, MinArgsNum: 1, Result: ir.IntType},
+	}
+	tests := []struct {
+		config  Config
+		allowed func(fn *ir.FuncType) bool
+	}{
+		{Config{}, func(fn *ir.FuncType) bool { return fn.MinPHPVersion == 0 }},
+		{Config{MinPHPVersion: 80000}, func(fn *ir.FuncType) bool { return true }},
+		{Config{PureBuiltins: true}, func(fn *ir.FuncType) bool { return fn.MinPHPVersion == 0 && !fn.Impure }},
+		{Config{NoBuiltins: true}, func(fn *ir.FuncType) bool { return false }},
+		{Config{Builtins: custom}, func(fn *ir.FuncType) bool { return fn == custom[0] }},
+	}
+
+	for i, test := range tests {
+		test.config.Rand = rand.New(rand.NewSource(1))
+		g := newGenerator(&test.config)
+		funcs := test.config.Builtins
+		if funcs == nil {
+			funcs = phpfunc.GetList()
+		}
+		for _, fn := range funcs {
+			if g.symtab.IsBuiltinFunc(fn.Name) != test.allowed(fn) {
+				t.Errorf("test %d: %s registered: %v", i, fn.Name, g.symtab.IsBuiltinFunc(fn.Name))
+			}
+		}
+		for j := 0; j < 100; j++ {
+			g.expr.GenerateValueOfType(g.expr.PickScalarType())
+		}
+	}
+}
+
+func TestNoBuiltinsCalls(t *testing.T) {
+	builtins := map[string]bool{}
+	for _, fn := range phpfunc.GetList() {
+		builtins[fn.Name] = true
+	}
+	for seed := int64(1); seed <= 200; seed++ {
+		for _, f := range CreateProgramFromSeed(seed, Config{NoBuiltins: true}).Files {
+			ir.WalkFile(f, func(n *ir.Node) bool {
+				if n.Op == ir.OpCall && n.Args[0].Op == ir.OpName {
+					name := strings.TrimPrefix(n.Args[0].Value.(string), `\`)
+					if builtins[name] {
+						t.Fatalf("seed %d: %s: %s is called with NoBuiltins", seed, f.Name, name)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestUserFuncCalls(t *testing.T) {
+	nonScalarCalls := 0
+	for seed := int64(0); seed < 30; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		program := g.CreateProgram()
+
+		// Only the earlier declared functions can be called,
+		// so the call graph is acyclic.
+		declared := map[string]bool{}
+		var walk func(caller string, n *ir.Node)
+		walk = func(caller string, n *ir.Node) {
+			if n.Op == ir.OpCall && n.Args[0].Op == ir.OpName {
+				name := n.Args[0].Value.(string)
+				if fn := g.symtab.funcs[name]; fn != nil && !g.symtab.IsBuiltinFunc(name) {
+					if !declared[name] {
+						t.Fatalf("seed %d: %s calls %s before it's declared", seed, caller, name)
+					}
+					if _, ok := fn.Result.(*ir.ScalarType); !ok {
+						nonScalarCalls++
+					}
+				}
+			}
+			for _, arg := range n.Args {
+				if arg != nil {
+					walk(caller, arg)
+				}
+			}
+		}
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				decl, ok := n.(*ir.RootFuncDecl)
+				if !ok {
+					continue
+				}
+				walk(decl.Type.Name, decl.Body)
+				declared[decl.Type.Name] = true
+			}
+		}
+	}
+	if nonScalarCalls == 0 {
+		t.Errorf("non-scalar result functions are never called")
+	}
+}
+
+func TestRecursiveFuncs(t *testing.T) {
+	const maxDepth = 4
+
+	isDepthDecrement := func(n *ir.Node) bool {
+		return n.Op == ir.OpSub && n.Args[0].Op == ir.OpVar && n.Args[0].Value == "depth" &&
+			n.Args[1].Op == ir.OpIntLit && n.Args[1].Value == int64(1)
+	}
+
+	numRecursiveCalls := 0
+	for seed := int64(0); seed < 30; seed++ {
+		config := &Config{Rand: rand.New(rand.NewSource(seed)), RecursiveFuncs: true, MaxRecursionDepth: maxDepth}
+		g := newGenerator(config)
+		program := g.CreateProgram()
+
+		var walk func(caller *ir.RootFuncDecl, n *ir.Node)
+		walk = func(caller *ir.RootFuncDecl, n *ir.Node) {
+			if n.Op == ir.OpCall && n.Args[0].Op == ir.OpName && g.symtab.IsRecursiveFunc(n.Args[0].Value.(string)) {
+				numRecursiveCalls++
+				depth := n.Args[1]
+				switch {
+				case g.symtab.IsRecursiveFunc(caller.Type.Name):
+					if !isDepthDecrement(depth) {
+						t.Fatalf("seed %d: %s doesn't decrement the depth:\n%s", seed, caller.Type.Name, irprint.SprintNode(n))
+					}
+				case depth.Op == ir.OpIntLit:
+					if v := depth.Value.(int64); v < 1 || v > maxDepth {
+						t.Fatalf("seed %d: %s passes %d depth", seed, caller.Type.Name, v)
+					}
+				default:
+					t.Fatalf("seed %d: %s calls a recursive function:\n%s", seed, caller.Type.Name, irprint.SprintNode(n))
+				}
+			}
+			for _, arg := range n.Args {
+				if arg != nil {
+					walk(caller, arg)
+				}
+			}
+		}
+
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				decl, ok := n.(*ir.RootFuncDecl)
+				if !ok {
+					continue
+				}
+				if g.symtab.IsRecursiveFunc(decl.Type.Name) {
+					baseCase := decl.Body.Args[0]
+					if baseCase.Op != ir.OpIf || !terminates(baseCase.Args[1]) {
+						t.Fatalf("seed %d: %s doesn't start with a base case", seed, decl.Type.Name)
+					}
+					// The base case can't have recursive calls.
+					walk(&ir.RootFuncDecl{Type: &ir.FuncType{Name: "base case"}}, baseCase)
+					for _, stmt := range decl.Body.Args[1:] {
+						walk(decl, stmt)
+					}
+					continue
+				}
+				walk(decl, decl.Body)
+			}
+		}
+	}
+	if numRecursiveCalls == 0 {
+		t.Errorf("recursive functions are never called")
+	}
+}
+
+func TestRecursiveProgramRun(t *testing.T) {
+	if _, err := exec.LookPath("php"); err != nil {
+		t.Skip("php is not installed")
+	}
+
+	for seed := int64(0); seed < 5; seed++ {
+		program := CreateProgram(&Config{Rand: rand.New(rand.NewSource(seed)), RecursiveFuncs: true})
+		runProgram(t, seed, program, 10*time.Second)
+	}
+}
+
+// runProgram runs the program with php and returns its output.
+// It fails if the program doesn't terminate in time.
+func runProgram(t *testing.T, seed int64, program *Program, timeout time.Duration) []byte {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, f := range program.RuntimeFiles {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), f.Contents, 0o664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range program.Files {
+		var buf bytes.Buffer
+		if err := irprint.FprintFile(&buf, f, &irprint.Config{}); err != nil {
+			t.Fatalf("seed %d: print %s: %v", seed, f.Name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.Name), buf.Bytes(), 0o664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "php", "-f", filepath.Join(dir, "main.php")).Output()
+	if ctx.Err() != nil {
+		t.Fatalf("seed %d: the program doesn't terminate", seed)
+	}
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		t.Fatalf("seed %d: run php: %v", seed, err)
+	}
+	return out
+}
+
+func TestClosureCaptures(t *testing.T) {
+	// assigned collects the variables that are assigned in n,
+	// except for the nested closures.
+	var assigned func(n *ir.Node, vars map[string]bool)
+	assigned = func(n *ir.Node, vars map[string]bool) {
+		if n.Op == ir.OpClosure {
+			return
+		}
+		if n.Op == ir.OpAssign && n.Args[0].Op == ir.OpVar {
+			vars[n.Args[0].Value.(string)] = true
+		}
+		for _, arg := range n.Args {
+			if arg != nil {
+				assigned(arg, vars)
+			}
+		}
+	}
+
+	numClosures := 0
+	numByRef := 0
+	var checkClosure func(seed int64, closure *ir.Node)
+	var walk func(seed int64, n *ir.Node, visible map[string]bool)
+	walk = func(seed int64, n *ir.Node, visible map[string]bool) {
+		switch n.Op {
+		case ir.OpVar:
+			if visible != nil && !visible[n.Value.(string)] {
+				t.Fatalf("seed %d: closure references $%s", seed, n.Value)
+			}
+		case ir.OpClosure:
+			for _, u := range n.Value.(*ir.ClosureInfo).Uses {
+				if visible != nil && !visible[u.Name] {
+					t.Fatalf("seed %d: closure captures undefined $%s", seed, u.Name)
+				}
+			}
+			checkClosure(seed, n)
+			return
+		}
+		for _, arg := range n.Args {
+			if arg != nil {
+				walk(seed, arg, visible)
+			}
+		}
+	}
+	checkClosure = func(seed int64, closure *ir.Node) {
+		numClosures++
+		body := closure.Args[0]
+		visible := map[string]bool{}
+		for _, param := range closure.Type.(*ir.FuncType).Params {
+			visible[param.Name] = true
+		}
+		for _, u := range closure.Value.(*ir.ClosureInfo).Uses {
+			visible[u.Name] = true
+			if u.ByRef {
+				numByRef++
+			}
+		}
+		assigned(body, visible)
+		walk(seed, body, visible)
+	}
+
+	for _, byRef := range []bool{false, true} {
+		numClosures, numByRef = 0, 0
+		for seed := int64(0); seed < 30; seed++ {
+			program := CreateProgram(&Config{Rand: rand.New(rand.NewSource(seed)), ByRefCaptures: byRef})
+			for _, f := range program.Files {
+				for _, n := range f.Nodes {
+					if decl, ok := n.(*ir.RootFuncDecl); ok {
+						walk(seed, decl.Body, nil)
+					}
+				}
+			}
+		}
+		if numClosures == 0 {
+			t.Errorf("byRef=%v: closures are never generated", byRef)
+		}
+		if (numByRef != 0) != byRef {
+			t.Errorf("byRef=%v: %d by reference captures", byRef, numByRef)
+		}
+	}
+}
+
+func TestClosureCapturesParams(t *testing.T) {
+	configs := []Config{
+		{},
+		{ElseProbability: 0.5, MaxElseIfs: 3, RecursiveFuncs: true, ShadowVars: true},
+		{Dialect: DialectKPHP},
+	}
+	numSeeds := int64(1000)
+	if testing.Short() {
+		numSeeds = 100
+	}
+	for i, config := range configs {
+		for seed := int64(1); seed <= numSeeds; seed++ {
+			for _, f := range CreateProgramFromSeed(seed, config).Files {
+				ir.WalkFile(f, func(n *ir.Node) bool {
+					if n.Op != ir.OpClosure {
+						return true
+					}
+					for _, u := range n.Value.(*ir.ClosureInfo).Uses {
+						for _, param := range n.Type.(*ir.FuncType).Params {
+							if u.Name == param.Name {
+								t.Fatalf("config %d seed %d: %s: closure captures its $%s param", i, seed, f.Name, u.Name)
+							}
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+}
+
+func TestTernaries(t *testing.T) {
+	types := []ir.Type{ir.BoolType, ir.IntType, ir.FloatType, ir.StringType}
+	for _, typ := range types {
+		numTernaries := 0
+		numShort := 0
+		var walk func(n *ir.Node)
+		walk = func(n *ir.Node) {
+			if n.Op == ir.OpTernary {
+				if n.Args[1] == nil {
+					numShort++
+				} else {
+					numTernaries++
+				}
+			}
+			for _, arg := range n.Args {
+				if arg != nil {
+					walk(arg)
+				}
+			}
+		}
+
+		for seed := int64(0); seed < 50; seed++ {
+			config := &Config{Rand: rand.New(rand.NewSource(seed))}
+			g := newGenerator(config)
+			for i := 0; i < 20; i++ {
+				n := g.expr.GenerateValueOfType(typ)
+				walk(n)
+				// The malformed nodes are reported as errors in the strict mode.
+				var buf bytes.Buffer
+				if err := irprint.FprintNode(&buf, n, &irprint.Config{Rand: config.Rand, Strict: true}); err != nil {
+					t.Fatalf("%s: seed %d: print: %v", typ, seed, err)
+				}
+			}
+		}
+		if numTernaries == 0 || numShort == 0 {
+			t.Errorf("%s: %d ternaries and %d short ternaries generated", typ, numTernaries, numShort)
+		}
+	}
+}
+
+func TestIncDecExprs(t *testing.T) {
+	numIncDec := 0
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		g.scope.Enter()
+		g.scope.PushVar("i", ir.IntType)
+		g.scope.PushVar("j", ir.IntType)
+		for i := 0; i < 20; i++ {
+			n := g.expr.GenerateValueOfType(ir.IntType)
+			// A mutated variable should not be referenced
+			// anywhere else in the same expression.
+			mutated := map[string]int{}
+			refs := map[string]int{}
+			var walk func(n *ir.Node)
+			walk = func(n *ir.Node) {
+				switch n.Op {
+				case ir.OpPreInc, ir.OpPreDec, ir.OpPostInc, ir.OpPostDec:
+					if n.Args[0].Op != ir.OpVar || n.Type != ir.IntType {
+						t.Fatalf("seed %d: unexpected %s node", seed, n.Op)
+					}
+					mutated[n.Args[0].Value.(string)]++
+					numIncDec++
+				case ir.OpVar:
+					refs[n.Value.(string)]++
+				}
+				for _, arg := range n.Args {
+					if arg != nil {
+						walk(arg)
+					}
+				}
+			}
+			walk(n)
+			for name := range mutated {
+				if refs[name] != 1 {
+					t.Fatalf("seed %d: $%s is mutated and referenced %d times", seed, name, refs[name])
+				}
+			}
+		}
+	}
+	if numIncDec == 0 {
+		t.Error("increments are never generated")
+	}
+}
+
+func TestIncDecStmts(t *testing.T) {
+	for _, weird := range []bool{false, true} {
+		numStringIncs := 0
+		for seed := int64(0); seed < 50; seed++ {
+			g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed)), WeirdIncrements: weird})
+			g.currentBlock = &ir.Node{Op: ir.OpBlock}
+			g.scope.Enter()
+			g.scope.PushVar("i", ir.IntType)
+			g.scope.PushVar("s", ir.StringType)
+			for i := 0; i < 10; i++ {
+				g.pushIncDecStmt()
+			}
+			for _, stmt := range g.currentBlock.Args {
+				switch stmt.Args[0].Value.(string) {
+				case "i":
+				case "s":
+					numStringIncs++
+				default:
+					t.Fatalf("seed %d: unexpected %s statement", seed, stmt.Op)
+				}
+			}
+		}
+		if (numStringIncs != 0) != weird {
+			t.Errorf("weird=%v: %d string increments", weird, numStringIncs)
+		}
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		negative bool
+		curly    bool
+		clamped  bool
+	}{
+		{name: "default", clamped: true},
+		{name: "php71", config: Config{MinPHPVersion: 70100}, negative: true, clamped: true},
+		{name: "php73", config: Config{MaxPHPVersion: 70300}, curly: true, clamped: true},
+		{name: "php8", config: Config{MaxPHPVersion: 80000}, clamped: true},
+		{name: "warnings", config: Config{AllowWarnings: true}},
+	}
+
+	for _, test := range tests {
+		numNegative, numCurly := 0, 0
+		for seed := int64(0); seed < 100; seed++ {
+			config := test.config
+			config.Rand = rand.New(rand.NewSource(seed))
+			g := newGenerator(&config)
+			g.scope.Enter()
+			g.scope.PushVar("s", ir.StringType)
+			n := g.expr.stringIndex()
+			if n == nil {
+				continue
+			}
+
+			elem := n
+			if n.Op == ir.OpNullCoalesce {
+				elem = n.Args[0]
+			}
+			if elem.Op != ir.OpIndex || n.Type != ir.StringType {
+				t.Fatalf("%s: seed %d: unexpected %s node", test.name, seed, n.Op)
+			}
+			key := elem.Args[1]
+			switch elem.Args[0].Op {
+			case ir.OpStringLit:
+				// Literals are always indexed within their bounds.
+				length := int64(len(elem.Args[0].Value.(string)))
+				offset := key.Value.(int64)
+				if offset >= length || offset < -length {
+					t.Fatalf("%s: seed %d: offset %d is out of bounds", test.name, seed, offset)
+				}
+			case ir.OpVar:
+				if (n.Op == ir.OpNullCoalesce) != test.clamped {
+					t.Fatalf("%s: seed %d: the read is not defaulted", test.name, seed)
+				}
+				if test.clamped && key.Op != ir.OpIntLit && key.Op != ir.OpMod {
+					t.Fatalf("%s: seed %d: unclamped %s offset", test.name, seed, key.Op)
+				}
+			}
+			if key.Op == ir.OpIntLit && key.Value.(int64) < 0 {
+				numNegative++
+			}
+			if curly, _ := elem.Value.(bool); curly {
+				numCurly++
+			}
+		}
+		// Unclamped offsets can be negative int literals by themselves.
+		if test.clamped && (numNegative != 0) != test.negative {
+			t.Errorf("%s: %d negative offsets", test.name, numNegative)
+		}
+		if (numCurly != 0) != test.curly {
+			t.Errorf("%s: %d curly offsets", test.name, numCurly)
+		}
+	}
+}
+
+func TestStringLits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		check  func(s string) bool
+	}{
+		{
+			name:   "ascii",
+			config: Config{StringWeights: StringWeights{ASCII: 1}, MaxStringLength: 4},
+			check: func(s string) bool {
+				for i := 0; i < len(s); i++ {
+					if s[i] < ' ' || s[i] > '~' {
+						return false
+					}
+				}
+				return len(s) <= 4
+			},
+		},
+		{
+			name:   "utf8",
+			config: Config{StringWeights: StringWeights{UTF8: 1}, MaxStringLength: 4},
+			check: func(s string) bool {
+				return utf8.ValidString(s) && utf8.RuneCountInString(s) <= 4
+			},
+		},
+		{
+			name:   "no invalid utf8",
+			config: Config{StringWeights: StringWeights{Bytes: 1, UTF8: 1}},
+			check:  utf8.ValidString,
+		},
+		{
+			name:   "numeric",
+			config: Config{StringWeights: StringWeights{Numeric: 1}},
+			check: func(s string) bool {
+				return containsString(numericStringValues, s)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		config := test.config
+		config.Rand = rand.New(rand.NewSource(1))
+		g := newValueGenerator(&config)
+		for i := 0; i < 500; i++ {
+			if s := g.StringValue(); !test.check(s) {
+				t.Fatalf("%s: unexpected %q string", test.name, s)
+			}
+		}
+	}
+
+	// The invalid UTF-8 strings are only generated with InvalidUTF8.
+	config := &Config{Rand: rand.New(rand.NewSource(1)), InvalidUTF8: true}
+	g := newValueGenerator(config)
+	numInvalid := 0
+	for i := 0; i < 500; i++ {
+		if !utf8.ValidString(g.StringValue()) {
+			numInvalid++
+		}
+	}
+	if numInvalid == 0 {
+		t.Error("invalid UTF-8 strings are never generated")
+	}
+}
+
+func TestFloatLits(t *testing.T) {
+	for _, special := range []bool{false, true} {
+		g := newValueGenerator(&Config{Rand: rand.New(rand.NewSource(1)), SpecialFloats: special})
+		numSpecial := 0
+		numNegativeZero := 0
+		numSubnormal := 0
+		for i := 0; i < 1000; i++ {
+			x := g.FloatValue()
+			switch {
+			case math.IsNaN(x) || math.IsInf(x, 0):
+				numSpecial++
+			case x == 0 && math.Signbit(x):
+				numNegativeZero++
+			case x != 0 && math.Abs(x) < 0x1p-1022:
+				numSubnormal++
+			}
+		}
+		// NaN and infinities are off by default.
+		if (numSpecial != 0) != special {
+			t.Errorf("special=%v: %d NaN or infinite values", special, numSpecial)
+		}
+		if numNegativeZero == 0 || numSubnormal == 0 {
+			t.Errorf("special=%v: %d negative zeros and %d subnormals", special, numNegativeZero, numSubnormal)
+		}
+	}
+}
+
+func TestExprWeights(t *testing.T) {
+	var walk func(n *ir.Node) bool
+	walk = func(n *ir.Node) bool {
+		if n.Op == ir.OpConcat {
+			return false
+		}
+		for _, arg := range n.Args {
+			if arg != nil && !walk(arg) {
+				return false
+			}
+		}
+		return true
+	}
+
+	weights := map[ExprChoice]int{{Type: "string", Name: "concat"}: 0}
+	for seed := int64(0); seed < 50; seed++ {
+		program := CreateProgram(&Config{Rand: rand.New(rand.NewSource(seed)), ExprWeights: weights})
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				if decl, ok := n.(*ir.RootFuncDecl); ok && !walk(decl.Body) {
+					t.Fatalf("seed %d: %s contains a concatenation", seed, decl.Type.Name)
+				}
+			}
+		}
+	}
+
+	invalid := []map[ExprChoice]int{
+		{{Type: "float", Name: "lit"}: 0, {Type: "float", Name: "sqrt"}: 1},
+		{{Type: "array", Name: "lit"}: 1},
+	}
+	disabled := map[ExprChoice]int{}
+	for _, name := range []string{"ternary", "short_ternary", "cast", "call", "concat", "lit", "interpolated", "var", "array_index", "closure_call", "index"} {
+		disabled[ExprChoice{Type: "string", Name: name}] = 0
+	}
+	invalid = append(invalid, disabled)
+	for i, weights := range invalid {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("weights %d: no panic", i)
+				}
+			}()
+			newGenerator(&Config{Rand: rand.New(rand.NewSource(1)), ExprWeights: weights})
+		}()
+	}
+}
+
+func TestLitPools(t *testing.T) {
+	config := &Config{
+		Rand:          rand.New(rand.NewSource(1)),
+		IntLits:       []int64{42},
+		StringLits:    []string{"pool"},
+		StringWeights: StringWeights{Pool: 1},
+	}
+	g := newValueGenerator(config)
+	numPooled := 0
+	for i := 0; i < 100; i++ {
+		if g.IntValue() == 42 {
+			numPooled++
+		}
+		if s := g.StringValue(); s != "pool" {
+			t.Fatalf("unexpected %q string", s)
+		}
+	}
+	if numPooled == 0 {
+		t.Error("int literals are never picked from the pool")
+	}
+}
+
+func TestPHPFeatures(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   phpFeatures
+	}{
+		{Config{}, phpFeatures{typeJuggling: true, impureBuiltins: true, switchContinue: true, legacyComparisons: true, newComparisons: true}},
+		{Config{PHPVersion: "7.0"}, phpFeatures{minVersion: 70000, curlyStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, switchContinue: true, legacyComparisons: true}},
+		{Config{PHPVersion: "7.3"}, phpFeatures{minVersion: 70300, negativeStringOffsets: true, curlyStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, switchContinue: true, legacyComparisons: true}},
+		{Config{PHPVersion: "7.4.33"}, phpFeatures{minVersion: 70433, negativeStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, nullCoalesceAssign: true, switchContinue: true, legacyComparisons: true}},
+		{Config{PHPVersion: "8.1"}, phpFeatures{minVersion: 80100, negativeStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, nullCoalesceAssign: true, switchContinue: true, newComparisons: true}},
+		{Config{PHPVersion: "8.1", SelfChecks: true}, phpFeatures{minVersion: 80100, negativeStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, nullCoalesceAssign: true, switchContinue: true, newComparisons: true, selfChecks: true}},
+		{Config{MinPHPVersion: 70400, MaxPHPVersion: 80100}, phpFeatures{minVersion: 70400, negativeStringOffsets: true, typeJuggling: true, impureBuiltins: true, nullCoalesceAssign: true, switchContinue: true, legacyComparisons: true, newComparisons: true}},
+		{Config{MinPHPVersion: 80000}, phpFeatures{minVersion: 80000, negativeStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, nullCoalesceAssign: true, switchContinue: true, newComparisons: true}},
+		{Config{PHPVersion: "8.2", MinPHPVersion: 70000}, phpFeatures{minVersion: 80200, negativeStringOffsets: true, stringNumberComparisons: true, typeJuggling: true, impureBuiltins: true, nullCoalesceAssign: true, switchContinue: true, newComparisons: true}},
+		{
+			Config{Dialect: DialectKPHP, MaxPHPVersion: 70300, ByRefCaptures: true},
+			phpFeatures{stringNumberComparisons: true, tuples: true, varTypeTags: true, legacyComparisons: true},
+		},
+		{Config{ByRefCaptures: true, PureBuiltins: true}, phpFeatures{typeJuggling: true, byRefCaptures: true, switchContinue: true, legacyComparisons: true, newComparisons: true}},
+	}
+	for _, test := range tests {
+		if have := newPHPFeatures(&test.config); *have != test.want {
+			t.Errorf("%+v:\nhave: %+v\nwant: %+v", test.config, *have, test.want)
+		}
+	}
+
+	for _, version := range []string{"8", "8.x", "8.1.2.3", "-7.4", "7.100"} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%q version is accepted", version)
+				}
+			}()
+			newPHPFeatures(&Config{PHPVersion: version})
+		}()
+	}
+}
+
+func TestDialects(t *testing.T) {
+	for _, dialect := range []Dialect{DialectPHP, DialectKPHP} {
+		numTuples := 0
+		numTags := 0
+		var walk func(seed int64, n *ir.Node)
+		walk = func(seed int64, n *ir.Node) {
+			switch n.Op {
+			case ir.OpCall:
+				if n.Args[0].Op == ir.OpName && n.Args[0].Value.(string) == "tuple" {
+					numTuples++
+				}
+			case ir.OpClosure:
+				for _, u := range n.Value.(*ir.ClosureInfo).Uses {
+					if u.ByRef && dialect == DialectKPHP {
+						t.Fatalf("seed %d: KPHP closure captures $%s by reference", seed, u.Name)
+					}
+				}
+			case ir.OpPreInc, ir.OpPostInc:
+				if n.Args[0].Type == ir.StringType && dialect == DialectKPHP {
+					t.Fatalf("seed %d: KPHP string increment", seed)
+				}
+			case ir.OpAssign:
+				switch n.Args[0].Type.(type) {
+				case *ir.ArrayType, *ir.TupleType:
+					if n.Value != nil {
+						numTags++
+					}
+				}
+			}
+			for _, arg := range n.Args {
+				if arg != nil {
+					walk(seed, arg)
+				}
+			}
+		}
+
+		for seed := int64(0); seed < 30; seed++ {
+			config := &Config{
+				Rand:            rand.New(rand.NewSource(seed)),
+				Dialect:         dialect,
+				ByRefCaptures:   true,
+				WeirdIncrements: true,
+			}
+			program := CreateProgram(config)
+			for _, f := range program.Files {
+				for _, n := range f.Nodes {
+					if decl, ok := n.(*ir.RootFuncDecl); ok {
+						walk(seed, decl.Body)
+					}
+				}
+			}
+		}
+		kphp := dialect == DialectKPHP
+		if (numTuples != 0) != kphp {
+			t.Errorf("dialect %d: %d tuples generated", dialect, numTuples)
+		}
+		if (numTags != 0) != kphp {
+			t.Errorf("dialect %d: %d array vars with @var tags", dialect, numTags)
+		}
+	}
+}
+
+func TestIfStmts(t *testing.T) {
+	const maxElseIfs = 2
+
+	numElse := 0
+	numElseIfs := 0
+	numShared := 0
+	var walk func(seed int64, n *ir.Node)
+	walkChain := func(seed int64, n *ir.Node) {
+		var branches []*ir.Node
+		elseIfs := 0
+		for {
+			branches = append(branches, n.Args[1])
+			if n.Op == ir.OpIf {
+				break
+			}
+			next := n.Args[2]
+			if next.Op != ir.OpIf && next.Op != ir.OpIfElse {
+				branches = append(branches, next)
+				numElse++
+				break
+			}
+			elseIfs++
+			n = next
+		}
+		if elseIfs > maxElseIfs {
+			t.Fatalf("seed %d: %d elseif branches", seed, elseIfs)
+		}
+		numElseIfs += elseIfs
+
+		// Check whether all branches end with the same variable assignment.
+		shared := ""
+		for i, b := range branches {
+			last := b.Args[len(b.Args)-1]
+			if last.Op != ir.OpAssign && last.Op != ir.OpAssignModify {
+				shared = ""
+				break
+			}
+			name := last.Args[0].Value.(string)
+			if i != 0 && name != shared {
+				shared = ""
+				break
+			}
+			shared = name
+		}
+		if shared != "" && len(branches) > 1 {
+			numShared++
+		}
+		for _, b := range branches {
+			walk(seed, b)
+		}
+	}
+	walk = func(seed int64, n *ir.Node) {
+		if n.Op == ir.OpIf || n.Op == ir.OpIfElse {
+			walkChain(seed, n)
+			return
+		}
+		for _, arg := range n.Args {
+			if arg != nil {
+				walk(seed, arg)
+			}
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		config := &Config{
+			Rand:            rand.New(rand.NewSource(seed)),
+			ElseProbability: 0.5,
+			MaxElseIfs:      maxElseIfs,
+		}
+		program := CreateProgram(config)
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				if decl, ok := n.(*ir.RootFuncDecl); ok {
+					walk(seed, decl.Body)
+				}
+			}
+		}
+	}
+	if numElse == 0 || numElseIfs == 0 || numShared == 0 {
+		t.Errorf("%d else, %d elseif branches and %d shared assignments", numElse, numElseIfs, numShared)
+	}
+}
+
+func TestCreateProgramDeterminism(t *testing.T) {
+	config := Config{
+		ElseProbability: 0.5,
+		MaxElseIfs:      3,
+		RecursiveFuncs:  true,
+		ByRefForeach:    true,
+		ShadowVars:      true,
+		OutputMode:      OutputBoth,
+		StmtWeights:     map[string]int{"var_dump": 1, "unset": 2},
+		ExprWeights:     map[ExprChoice]int{{Type: "string", Name: "lit"}: 5},
+	}
+	print := func(seed int64) string {
+		var buf bytes.Buffer
+		for _, f := range CreateProgramFromSeed(seed, config).Files {
+			buf.WriteString(irprint.SprintFile(f))
+		}
+		return buf.String()
+	}
+
+	for seed := int64(1); seed <= 20; seed++ {
+		program1 := print(seed)
+		program2 := print(seed)
+		if program1 != program2 {
+			t.Fatalf("seed %d: the programs differ:\n%s\n%s", seed, program1, program2)
+		}
+		if header := fmt.Sprintf("seed: %d\n", seed); !strings.Contains(program1, header) {
+			t.Fatalf("seed %d: the seed is not printed", seed)
+		}
+		if print(seed+1) == program1 {
+			t.Fatalf("seeds %d and %d give the same program", seed, seed+1)
+		}
+	}
+}
+
+func TestCloneEqualHash(t *testing.T) {
+	config := Config{
+		ElseProbability: 0.5,
+		MaxElseIfs:      3,
+		RecursiveFuncs:  true,
+		ShadowVars:      true,
+		StmtWeights:     map[string]int{"var_dump": 1, "unset": 2},
+	}
+	for seed := int64(1); seed <= 20; seed++ {
+		for _, f := range CreateProgramFromSeed(seed, config).Files {
+			clone := f.Clone()
+			if !ir.EqualFile(f, clone) {
+				t.Fatalf("seed %d: %s clone is not equal", seed, f.Name)
+			}
+			if ir.HashFile(f) != ir.HashFile(clone) {
+				t.Fatalf("seed %d: %s clone hash differs", seed, f.Name)
+			}
+
+			var lits []*ir.Node
+			ir.WalkFile(clone, func(n *ir.Node) bool {
+				if n.Op == ir.OpIntLit || n.Op == ir.OpStringLit {
+					lits = append(lits, n)
+				}
+				return true
+			})
+			// Rehashing the whole file is slow, so only some literals are checked.
+			step := len(lits)/5 + 1
+			for i := 0; i < len(lits); i += step {
+				lit := lits[i]
+				orig := lit.Value
+				if lit.Op == ir.OpIntLit {
+					lit.Value = lit.Value.(int64) + 1
+				} else {
+					lit.Value = lit.Value.(string) + "x"
+				}
+				if ir.EqualFile(f, clone) {
+					t.Fatalf("seed %d: %s is equal after changing %v literal", seed, f.Name, orig)
+				}
+				if ir.HashFile(f) == ir.HashFile(clone) {
+					t.Fatalf("seed %d: %s hash is the same after changing %v literal", seed, f.Name, orig)
+				}
+				lit.Value = orig
+			}
+		}
+	}
+}
+
+func TestLoopStmts(t *testing.T) {
+	const maxNesting = 2
+
+	// refs counts the references to the name variable in n.
+	var refs func(n *ir.Node, name string) int
+	refs = func(n *ir.Node, name string) int {
+		count := 0
+		if n.Op == ir.OpVar && n.Value.(string) == name {
+			count++
+		}
+		for _, arg := range n.Args {
+			if arg != nil {
+				count += refs(arg, name)
+			}
+		}
+		return count
+	}
+	// hasContinue reports whether n has a continue of the current loop.
+	// The levels argument is the number of the loops and switches
+	// between n and the current loop.
+	var hasContinue func(n *ir.Node, levels int) bool
+	hasContinue = func(n *ir.Node, levels int) bool {
+		switch n.Op {
+		case ir.OpContinue:
+			level := n.Value.(int)
+			if level == 0 {
+				level = 1
+			}
+			return level == levels+1
+		case ir.OpWhile, ir.OpFor, ir.OpForeach, ir.OpSwitch:
+			levels++
+		case ir.OpClosure:
+			return false
+		}
+		for _, arg := range n.Args {
+			if arg != nil && hasContinue(arg, levels) {
+				return true
+			}
+		}
+		return false
+	}
+
+	numLoops := 0
+	var walk func(seed int64, n *ir.Node, depth int)
+	walk = func(seed int64, n *ir.Node, depth int) {
+		if n.Op == ir.OpWhile || n.Op == ir.OpFor || n.Op == ir.OpForeach {
+			depth++
+			if depth > maxNesting {
+				t.Fatalf("seed %d: loop nesting level is %d", seed, depth)
+			}
+		}
+		if n.Op == ir.OpWhile {
+			numLoops++
+			cond := n.Args[0]
+			body := n.Args[1]
+			counter := cond.Args[0]
+			if counter.Op == ir.OpPostInc {
+				counter = counter.Args[0]
+			}
+			name := counter.Value.(string)
+			if cond.Op == ir.OpGreater {
+				// The counter is decremented at the end of the body,
+				// unless the loop is always left on the first iteration.
+				last := body.Args[len(body.Args)-1]
+				numUpdates := 1
+				if terminates(body) {
+					numUpdates = 0
+				} else if last.Op != ir.OpPostDec || last.Args[0].Value.(string) != name {
+					t.Fatalf("seed %d: no counter update at the end of the loop", seed)
+				}
+				if refs(body, name) != numUpdates {
+					t.Fatalf("seed %d: $%s is used in the loop body", seed, name)
+				}
+				if hasContinue(body, 0) {
+					t.Fatalf("seed %d: continue skips the counter update", seed)
+				}
+			} else if refs(body, name) != 0 {
+				t.Fatalf("seed %d: $%s is used in the loop body", seed, name)
+			}
+		}
+		if n.Op == ir.OpFor {
+			numLoops++
+			name := n.Args[0].Args[0].Args[0].Value.(string)
+			if refs(n.Args[3], name) != 0 {
+				t.Fatalf("seed %d: $%s is used in the loop body", seed, name)
+			}
+		}
+		for _, arg := range n.Args {
+			if arg != nil {
+				walk(seed, arg, depth)
+			}
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		program := CreateProgram(&Config{Rand: rand.New(rand.NewSource(seed)), MaxLoopNesting: maxNesting})
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				if decl, ok := n.(*ir.RootFuncDecl); ok {
+					walk(seed, decl.Body, 0)
+				}
+			}
+		}
+	}
+	if numLoops == 0 {
+		t.Fatal("loops are never generated")
+	}
+}
+
+func TestLoopProgramRun(t *testing.T) {
+	if _, err := exec.LookPath("php"); err != nil {
+		t.Skip("php is not installed")
+	}
+
+	for seed := int64(0); seed < 10; seed++ {
+		config := &Config{
+			Rand:           rand.New(rand.NewSource(seed)),
+			MaxLoopNesting: 4,
+			ByRefForeach:   true,
+		}
+		program := CreateProgram(config)
+		runProgram(t, seed, program, 5*time.Second)
+	}
+}
+
+func TestForeachStmts(t *testing.T) {
+	// isAssigned reports whether block assigns the name variable
+	// before the i-th statement.
+	isAssigned := func(block *ir.Node, i int, name string) bool {
+		for _, n := range block.Args[:i] {
+			if n.Op == ir.OpAssign && n.Args[0].Op == ir.OpVar && n.Args[0].Value.(string) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, footguns := range []bool{false, true} {
+		numLoops := 0
+		numByRef := 0
+		var walk func(seed int64, n *ir.Node)
+		walk = func(seed int64, n *ir.Node) {
+			for i, stmt := range n.Args {
+				if stmt == nil {
+					continue
+				}
+				walk(seed, stmt)
+				if n.Op != ir.OpBlock || stmt.Op != ir.OpForeach {
+					continue
+				}
+				numLoops++
+				key := stmt.Args[1]
+				value := stmt.Args[2]
+				body := stmt.Args[3]
+				if key != nil && !isAssigned(n, i, key.Value.(string)) {
+					t.Fatalf("seed %d: $%s is not initialized before the loop", seed, key.Value)
+				}
+				if !isAssigned(n, i, value.Value.(string)) {
+					t.Fatalf("seed %d: $%s is not initialized before the loop", seed, value.Value)
+				}
+				acc := body.Args[0]
+				x := acc.Args[1]
+				if x.Op == ir.OpCast {
+					x = x.Args[0]
+				}
+				if acc.Op != ir.OpAssignModify || x.Value != value.Value {
+					t.Fatalf("seed %d: the loop body doesn't accumulate $%s", seed, value.Value)
+				}
+				next := n.Args[i+1]
+				unset := next.Op == ir.OpUnset && next.Args[0].Value.(string) == value.Value.(string)
+				if stmt.Value.(bool) {
+					numByRef++
+					if unset == footguns {
+						t.Fatalf("seed %d: footguns=%v, unset=%v", seed, footguns, unset)
+					}
+				} else if unset {
+					t.Fatalf("seed %d: by value $%s is unset", seed, value.Value)
+				}
+			}
+		}
+
+		for seed := int64(0); seed < 50; seed++ {
+			config := &Config{
+				Rand:         rand.New(rand.NewSource(seed)),
+				ByRefForeach: true,
+				Footguns:     footguns,
+			}
+			program := CreateProgram(config)
+			for _, f := range program.Files {
+				for _, n := range f.Nodes {
+					if decl, ok := n.(*ir.RootFuncDecl); ok {
+						walk(seed, decl.Body)
+					}
+				}
+			}
+		}
+		if numLoops == 0 || numByRef == 0 {
+			t.Fatalf("footguns=%v: %d loops, %d by reference", footguns, numLoops, numByRef)
+		}
+	}
+}
+
+func TestSwitchStmts(t *testing.T) {
+	for _, allowWarnings := range []bool{false, true} {
+		numSwitches := 0
+		numMiddleDefaults := 0
+		numFallthroughs := 0
+		numDuplicates := 0
+		numContinues := make(map[int]int)
+
+		// switchContinues counts the continue statements
+		// that target the switch node.
+		var switchContinues func(n *ir.Node) map[int]int
+		switchContinues = func(n *ir.Node) map[int]int {
+			counts := make(map[int]int)
+			var walk func(n *ir.Node)
+			walk = func(n *ir.Node) {
+				switch n.Op {
+				case ir.OpContinue:
+					counts[n.Value.(int)]++
+				case ir.OpWhile, ir.OpFor, ir.OpForeach, ir.OpSwitch, ir.OpClosure:
+					return
+				}
+				for _, arg := range n.Args {
+					if arg != nil {
+						walk(arg)
+					}
+				}
+			}
+			for _, c := range n.Args[1:] {
+				walk(c)
+			}
+			return counts
+		}
+
+		var walk func(seed int64, n *ir.Node, loopDepth int)
+		walk = func(seed int64, n *ir.Node, loopDepth int) {
+			switch n.Op {
+			case ir.OpWhile, ir.OpFor, ir.OpForeach:
+				loopDepth++
+			case ir.OpClosure:
+				loopDepth = 0
+			case ir.OpSwitch:
+				numSwitches++
+				labels := make(map[any]bool)
+				numLabels := 0
+				clauses := n.Args[1:]
+				for i, c := range clauses {
+					body := c.Args
+					if c.Op == ir.OpCase {
+						numLabels++
+						if labels[c.Args[0].Value] {
+							numDuplicates++
+						}
+						labels[c.Args[0].Value] = true
+						body = c.Args[1:]
+					} else if i != len(clauses)-1 {
+						numMiddleDefaults++
+					}
+					if body[0].Op != ir.OpAssignModify {
+						t.Fatalf("seed %d: the case doesn't update the accumulator", seed)
+					}
+					last := body[len(body)-1].Op
+					if i != len(clauses)-1 && last != ir.OpBreak && last != ir.OpContinue {
+						numFallthroughs++
+					}
+				}
+				if numLabels < 2 || numLabels > 6 {
+					t.Fatalf("seed %d: %d case labels", seed, numLabels)
+				}
+				for level, count := range switchContinues(n) {
+					if loopDepth == 0 || level == 0 && !allowWarnings {
+						t.Fatalf("seed %d: continue %d at loop depth %d", seed, level, loopDepth)
+					}
+					numContinues[level] += count
+				}
+			}
+			for _, arg := range n.Args {
+				if arg != nil {
+					walk(seed, arg, loopDepth)
+				}
+			}
+		}
+
+		for seed := int64(0); seed < 100; seed++ {
+			config := &Config{
+				Rand:           rand.New(rand.NewSource(seed)),
+				DuplicateCases: allowWarnings,
+				AllowWarnings:  allowWarnings,
+			}
+			program := CreateProgram(config)
+			for _, f := range program.Files {
+				for _, n := range f.Nodes {
+					if decl, ok := n.(*ir.RootFuncDecl); ok {
+						walk(seed, decl.Body, 0)
+					}
+				}
+			}
+		}
+		if numSwitches == 0 || numMiddleDefaults == 0 || numFallthroughs == 0 || numContinues[2] == 0 {
+			t.Fatalf("allowWarnings=%v: %d switches, %d middle defaults, %d fallthroughs, %d continue 2",
+				allowWarnings, numSwitches, numMiddleDefaults, numFallthroughs, numContinues[2])
+		}
+		if (numDuplicates != 0) != allowWarnings {
+			t.Fatalf("duplicateCases=%v: %d duplicated labels", allowWarnings, numDuplicates)
+		}
+		if (numContinues[0] != 0) != allowWarnings {
+			t.Fatalf("allowWarnings=%v: %d switch continues", allowWarnings, numContinues[0])
+		}
+	}
+}
+
+func TestBreakLevels(t *testing.T) {
+	isJump := func(n *ir.Node) bool {
+		return n.Op == ir.OpBreak || n.Op == ir.OpContinue
+	}
+
+	for _, deadCode := range []bool{false, true} {
+		numDeadCode := 0
+		numLevels := map[ir.Op]int{}
+
+		// targets are the loops and switches around the current node,
+		// from the outermost one. Switches are false.
+		var walk func(seed int64, n *ir.Node, targets []bool)
+		walk = func(seed int64, n *ir.Node, targets []bool) {
+			switch n.Op {
+			case ir.OpBreak, ir.OpContinue:
+				level := n.Value.(int)
+				if level == 0 {
+					level = 1
+				}
+				if level > len(targets) {
+					t.Fatalf("seed %d: %s %d at nesting level %d", seed, n.Op, level, len(targets))
+				}
+				if level > 1 {
+					numLevels[n.Op]++
+				}
+				if n.Op == ir.OpContinue && !targets[len(targets)-level] {
+					t.Fatalf("seed %d: continue %d targets a switch", seed, level)
+				}
+			case ir.OpWhile, ir.OpFor, ir.OpForeach:
+				targets = append(targets[:len(targets):len(targets)], true)
+			case ir.OpSwitch:
+				targets = append(targets[:len(targets):len(targets)], false)
+			case ir.OpClosure:
+				targets = nil
+			case ir.OpBlock, ir.OpCase, ir.OpDefaultCase:
+				for i, stmt := range n.Args {
+					if i != len(n.Args)-1 && isJump(stmt) {
+						numDeadCode++
+					}
+				}
+			}
+			for _, arg := range n.Args {
+				if arg != nil {
+					walk(seed, arg, targets)
+				}
+			}
+		}
+
+		for seed := int64(0); seed < 100; seed++ {
+			config := &Config{
+				Rand:           rand.New(rand.NewSource(seed)),
+				MaxLoopNesting: 4,
+				DeadCode:       deadCode,
+			}
+			program := CreateProgram(config)
+			for _, f := range program.Files {
+				for _, n := range f.Nodes {
+					if decl, ok := n.(*ir.RootFuncDecl); ok {
+						walk(seed, decl.Body, nil)
+					}
+				}
+			}
+		}
+		if numLevels[ir.OpBreak] == 0 || numLevels[ir.OpContinue] == 0 {
+			t.Fatalf("deadCode=%v: %d break levels, %d continue levels",
+				deadCode, numLevels[ir.OpBreak], numLevels[ir.OpContinue])
+		}
+		if (numDeadCode != 0) != deadCode {
+			t.Fatalf("deadCode=%v: %d unreachable statements", deadCode, numDeadCode)
+		}
+	}
+}
+
+func TestObserveLiveVars(t *testing.T) {
+	for _, noObserve := range []bool{false, true} {
+		numObserved := 0
+		for seed := int64(0); seed < 20; seed++ {
+			config := &Config{
+				Rand:           rand.New(rand.NewSource(seed)),
+				RecursiveFuncs: true,
+				NoObserve:      noObserve,
+			}
+			program := CreateProgram(config)
+
+			// observed returns the variables printed right before the i-th block statement.
+			observed := func(block *ir.Node, i int) map[string]bool {
+				names := make(map[string]bool)
+				for j := i - 1; j >= 0; j-- {
+					call := block.Args[j]
+					if call.Op != ir.OpCall || !strings.HasPrefix(call.Args[0].Value.(string), "observe_") {
+						break
+					}
+					arg := call.Args[2]
+					if observeFuncName(arg.Type) != call.Args[0].Value.(string) {
+						t.Fatalf("seed %d: %s is called for a %s var", seed, call.Args[0].Value, arg.Type)
+					}
+					names[arg.Value.(string)] = true
+					numObserved++
+				}
+				return names
+			}
+
+			for _, f := range program.Files {
+				for _, n := range f.Nodes {
+					decl, ok := n.(*ir.RootFuncDecl)
+					if !ok || decl.Type.Name == "main" {
+						continue
+					}
+					// The unset params are not printed.
+					unset := make(map[string]bool)
+					var collectUnset func(n *ir.Node)
+					collectUnset = func(n *ir.Node) {
+						if n.Op == ir.OpUnset {
+							unset[n.Args[0].Value.(string)] = true
+						}
+						for _, arg := range n.Args {
+							if arg != nil {
+								collectUnset(arg)
+							}
+						}
+					}
+					collectUnset(decl.Body)
+					// checkParams reports whether all scalar params are printed.
+					checkParams := func(names map[string]bool) {
+						for _, param := range decl.Type.Params {
+							if param.Name == "depth" || observeFuncName(param.Type) == "" || unset[param.Name] {
+								continue
+							}
+							if names[param.Name] == noObserve {
+								t.Fatalf("seed %d: %s: $%s observed=%v", seed, decl.Type.Name, param.Name, names[param.Name])
+							}
+						}
+					}
+					var walk func(n *ir.Node)
+					walk = func(n *ir.Node) {
+						if n.Op == ir.OpClosure {
+							return
+						}
+						for i, arg := range n.Args {
+							if arg == nil {
+								continue
+							}
+							if n.Op == ir.OpBlock && arg.Op == ir.OpReturn {
+								checkParams(observed(n, i))
+							}
+							walk(arg)
+						}
+					}
+					walk(decl.Body)
+					if decl.Type.Result == ir.VoidType {
+						checkParams(observed(decl.Body, len(decl.Body.Args)))
+					}
+				}
+			}
+		}
+		if (numObserved != 0) == noObserve {
+			t.Fatalf("noObserve=%v: %d observed vars", noObserve, numObserved)
+		}
+	}
+
+	// The vars are printed in their declaration order,
+	// a redeclared variable is printed at its latest position.
+	g := newGenerator(&Config{Rand: rand.New(rand.NewSource(1))})
+	g.scope.Enter()
+	for _, name := range []string{"a", "b", "c", "a", "d"} {
+		g.scope.PushVar(name, ir.IntType)
+	}
+	var names []string
+	for _, call := range g.observeLiveVars() {
+		names = append(names, call.Args[1].Value.(string))
+	}
+	if have, want := strings.Join(names, ","), "b,c,a,d"; have != want {
+		t.Fatalf("observed vars order: have %s, want %s", have, want)
+	}
+}
+
+func TestOutputHash(t *testing.T) {
+	// mainCalls returns the names of the funcs called by main.
+	mainCalls := func(program *Program) []string {
+		var names []string
+		for _, n := range program.Files[len(program.Files)-1].Nodes {
+			if decl, ok := n.(*ir.RootFuncDecl); ok && decl.Type.Name == "main" {
+				for _, stmt := range decl.Body.Args {
+					if stmt.Op == ir.OpCall {
+						names = append(names, stmt.Args[0].Value.(string))
+					}
+				}
+			}
+		}
+		return names
+	}
+	for _, mode := range []OutputMode{OutputFull, OutputHash, OutputBoth} {
+		names := mainCalls(CreateProgram(&Config{Rand: rand.New(rand.NewSource(0)), OutputMode: mode}))
+		hasStart := names[0] == "observe_start"
+		hasFinish := names[len(names)-1] == "observe_finish"
+		if hasStart != (mode != OutputFull) || hasFinish != hasStart {
+			t.Fatalf("mode %d: main calls %v", mode, names)
+		}
+	}
+
+	// The raw output is not hashed, so it's only generated in the full mode.
+	for _, mode := range []OutputMode{OutputFull, OutputHash, OutputBoth} {
+		numPrints := 0
+		for seed := int64(0); seed < 20; seed++ {
+			for _, f := range CreateProgramFromSeed(seed, Config{OutputMode: mode}).Files {
+				ir.WalkFile(f, func(n *ir.Node) bool {
+					if n.Op == ir.OpPrint || n.Op == ir.OpEcho {
+						numPrints++
+					}
+					return true
+				})
+			}
+		}
+		if (numPrints != 0) != (mode == OutputFull) {
+			t.Errorf("mode %d: %d print and echo nodes", mode, numPrints)
+		}
+	}
+
+	if _, err := exec.LookPath("php"); err != nil {
+		t.Skip("php is not installed")
+	}
+
+	for seed := int64(0); seed < 5; seed++ {
+		var outputs [2][]byte
+		for i := range outputs {
+			config := &Config{
+				Rand:       rand.New(rand.NewSource(seed)),
+				OutputMode: OutputHash,
+				Seed:       seed,
+			}
+			outputs[i] = runProgram(t, seed, CreateProgram(config), 5*time.Second)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Fatalf("seed %d: outputs differ:\n%s\n%s", seed, outputs[0], outputs[1])
+		}
+		if !bytes.Contains(outputs[0], []byte(fmt.Sprintf("seed %d: ", seed))) {
+			t.Fatalf("seed %d: no hash in the output:\n%s", seed, outputs[0])
+		}
+	}
+}
+
+func TestStmtWeights(t *testing.T) {
+	// countOps counts the n nodes by their op.
+	var countOps func(n *ir.Node, counts map[ir.Op]int)
+	countOps = func(n *ir.Node, counts map[ir.Op]int) {
+		counts[n.Op]++
+		for _, arg := range n.Args {
+			if arg != nil {
+				countOps(arg, counts)
+			}
+		}
+	}
+	generate := func(config *Config) (*Program, map[ir.Op]int) {
+		program := CreateProgram(config)
+		counts := make(map[ir.Op]int)
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				if decl, ok := n.(*ir.RootFuncDecl); ok {
+					countOps(decl.Body, counts)
+				}
+			}
+		}
+		return program, counts
+	}
+
+	noLoops := map[string]int{"while": 0, "for": 0, "foreach": 0}
+	forLoops := map[string]int{"for": 20}
+	var sawFor bool
+	for seed := int64(0); seed < 20; seed++ {
+		_, counts := generate(&Config{Rand: rand.New(rand.NewSource(seed)), StmtWeights: noLoops})
+		if counts[ir.OpWhile]+counts[ir.OpFor]+counts[ir.OpForeach]+counts[ir.OpContinue] != 0 {
+			t.Fatalf("seed %d: loops are generated: %v", seed, counts)
+		}
+		_, counts = generate(&Config{Rand: rand.New(rand.NewSource(seed)), StmtWeights: forLoops})
+		sawFor = sawFor || counts[ir.OpFor] != 0
+	}
+	if !sawFor {
+		t.Fatal("for loops are never generated")
+	}
+
+	tests := []struct {
+		config   Config
+		warnings int
+	}{
+		{Config{}, 0},
+		{Config{MaxLoopNesting: -1}, 0},
+		{Config{MaxLoopNesting: -1, StmtWeights: map[string]int{"while": 2, "for": 0}}, 1},
+		{Config{OutputMode: OutputHash, StmtWeights: map[string]int{"echo": 1}}, 1},
+		{Config{OutputMode: OutputHash, NoObserve: true, StmtWeights: map[string]int{"echo": 1}}, 0},
+	}
+	for _, test := range tests {
+		test.config.Rand = rand.New(rand.NewSource(1))
+		program, counts := generate(&test.config)
+		if len(program.Warnings) != test.warnings {
+			t.Errorf("%v: warnings: %q", test.config.StmtWeights, program.Warnings)
+		}
+		if test.config.MaxLoopNesting < 0 && counts[ir.OpWhile]+counts[ir.OpFor]+counts[ir.OpForeach] != 0 {
+			t.Errorf("%v: loops are generated", test.config.StmtWeights)
+		}
+		if test.config.OutputMode == OutputHash && !test.config.NoObserve && counts[ir.OpEcho] != 0 {
+			t.Errorf("%v: echo is generated", test.config.StmtWeights)
+		}
+	}
+
+	disabled := map[string]int{}
+	for _, o := range newGenerator(&Config{Rand: rand.New(rand.NewSource(1))}).stmtChoices.options {
+		disabled[o.name] = 0
+	}
+	for i, weights := range []map[string]int{{"goto": 1}, disabled} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("weights %d: no panic", i)
+				}
+			}()
+			newGenerator(&Config{Rand: rand.New(rand.NewSource(1)), StmtWeights: weights})
+		}()
+	}
+}
+
+func TestStatementLimits(t *testing.T) {
+	const (
+		maxBlockStatements    = 3
+		maxFunctionStatements = 12
+		maxBlockNesting       = 2
+	)
+
+	isObserve := func(n *ir.Node) bool {
+		return n.Op == ir.OpCall && strings.HasPrefix(n.Args[0].Value.(string), "observe_")
+	}
+
+	for seed := int64(0); seed < 100; seed++ {
+		config := &Config{
+			Rand:                  rand.New(rand.NewSource(seed)),
+			RecursiveFuncs:        true,
+			ElseProbability:       0.5,
+			MaxElseIfs:            2,
+			MaxBlockStatements:    maxBlockStatements,
+			MaxFunctionStatements: maxFunctionStatements,
+			MaxBlockNesting:       maxBlockNesting,
+		}
+		program := CreateProgram(config)
+
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				decl, ok := n.(*ir.RootFuncDecl)
+				if !ok || decl.Type.Name == "main" {
+					continue
+				}
+				numStatements := 0
+				numHelpers := 0
+
+				// walk checks the block statements. The extra argument is
+				// the number of the block helper statements, like the if
+				// branch shared variable assignment.
+				var walk func(n *ir.Node, depth, extra int)
+				walk = func(n *ir.Node, depth, extra int) {
+					if n.Op == ir.OpClosure && n.Value.(*ir.ClosureInfo).ArrowFunc {
+						// The arrow function body is a single expression.
+						return
+					}
+					isBlock := n.Op == ir.OpBlock || n.Op == ir.OpCase || n.Op == ir.OpDefaultCase
+					if isBlock && depth > maxBlockNesting {
+						t.Fatalf("seed %d: %s: block nesting level is %d", seed, decl.Type.Name, depth)
+					}
+					if n.Op == ir.OpCase || n.Op == ir.OpDefaultCase {
+						// The accumulator update and the break.
+						extra += 2
+					}
+					count := 0
+					for i, arg := range n.Args {
+						if arg == nil || n.Op == ir.OpCase && i == 0 {
+							continue
+						}
+						if isBlock && !isObserve(arg) && arg.Op != ir.OpReturn {
+							count++
+							switch arg.Op {
+							case ir.OpSwitch, ir.OpWhile:
+								extra += 2
+							case ir.OpForeach:
+								extra += 5
+							}
+						}
+						childDepth := depth
+						if isBlock {
+							childDepth++
+						}
+						childExtra := 0
+						switch n.Op {
+						case ir.OpIf, ir.OpIfElse, ir.OpWhile:
+							childExtra = 1
+						case ir.OpForeach:
+							childExtra = 2
+						}
+						walk(arg, childDepth, childExtra)
+					}
+					if !isBlock {
+						return
+					}
+					if count > maxBlockStatements+extra {
+						t.Fatalf("seed %d: %s: %d statements in a block", seed, decl.Type.Name, count)
+					}
+					numStatements += count
+					numHelpers += extra
+				}
+				// The function body ends with the non-scalar block vars dumps.
+				walk(decl.Body, 0, maxBlockStatements)
+				if numStatements > maxFunctionStatements+numHelpers {
+					t.Fatalf("seed %d: %s: %d statements", seed, decl.Type.Name, numStatements)
+				}
+			}
+		}
+	}
+}
+
+func TestVarPicking(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	reads := map[string]int{}
+	numReads := 0
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		g.scope.Enter()
+		for _, name := range names {
+			g.scope.PushVar(name, ir.IntType)
+		}
+		g.scope.PushVar("s", ir.StringType)
+		for i := 0; i < 10; i++ {
+			v := g.scope.FindVarOfType(ir.IntType)
+			if v == nil || v.typ != ir.IntType {
+				t.Fatalf("seed %d: int variable is not found", seed)
+			}
+			reads[v.name]++
+			numReads++
+		}
+	}
+	for _, name := range names {
+		// The uniform distribution gives a quarter of reads.
+		if reads[name] < numReads/8 {
+			t.Errorf("$%s is read %d times out of %d", name, reads[name], numReads)
+		}
+	}
+}
+
+func TestShadowVars(t *testing.T) {
+	numShadows := 0
+	for seed := int64(0); seed < 50; seed++ {
+		config := &Config{
+			Rand:       rand.New(rand.NewSource(seed)),
+			ShadowVars: true,
+		}
+		program := CreateProgram(config)
+
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				decl, ok := n.(*ir.RootFuncDecl)
+				if !ok {
+					continue
+				}
+				// blocks are the variable types by the enclosing blocks.
+				var blocks []map[string]ir.Type
+				outerType := func(name string) ir.Type {
+					for i := len(blocks) - 2; i >= 0; i-- {
+						if typ, ok := blocks[i][name]; ok {
+							return typ
+						}
+					}
+					return nil
+				}
+				var walk func(n *ir.Node)
+				// walkStmts checks the block statements, the plain
+				// nested blocks share the scope with their parent.
+				var walkStmts func(block *ir.Node)
+				walkStmts = func(block *ir.Node) {
+					for i, stmt := range block.Args {
+						switch {
+						case stmt.Op == ir.OpBlock:
+							walkStmts(stmt)
+							continue
+						case stmt.Op == ir.OpAssign && stmt.Args[0].Op == ir.OpVar:
+							name := stmt.Args[0].Value.(string)
+							typ := stmt.Args[0].Type
+							if outer := outerType(name); outer != nil {
+								if ir.TypeDocString(outer) != ir.TypeDocString(typ) {
+									t.Fatalf("seed %d: %s: $%s %s shadows %s", seed, decl.Type.Name, name, ir.TypeDocString(typ), ir.TypeDocString(outer))
+								}
+								// The last if branch statement can be
+								// a shared variable assignment.
+								if i != len(block.Args)-1 {
+									numShadows++
+								}
+							}
+							blocks[len(blocks)-1][name] = typ
+						case stmt.Op == ir.OpUnset:
+							name := stmt.Args[0].Value.(string)
+							if outerType(name) != nil {
+								t.Fatalf("seed %d: %s: outer $%s is unset", seed, decl.Type.Name, name)
+							}
+						}
+						walk(stmt)
+					}
+				}
+				walk = func(n *ir.Node) {
+					if n.Op == ir.OpClosure {
+						// The closure variables are not shared with the function.
+						return
+					}
+					if n.Op != ir.OpBlock {
+						for _, arg := range n.Args {
+							if arg != nil {
+								walk(arg)
+							}
+						}
+						return
+					}
+					blocks = append(blocks, map[string]ir.Type{})
+					walkStmts(n)
+					blocks = blocks[:len(blocks)-1]
+				}
+				walk(decl.Body)
+			}
+		}
+	}
+	if numShadows == 0 {
+		t.Error("shadowing variables are never generated")
+	}
+
+	// The redeclared outer variable is marked as mutated.
+	numRedeclared := 0
+	for seed := int64(0); seed < 50; seed++ {
+		g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed)), ShadowVars: true})
+		g.scope.Enter()
+		g.scope.PushVar("x", ir.IntType)
+		g.scope.Enter()
+		g.currentBlock = &ir.Node{Op: ir.OpBlock}
+		g.pushVarDeclStmt()
+		redeclared := g.scope.IsCurrentBlockVar("x")
+		g.scope.Leave()
+		if redeclared {
+			numRedeclared++
+			if !g.scope.FindVarByName("x").mutated {
+				t.Fatalf("seed %d: redeclared $x is not marked as mutated", seed)
+			}
+		}
+	}
+	if numRedeclared == 0 {
+		t.Error("outer variables are never redeclared")
+	}
+}
+
+func TestCompoundAssignStmts(t *testing.T) {
+	nullableInt := &ir.NullableType{X: ir.IntType}
+	vars := map[string]ir.Type{
+		"i": ir.IntType,
+		"f": ir.FloatType,
+		"s": ir.StringType,
+		"b": ir.BoolType,
+		"n": nullableInt,
+		"a": &ir.ArrayType{Elem: ir.IntType},
+	}
+	wantOps := map[string][]ir.Op{
+		"i": {ir.OpAdd, ir.OpSub, ir.OpMul, ir.OpBitAnd, ir.OpBitOr, ir.OpBitXor},
+		"f": {ir.OpAdd, ir.OpSub, ir.OpMul},
+		"s": {ir.OpConcat},
+		"n": {ir.OpNullCoalesce},
+	}
+	for _, version := range []string{"7.3", "8.1"} {
+		haveOps := map[string]map[ir.Op]bool{}
+		for seed := int64(0); seed < 50; seed++ {
+			g := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed)), PHPVersion: version})
+			g.scope.Enter()
+			for _, name := range []string{"i", "f", "s", "b", "n", "a"} {
+				g.scope.PushVar(name, vars[name])
+			}
+			for i := 0; i < 20; i++ {
+				g.currentBlock = &ir.Node{Op: ir.OpBlock}
+				if !g.pushCompoundAssignStmt() {
+					continue
+				}
+				n := g.currentBlock.Args[0]
+				if n.Op != ir.OpAssignModify || n.Args[0].Op != ir.OpVar {
+					t.Fatalf("seed %d: unexpected %s statement", seed, n.Op)
+				}
+				name := n.Args[0].Value.(string)
+				if haveOps[name] == nil {
+					haveOps[name] = map[ir.Op]bool{}
+				}
+				haveOps[name][n.Value.(ir.Op)] = true
+				if n.Value == ir.OpMul {
+					// The *= rhs is bounded, so it can't overflow in a loop.
+					rhs := n.Args[1]
+					switch name {
+					case "i":
+						if rhs.Op != ir.OpTernary || rhs.Args[2].Op != ir.OpIntLit || rhs.Args[2].Value != int64(1) {
+							t.Fatalf("seed %d: unbounded $i *= %s", seed, rhs.Op)
+						}
+					case "f":
+						if rhs.Op != ir.OpFloatLit || math.Abs(rhs.Value.(float64)) > 1 {
+							t.Fatalf("seed %d: unbounded $f *= %v", seed, rhs.Value)
+						}
+					}
+				}
+				if !g.scope.FindVarByName(name).mutated {
+					t.Fatalf("seed %d: $%s is not marked as mutated", seed, name)
+				}
+			}
+		}
+
+		for name, ops := range haveOps {
+			for op := range ops {
+				allowed := false
+				for _, want := range wantOps[name] {
+					allowed = allowed || op == want
+				}
+				if !allowed || version == "7.3" && op == ir.OpNullCoalesce {
+					t.Errorf("PHP %s: %s compound assignment is generated for %s", version, op, vars[name])
+				}
+			}
+		}
+		for name, ops := range wantOps {
+			if name == "n" && version == "7.3" {
+				continue
+			}
+			for _, op := range ops {
+				if !haveOps[name][op] {
+					t.Errorf("PHP %s: %s compound assignment is never generated for %s", version, op, vars[name])
+				}
+			}
+		}
+	}
+}
+
+func TestRuntimeLibrary(t *testing.T) {
+	defined := map[string]bool{}
+	for _, m := range regexp.MustCompile(`(?m)^function (\w+)\(`).FindAllSubmatch(RuntimeLibrary().Contents, -1) {
+		defined[string(m[1])] = true
+	}
+	known := map[string]bool{}
+	for _, keyword := range []string{"array", "function", "fn", "if", "elseif", "while", "for", "foreach", "switch", "print", "isset", "unset", "empty", "list", "exit", "return", "use"} {
+		known[keyword] = true
+	}
+	for _, fn := range phpfunc.GetList() {
+		known[fn.Name] = true
+	}
+
+	stringLit := regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+	comment := regexp.MustCompile(`(?s)/\*.*?\*/`)
+	call := regexp.MustCompile(`(?:^|[^\w$>:\\])(\w+)\s*\(`)
+	called := map[string]bool{}
+	for seed := int64(0); seed < 50; seed++ {
+		config := &Config{
+			Rand:          rand.New(rand.NewSource(seed)),
+			SpecialFloats: true,
+			AllowNaN:      true,
+			OutputMode:    OutputBoth,
+		}
+		program := CreateProgram(config)
+		if len(program.RuntimeFiles) != 1 || program.RuntimeFiles[0].Name != RuntimeLibrary().Name {
+			t.Fatalf("seed %d: the runtime library is not added", seed)
+		}
+
+		userFuncs := map[string]bool{}
+		for _, f := range program.Files {
+			for _, n := range f.Nodes {
+				if decl, ok := n.(*ir.RootFuncDecl); ok {
+					userFuncs[decl.Type.Name] = true
+				}
+			}
+		}
+		for _, f := range program.Files {
+			var buf bytes.Buffer
+			if err := irprint.FprintFile(&buf, f, &irprint.Config{}); err != nil {
+				t.Fatalf("seed %d: print %s: %v", seed, f.Name, err)
+			}
+			code := comment.ReplaceAll(stringLit.ReplaceAll(buf.Bytes(), nil), nil)
+			for _, m := range call.FindAllSubmatch(code, -1) {
+				name := string(m[1])
+				if known[name] || userFuncs[name] {
+					continue
+				}
+				if !defined[name] {
+					t.Fatalf("seed %d: %s: %s is not defined by the runtime library", seed, f.Name, name)
+				}
+				called[name] = true
+			}
+		}
+	}
+
+	for _, name := range []string{"_safe_int_div", "_safe_int_mod", "float_eq2", "make_nan", "dump_with_pos", "observe_int"} {
+		if !called[name] {
+			t.Errorf("%s is never called", name)
+		}
+	}
+}
+
+func TestCreateProgramContext(t *testing.T) {
+	// The if statements are nested so often that
+	// the generation would take too long otherwise.
+	config := &Config{
+		Rand:            rand.New(rand.NewSource(1)),
+		ElseProbability: 1,
+		MaxElseIfs:      5,
+		StmtWeights:     map[string]int{"if": 10},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	program, err := CreateProgramContext(ctx, config)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the generation took %s", elapsed)
+	}
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, f := range program.Files {
+		if err := irprint.FprintFile(io.Discard, f, &irprint.Config{}); err != nil {
+			t.Fatalf("print %s: %v", f.Name, err)
+		}
+	}
+
+	program, err = CreateProgramContext(context.Background(), &Config{Rand: rand.New(rand.NewSource(1))})
+	if err != nil || len(program.Files) == 0 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMaxTotalExprs(t *testing.T) {
+	countNodes := func(program *Program) int {
+		numNodes := 0
+		for _, f := range program.Files {
+			ir.WalkFile(f, func(n *ir.Node) bool {
+				numNodes++
+				return true
+			})
+		}
+		return numNodes
+	}
+
+	const maxTotalExprs = 100
+	for seed := int64(0); seed < 20; seed++ {
+		unlimited := newGenerator(&Config{Rand: rand.New(rand.NewSource(seed))})
+		unlimitedNodes := countNodes(unlimited.CreateProgram())
+		if unlimited.expr.totalExprs <= maxTotalExprs {
+			t.Fatalf("seed %d: only %d subexpressions are generated without a limit", seed, unlimited.expr.totalExprs)
+		}
+
+		g := newGenerator(&Config{
+			Rand:          rand.New(rand.NewSource(seed)),
+			MaxTotalExprs: maxTotalExprs,
+		})
+		program := g.CreateProgram()
+		if g.expr.totalExprs != maxTotalExprs {
+			t.Fatalf("seed %d: %d subexpressions generated, want %d", seed, g.expr.totalExprs, maxTotalExprs)
+		}
+		if numNodes := countNodes(program); numNodes >= unlimitedNodes {
+			t.Fatalf("seed %d: %d nodes generated, %d without a limit", seed, numNodes, unlimitedNodes)
+		}
+		if _, err := exec.LookPath("php"); err == nil {
+			lintProgram(t, seed, program)
+		}
+	}
+}
+
+// lintProgram checks the program files syntax with php -l.
+func lintProgram(t *testing.T, seed int64, program *Program) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, f := range program.Files {
+		var buf bytes.Buffer
+		if err := irprint.FprintFile(&buf, f, &irprint.Config{}); err != nil {
+			t.Fatalf("seed %d: print %s: %v", seed, f.Name, err)
+		}
+		filename := filepath.Join(dir, f.Name)
+		if err := os.WriteFile(filename, buf.Bytes(), 0o664); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command("php", "-l", filename).CombinedOutput(); err != nil {
+			t.Fatalf("seed %d: %s: %v: %s", seed, f.Name, err, out)
+		}
+	}
+}
+
+// TestGenerateBatch should be run with the race detector
+// to make sure that the generators don't share mutable state.
+func TestGenerateBatch(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	config := &Config{
+		ElseProbability: 0.5,
+		RecursiveFuncs:  true,
+		StmtWeights:     map[string]int{"var_dump": 2},
+	}
+	const baseSeed = 100
+	programs, err := GenerateBatch(context.Background(), baseSeed, 8, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) != 8 {
+		t.Fatalf("%d programs are generated", len(programs))
+	}
+	for i, program := range programs {
+		seed := int64(baseSeed + i)
+		want := CreateProgramFromSeed(seed, *config)
+		for j, f := range program.Files {
+			if have, want := irprint.SprintFile(f), irprint.SprintFile(want.Files[j]); have != want {
+				t.Fatalf("seed %d: %s differs from the sequentially generated one", seed, f.Name)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	programs, err = GenerateBatch(ctx, baseSeed, 4, config)
+	if err != context.Canceled || len(programs) != 4 {
+		t.Fatalf("unexpected result: %d programs, %v error", len(programs), err)
+	}
+}
+
+func BenchmarkGenerateBatch(b *testing.B) {
+	config := &Config{}
+	for _, procs := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("procs%d", procs), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+			const batchSize = 32
+			for i := 0; i < b.N; i++ {
+				if _, err := GenerateBatch(context.Background(), int64(i*batchSize), batchSize, config); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPrograms(t *testing.T) {
+	configs := []Config{
+		{},
+		{
+			ElseProbability: 0.5,
+			MaxElseIfs:      3,
+			RecursiveFuncs:  true,
+			ShadowVars:      true,
+			StmtWeights:     map[string]int{"var_dump": 1, "unset": 2},
+		},
+		{
+			StrictTypes:    true,
+			ByRefCaptures:  true,
+			ByRefForeach:   true,
+			DeadCode:       true,
+			Footguns:       true,
+			DuplicateCases: true,
+		},
+		{Dialect: DialectKPHP},
+		{SpecialFloats: true, AllowNaN: true},
+		{
+			ElseProbability: 0.5,
+			MaxElseIfs:      3,
+			ShadowVars:      true,
+			DeadCode:        true,
+			ByRefCaptures:   true,
+		},
+		// Warnings, like a continue targeting a switch, are expected here.
+		{AllowWarnings: true},
+	}
+	numSeeds := int64(3000)
+	if testing.Short() {
+		numSeeds = 50
+	}
+	for i, config := range configs {
+		for seed := int64(1); seed <= numSeeds; seed++ {
+			for _, f := range CreateProgramFromSeed(seed, config).Files {
+				for _, err := range ir.Check(f) {
+					if config.AllowWarnings && err.(*ir.CheckError).Severity == ir.SeverityWarning {
+						continue
+					}
+					t.Fatalf("config %d seed %d: %s: %v", i, seed, f.Name, err)
+				}
+			}
+		}
+	}
+}
+
+func TestSelfChecks(t *testing.T) {
+	isSelfCheck := func(n *ir.Node) bool {
+		return n.Op == ir.OpCall && n.Args[0].Op == ir.OpName && n.Args[0].Value == "self_check"
+	}
+	// flatten lists the program nodes, except for the self-checks.
+	flatten := func(program *Program) []string {
+		var nodes []string
+		for _, f := range program.Files {
+			ir.WalkFile(f, func(n *ir.Node) bool {
+				if isSelfCheck(n) {
+					return false
+				}
+				nodes = append(nodes, fmt.Sprintf("%s %v", n.Op, n.Value))
+				return true
+			})
+		}
+		return nodes
+	}
+
+	numChecks := 0
+	for seed := int64(1); seed <= 50; seed++ {
+		program := CreateProgramFromSeed(seed, Config{SelfChecks: true})
+		for _, f := range program.Files {
+			ir.WalkFile(f, func(n *ir.Node) bool {
+				if !isSelfCheck(n) {
+					return true
+				}
+				numChecks++
+				want := n.Args[3]
+				switch want.Op {
+				case ir.OpIntLit, ir.OpFloatLit, ir.OpStringLit, ir.OpBoolLit:
+				default:
+					t.Fatalf("seed %d: self-check of %s value", seed, want.Op)
+				}
+				return false
+			})
+		}
+
+		// The self-checks don't change the rest of the program.
+		have := flatten(program)
+		want := flatten(CreateProgramFromSeed(seed, Config{}))
+		if strings.Join(have, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("seed %d: the program differs from the one without self-checks", seed)
+		}
+
+		if _, err := exec.LookPath("php"); err == nil && seed <= 5 {
+			if out := runProgram(t, seed, program, 10*time.Second); bytes.Contains(out, []byte("self-check failed")) {
+				t.Fatalf("seed %d: self-check failed:\n%s", seed, out)
+			}
+		}
+	}
+	if numChecks == 0 {
+		t.Fatalf("self-checks are never generated")
+	}
+
+	for _, f := range CreateProgramFromSeed(1, Config{SelfChecks: true, Dialect: DialectKPHP}).Files {
+		ir.WalkFile(f, func(n *ir.Node) bool {
+			if isSelfCheck(n) {
+				t.Fatalf("self-check is generated for KPHP")
+			}
+			return true
+		})
+	}
+}
+
+// TestEvalDifferential compares the ir/eval results
+// of the random expressions with the php results.
+func TestEvalDifferential(t *testing.T) {
+	if _, err := exec.LookPath("php"); err != nil {
+		t.Skip("php is not installed")
+	}
+	versionOut, err := exec.Command("php", "-r", "echo PHP_VERSION_ID;").Output()
+	if err != nil {
+		t.Fatalf("get php version: %v", err)
+	}
+	var version int
+	if _, err := fmt.Sscan(string(versionOut), &version); err != nil {
+		t.Fatalf("parse php version %q: %v", versionOut, err)
+	}
+	env := &eval.Env{LegacyComparisons: version < 80000}
+
+	var exprs []string
+	var code, want bytes.Buffer
+	code.WriteString("<?php\nrequire_once __DIR__ . '/fuzzlib.php';\n")
+	types := []ir.Type{ir.IntType, ir.FloatType, ir.StringType, ir.BoolType, ir.MixedType}
+	for seed := int64(0); seed < 200; seed++ {
+		g := newGenerator(&Config{
+			Rand:          rand.New(rand.NewSource(seed)),
+			MinPHPVersion: version,
+			MaxPHPVersion: version,
+			SpecialFloats: true,
+		})
+		for i := 0; i < 20; i++ {
+			n := g.expr.GenerateValueOfType(types[i%len(types)])
+			v, err := eval.Eval(n, env)
+			if err != nil {
+				continue
+			}
+			marker := fmt.Sprintf("=== %d\n", len(exprs))
+			switch v := v.(type) {
+			case int64:
+				fmt.Fprintf(&want, "%sint(%d)\n", marker, v)
+			case float64:
+				fmt.Fprintf(&want, "%sfloat(%s)\n", marker, eval.FormatFloat(v, -1))
+			case string:
+				fmt.Fprintf(&want, "%sstring(%d) \"%s\"\n", marker, len(v), v)
+			case bool:
+				fmt.Fprintf(&want, "%sbool(%v)\n", marker, v)
+			default:
+				// The arrays output format is not reproduced.
+				continue
+			}
+			src := irprint.SprintNode(n)
+			fmt.Fprintf(&code, "echo %q;\nvar_dump(%s);\n", marker, src)
+			exprs = append(exprs, src)
+		}
+	}
+	if len(exprs) < 1000 {
+		t.Fatalf("only %d expressions are evaluated", len(exprs))
+	}
+
+	dir := t.TempDir()
+	lib := RuntimeLibrary()
+	if err := os.WriteFile(filepath.Join(dir, lib.Name), lib.Contents, 0o664); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.php"), code.Bytes(), 0o664); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("php", "-d", "precision=14", "-d", "serialize_precision=-1", "-f", filepath.Join(dir, "main.php")).Output()
+	if err != nil {
+		t.Fatalf("run php: %v\n%s", err, out)
+	}
+	if bytes.Equal(out, want.Bytes()) {
+		return
+	}
+
+	marker := regexp.MustCompile(`(?m)^=== \d+\n`)
+	haveResults := marker.Split(string(out), -1)
+	wantResults := marker.Split(want.String(), -1)
+	for i := 1; i < len(haveResults) && i < len(wantResults); i++ {
+		if haveResults[i] != wantResults[i] {
+			t.Fatalf("%s:\nphp:  %s\neval: %s", exprs[i-1], haveResults[i], wantResults[i])
+		}
+	}
+	t.Fatalf("the outputs differ:\n%s", out)
+}
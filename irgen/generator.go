@@ -4,10 +4,12 @@ import (
 	_ "embed"
 	"fmt"
 	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/ir/eval"
 	"github.com/quasilyte/phpsmith/phpdoc"
 	"github.com/quasilyte/phpsmith/phpfunc"
 	"github.com/quasilyte/phpsmith/randutil"
@@ -21,49 +23,187 @@ type generator struct {
 
 	rand *rand.Rand
 
-	files []*File
+	files []*ir.File
 
 	stmtDepth int
 
+	// funcStmts is the number of statements generated
+	// in the current function body, see MaxFunctionStatements.
+	funcStmts int
+
 	varNameSeq int
 
+	closureParamSeq int
+
 	currentBlock *ir.Node
 
-	insideLoop bool
+	// breakLevels describes the enclosing loops and switches
+	// that can be targeted by break and continue statements,
+	// from the outermost to the innermost one.
+	// A level is false if a continue can't target it.
+	breakLevels []bool
+
+	// loopDepth is the current loop nesting level.
+	loopDepth int
+
+	namespace string
 
 	scope *scope
 
 	symtab *symbolTable
 	expr   *exprGenerator
+
+	stmtChoices stmtChoiceList
+
+	// warnings are reported via Program.Warnings.
+	warnings []string
+}
+
+type stmtChoiceList struct {
+	indexMap []uint16
+	options  []stmtChoice
+}
+
+type stmtChoice struct {
+	name string
+	freq int
+
+	// generate adds the statement to the current block, it returns
+	// false if the statement can't be generated in the current context.
+	generate func() bool
+
+	// unavailable is a reason the statement is never generated with
+	// the current config, such choices are disabled.
+	unavailable string
+
+	// nested tells whether the statement has a nested block,
+	// see MaxBlockNesting.
+	nested bool
 }
 
 func newGenerator(config *Config) *generator {
+	features := newPHPFeatures(config)
 	symtab := newSymbolTable()
-	{
-		coreFuncs := phpfunc.GetList()
+	if !config.NoBuiltins {
+		coreFuncs := config.Builtins
+		if coreFuncs == nil {
+			coreFuncs = phpfunc.GetList()
+		}
 		for _, fn := range coreFuncs {
-			symtab.AddFunc(fn)
+			if fn.MinPHPVersion > features.minVersion || (fn.Impure && !features.impureBuiltins) {
+				continue
+			}
+			symtab.AddBuiltinFunc(fn)
 		}
 	}
 
-	s := newScope()
-	return &generator{
+	s := newScope(config.Rand)
+	g := &generator{
 		config: config,
 		rand:   config.Rand,
 		symtab: symtab,
 		scope:  s,
-		expr:   newExprGenerator(config, s, symtab),
+		expr:   newExprGenerator(config, features, s, symtab),
+	}
+
+	// always wraps the statements that can always be generated.
+	always := func(f func()) func() bool {
+		return func() bool {
+			f()
+			return true
+		}
+	}
+	var noLoops, noEcho string
+	if g.maxLoopNesting() < 0 {
+		noLoops = "the loops are disabled by MaxLoopNesting"
+	}
+	if !config.NoObserve && config.OutputMode != OutputFull {
+		noEcho = "the echo output is not hashed"
+	}
+	g.stmtChoices = g.makeStmtChoicesList(config.StmtWeights, []stmtChoice{
+		{name: "var_decl", freq: 1, generate: always(g.pushVarDeclStmt)},
+		{name: "assign", freq: 1, generate: always(g.pushAssignStmt)},
+		{name: "compound_assign", freq: 1, generate: g.pushCompoundAssignStmt},
+		{name: "inc_dec", freq: 1, generate: always(g.pushIncDecStmt)},
+		{name: "var_dump", freq: 3, generate: g.pushVarDump},
+		{name: "echo", freq: 1, generate: g.pushEchoStmt, unavailable: noEcho},
+		{name: "call", freq: 1, generate: g.pushCallStmt},
+		{name: "unset", freq: 1, generate: g.pushUnsetStmt},
+		{name: "block", freq: 1, generate: always(g.pushBlockStmt), nested: true},
+		{name: "if", freq: 1, generate: always(g.pushIfStmt), nested: true},
+		{name: "while", freq: 1, generate: always(g.pushLoopStmt), unavailable: noLoops, nested: true},
+		{name: "for", freq: 1, generate: always(g.pushForStmt), unavailable: noLoops, nested: true},
+		{name: "foreach", freq: 1, generate: always(g.pushForeachStmt), unavailable: noLoops, nested: true},
+		{name: "switch", freq: 1, generate: always(g.pushSwitchStmt), nested: true},
+		{name: "break", freq: 1, generate: g.pushBreakStmt},
+		{name: "continue", freq: 1, generate: g.pushContinueStmt, unavailable: noLoops},
+		{name: "closure", freq: 1, generate: always(g.pushClosureDecl)},
+	})
+
+	return g
+}
+
+// makeStmtChoicesList creates a statement choice list from the options.
+// The weights override the options freq, makeStmtChoicesList panics
+// if they refer to unknown statements or disable all of them.
+//
+// The unavailable options are disabled. It's reported as
+// a warning if they're enabled by the weights.
+func (g *generator) makeStmtChoicesList(weights map[string]int, options []stmtChoice) stmtChoiceList {
+	// The names are sorted, so the reported one doesn't
+	// depend on the map iteration order.
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		known := false
+		for _, o := range options {
+			known = known || o.name == name
+		}
+		if !known {
+			panic(fmt.Sprintf("unknown statement choice %q", name))
+		}
+	}
+
+	indexes := make([]uint16, 0, len(options)*2)
+	for i, o := range options {
+		freq := o.freq
+		w, ok := weights[o.name]
+		if ok {
+			freq = w
+		}
+		if o.unavailable != "" {
+			if ok && w != 0 {
+				g.warnings = append(g.warnings, fmt.Sprintf("%s statements are disabled: %s", o.name, o.unavailable))
+			}
+			freq = 0
+		}
+		for j := 0; j < freq; j++ {
+			indexes = append(indexes, uint16(i))
+		}
+	}
+	if len(indexes) == 0 {
+		panic("all statement choices are disabled")
+	}
+	return stmtChoiceList{
+		indexMap: indexes,
+		options:  options,
 	}
 }
 
 func (g *generator) CreateProgram() *Program {
 	var mainFileRequires []*ir.RootRequire
 
-	mainFileRequires = append(mainFileRequires, &ir.RootRequire{Path: "fuzzlib.php"})
-	runtimeFiles := []*RuntimeFile{
-		{Name: "fuzzlib.php", Contents: phpFuzzlib},
+	if g.config.NamespaceProbability != 0 && randutil.Chance(g.rand, g.config.NamespaceProbability) {
+		g.namespace = `Phpsmith\Generated`
 	}
 
+	fuzzlib := RuntimeLibrary()
+	mainFileRequires = append(mainFileRequires, &ir.RootRequire{Path: fuzzlib.Name})
+	runtimeFiles := []*RuntimeFile{fuzzlib}
+
 	numLibs := randutil.IntRange(g.rand, 3, 5)
 	for i := 0; i < numLibs; i++ {
 		filename := fmt.Sprintf("lib%d.php", i)
@@ -75,14 +215,29 @@ func (g *generator) CreateProgram() *Program {
 	return &Program{
 		Files:        g.files,
 		RuntimeFiles: runtimeFiles,
+		Warnings:     g.warnings,
+	}
+}
+
+func (g *generator) newFile(filename string) *ir.File {
+	return &ir.File{
+		Name:        filename,
+		StrictTypes: g.config.StrictTypes,
+		Namespace:   g.namespace,
 	}
 }
 
-func (g *generator) createLibFile(filename string) *File {
-	file := &File{Name: filename}
+func (g *generator) createLibFile(filename string) *ir.File {
+	file := g.newFile(filename)
 
 	funcPrefix := strings.TrimSuffix(filename, ".php")
 
+	if g.config.RecursiveFuncs {
+		for _, fn := range g.createRecursiveFuncs(funcPrefix) {
+			file.Nodes = append(file.Nodes, fn)
+		}
+	}
+
 	numLibFuncs := randutil.IntRange(g.rand, 2, 4)
 	for i := 0; i < numLibFuncs; i++ {
 		funcName := fmt.Sprintf("%s_func%d", funcPrefix, i)
@@ -94,15 +249,24 @@ func (g *generator) createLibFile(filename string) *File {
 	return file
 }
 
-func (g *generator) createMainFile(requires []*ir.RootRequire) *File {
-	file := &File{
-		Name: "main.php",
-	}
+func (g *generator) createMainFile(requires []*ir.RootRequire) *ir.File {
+	file := g.newFile("main.php")
 
 	for _, r := range requires {
 		file.Nodes = append(file.Nodes, r)
 	}
 
+	if g.config.RecursiveFuncs {
+		maxDepth := g.config.MaxRecursionDepth
+		if maxDepth == 0 {
+			maxDepth = 3
+		}
+		g.expr.recursionDepth = func() *ir.Node {
+			return ir.NewIntLit(int64(randutil.IntRange(g.rand, 1, maxDepth)))
+		}
+		defer func() { g.expr.recursionDepth = nil }()
+	}
+
 	funcs := make([]*ir.RootFuncDecl, randutil.IntRange(g.rand, 2, 4))
 	for i := range funcs {
 		funcs[i] = g.createFunc("func"+strconv.Itoa(i), false)
@@ -116,11 +280,28 @@ func (g *generator) createMainFile(requires []*ir.RootRequire) *File {
 		},
 		Body: &ir.Node{Op: ir.OpBlock},
 	}
+	hashOutput := !g.config.NoObserve && g.config.OutputMode != OutputFull
+	if hashOutput {
+		mode := "hash"
+		if g.config.OutputMode == OutputBoth {
+			mode = "both"
+		}
+		start := ir.NewCall(ir.NewName("observe_start"), ir.NewStringLit(mode))
+		mainFunc.Body.Args = append(mainFunc.Body.Args, start)
+	}
 	for _, fn := range funcs {
 		funcNode := ir.NewName(fn.Type.Name)
 		call := &ir.Node{Op: ir.OpCall, Args: []*ir.Node{funcNode}}
 		mainFunc.Body.Args = append(mainFunc.Body.Args, call)
 	}
+	if hashOutput {
+		finish := ir.NewCall(ir.NewName("observe_finish"), ir.NewIntLit(g.config.Seed))
+		mainFunc.Body.Args = append(mainFunc.Body.Args, finish)
+	}
+	if randutil.Chance(g.rand, 0.1) {
+		// Sometimes terminate the script explicitly.
+		mainFunc.Body.Args = append(mainFunc.Body.Args, ir.NewExit(ir.NewIntLit(0)))
+	}
 
 	for _, fn := range funcs {
 		file.Nodes = append(file.Nodes, fn)
@@ -134,7 +315,40 @@ func (g *generator) createMainFile(requires []*ir.RootRequire) *File {
 	return file
 }
 
+// createRecursiveFuncs creates the library functions that can call
+// themselves and each other. Their first param is the recursion depth;
+// it's not visible to the other expressions, so every recursive call
+// decrements it and the function returns early once it's not positive.
+func (g *generator) createRecursiveFuncs(funcPrefix string) []*ir.RootFuncDecl {
+	funcs := make([]*ir.RootFuncDecl, randutil.IntRange(g.rand, 1, 2))
+	for i := range funcs {
+		fn := g.declareFunc(fmt.Sprintf("%s_rec%d", funcPrefix, i), true)
+		depthParam := ir.TypeField{Name: "depth", Type: ir.IntType}
+		fn.Type.Params = append([]ir.TypeField{depthParam}, fn.Type.Params...)
+		fn.Type.MinArgsNum++
+		depthTag := &phpdoc.ParamTag{VarName: "$depth", Type: "int"}
+		fn.Tags = append([]phpdoc.Tag{depthTag}, fn.Tags...)
+		g.symtab.AddRecursiveFunc(fn.Type)
+		funcs[i] = fn
+	}
+
+	g.expr.recursionDepth = func() *ir.Node {
+		return ir.NewSub(ir.NewVar("depth", ir.IntType), ir.NewIntLit(1))
+	}
+	defer func() { g.expr.recursionDepth = nil }()
+	for _, fn := range funcs {
+		g.generateFuncBody(fn, true, true)
+	}
+	return funcs
+}
+
 func (g *generator) createFunc(name string, isLibFunc bool) *ir.RootFuncDecl {
+	fn := g.declareFunc(name, isLibFunc)
+	g.generateFuncBody(fn, isLibFunc, false)
+	return fn
+}
+
+func (g *generator) declareFunc(name string, isLibFunc bool) *ir.RootFuncDecl {
 	fn := &ir.RootFuncDecl{
 		Body: ir.NewBlock(),
 	}
@@ -149,12 +363,12 @@ func (g *generator) createFunc(name string, isLibFunc bool) *ir.RootFuncDecl {
 			param := ir.TypeField{Name: paramName, Type: g.expr.PickType()}
 			fn.Tags = append(fn.Tags, &phpdoc.ParamTag{
 				VarName: "$" + paramName,
-				Type:    param.Type.String(),
+				Type:    ir.TypeDocString(param.Type),
 			})
 			fn.Type.Params = append(fn.Type.Params, param)
 		}
 		fn.Type.MinArgsNum = len(fn.Type.Params)
-		fn.Tags = append(fn.Tags, &phpdoc.ReturnTag{Type: fn.Type.Result.String()})
+		fn.Tags = append(fn.Tags, &phpdoc.ReturnTag{Type: ir.TypeDocString(fn.Type.Result)})
 	} else {
 		fn.Type = &ir.FuncType{
 			Name:   name,
@@ -162,9 +376,18 @@ func (g *generator) createFunc(name string, isLibFunc bool) *ir.RootFuncDecl {
 		}
 	}
 	fn.Type.Name = name
+	return fn
+}
 
+// generateFuncBody fills the fn body. The recursive function
+// depth param is not added to the scope.
+func (g *generator) generateFuncBody(fn *ir.RootFuncDecl, isLibFunc, recursive bool) {
+	params := fn.Type.Params
+	if recursive {
+		params = params[1:]
+	}
 	g.scope.Enter()
-	for _, param := range fn.Type.Params {
+	for _, param := range params {
 		g.scope.PushVar(param.Name, param.Type)
 	}
 	defer func() {
@@ -177,41 +400,112 @@ func (g *generator) createFunc(name string, isLibFunc bool) *ir.RootFuncDecl {
 	g.varNameSeq = 0
 	g.currentBlock = fn.Body
 
+	if recursive {
+		// The base case can't have recursive calls.
+		recursionDepth := g.expr.recursionDepth
+		g.expr.recursionDepth = nil
+		cond := ir.NewLessOrEqual(ir.NewVar("depth", ir.IntType), ir.NewIntLit(0))
+		ret := ir.NewReturn(g.expr.GenerateStrictValueOfType(fn.Type.Result))
+		baseCase := ir.NewBlock(append(g.observeLiveVars(), ret)...)
+		g.currentBlock.Args = append(g.currentBlock.Args, ir.NewIf(cond, baseCase))
+		g.expr.recursionDepth = recursionDepth
+	}
+
 	numBlockVars := 0
 	if isLibFunc {
-		numBlockVars = randutil.IntRange(g.rand, 0, 2)
+		numBlockVars = g.numBlockStatements(0, 2)
 	} else {
-		numBlockVars = randutil.IntRange(g.rand, 3, 7)
+		numBlockVars = g.numBlockStatements(3, 7)
 	}
+	if limit := g.config.MaxFunctionStatements; limit != 0 && numBlockVars > limit {
+		numBlockVars = limit
+	}
+	// The block vars are counted like the other
+	// function body statements.
+	g.funcStmts = numBlockVars
+	g.stmtDepth++
 	blockVars := make([]string, numBlockVars)
 	for i := range blockVars {
 		blockVars[i] = g.genVarname()
 		g.pushVarDecl(blockVars[i])
 	}
+	g.stmtDepth--
 	numStatements := 0
 	if isLibFunc {
-		numStatements = randutil.IntRange(g.rand, 1, 3)
+		numStatements = g.numBlockStatements(1, 3)
 	} else {
-		numStatements = randutil.IntRange(g.rand, 3, 10)
+		numStatements = g.numBlockStatements(3, 10)
+	}
+	if limit := g.config.MaxBlockStatements; limit != 0 && numStatements > limit-numBlockVars {
+		numStatements = limit - numBlockVars
 	}
 	for i := 0; i < numStatements; i++ {
 		g.pushStatement()
 	}
 
 	if isLibFunc {
-		ret := ir.NewReturn(g.expr.GenerateValueOfType(fn.Type.Result))
+		ret := ir.NewReturn(g.expr.GenerateStrictValueOfType(fn.Type.Result))
+		g.currentBlock.Args = append(g.currentBlock.Args, g.observeLiveVars()...)
 		g.currentBlock.Args = append(g.currentBlock.Args, ret)
 	} else {
 		for _, name := range blockVars {
 			v := g.scope.FindVarByName(name)
+			if v == nil {
+				// Removed by unset.
+				continue
+			}
+			if observeFuncName(v.typ) != "" && !g.config.NoObserve {
+				// Printed by the observeLiveVars statements below.
+				continue
+			}
 			if canDump(v.typ) {
 				varDump := g.varDumpCall(ir.NewVar(name, v.typ))
 				g.currentBlock.Args = append(g.currentBlock.Args, varDump)
 			}
 		}
+		g.currentBlock.Args = append(g.currentBlock.Args, g.observeLiveVars()...)
 	}
+}
 
-	return fn
+// observeLiveVars returns the statements that print all visible
+// scalar variables in their declaration order, the redeclared
+// variables are printed at their latest declaration position.
+// Every value type has its own canonical output format.
+func (g *generator) observeLiveVars() []*ir.Node {
+	if g.config.NoObserve {
+		return nil
+	}
+	vars := g.scope.VisibleVars()
+	stmts := make([]*ir.Node, 0, len(vars))
+	// VisibleVars lists the latest declarations first,
+	// so they're iterated backwards to get the declaration order.
+	for i := len(vars) - 1; i >= 0; i-- {
+		v := vars[i]
+		funcName := observeFuncName(v.typ)
+		if funcName == "" {
+			continue
+		}
+		call := ir.NewCall(ir.NewName(funcName), ir.NewStringLit(v.name), ir.NewVar(v.name, v.typ))
+		stmts = append(stmts, call)
+	}
+	return stmts
+}
+
+// observeFuncName returns the fuzzlib function that prints
+// the typ values or an empty string if there is none.
+func observeFuncName(typ ir.Type) string {
+	switch typ {
+	case ir.BoolType:
+		return "observe_bool"
+	case ir.IntType:
+		return "observe_int"
+	case ir.FloatType:
+		return "observe_float"
+	case ir.StringType:
+		return "observe_string"
+	default:
+		return ""
+	}
 }
 
 func (g *generator) genVarname() string {
@@ -220,8 +514,32 @@ func (g *generator) genVarname() string {
 	return varname
 }
 
+// pushVarDeclStmt declares a new variable.
+//
+// With ShadowVars, it can redeclare a scalar variable from the outer
+// blocks instead. PHP variables are function scoped, so it's really
+// an assignment of the outer variable, its type stays the same
+// and it's marked as mutated.
+func (g *generator) pushVarDeclStmt() {
+	if g.config.ShadowVars && randutil.Chance(g.rand, 0.3) {
+		v := g.scope.PickVar(func(v *scopeVar) bool {
+			typ, ok := v.typ.(*ir.ScalarType)
+			return ok && typ != ir.MixedType && !g.scope.IsCurrentBlockVar(v.name)
+		})
+		if v != nil {
+			g.scope.MarkMutated(v.name)
+			g.pushVarDeclOfType(v.name, v.typ)
+			return
+		}
+	}
+	g.pushVarDecl(g.genVarname())
+}
+
 func (g *generator) pushVarDecl(name string) {
-	typ := g.expr.PickType()
+	g.pushVarDeclOfType(name, g.expr.PickType())
+}
+
+func (g *generator) pushVarDeclOfType(name string, typ ir.Type) {
 	lhs := ir.NewVar(name, typ)
 	rhs := g.expr.GenerateValueOfType(typ)
 	if scalarType, ok := typ.(*ir.ScalarType); ok {
@@ -231,10 +549,18 @@ func (g *generator) pushVarDecl(name string) {
 		}
 	}
 	assign := ir.NewAssign(lhs, rhs)
-	if scalarType, ok := typ.(*ir.ScalarType); ok && scalarType.Kind == ir.ScalarBool {
-		assign.Value = &phpdoc.VarTag{VarName: "$" + name, Type: "bool"}
+	switch typ := typ.(type) {
+	case *ir.ScalarType:
+		if typ.Kind == ir.ScalarBool {
+			assign.Value = &phpdoc.VarTag{VarName: "$" + name, Type: "bool"}
+		}
+	case *ir.ArrayType, *ir.TupleType:
+		if g.expr.features.varTypeTags {
+			assign.Value = &phpdoc.VarTag{VarName: "$" + name, Type: ir.TypeDocString(typ)}
+		}
 	}
 	g.currentBlock.Args = append(g.currentBlock.Args, assign)
+	g.pushSelfCheck(lhs, rhs)
 	g.scope.PushVar(name, typ)
 }
 
@@ -244,142 +570,756 @@ func (g *generator) pushStatement() {
 		g.stmtDepth--
 	}()
 
-	switch randutil.IntRange(g.rand, 0, 10+(g.stmtDepth*2)) {
-	case 0:
-		if g.insideLoop {
-			g.currentBlock.Args = append(g.currentBlock.Args, ir.NewBreak(0))
-		} else {
-			g.pushBlockStmt()
-		}
-	case 1:
-		if g.insideLoop {
-			g.currentBlock.Args = append(g.currentBlock.Args, ir.NewContinue(0))
-		} else {
-			g.pushIfStmt()
+	if !g.config.DeadCode && terminates(g.currentBlock) {
+		// The statement would be unreachable.
+		return
+	}
+
+	if g.config.MaxFunctionStatements != 0 && g.funcStmts >= g.config.MaxFunctionStatements {
+		return
+	}
+	g.expr.checkContext()
+	if g.expr.stopped {
+		return
+	}
+	g.funcStmts++
+
+	// The nested blocks get more variable declarations,
+	// so the statements nesting is limited.
+	list := &g.stmtChoices
+	probe := g.rand.Intn(len(list.indexMap) + g.stmtDepth*2)
+	if probe >= len(list.indexMap) {
+		g.pushVarDecl(g.genVarname())
+		return
+	}
+	for i := 0; i < maxChoiceAttempts; i++ {
+		option := &list.options[list.indexMap[probe]]
+		if (!option.nested || g.canNest()) && option.generate() {
+			return
 		}
-	case 2, 3, 4:
-		if !g.pushVarDump() {
-			g.pushAssignStmt()
+		probe = g.rand.Intn(len(list.indexMap))
+	}
+	g.pushVarDecl(g.genVarname())
+}
+
+// canNest reports whether the current statement can have
+// a nested block, see MaxBlockNesting.
+func (g *generator) canNest() bool {
+	return g.config.MaxBlockNesting == 0 || g.stmtDepth <= g.config.MaxBlockNesting
+}
+
+// numBlockStatements returns a random number of statements
+// in the min and max range for a new block.
+// It's limited by MaxBlockStatements.
+func (g *generator) numBlockStatements(min, max int) int {
+	n := randutil.IntRange(g.rand, min, max)
+	if g.config.MaxBlockStatements != 0 && n > g.config.MaxBlockStatements {
+		n = g.config.MaxBlockStatements
+	}
+	return n
+}
+
+func (g *generator) pushBreakStmt() bool {
+	if len(g.breakLevels) == 0 {
+		return false
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, ir.NewBreak(g.pickBreakLevel(false)))
+	return true
+}
+
+func (g *generator) pushContinueStmt() bool {
+	level := g.pickBreakLevel(true)
+	if level == -1 {
+		return false
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, ir.NewContinue(level))
+	return true
+}
+
+// pushEchoStmt adds an echo of an int or string value.
+func (g *generator) pushEchoStmt() bool {
+	x := g.expr.GenerateValueOfType(randutil.Elem(g.rand, switchTagTypes))
+	g.currentBlock.Args = append(g.currentBlock.Args, ir.NewEcho(x, ir.NewStringLit("\n")))
+	return true
+}
+
+// pushCallStmt adds a generated function call,
+// its result is discarded.
+func (g *generator) pushCallStmt() bool {
+	if len(g.symtab.userFuncs) == 0 {
+		return false
+	}
+	call := g.expr.callOfType(randutil.Elem(g.rand, g.symtab.userFuncs))
+	if call == nil {
+		return false
+	}
+	if call.Op == ir.OpCast {
+		call = call.Args[0]
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, call)
+	return true
+}
+
+// pushUnsetStmt adds an unset of a variable declared in the current block,
+// so it's not visible to the rest of the block.
+func (g *generator) pushUnsetStmt() bool {
+	v := g.pickVar()
+	if v == nil || g.scope.Shadows(v.name) {
+		// The outer block variable would be unset too.
+		return false
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, ir.NewUnset(ir.NewVar(v.name, v.typ)))
+	g.scope.RemoveVar(v.name)
+	return true
+}
+
+// pickBreakLevel returns a break or continue level.
+// The innermost level is preferred, it's returned as 0.
+//
+// The continue levels are limited to the loops that permit it,
+// -1 is returned if there are none.
+func (g *generator) pickBreakLevel(isContinue bool) int {
+	var levels []int
+	for i := len(g.breakLevels) - 1; i >= 0; i-- {
+		if !isContinue || g.breakLevels[i] {
+			levels = append(levels, len(g.breakLevels)-i)
 		}
-	case 5, 6:
-		g.pushAssignStmt()
-	case 7:
-		g.pushLoopStmt()
-	case 8:
-		g.pushSwitchStmt()
+	}
+	if len(levels) == 0 {
+		return -1
+	}
+	level := levels[0]
+	if len(levels) > 1 && randutil.Chance(g.rand, 0.3) {
+		level = randutil.Elem(g.rand, levels[1:])
+	}
+	if level == 1 {
+		return 0
+	}
+	return level
+}
+
+// terminates reports whether the last block statement
+// is an unconditional jump.
+func terminates(block *ir.Node) bool {
+	if len(block.Args) == 0 {
+		return false
+	}
+	last := block.Args[len(block.Args)-1]
+	switch last.Op {
+	case ir.OpBreak, ir.OpContinue, ir.OpReturn, ir.OpReturnVoid:
+		return true
+	case ir.OpBlock:
+		return terminates(last)
 	default:
-		g.pushVarDecl(g.genVarname())
+		return false
 	}
 }
 
+// pushSwitchStmt adds a switch over an int or string subject.
+// Every case appends its index to an accumulator variable that is
+// dumped after the switch, so the executed cases are observable.
+//
+// Some cases fall through to the next one and the default case
+// can be placed anywhere. Inside a loop, a case can also end with
+// a continue 2 that targets the loop. A plain continue targets
+// the switch itself and acts like a break, PHP warns about it,
+// so it's only generated with AllowWarnings.
 func (g *generator) pushSwitchStmt() {
-	var tagType ir.Type
-	if randutil.Chance(g.rand, 0.3) {
-		tagType = g.expr.PickEnumType()
+	tagType := randutil.Elem(g.rand, switchTagTypes)
+	numCases := randutil.IntRange(g.rand, 2, 6)
+	labels := g.switchLabels(tagType, numCases)
+	defaultPos := -1
+	if randutil.Bool(g.rand) {
+		defaultPos = randutil.IntRange(g.rand, 0, len(labels))
+	}
+	canContinue := len(g.breakLevels) != 0 && g.breakLevels[len(g.breakLevels)-1]
+
+	var tagExpr *ir.Node
+	if randutil.Bool(g.rand) {
+		label := randutil.Elem(g.rand, labels)
+		tagExpr = &ir.Node{Op: label.Op, Value: label.Value, Type: label.Type}
 	} else {
-		tagType = g.expr.PickScalarTypeNoBool()
+		tagExpr = g.expr.GenerateValueOfType(tagType)
 	}
-	numCases := randutil.IntRange(g.rand, 0, 10)
-	hasDefault := randutil.Bool(g.rand)
-	prevCurrentBlock := g.currentBlock
+	acc := ir.NewVar(g.genVarname(), ir.StringType)
+	g.currentBlock.Args = append(g.currentBlock.Args, ir.NewAssign(acc, ir.NewStringLit("")))
 
-	g.scope.Enter()
-	defer g.scope.Leave()
+	prevCurrentBlock := g.currentBlock
+	// A continue would target the switch, so it's forbidden.
+	g.breakLevels = append(g.breakLevels, false)
 
-	tagExpr := g.expr.GenerateValueOfType(tagType)
 	switchNode := &ir.Node{Op: ir.OpSwitch, Args: []*ir.Node{tagExpr}}
-	caseSet := make(map[any]struct{})
-	for i := 0; i < numCases; i++ {
-		x := g.expr.GenerateValueOfType(tagType)
-		caseValue := extractValue(x)
-		if _, ok := caseSet[caseValue]; ok {
-			continue
+	numClauses := len(labels)
+	if defaultPos != -1 {
+		numClauses++
+	}
+	for i := 0; i < numClauses; i++ {
+		var caseNode *ir.Node
+		switch {
+		case i == defaultPos:
+			caseNode = &ir.Node{Op: ir.OpDefaultCase}
+		case defaultPos != -1 && i > defaultPos:
+			caseNode = &ir.Node{Op: ir.OpCase, Args: []*ir.Node{labels[i-1]}}
+		default:
+			caseNode = &ir.Node{Op: ir.OpCase, Args: []*ir.Node{labels[i]}}
 		}
-		caseSet[caseValue] = struct{}{}
 
 		g.scope.Enter()
-		caseNode := &ir.Node{Op: ir.OpCase, Args: []*ir.Node{x}}
-		caseSize := randutil.IntRange(g.rand, 0, 2)
 		g.currentBlock = caseNode
+		caseNode.Args = append(caseNode.Args, ir.NewAssignModify(ir.OpConcat, acc, ir.NewStringLit(strconv.Itoa(i))))
+		caseSize := g.numBlockStatements(0, 2)
 		for j := 0; j < caseSize; j++ {
 			g.pushStatement()
 		}
-		if randutil.IntRange(g.rand, 0, 8) != 0 {
-			g.currentBlock.Args = append(g.currentBlock.Args, ir.NewBreak(0))
-		}
-		switchNode.Args = append(switchNode.Args, caseNode)
-
-		g.scope.Leave()
-	}
-	if hasDefault {
-		g.scope.Enter()
-		caseNode := &ir.Node{Op: ir.OpDefaultCase}
-		caseSize := randutil.IntRange(g.rand, 0, 2)
-		g.currentBlock = caseNode
-		for j := 0; j < caseSize; j++ {
-			g.pushStatement()
+		if i != numClauses-1 && !terminates(caseNode) {
+			switch roll := g.rand.Float64(); {
+			case roll < 0.25:
+				// Fall through to the next case.
+			case roll < 0.35 && canContinue:
+				caseNode.Args = append(caseNode.Args, ir.NewContinue(2))
+			case roll < 0.4 && canContinue && g.config.AllowWarnings && g.expr.features.switchContinue:
+				caseNode.Args = append(caseNode.Args, ir.NewContinue(0))
+			default:
+				caseNode.Args = append(caseNode.Args, ir.NewBreak(0))
+			}
 		}
 		switchNode.Args = append(switchNode.Args, caseNode)
 		g.scope.Leave()
 	}
 
+	g.breakLevels = g.breakLevels[:len(g.breakLevels)-1]
 	g.currentBlock = prevCurrentBlock
-	g.currentBlock.Args = append(g.currentBlock.Args, switchNode)
+	g.currentBlock.Args = append(g.currentBlock.Args, switchNode, g.varDumpCall(acc))
+	g.scope.PushVar(acc.Value.(string), ir.StringType)
 }
 
+// switchLabels returns n case label literals of the typ type.
+// The labels are unique unless DuplicateCases is set.
+func (g *generator) switchLabels(typ ir.Type, n int) []*ir.Node {
+	var values []any
+	if typ == ir.IntType {
+		values = toEfaceSlice(generateUniqueValues(n, g.expr.valueGenerator.IntValue))
+	} else {
+		values = toEfaceSlice(generateUniqueValues(n, g.expr.valueGenerator.StringValue))
+	}
+	labels := make([]*ir.Node, len(values))
+	for i, v := range values {
+		if i != 0 && g.config.DuplicateCases && randutil.Chance(g.rand, 0.2) {
+			// The duplicated case is never executed.
+			v = values[g.rand.Intn(i)]
+			values[i] = v
+		}
+		if typ == ir.IntType {
+			labels[i] = ir.NewIntLit(v.(int64))
+		} else {
+			labels[i] = ir.NewStringLit(v.(string))
+		}
+	}
+	return labels
+}
+
+// pushLoopStmt adds a while loop that terminates by construction.
+// Its counter variable is not visible to the loop body, so the body
+// can't affect the number of iterations.
 func (g *generator) pushLoopStmt() {
-	prevInLoop := g.insideLoop
+	if g.loopDepth >= g.maxLoopNesting() {
+		g.pushIfStmt()
+		return
+	}
+
 	prevCurrentBlock := g.currentBlock
-	g.insideLoop = true
+	g.loopDepth++
 	g.scope.Enter()
 
-	iterVarName := g.genVarname()
-	iterVar := ir.NewVar(iterVarName, ir.IntType)
-	iterVarAssign := ir.NewAssign(iterVar, ir.NewIntLit(0))
-	g.currentBlock.Args = append(g.currentBlock.Args, iterVarAssign)
-	loopCond := ir.NewLess(ir.NewPostInc(iterVar), ir.NewIntLit(int64(randutil.IntRange(g.rand, 1, 10))))
+	counter := ir.NewVar(g.genVarname(), ir.IntType)
+	bound := ir.NewIntLit(int64(randutil.IntRange(g.rand, 1, 10)))
 	whileNode := &ir.Node{Op: ir.OpWhile}
-	whileNode.Args = append(whileNode.Args, loopCond)
+	var update *ir.Node
+	if randutil.Bool(g.rand) {
+		// $i = 0; while ($i++ < n) { ... }
+		g.currentBlock.Args = append(g.currentBlock.Args, ir.NewAssign(counter, ir.NewIntLit(0)))
+		whileNode.Args = append(whileNode.Args, ir.NewLess(ir.NewPostInc(counter), bound))
+		g.breakLevels = append(g.breakLevels, true)
+	} else {
+		// $i = n; while ($i > 0) { ...; $i--; }
+		g.currentBlock.Args = append(g.currentBlock.Args, ir.NewAssign(counter, bound))
+		whileNode.Args = append(whileNode.Args, ir.NewGreater(counter, ir.NewIntLit(0)))
+		update = ir.NewPostDec(counter)
+		// A continue would skip the counter update.
+		g.breakLevels = append(g.breakLevels, false)
+	}
 
 	g.currentBlock = whileNode
 	g.pushBlockStmt()
+	if body := whileNode.Args[1]; update != nil && !terminates(body) {
+		body.Args = append(body.Args, update)
+	}
 
 	g.scope.Leave()
-	g.insideLoop = prevInLoop
+	g.loopDepth--
+	g.breakLevels = g.breakLevels[:len(g.breakLevels)-1]
 	g.currentBlock = prevCurrentBlock
 	g.currentBlock.Args = append(g.currentBlock.Args, whileNode)
 }
 
+// pushForeachStmt adds a foreach loop over an array variable.
+// The loop body accumulates the iterated values into a new variable
+// that is dumped after the loop.
+//
+// The iteration variables are initialized before the loop, so they're
+// defined after it even if the array is empty. The by reference value
+// variable is unset after the loop unless Footguns is set.
+func (g *generator) pushForeachStmt() {
+	if g.loopDepth >= g.maxLoopNesting() {
+		g.pushIfStmt()
+		return
+	}
+
+	arr := g.foreachArray()
+	arrType := arr.Type.(*ir.ArrayType)
+	elemType := arrType.Elem.(*ir.ScalarType)
+	keyType := ir.IntType
+	if arrType.Key != nil {
+		// Numeric string keys are converted to ints.
+		keyType = ir.MixedType
+	}
+	byRef := g.config.ByRefForeach && randutil.Bool(g.rand)
+
+	accType := elemType
+	var accInit *ir.Node
+	switch elemType.Kind {
+	case ir.ScalarFloat:
+		accInit = ir.NewFloatLit(0)
+	case ir.ScalarString:
+		accInit = ir.NewStringLit("")
+	default:
+		accType = ir.IntType
+		accInit = ir.NewIntLit(0)
+	}
+	acc := ir.NewVar(g.genVarname(), accType)
+	value := ir.NewVar(g.genVarname(), elemType)
+	var key *ir.Node
+	if keyType == ir.IntType || accType == ir.StringType {
+		if randutil.Bool(g.rand) {
+			key = ir.NewVar(g.genVarname(), keyType)
+		}
+	}
+
+	g.currentBlock.Args = append(g.currentBlock.Args,
+		ir.NewAssign(acc, accInit),
+		ir.NewAssign(value, g.expr.GenerateStrictValueOfType(elemType)))
+	if key != nil {
+		g.currentBlock.Args = append(g.currentBlock.Args, ir.NewAssign(key, ir.NewIntLit(0)))
+		g.scope.PushVar(key.Value.(string), keyType)
+	}
+	if !byRef || g.config.Footguns {
+		g.scope.PushVar(value.Value.(string), elemType)
+	}
+
+	prevCurrentBlock := g.currentBlock
+	g.breakLevels = append(g.breakLevels, true)
+	g.loopDepth++
+	g.scope.Enter()
+	if byRef && !g.config.Footguns {
+		g.scope.PushVar(value.Value.(string), elemType)
+	}
+
+	body := &ir.Node{Op: ir.OpBlock}
+	g.currentBlock = body
+	body.Args = append(body.Args, g.accumulate(acc, value))
+	if key != nil {
+		body.Args = append(body.Args, g.accumulate(acc, key))
+	}
+	numStatements := g.numBlockStatements(0, 2)
+	for i := 0; i < numStatements; i++ {
+		g.pushStatement()
+	}
+
+	g.scope.Leave()
+	g.loopDepth--
+	g.breakLevels = g.breakLevels[:len(g.breakLevels)-1]
+	g.currentBlock = prevCurrentBlock
+
+	g.currentBlock.Args = append(g.currentBlock.Args, ir.NewForeach(arr, key, value, body, byRef))
+	if byRef && !g.config.Footguns {
+		g.currentBlock.Args = append(g.currentBlock.Args, ir.NewUnset(value))
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, g.varDumpCall(acc))
+	g.scope.PushVar(acc.Value.(string), accType)
+}
+
+// foreachArray returns an array variable with scalar elements,
+// it's declared if there is no such variable in scope.
+func (g *generator) foreachArray() *ir.Node {
+	v := g.scope.PickVar(func(v *scopeVar) bool {
+		typ, ok := v.typ.(*ir.ArrayType)
+		if !ok {
+			return false
+		}
+		elemType, ok := typ.Elem.(*ir.ScalarType)
+		return ok && elemType != ir.MixedType
+	})
+	if v != nil {
+		return ir.NewVar(v.name, v.typ)
+	}
+
+	typ := &ir.ArrayType{Elem: randutil.Elem(g.rand, scalarTypes)}
+	if randutil.Chance(g.rand, 0.3) {
+		typ.Key = ir.StringType
+	}
+	name := g.genVarname()
+	assign := ir.NewAssign(ir.NewVar(name, typ), g.expr.GenerateValueOfType(typ))
+	if g.expr.features.varTypeTags {
+		assign.Value = &phpdoc.VarTag{VarName: "$" + name, Type: ir.TypeDocString(typ)}
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, assign)
+	g.scope.PushVar(name, typ)
+	return ir.NewVar(name, typ)
+}
+
+// accumulate returns an x addition to the acc variable.
+func (g *generator) accumulate(acc, x *ir.Node) *ir.Node {
+	if acc.Type == ir.StringType {
+		return ir.NewAssignModify(ir.OpConcat, acc, x)
+	}
+	if x.Type != acc.Type && x.Type != ir.IntType {
+		x = &ir.Node{Op: ir.OpCast, Args: []*ir.Node{x}, Type: acc.Type}
+	}
+	return ir.NewAssignModify(ir.OpAdd, acc, x)
+}
+
+// pushForStmt adds a for loop with a counter that is not visible
+// to the loop body, like pushLoopStmt.
+func (g *generator) pushForStmt() {
+	if g.loopDepth >= g.maxLoopNesting() {
+		g.pushIfStmt()
+		return
+	}
+
+	prevCurrentBlock := g.currentBlock
+	g.breakLevels = append(g.breakLevels, true)
+	g.loopDepth++
+	g.scope.Enter()
+
+	// for ($i = 0; $i < n; $i++) { ... }
+	counter := ir.NewVar(g.genVarname(), ir.IntType)
+	bound := ir.NewIntLit(int64(randutil.IntRange(g.rand, 1, 10)))
+	tmp := &ir.Node{Op: ir.OpBlock}
+	g.currentBlock = tmp
+	g.pushBlockStmt()
+	forNode := ir.NewFor(
+		[]*ir.Node{ir.NewAssign(counter, ir.NewIntLit(0))},
+		[]*ir.Node{ir.NewLess(counter, bound)},
+		[]*ir.Node{ir.NewPostInc(counter)},
+		tmp.Args[0])
+
+	g.scope.Leave()
+	g.loopDepth--
+	g.breakLevels = g.breakLevels[:len(g.breakLevels)-1]
+	g.currentBlock = prevCurrentBlock
+	g.currentBlock.Args = append(g.currentBlock.Args, forNode)
+}
+
+func (g *generator) maxLoopNesting() int {
+	if g.config.MaxLoopNesting == 0 {
+		return 3
+	}
+	return g.config.MaxLoopNesting
+}
+
 func (g *generator) pushAssignStmt() {
 	v := g.pickVar()
 	if v == nil {
 		g.pushVarDecl(g.genVarname())
 		return
 	}
-	var op ir.Op
-	if typ, ok := v.typ.(*ir.ScalarType); ok && randutil.Bool(g.rand) {
-		var opChoice []ir.Op
-		switch typ.Kind {
-		case ir.ScalarInt, ir.ScalarFloat:
-			opChoice = []ir.Op{ir.OpAdd, ir.OpSub}
-		case ir.ScalarString:
-			opChoice = []ir.Op{ir.OpConcat}
-		case ir.ScalarMixed:
-			opChoice = []ir.Op{ir.OpAdd, ir.OpSub, ir.OpConcat}
-		}
-		if len(opChoice) != 0 {
-			op = opChoice[g.rand.Intn(len(opChoice))]
+	g.pushVarAssign(v, false)
+}
+
+// pushCompoundAssignStmt adds an assignment like $x += 10.
+func (g *generator) pushCompoundAssignStmt() bool {
+	v := g.pickVar()
+	if v == nil || len(g.compoundAssignOps(v.typ)) == 0 {
+		return false
+	}
+	g.pushVarAssign(v, true)
+	return true
+}
+
+// compoundAssignOps returns the compound assignment ops
+// that can be used with the typ variables.
+func (g *generator) compoundAssignOps(typ ir.Type) []ir.Op {
+	if _, ok := typ.(*ir.NullableType); ok {
+		if !g.expr.features.nullCoalesceAssign {
+			return nil
 		}
+		return []ir.Op{ir.OpNullCoalesce}
+	}
+	scalarType, ok := typ.(*ir.ScalarType)
+	if !ok {
+		return nil
+	}
+	// The *= rhs is bounded, see mulAssignValue.
+	switch scalarType.Kind {
+	case ir.ScalarInt:
+		return []ir.Op{ir.OpAdd, ir.OpSub, ir.OpMul, ir.OpBitAnd, ir.OpBitOr, ir.OpBitXor}
+	case ir.ScalarFloat:
+		return []ir.Op{ir.OpAdd, ir.OpSub, ir.OpMul}
+	case ir.ScalarString:
+		return []ir.Op{ir.OpConcat}
+	case ir.ScalarMixed:
+		return []ir.Op{ir.OpAdd, ir.OpSub, ir.OpConcat}
+	default:
+		return nil
+	}
+}
+
+// pushVarAssign adds the v variable assignment. It's a compound
+// assignment if the compound is set and the v type permits it.
+// The v variable is marked as mutated.
+func (g *generator) pushVarAssign(v *scopeVar, compound bool) {
+	var op ir.Op
+	if opChoice := g.compoundAssignOps(v.typ); compound && len(opChoice) != 0 {
+		op = randutil.Elem(g.rand, opChoice)
 	}
 	var assign *ir.Node
 	lhs := ir.NewVar(v.name, v.typ)
-	rhs := g.expr.GenerateValueOfType(v.typ)
+	var rhs *ir.Node
+	switch typ := v.typ.(type) {
+	case *ir.FuncType:
+		rhs = g.closureValue(typ)
+	case *ir.NullableType:
+		if op == ir.OpNullCoalesce {
+			// A null default would be pointless.
+			rhs = g.expr.GenerateValueOfType(typ.X)
+		} else {
+			rhs = g.expr.GenerateValueOfType(typ)
+		}
+	default:
+		if op == ir.OpMul {
+			rhs = g.mulAssignValue(v)
+		} else {
+			rhs = g.expr.GenerateValueOfType(v.typ)
+		}
+	}
 	if op != ir.OpInvalid {
 		assign = ir.NewAssignModify(op, lhs, rhs)
 	} else {
 		assign = ir.NewAssign(lhs, rhs)
 	}
 	g.currentBlock.Args = append(g.currentBlock.Args, assign)
+	if op == ir.OpInvalid {
+		g.pushSelfCheck(lhs, rhs)
+	}
+	g.scope.MarkMutated(v.name)
+}
+
+// mulAssignFactors are the float *= operands. Their magnitude is
+// not greater than 1, so the repeated multiplications can't reach INF,
+// and they're exact in binary, so the results don't depend on rounding.
+var mulAssignFactors = []float64{1, -1, 0.5, -0.5, 0.25, 0.75}
+
+// mulAssignValue returns the v *= rhs operand that can't overflow
+// even if the multiplication is repeated in a loop.
+//
+// Ints are multiplied by a small factor only if the result fits into
+// the int range, like ($x >= -4294967296 && $x <= 4294967296 ? 3 : 1).
+func (g *generator) mulAssignValue(v *scopeVar) *ir.Node {
+	if v.typ == ir.FloatType {
+		return ir.NewFloatLit(randutil.Elem(g.rand, mulAssignFactors))
+	}
+	const limit = 1 << 32
+	x := func() *ir.Node { return ir.NewVar(v.name, v.typ) }
+	fits := ir.NewAnd(ir.NewGreaterOrEqual(x(), ir.NewIntLit(-limit)), ir.NewLessOrEqual(x(), ir.NewIntLit(limit)))
+	factor := ir.NewIntLit(int64(randutil.IntRange(g.rand, -3, 3)))
+	rhs := ir.NewTernary(fits, factor, ir.NewIntLit(1))
+	rhs.Type = ir.IntType
+	return rhs
+}
+
+// pushSelfCheck adds a self_check call after the v = rhs assignment
+// if the rhs value can be computed in advance, see Config.SelfChecks.
+// It doesn't consume the random numbers, so the rest of the program
+// is the same as without the self-checks.
+func (g *generator) pushSelfCheck(v, rhs *ir.Node) {
+	if !g.expr.features.selfChecks {
+		return
+	}
+	want := g.evalConst(rhs)
+	if want == nil {
+		return
+	}
+	name := v.Value.(string)
+	call := ir.NewCall(ir.NewName("self_check"), ir.NewStringLit(name), ir.NewVar(name, v.Type), want)
+	g.currentBlock.Args = append(g.currentBlock.Args, call)
+}
+
+// evalConst returns a literal with the n scalar value or nil if
+// it can't be computed or it depends on the target PHP version.
+// NaN values are not returned since they're not equal to themselves.
+func (g *generator) evalConst(n *ir.Node) *ir.Node {
+	var modes []bool
+	if g.expr.features.newComparisons {
+		modes = append(modes, false)
+	}
+	if g.expr.features.legacyComparisons {
+		modes = append(modes, true)
+	}
+	var result interface{}
+	for i, legacy := range modes {
+		v, err := eval.Eval(n, &eval.Env{LegacyComparisons: legacy})
+		if err != nil {
+			return nil
+		}
+		if i != 0 && v != result {
+			return nil
+		}
+		result = v
+	}
+	switch v := result.(type) {
+	case int64:
+		return ir.NewIntLit(v)
+	case float64:
+		if v != v {
+			return nil
+		}
+		return ir.NewFloatLit(v)
+	case string:
+		return ir.NewStringLit(v)
+	case bool:
+		return ir.NewBoolLit(v)
+	default:
+		return nil
+	}
+}
+
+// pushIncDecStmt adds an int variable increment or decrement.
+// String variables are also incremented with WeirdIncrements.
+func (g *generator) pushIncDecStmt() {
+	op := randutil.Elem(g.rand, incDecOps)
+	v := g.expr.varOfType(ir.IntType)
+	if g.config.WeirdIncrements && g.expr.features.typeJuggling && !g.config.StrictTypes && randutil.Bool(g.rand) {
+		if s := g.expr.varOfType(ir.StringType); s != nil {
+			// Numeric strings are converted to numbers, other strings
+			// are incremented like "a" => "b" and "z" => "aa".
+			v = s
+			op = randutil.Elem(g.rand, []ir.Op{ir.OpPreInc, ir.OpPostInc})
+		}
+	}
+	if v == nil {
+		g.pushAssignStmt()
+		return
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, &ir.Node{Op: op, Args: []*ir.Node{v}})
+	g.scope.MarkMutated(v.Value.(string))
+}
+
+func (g *generator) pushClosureDecl() {
+	typ := &ir.FuncType{Result: g.expr.PickScalarType()}
+	numParams := randutil.IntRange(g.rand, 0, 2)
+	for i := 0; i < numParams; i++ {
+		// Params can't have the same names as the captured variables,
+		// so the names of the new params are unique.
+		paramName := "a" + strconv.Itoa(g.closureParamSeq)
+		g.closureParamSeq++
+		typ.Params = append(typ.Params, ir.TypeField{Name: paramName, Type: g.expr.PickScalarType()})
+	}
+	typ.MinArgsNum = numParams
+
+	name := g.genVarname()
+	assign := ir.NewAssign(ir.NewVar(name, typ), g.closureValue(typ))
+	g.currentBlock.Args = append(g.currentBlock.Args, assign)
+	g.scope.PushVar(name, typ)
+}
+
+func hasParam(typ *ir.FuncType, name string) bool {
+	for _, p := range typ.Params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// closureValue generates a closure that captures up to 3 variables.
+// Its body only sees the params and the captured variables.
+func (g *generator) closureValue(typ *ir.FuncType) *ir.Node {
+	var uses []ir.ClosureUse
+	var captured []scopeVar
+	var vars []scopeVar
+	for _, v := range g.scope.VisibleVars() {
+		// A reassigned closure reuses the typ params that could be
+		// visible here, but a param can't be captured under the same name.
+		if !hasParam(typ, v.name) {
+			vars = append(vars, v)
+		}
+	}
+	g.rand.Shuffle(len(vars), func(i, j int) { vars[i], vars[j] = vars[j], vars[i] })
+	numCaptures := randutil.IntRange(g.rand, 0, 3)
+	if numCaptures > len(vars) {
+		numCaptures = len(vars)
+	}
+	// The closure is an arrow function if it can't have a body block.
+	canNest := g.canNest()
+	for _, v := range vars[:numCaptures] {
+		// By reference captured closures could call each other endlessly.
+		_, isFunc := v.typ.(*ir.FuncType)
+		byRef := g.expr.features.byRefCaptures && !isFunc && canNest && randutil.Bool(g.rand)
+		uses = append(uses, ir.ClosureUse{Name: v.name, ByRef: byRef})
+		captured = append(captured, v)
+	}
+
+	prevScope := g.scope
+	prevCurrentBlock := g.currentBlock
+	prevBreakLevels := g.breakLevels
+	prevRecursionDepth := g.expr.recursionDepth
+	g.scope = newScope(g.rand)
+	g.expr.scope = g.scope
+	g.breakLevels = nil
+	g.expr.recursionDepth = nil
+	defer func() {
+		g.scope = prevScope
+		g.expr.scope = prevScope
+		g.currentBlock = prevCurrentBlock
+		g.breakLevels = prevBreakLevels
+		g.expr.recursionDepth = prevRecursionDepth
+	}()
+
+	g.scope.Enter()
+	for _, param := range typ.Params {
+		g.scope.PushVar(param.Name, param.Type)
+	}
+	for _, v := range captured {
+		g.scope.PushVar(v.name, v.typ)
+	}
+
+	numStatements := 0
+	if canNest {
+		numStatements = g.numBlockStatements(0, 2)
+	}
+	canBeArrow := numStatements == 0
+	for _, u := range uses {
+		canBeArrow = canBeArrow && !u.ByRef
+	}
+	if canBeArrow {
+		return ir.NewArrowClosure(typ, uses, g.closureResult(typ))
+	}
+
+	body := ir.NewBlock()
+	g.currentBlock = body
+	for i := 0; i < numStatements; i++ {
+		g.pushStatement()
+	}
+	body.Args = append(body.Args, g.observeLiveVars()...)
+	body.Args = append(body.Args, ir.NewReturn(g.closureResult(typ)))
+	return ir.NewClosure(typ, uses, body)
+}
+
+// closureResult generates the typ closure return value.
+// Closures declare the result type, so it's always converted explicitly.
+func (g *generator) closureResult(typ *ir.FuncType) *ir.Node {
+	result := g.expr.GenerateValueOfType(typ.Result)
+	return &ir.Node{Op: ir.OpCast, Args: []*ir.Node{g.expr.maybeAddParens(result)}, Type: typ.Result}
 }
 
 func (g *generator) pushVarDump() bool {
@@ -406,7 +1346,7 @@ func (g *generator) pushBlockStmt() {
 	newBlock := &ir.Node{Op: ir.OpBlock}
 	oldBlock := g.currentBlock
 	g.currentBlock = newBlock
-	numStatements := randutil.IntRange(g.rand, 1, 3)
+	numStatements := g.numBlockStatements(1, 3)
 	for i := 0; i < numStatements; i++ {
 		g.pushStatement()
 	}
@@ -414,19 +1354,62 @@ func (g *generator) pushBlockStmt() {
 	g.currentBlock = oldBlock
 }
 
+// pushIfStmt adds an if statement with up to MaxElseIfs elseif branches
+// and an optional else branch. Sometimes all branches assign the same
+// variable, so the code after the if statement depends on the taken branch.
 func (g *generator) pushIfStmt() {
-	cond := g.expr.condValue()
+	var shared *scopeVar
+	if randutil.Bool(g.rand) {
+		shared = g.pickVar()
+	}
 
+	numConds := 1
+	if g.config.MaxElseIfs > 0 {
+		numConds += randutil.IntRange(g.rand, 0, g.config.MaxElseIfs)
+	}
+	conds := make([]*ir.Node, numConds)
+	bodies := make([]*ir.Node, numConds)
+	for i := range conds {
+		conds[i] = g.expr.condValue()
+		bodies[i] = g.ifBranch(shared)
+	}
+
+	var ifNode *ir.Node
+	if randutil.Chance(g.rand, g.config.ElseProbability) {
+		ifNode = g.ifBranch(shared)
+	}
+	for i := numConds - 1; i >= 0; i-- {
+		if ifNode == nil {
+			ifNode = ir.NewIf(conds[i], bodies[i])
+		} else {
+			ifNode = ir.NewIfElse(conds[i], bodies[i], ifNode)
+		}
+	}
+	g.currentBlock.Args = append(g.currentBlock.Args, ifNode)
+}
+
+// ifBranch generates an if statement branch block in a child scope.
+// The shared variable is assigned at its end if it's not nil.
+func (g *generator) ifBranch(shared *scopeVar) *ir.Node {
 	oldBlock := g.currentBlock
 	g.scope.Enter()
+	defer func() {
+		g.scope.Leave()
+		g.currentBlock = oldBlock
+	}()
 
-	newBlock := &ir.Node{Op: ir.OpBlock}
-	g.currentBlock = newBlock
-	g.pushStatement()
-	oldBlock.Args = append(oldBlock.Args, ir.NewIf(cond, newBlock))
-
-	g.scope.Leave()
-	g.currentBlock = oldBlock
+	g.currentBlock = &ir.Node{Op: ir.OpBlock}
+	numStatements := g.numBlockStatements(1, 3)
+	for i := 0; i < numStatements; i++ {
+		g.pushStatement()
+	}
+	if shared != nil && !terminates(g.currentBlock) {
+		// The assigned closure is nested like the branch statements.
+		g.stmtDepth++
+		g.pushVarAssign(shared, randutil.Bool(g.rand))
+		g.stmtDepth--
+	}
+	return g.currentBlock
 }
 
 func (g *generator) pickVar() *scopeVar {
@@ -1,6 +1,8 @@
 package irgen
 
 import (
+	"context"
+	"fmt"
 	"math/rand"
 
 	"github.com/quasilyte/phpsmith/ir"
@@ -8,11 +10,280 @@ import (
 
 type Config struct {
 	Rand *rand.Rand
+
+	// StrictTypes makes the generated files use declare(strict_types=1).
+	// The generated code doesn't rely on implicit scalar type coercions
+	// in this mode.
+	StrictTypes bool
+
+	// NamespaceProbability is a chance of putting all generated files
+	// into a non-global namespace.
+	NamespaceProbability float64
+
+	// QualifiedCallProbability is a chance of calling a builtin function
+	// using its fully qualified name, like \strlen().
+	QualifiedCallProbability float64
+
+	// MixedTypeComparisons allows comparisons of different scalar types,
+	// like $s < $i. Note that PHP 8 changed the string to number
+	// comparison semantics, so they're only generated if the target
+	// versions are either all older or all newer than PHP 8.
+	MixedTypeComparisons bool
+
+	// CastProbability is a chance of generating an explicit conversion,
+	// like (int)$s, in place of a scalar expression.
+	CastProbability float64
+
+	// MaxArrayDepth limits the nesting of the generated array types,
+	// int[][] has a depth of 2. Zero value is the same as 1.
+	MaxArrayDepth int
+
+	// DuplicateArrayKeys permits associative array literals
+	// with duplicated keys, the last value wins in this case.
+	DuplicateArrayKeys bool
+
+	// ElseProbability is a chance of an if statement having an else branch.
+	ElseProbability float64
+
+	// MaxElseIfs limits the number of elseif branches of an if statement.
+	// Zero value means no elseif branches.
+	MaxElseIfs int
+
+	// MaxLoopNesting limits the loops nesting level.
+	// Zero value means 3, a negative value disables the loops.
+	MaxLoopNesting int
+
+	// MaxBlockStatements limits the number of statements in a block.
+	// MaxFunctionStatements limits the total number of statements
+	// in a function body, including the nested blocks.
+	// MaxBlockNesting limits the nesting level of the blocks
+	// inside a function body.
+	//
+	// The helper statements, like the loop counter updates and
+	// the observed variable prints, are not limited.
+	// Zero values mean no limit.
+	MaxBlockStatements    int
+	MaxFunctionStatements int
+	MaxBlockNesting       int
+
+	// StmtWeights override the built-in frequencies of the statement
+	// choices, like "assign" or "foreach", zero weight disables the choice.
+	// See newGenerator for the full list.
+	//
+	// The statements that can't be generated with the current config
+	// are disabled, it's reported by Program.Warnings.
+	StmtWeights map[string]int
+
+	// NoObserve disables the scalar variable prints
+	// at the function ends and before the returns.
+	// It's useful for the crash-only fuzzing.
+	NoObserve bool
+
+	// SelfChecks makes the generated code compare the variables
+	// with their values computed in advance (see the ir/eval package)
+	// after the constant expression assignments.
+	// The mismatches are printed as "self-check failed" lines.
+	// It has no effect in the KPHP dialect.
+	SelfChecks bool
+
+	// OutputMode tells how the observed variables are printed.
+	// It has no effect with NoObserve.
+	OutputMode OutputMode
+
+	// Seed is printed along with the observed values hash.
+	Seed int64
+
+	// DeadCode permits the statements after
+	// unconditional break and continue statements.
+	DeadCode bool
+
+	// DuplicateCases permits the switch statements with
+	// duplicated case values, only the first of them is reachable.
+	DuplicateCases bool
+
+	// ShadowVars permits the inner block variable declarations
+	// that reuse the outer block variable names.
+	ShadowVars bool
+
+	// ByRefForeach permits the foreach loops with by reference
+	// value variables, like foreach ($xs as &$x).
+	ByRefForeach bool
+
+	// Footguns permits the code with a famous surprising behavior,
+	// like a foreach by reference variable that is not unset after the loop.
+	Footguns bool
+
+	// MaxExprDepth limits the expressions nesting level.
+	// Zero value means a default limit of 10.
+	MaxExprDepth int
+
+	// MaxExprNodes limits the number of subexpressions
+	// in every generated expression. Zero value means no limit.
+	MaxExprNodes int
+
+	// MaxTotalExprs is a budget of the subexpressions in the whole
+	// program, like MaxExprNodes is for a single expression.
+	// Once it's spent, no new statements are generated and the
+	// current ones are finished with the leaf expressions only.
+	// It's not a cap on the program size: the leaves and the required
+	// statements, like the function returns, are not counted.
+	// Zero value means no limit.
+	MaxTotalExprs int
+
+	// MinPHPVersion is the oldest PHP version the generated code should
+	// run on, in the PHP_VERSION_ID format (like 80100 for PHP 8.1).
+	// Builtins that were introduced later are not called.
+	MinPHPVersion int
+
+	// MaxPHPVersion is the newest PHP version the generated code should
+	// run on, in the same format as MinPHPVersion. The syntax removed
+	// after it can be used, like $s{0} string offsets for PHP 7.3.
+	// Zero value means no upper bound.
+	MaxPHPVersion int
+
+	// MaxStringLength is the max number of characters in the
+	// generated string literals. Zero value means 8.
+	MaxStringLength int
+
+	// StringWeights sets the string literals content distribution.
+	// Zero value means the default weights.
+	StringWeights StringWeights
+
+	// InvalidUTF8 permits the string literals with arbitrary bytes,
+	// they are not always valid UTF-8.
+	InvalidUTF8 bool
+
+	// IntLits, FloatLits and StringLits replace the predefined pools
+	// the literals are sometimes picked from if they're not empty.
+	IntLits    []int64
+	FloatLits  []float64
+	StringLits []string
+
+	// ExprWeights override the built-in frequencies of the expression
+	// choices, zero weight disables the choice. The weights can't
+	// disable all choices of a type.
+	ExprWeights map[ExprChoice]int
+
+	// Dialect is the target language dialect.
+	Dialect Dialect
+
+	// PHPVersion is the target PHP version, like "7.4" or "8.1".
+	// It overrides both MinPHPVersion and MaxPHPVersion if set.
+	PHPVersion string
+
+	// Builtins is a list of builtin functions that can be called,
+	// phpfunc.GetList() is used if it's nil.
+	Builtins []*ir.FuncType
+
+	// NoBuiltins disables the builtin function calls.
+	NoBuiltins bool
+
+	// PureBuiltins excludes the builtins with environment-dependent
+	// results, like file_exists.
+	PureBuiltins bool
+
+	// RecursiveFuncs enables the generation of recursive functions.
+	// They take an extra $depth argument decremented by every recursive
+	// call and return early once it's not positive.
+	RecursiveFuncs bool
+
+	// MaxRecursionDepth is the max $depth argument of the recursive
+	// function calls from the main file. Zero value means 3.
+	MaxRecursionDepth int
+
+	// ByRefCaptures permits the closures to capture variables
+	// by reference, like function() use (&$x).
+	ByRefCaptures bool
+
+	// WeirdIncrements permits the string variables increments,
+	// like $s++. Numeric strings become numbers after that,
+	// so it has no effect with StrictTypes.
+	WeirdIncrements bool
+
+	// AllowWarnings permits the expressions that emit warnings,
+	// like the out of range string offsets.
+	AllowWarnings bool
+
+	// SpecialFloats permits the NaN and infinite float literals.
+	// They're disabled by default since they break the naive
+	// output diffing, NaN is not even equal to itself.
+	SpecialFloats bool
+
+	// AllowNaN permits the sqrt and fmod calls that can produce NaN
+	// from a non-NaN argument, like sqrt of a negative number.
+	AllowNaN bool
+}
+
+// Dialect is a PHP language dialect.
+type Dialect int
+
+const (
+	// DialectPHP is the PHP language as implemented by the php interpreter.
+	DialectPHP Dialect = iota
+
+	// DialectKPHP is the statically typed subset of PHP that KPHP compiles.
+	// It permits the KPHP tuples, but excludes the by reference captures,
+	// the string increments and other type juggling, the environment-dependent
+	// builtins, and the removed syntax like $s{0}. The array and tuple
+	// variables are declared with @var tags.
+	DialectKPHP
+)
+
+// OutputMode is the observed variables output format.
+type OutputMode int
+
+const (
+	// OutputFull prints every observed variable.
+	OutputFull OutputMode = iota
+
+	// OutputHash prints only the md5 hash of the observed variables
+	// output and the seed at the main function end.
+	// It's useful for the big programs with a huge output.
+	OutputHash
+
+	// OutputBoth is like OutputFull, but the hash is printed too.
+	OutputBoth
+)
+
+// ExprChoice identifies a kind of the generated expressions.
+type ExprChoice struct {
+	// Type is a result type: "bool", "int", "float" or "string".
+	// The "cond" type is for the bool expressions used as conditions.
+	Type string
+
+	// Name is a choice name, like "concat" or "lit".
+	// See newExprGenerator for the full list.
+	Name string
+}
+
+// StringWeights are the relative frequencies of the string literal kinds.
+type StringWeights struct {
+	// Pool is a predefined set of the interesting strings.
+	Pool int
+
+	// ASCII is printable ASCII characters.
+	ASCII int
+
+	// Bytes is arbitrary bytes, they're only used with Config.InvalidUTF8.
+	Bytes int
+
+	// UTF8 is valid UTF-8 characters, including multibyte
+	// and astral plane code points.
+	UTF8 int
+
+	// Numeric is numeric-looking strings, like "007" and "1e3".
+	Numeric int
+
+	// Printf is strings with printf specifiers, like "%d".
+	Printf int
 }
 
 type Program struct {
-	Files        []*File
+	Files        []*ir.File
 	RuntimeFiles []*RuntimeFile
+
+	// Warnings describe the config settings that were ignored.
+	Warnings []string
 }
 
 type RuntimeFile struct {
@@ -21,13 +292,51 @@ type RuntimeFile struct {
 	Contents []byte
 }
 
-type File struct {
-	Name string
-
-	Nodes []ir.RootNode
+// RuntimeLibrary returns the fuzzlib.php file that defines the helper
+// functions called by the generated programs, including the ones that
+// are printed by irprint in place of some operations, like _safe_int_div.
+//
+// CreateProgram adds it to the program runtime files,
+// the main file requires it.
+func RuntimeLibrary() *RuntimeFile {
+	return &RuntimeFile{Name: "fuzzlib.php", Contents: phpFuzzlib}
 }
 
 func CreateProgram(config *Config) *Program {
 	g := newGenerator(config)
 	return g.CreateProgram()
 }
+
+// CreateProgramContext is like CreateProgram, but it stops generating
+// new statements once the ctx is done. The program is still complete
+// and printable then, it's returned along with the ctx error.
+func CreateProgramContext(ctx context.Context, config *Config) (*Program, error) {
+	g := newGenerator(config)
+	g.expr.ctx = ctx
+	program := g.CreateProgram()
+	if g.expr.stopped {
+		return program, ctx.Err()
+	}
+	return program, nil
+}
+
+// CreateProgramFromSeed creates a program using the seed
+// as the config Rand source and its Seed.
+// The same seed and config settings always give the same program.
+//
+// The seed is written into the generated files headers,
+// so the program can be reproduced from its files alone.
+func CreateProgramFromSeed(seed int64, config Config) *Program {
+	program, _ := createSeededProgram(context.Background(), seed, config)
+	return program
+}
+
+func createSeededProgram(ctx context.Context, seed int64, config Config) (*Program, error) {
+	config.Rand = rand.New(rand.NewSource(seed))
+	config.Seed = seed
+	program, err := CreateProgramContext(ctx, &config)
+	for _, f := range program.Files {
+		f.Header = fmt.Sprintf("Generated by phpsmith, seed: %d", seed)
+	}
+	return program, err
+}
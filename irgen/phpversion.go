@@ -0,0 +1,130 @@
+package irgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// php71 introduced negative string offsets.
+	php71 = 70100
+
+	// php74 deprecated curly brace string offsets, PHP 8 removed them.
+	// It also introduced the ??= operator.
+	php74 = 70400
+
+	// php80 changed the string to number comparison semantics.
+	php80 = 80000
+)
+
+// phpFeatures tells which version-dependent and dialect-dependent
+// features can be generated.
+//
+// It's derived from the config by newPHPFeatures, so the version
+// and dialect checks are not scattered around the generator.
+type phpFeatures struct {
+	// minVersion is the oldest target version, builtins
+	// introduced after it are not called.
+	minVersion int
+
+	// negativeStringOffsets permits $s[-1] reads.
+	negativeStringOffsets bool
+
+	// curlyStringOffsets permits $s{0} reads.
+	curlyStringOffsets bool
+
+	// stringNumberComparisons permits comparisons of strings with
+	// ints and floats, they're only stable when all target versions
+	// are either older or newer than PHP 8.
+	stringNumberComparisons bool
+
+	// tuples permits the KPHP tuple types.
+	tuples bool
+
+	// typeJuggling permits the mixed type comparisons,
+	// string increments and string to number casts.
+	typeJuggling bool
+
+	// byRefCaptures permits the closures to capture variables by reference.
+	byRefCaptures bool
+
+	// impureBuiltins permits the environment-dependent builtins.
+	impureBuiltins bool
+
+	// nullCoalesceAssign permits the ??= compound assignments.
+	nullCoalesceAssign bool
+
+	// switchContinue permits the continue statements targeting a switch.
+	switchContinue bool
+
+	// varTypeTags makes the array and tuple variables
+	// declared with @var tags.
+	varTypeTags bool
+
+	// legacyComparisons and newComparisons tell whether the targets
+	// include the versions older than PHP 8 and PHP 8 or newer.
+	// The self-checks are only generated for the expressions that
+	// have the same value with all target comparison semantics.
+	legacyComparisons bool
+	newComparisons    bool
+
+	// selfChecks permits the self_check calls, see Config.SelfChecks.
+	selfChecks bool
+}
+
+func newPHPFeatures(config *Config) *phpFeatures {
+	minVersion := config.MinPHPVersion
+	maxVersion := config.MaxPHPVersion
+	if config.PHPVersion != "" {
+		version, err := parsePHPVersion(config.PHPVersion)
+		if err != nil {
+			panic(err.Error())
+		}
+		minVersion = version
+		maxVersion = version
+	}
+
+	// Zero maxVersion means no upper bound.
+	maxBelow := func(version int) bool {
+		return maxVersion != 0 && maxVersion < version
+	}
+	kphp := config.Dialect == DialectKPHP
+	return &phpFeatures{
+		minVersion:              minVersion,
+		negativeStringOffsets:   minVersion >= php71,
+		curlyStringOffsets:      maxBelow(php74) && !kphp,
+		stringNumberComparisons: minVersion >= php80 || maxBelow(php80),
+		tuples:                  kphp,
+		typeJuggling:            !kphp,
+		byRefCaptures:           config.ByRefCaptures && !kphp,
+		impureBuiltins:          !config.PureBuiltins && !kphp,
+		nullCoalesceAssign:      minVersion >= php74,
+		switchContinue:          !kphp,
+		varTypeTags:             kphp,
+		legacyComparisons:       minVersion < php80,
+		newComparisons:          !maxBelow(php80),
+		selfChecks:              config.SelfChecks && !kphp,
+	}
+}
+
+// parsePHPVersion converts a version like "8.1" or "7.4.3"
+// into the PHP_VERSION_ID format.
+func parsePHPVersion(s string) (int, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid PHP version %q", s)
+	}
+	version := 0
+	for i, multiplier := range []int{10000, 100, 1} {
+		if i >= len(parts) {
+			break
+		}
+		x, err := strconv.Atoi(parts[i])
+		if err != nil || x < 0 || x > 99 {
+			return 0, fmt.Errorf("invalid PHP version %q", s)
+		}
+		version += x * multiplier
+	}
+	return version, nil
+}
@@ -1,21 +1,29 @@
 package irgen
 
 import (
+	"math/rand"
+
 	"github.com/quasilyte/phpsmith/ir"
 )
 
 type scope struct {
 	vars   []scopeVar
 	depths []int
+
+	rand *rand.Rand
 }
 
 type scopeVar struct {
 	name string
 	typ  ir.Type
+
+	// mutated is set when the variable is assigned after its
+	// declaration, so its initial value can't be assumed.
+	mutated bool
 }
 
-func newScope() *scope {
-	return &scope{}
+func newScope(rand *rand.Rand) *scope {
+	return &scope{rand: rand}
 }
 
 func (s *scope) Enter() {
@@ -33,14 +41,57 @@ func (s *scope) PushVar(name string, typ ir.Type) {
 	s.depths[len(s.depths)-1]++
 }
 
+// RemoveVar removes the name variable declared in the current block.
+func (s *scope) RemoveVar(name string) {
+	depth := s.depths[len(s.depths)-1]
+	for i := len(s.vars) - depth; i < len(s.vars); i++ {
+		if s.vars[i].name == name {
+			s.vars = append(s.vars[:i], s.vars[i+1:]...)
+			s.depths[len(s.depths)-1]--
+			return
+		}
+	}
+}
+
+// MarkMutated marks the visible name variable as mutated.
+func (s *scope) MarkMutated(name string) {
+	if v := s.FindVarByName(name); v != nil {
+		v.mutated = true
+	}
+}
+
 func (s *scope) CurrentBlockVars() []scopeVar {
 	depth := s.depths[len(s.depths)-1]
 	return s.vars[len(s.vars)-depth:]
 }
 
+// IsCurrentBlockVar reports whether the name variable
+// is declared in the current block.
+func (s *scope) IsCurrentBlockVar(name string) bool {
+	for _, v := range s.CurrentBlockVars() {
+		if v.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Shadows reports whether the name variable declared in the current
+// block has the same name as a variable from the outer blocks.
+func (s *scope) Shadows(name string) bool {
+	depth := s.depths[len(s.depths)-1]
+	for _, v := range s.vars[:len(s.vars)-depth] {
+		if v.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FindVarOfType returns a random visible variable of the typ type.
 func (s *scope) FindVarOfType(typ ir.Type) *scopeVar {
-	return s.FindVar(func(v *scopeVar) bool {
-		return typesIdentical(typ, v.typ)
+	return s.PickVar(func(v *scopeVar) bool {
+		return ir.TypesIdentical(typ, v.typ)
 	})
 }
 
@@ -64,3 +115,31 @@ func (s *scope) FindVar(predicate func(*scopeVar) bool) *scopeVar {
 	}
 	return nil
 }
+
+// PickVar returns a random visible variable that matches the predicate,
+// all of them are equally likely to be picked.
+func (s *scope) PickVar(predicate func(*scopeVar) bool) *scopeVar {
+	var candidates []*scopeVar
+	s.FindVar(func(v *scopeVar) bool {
+		if predicate(v) {
+			candidates = append(candidates, v)
+		}
+		return false
+	})
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[s.rand.Intn(len(candidates))]
+}
+
+// VisibleVars returns the variables that are not shadowed
+// by the later declarations with the same name.
+// The latest declared variables are listed first.
+func (s *scope) VisibleVars() []scopeVar {
+	var vars []scopeVar
+	s.FindVar(func(v *scopeVar) bool {
+		vars = append(vars, *v)
+		return false
+	})
+	return vars
+}
@@ -5,22 +5,57 @@ import "github.com/quasilyte/phpsmith/ir"
 type symbolTable struct {
 	funcs map[string]*ir.FuncType
 
+	builtinFuncs map[string]struct{}
+
 	voidFuncs   []*ir.FuncType
 	boolFuncs   []*ir.FuncType
 	intFuncs    []*ir.FuncType
 	floatFuncs  []*ir.FuncType
 	stringFuncs []*ir.FuncType
 	arrayFuncs  []*ir.FuncType
+
+	// userFuncs are the generated functions, in the declaration order.
+	userFuncs []*ir.FuncType
+
+	// recursiveFuncs are the generated functions that take
+	// the recursion depth as the first argument.
+	recursiveFuncs map[string]struct{}
 }
 
 func newSymbolTable() *symbolTable {
 	return &symbolTable{
-		funcs: make(map[string]*ir.FuncType),
+		funcs:        make(map[string]*ir.FuncType),
+		builtinFuncs: make(map[string]struct{}),
+
+		recursiveFuncs: make(map[string]struct{}),
 	}
 }
 
+func (symtab *symbolTable) AddBuiltinFunc(fn *ir.FuncType) {
+	symtab.builtinFuncs[fn.Name] = struct{}{}
+	symtab.AddFunc(fn)
+}
+
+func (symtab *symbolTable) IsBuiltinFunc(name string) bool {
+	_, ok := symtab.builtinFuncs[name]
+	return ok
+}
+
+func (symtab *symbolTable) AddRecursiveFunc(fn *ir.FuncType) {
+	symtab.recursiveFuncs[fn.Name] = struct{}{}
+	symtab.AddFunc(fn)
+}
+
+func (symtab *symbolTable) IsRecursiveFunc(name string) bool {
+	_, ok := symtab.recursiveFuncs[name]
+	return ok
+}
+
 func (symtab *symbolTable) AddFunc(fn *ir.FuncType) {
 	symtab.funcs[fn.Name] = fn
+	if !symtab.IsBuiltinFunc(fn.Name) {
+		symtab.userFuncs = append(symtab.userFuncs, fn)
+	}
 
 	switch resultType := fn.Result.(type) {
 	case *ir.ScalarType:
@@ -41,3 +76,14 @@ func (symtab *symbolTable) AddFunc(fn *ir.FuncType) {
 		symtab.arrayFuncs = append(symtab.arrayFuncs, fn)
 	}
 }
+
+// UserFuncsOfType returns the generated functions with the typ result.
+func (symtab *symbolTable) UserFuncsOfType(typ ir.Type) []*ir.FuncType {
+	var funcs []*ir.FuncType
+	for _, fn := range symtab.userFuncs {
+		if ir.TypesIdentical(typ, fn.Result) {
+			funcs = append(funcs, fn)
+		}
+	}
+	return funcs
+}
@@ -1,8 +1,6 @@
 package irgen
 
 import (
-	"fmt"
-
 	"github.com/quasilyte/phpsmith/ir"
 )
 
@@ -12,31 +10,31 @@ func canDump(t ir.Type) bool {
 		return true
 	case *ir.ArrayType:
 		return canDump(t.Elem)
+	case *ir.NullableType:
+		return canDump(t.X)
+	case *ir.UnionType:
+		for _, x := range t.Types {
+			if !canDump(x) {
+				return false
+			}
+		}
+		return true
 	default:
 		return false
 	}
 }
 
-func typesIdentical(t1, t2 ir.Type) bool {
-	switch t1 := t1.(type) {
-	case *ir.ScalarType:
-		t2, ok := t2.(*ir.ScalarType)
-		return ok && t1.Kind == t2.Kind
-
-	case *ir.EnumType:
-		t2, ok := t2.(*ir.EnumType)
-		if !ok || len(t1.Values) != len(t2.Values) || !typesIdentical(t1.ValueType, t2.ValueType) {
-			return false
-		}
-		for i, v1 := range t1.Values {
-			v2 := t2.Values[i]
-			if v1 != v2 {
-				return false
-			}
-		}
+// needsStrictCast reports whether typ values should be converted
+// explicitly to avoid strict_types=1 mode type errors.
+func needsStrictCast(t ir.Type) bool {
+	scalarType, ok := t.(*ir.ScalarType)
+	if !ok {
+		return false
+	}
+	switch scalarType.Kind {
+	case ir.ScalarBool, ir.ScalarInt, ir.ScalarFloat, ir.ScalarString:
 		return true
-
 	default:
-		panic(fmt.Sprintf("unexpected type %T", t1))
+		return false
 	}
 }
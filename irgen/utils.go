@@ -14,3 +14,12 @@ func isSimpleNode(n *ir.Node) bool {
 		return false
 	}
 }
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -5,16 +5,84 @@ import (
 	"math/rand"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/quasilyte/phpsmith/randutil"
 )
 
 type valueGenerator struct {
 	rand *rand.Rand
+
+	specialFloats bool
+
+	intLits    []int64
+	floatLits  []float64
+	stringLits []string
+
+	maxStringLength int
+	stringKinds     []stringKind
+	stringWeights   int
+}
+
+// stringKind generates the string literals of n characters.
+type stringKind struct {
+	weight   int
+	generate func(n int) string
+}
+
+func newValueGenerator(config *Config) *valueGenerator {
+	g := &valueGenerator{
+		rand:            config.Rand,
+		specialFloats:   config.SpecialFloats,
+		maxStringLength: config.MaxStringLength,
+		intLits:         config.IntLits,
+		floatLits:       config.FloatLits,
+		stringLits:      config.StringLits,
+	}
+	if len(g.intLits) == 0 {
+		g.intLits = intLitValues
+	}
+	if len(g.floatLits) == 0 {
+		g.floatLits = floatLitValues
+	}
+	if len(g.stringLits) == 0 {
+		g.stringLits = stringLitValues
+	}
+	if g.maxStringLength == 0 {
+		g.maxStringLength = 8
+	}
+
+	weights := config.StringWeights
+	if weights == (StringWeights{}) {
+		weights = defaultStringWeights
+	}
+	if !config.InvalidUTF8 {
+		weights.Bytes = 0
+	}
+	g.stringKinds = []stringKind{
+		{weight: weights.Pool, generate: func(int) string { return randutil.Elem(g.rand, g.stringLits) }},
+		{weight: weights.ASCII, generate: g.asciiString},
+		{weight: weights.Bytes, generate: g.bytesString},
+		{weight: weights.UTF8, generate: g.utf8String},
+		{weight: weights.Numeric, generate: func(int) string { return randutil.Elem(g.rand, numericStringValues) }},
+		{weight: weights.Printf, generate: g.printfString},
+	}
+	for _, kind := range g.stringKinds {
+		g.stringWeights += kind.weight
+	}
+	if g.stringWeights == 0 {
+		panic("all string weights are zero")
+	}
+	return g
 }
 
-func newValueGenerator(r *rand.Rand) *valueGenerator {
-	return &valueGenerator{rand: r}
+var defaultStringWeights = StringWeights{
+	Pool:    2,
+	ASCII:   4,
+	Bytes:   1,
+	UTF8:    2,
+	Numeric: 2,
+	Printf:  1,
 }
 
 func toEfaceSlice[T any](xs []T) []any {
@@ -25,17 +93,18 @@ func toEfaceSlice[T any](xs []T) []any {
 	return result
 }
 
+// generateUniqueValues returns up to n unique values in the generation
+// order, so the result only depends on f. It can return less values
+// if f doesn't produce enough of them, like with a small literals pool.
 func generateUniqueValues[T comparable](n int, f func() T) []T {
 	set := make(map[T]struct{}, n)
-	for len(set) < n {
+	slice := make([]T, 0, n)
+	for attempts := 0; len(slice) < n && attempts < n*100; attempts++ {
 		x := f()
 		if _, ok := set[x]; ok {
 			continue
 		}
 		set[x] = struct{}{}
-	}
-	slice := make([]T, 0, len(set))
-	for x := range set {
 		slice = append(slice, x)
 	}
 	return slice
@@ -50,36 +119,101 @@ func (g *valueGenerator) IntValue() int64 {
 	case 4:
 		return int64(randutil.IntRange(g.rand, 100000, 19438420511))
 	default:
-		return intLitValues[g.rand.Intn(len(intLitValues))]
+		return randutil.Elem(g.rand, g.intLits)
 	}
 }
 
 func (g *valueGenerator) FloatValue() float64 {
-	switch g.rand.Intn(8) {
-	case 0:
-		return g.rand.Float64()
-	case 2, 3:
-		return g.rand.Float64() * float64(g.rand.Intn(1000))
-	case 4:
-		return g.rand.Float64() * float64(g.rand.Intn(10000000))
+	switch g.rand.Intn(16) {
+	case 0, 1, 2:
+		return niceFloatValues[g.rand.Intn(len(niceFloatValues))]
+	case 3, 4, 5:
+		return g.rand.Float64()*2000 - 1000
+	case 6, 7:
+		// The magnitudes are distributed exponentially.
+		return g.floatSign() * g.rand.Float64() * math.Pow(10, float64(randutil.IntRange(g.rand, -307, 308)))
+	case 8:
+		return g.floatSign() * math.SmallestNonzeroFloat64 * float64(randutil.IntRange(g.rand, 1, 1000))
+	case 9:
+		// The integers above 2^53 are exact only if they're even.
+		return g.floatSign() * float64(1<<53+2*g.rand.Int63n(1<<20))
+	case 10:
+		return math.Copysign(0, -1)
+	case 11:
+		if g.specialFloats {
+			return specialFloatValues[g.rand.Intn(len(specialFloatValues))]
+		}
+		return randutil.Elem(g.rand, g.floatLits)
 	default:
-		return floatLitValues[g.rand.Intn(len(floatLitValues))]
+		return randutil.Elem(g.rand, g.floatLits)
+	}
+}
+
+func (g *valueGenerator) floatSign() float64 {
+	if randutil.Bool(g.rand) {
+		return -1
 	}
+	return 1
 }
 
 func (g *valueGenerator) StringValue() string {
-	if randutil.Chance(g.rand, 0.2) {
-		return randutil.Elem(g.rand, stringLitValues)
+	n := g.rand.Intn(g.maxStringLength + 1)
+	x := g.rand.Intn(g.stringWeights)
+	for _, kind := range g.stringKinds {
+		if x < kind.weight {
+			return kind.generate(n)
+		}
+		x -= kind.weight
+	}
+	panic("unreachable")
+}
+
+func (g *valueGenerator) asciiString(n int) string {
+	var s strings.Builder
+	for i := 0; i < n; i++ {
+		s.WriteByte(byte(randutil.IntRange(g.rand, ' ', '~')))
+	}
+	return s.String()
+}
+
+// bytesString can return an invalid UTF-8 string.
+func (g *valueGenerator) bytesString(n int) string {
+	s := make([]byte, n)
+	g.rand.Read(s)
+	return string(s)
+}
+
+func (g *valueGenerator) utf8String(n int) string {
+	var s strings.Builder
+	for i := 0; i < n; i++ {
+		var ch rune
+		switch g.rand.Intn(4) {
+		case 0:
+			ch = rune(randutil.IntRange(g.rand, ' ', '~'))
+		case 1:
+			ch = rune(randutil.IntRange(g.rand, 0x80, 0x7ff))
+		case 2:
+			ch = rune(randutil.IntRange(g.rand, 0x800, 0xffff))
+		default:
+			ch = rune(randutil.IntRange(g.rand, 0x10000, unicode.MaxRune))
+		}
+		if !utf8.ValidRune(ch) {
+			// A surrogate half.
+			ch = utf8.RuneError
+		}
+		s.WriteRune(ch)
 	}
+	return s.String()
+}
 
+// printfString interleaves the ASCII characters with printf specifiers.
+func (g *valueGenerator) printfString(n int) string {
 	var s strings.Builder
-	count := randutil.IntRange(g.rand, 1, 6)
-	for i := 0; i < count; i++ {
-		ch := g.rand.Intn(unicode.MaxASCII)
-		if !unicode.IsPrint(rune(ch)) || ch == '$' {
-			s.WriteString(stringLitValues[g.rand.Intn(len(stringLitValues))])
+	for i := 0; i < n; i++ {
+		if randutil.Chance(g.rand, 0.3) {
+			s.WriteString(randutil.Elem(g.rand, printfSpecifiers))
 		} else {
-			s.WriteByte(byte(ch))
+			s.WriteByte(byte(randutil.IntRange(g.rand, ' ', '~')))
 		}
 	}
 	return s.String()
@@ -108,6 +242,26 @@ var floatLitValues = []float64{
 	21948.293242,
 	-2222.9999,
 	2842.6378,
+	math.MaxFloat64,
+	-math.MaxFloat64,
+	math.SmallestNonzeroFloat64,
+	1 << 53,
+	1<<53 + 2,
+}
+
+// niceFloatValues make the float comparisons hit the equal values.
+var niceFloatValues = []float64{
+	0,
+	1,
+	-1,
+	0.5,
+	2,
+	10,
+	0.25,
+}
+
+// specialFloatValues are only generated with Config.SpecialFloats.
+var specialFloatValues = []float64{
 	math.NaN(),
 	math.Inf(1),
 	math.Inf(-1),
@@ -134,3 +288,50 @@ var stringLitValues = []string{
 	`{"key":1}`,
 	`["val"]`,
 }
+
+var numericStringValues = []string{
+	"007",
+	"1e3",
+	"0x1A",
+	"0b11",
+	"0o17",
+	" 12",
+	"12 ",
+	"1_000",
+	"-0",
+	"+1",
+	".5",
+	"1.",
+	"-1.5e-3",
+	"9223372036854775807",
+	"9223372036854775808",
+	"-9223372036854775809",
+	"1e1000",
+	"INF",
+	"NAN",
+	"12abc",
+}
+
+var printfSpecifiers = []string{
+	"%",
+	"%%",
+	"%s",
+	"%d",
+	"%u",
+	"%x",
+	"%X",
+	"%o",
+	"%b",
+	"%c",
+	"%e",
+	"%f",
+	"%F",
+	"%g",
+	"%05d",
+	"%-10s",
+	"%'*10s",
+	"%.2f",
+	"%+d",
+	"%1$s",
+	"%2$d",
+}
@@ -0,0 +1,85 @@
+package irprint
+
+import (
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// printAltBody prints a loop body using the alternative syntax,
+// like "while ($x):" followed by statements and "endwhile;".
+func (p *printer) printAltBody(body *ir.Node, end string) printFlags {
+	p.printAltSeq(body, false)
+	p.indent()
+	p.w.WriteString(end)
+	return flagNeedSemicolon | flagNeedNewline
+}
+
+// printAltIf prints if statement with its elseif and else
+// clauses using the alternative syntax.
+// The clauses of the colon form can't be printed in the brace form.
+func (p *printer) printAltIf(n *ir.Node) printFlags {
+	p.w.WriteString(p.keyword("if ("))
+	p.printNode(n.Args[0])
+	p.w.WriteByte(')')
+	for n.Op == ir.OpIfElse {
+		p.printAltSeq(n.Args[1], true)
+		p.indent()
+		elseNode := n.Args[2]
+		if elseNode.Op != ir.OpIf && elseNode.Op != ir.OpIfElse {
+			p.w.WriteString(p.keyword("else"))
+			return p.printAltBody(elseNode, p.keyword("endif"))
+		}
+		p.w.WriteString(p.keyword("elseif ("))
+		p.printNode(elseNode.Args[0])
+		p.w.WriteByte(')')
+		n = elseNode
+	}
+	return p.printAltBody(n.Args[1], p.keyword("endif"))
+}
+
+// printAltSeq prints the colon-form body statements.
+// The beforeElse argument tells whether it's followed by elseif or else.
+func (p *printer) printAltSeq(body *ir.Node, beforeElse bool) {
+	stmts := []*ir.Node{body}
+	if body.Op == ir.OpBlock {
+		stmts = body.Args
+	}
+	if beforeElse && len(stmts) != 0 && endsWithOpenIf(stmts[len(stmts)-1]) {
+		// "if ($x): if ($y) {} else: endif;" is a syntax error:
+		// the else is attached to the inner if that doesn't expect a colon.
+		// Wrapping the inner if into a block closes it.
+		last := len(stmts) - 1
+		stmts = append(stmts[:last:last], ir.NewBlock(stmts[last]))
+	}
+	p.w.WriteString(":\n")
+	p.depth++
+	p.printSeq(stmts)
+	p.depth--
+}
+
+// endsWithOpenIf reports whether the printed n statement can end
+// with an if statement that would take the following else.
+func endsWithOpenIf(n *ir.Node) bool {
+	switch n.Op {
+	case ir.OpIf:
+		return true
+	case ir.OpIfElse:
+		return endsWithOpenIf(n.Args[2])
+	case ir.OpWhile:
+		return endsWithOpenIf(n.Args[1])
+	case ir.OpFor, ir.OpForeach:
+		return endsWithOpenIf(n.Args[3])
+	default:
+		return false
+	}
+}
+
+func (p *printer) useAltSyntax() bool {
+	if !p.config.AltSyntax {
+		return false
+	}
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package irprint
+
+import (
+	"fmt"
+
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// castKeywords returns the PHP cast keywords for typ,
+// the first one is the canonical spelling, others are its synonyms.
+// An empty result is returned for types that can't be cast to.
+//
+// The (real) synonym is not used, it's removed in PHP 8.
+// The (unset) cast is removed in PHP 8 as well.
+func castKeywords(typ ir.Type) []string {
+	switch typ := typ.(type) {
+	case *ir.ScalarType:
+		switch typ.Kind {
+		case ir.ScalarBool:
+			return []string{"bool", "boolean"}
+		case ir.ScalarInt:
+			return []string{"int", "integer"}
+		case ir.ScalarFloat:
+			return []string{"float", "double"}
+		case ir.ScalarString:
+			return []string{"string", "binary"}
+		}
+	case *ir.EnumType:
+		return castKeywords(typ.ValueType)
+	case *ir.ArrayType, *ir.TupleType:
+		return []string{"array"}
+	case *ir.ClassType, *ir.ObjectType:
+		return []string{"object"}
+	case *ir.NullableType:
+		// There are no nullable casts.
+		return castKeywords(typ.X)
+	}
+	return nil
+}
+
+func (p *printer) castKeyword(typ ir.Type) string {
+	keywords := castKeywords(typ)
+	if len(keywords) == 0 {
+		panic(fmt.Sprintf("can't print a cast to %v type", typ))
+	}
+	if p.config.Rand != nil {
+		return randutil.Elem(p.config.Rand, keywords)
+	}
+	return keywords[0]
+}
@@ -0,0 +1,224 @@
+package irprint
+
+import (
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// classBody is a set of class-like declaration members.
+// They're printed in the field order, member groups are
+// separated by empty lines.
+type classBody struct {
+	uses    []*ir.TraitUse
+	cases   []*ir.EnumCase
+	consts  []*ir.ClassConst
+	props   []*ir.ClassProp
+	methods []*ir.ClassMethod
+
+	// signaturesOnly makes all methods printed without bodies.
+	signaturesOnly bool
+}
+
+func (p *printer) printClassDecl(decl *ir.RootClassDecl) {
+	p.printDocComment(decl.Tags)
+	p.printAttributes(decl.Attributes)
+	if decl.Abstract {
+		p.w.WriteString(p.keyword("abstract "))
+	}
+	p.w.WriteString(p.keyword("class ") + decl.Name)
+	if decl.Extends != "" {
+		p.w.WriteString(p.keyword(" extends ") + decl.Extends)
+	}
+	if len(decl.Implements) != 0 {
+		p.w.WriteString(p.keyword(" implements ") + strings.Join(decl.Implements, ", "))
+	}
+	p.printClassBody(classBody{
+		uses:    decl.Uses,
+		consts:  decl.Consts,
+		props:   decl.Props,
+		methods: decl.Methods,
+	})
+}
+
+func (p *printer) printInterfaceDecl(decl *ir.RootInterfaceDecl) {
+	p.printDocComment(decl.Tags)
+	p.printAttributes(decl.Attributes)
+	p.w.WriteString(p.keyword("interface ") + decl.Name)
+	if len(decl.Extends) != 0 {
+		p.w.WriteString(p.keyword(" extends ") + strings.Join(decl.Extends, ", "))
+	}
+	p.printClassBody(classBody{
+		consts:         decl.Consts,
+		methods:        decl.Methods,
+		signaturesOnly: true,
+	})
+}
+
+func (p *printer) printTraitDecl(decl *ir.RootTraitDecl) {
+	p.printDocComment(decl.Tags)
+	p.printAttributes(decl.Attributes)
+	p.w.WriteString(p.keyword("trait ") + decl.Name)
+	p.printClassBody(classBody{
+		uses:    decl.Uses,
+		props:   decl.Props,
+		methods: decl.Methods,
+	})
+}
+
+func (p *printer) printEnumDecl(decl *ir.RootEnumDecl) {
+	p.printDocComment(decl.Tags)
+	p.printAttributes(decl.Attributes)
+	p.w.WriteString(p.keyword("enum ") + decl.Name)
+	if decl.BackingType != nil {
+		p.w.WriteString(": " + decl.BackingType.String())
+	}
+	if len(decl.Implements) != 0 {
+		p.w.WriteString(p.keyword(" implements ") + strings.Join(decl.Implements, ", "))
+	}
+	p.printClassBody(classBody{
+		cases:   decl.Cases,
+		consts:  decl.Consts,
+		methods: decl.Methods,
+	})
+}
+
+func (p *printer) printClassBody(body classBody) {
+	p.braceSeparator()
+	p.w.WriteString("{\n")
+	p.depth++
+
+	separate := false
+	separator := func() {
+		if separate {
+			p.w.WriteByte('\n')
+		}
+		separate = true
+	}
+
+	if len(body.uses) != 0 {
+		separator()
+		for _, use := range body.uses {
+			p.printTraitUse(use)
+		}
+	}
+
+	if len(body.cases) != 0 {
+		separator()
+		for _, c := range body.cases {
+			p.indent()
+			p.w.WriteString(p.keyword("case ") + c.Name)
+			if c.Value != nil {
+				p.w.WriteString(" = ")
+				p.printNode(c.Value)
+			}
+			p.w.WriteString(";\n")
+		}
+	}
+
+	if len(body.consts) != 0 {
+		separator()
+		for _, c := range body.consts {
+			p.indent()
+			p.printModifiers(c.Visibility, false)
+			p.w.WriteString(p.keyword("const ") + c.Name + " = ")
+			p.printNode(c.Value)
+			p.w.WriteString(";\n")
+		}
+	}
+
+	if len(body.props) != 0 {
+		separator()
+		for _, prop := range body.props {
+			p.printProp(prop)
+		}
+	}
+
+	for _, m := range body.methods {
+		separator()
+		p.printMethod(m, body.signaturesOnly)
+	}
+
+	p.depth--
+	p.w.WriteString("}\n")
+}
+
+func (p *printer) printTraitUse(use *ir.TraitUse) {
+	p.indent()
+	p.w.WriteString(p.keyword("use ") + strings.Join(use.Traits, ", "))
+	if len(use.Rules) == 0 {
+		p.w.WriteString(";\n")
+		return
+	}
+	p.braceSeparator()
+	p.w.WriteString("{\n")
+	p.depth++
+	for _, rule := range use.Rules {
+		p.indent()
+		if rule.Trait != "" {
+			p.w.WriteString(rule.Trait + "::")
+		}
+		p.w.WriteString(rule.Method)
+		if len(rule.Insteadof) != 0 {
+			p.w.WriteString(p.keyword(" insteadof ") + strings.Join(rule.Insteadof, ", "))
+		} else {
+			p.w.WriteString(p.keyword(" as"))
+			if rule.Visibility != ir.VisibilityNone {
+				p.w.WriteString(" " + p.keyword(rule.Visibility.String()))
+			}
+			if rule.Alias != "" {
+				p.w.WriteString(" " + rule.Alias)
+			}
+		}
+		p.w.WriteString(";\n")
+	}
+	p.depth--
+	p.indent()
+	p.w.WriteString("}\n")
+}
+
+func (p *printer) printProp(prop *ir.ClassProp) {
+	p.printDocComment(prop.Tags)
+	p.indent()
+	if prop.Visibility == ir.VisibilityNone && !prop.Static {
+		// A property declaration requires at least one modifier.
+		p.w.WriteString(p.keyword("public "))
+	}
+	p.printModifiers(prop.Visibility, prop.Static)
+	if prop.Type != nil {
+		if hint := paramTypeHint(prop.Type); hint != "" {
+			p.w.WriteString(hint + " ")
+		}
+	}
+	p.w.WriteString("$" + prop.Name)
+	if prop.Default != nil {
+		p.w.WriteString(" = ")
+		p.printNode(prop.Default)
+	}
+	p.w.WriteString(";\n")
+}
+
+func (p *printer) printMethod(m *ir.ClassMethod, signatureOnly bool) {
+	p.printDocComment(m.Func.Tags)
+	p.printAttributes(m.Func.Attributes)
+	p.indent()
+	if m.Abstract {
+		p.w.WriteString(p.keyword("abstract "))
+	}
+	p.printModifiers(m.Visibility, m.Static)
+	if m.Abstract || signatureOnly {
+		p.printFuncSignature(m.Func)
+		p.w.WriteString(";\n")
+	} else {
+		p.printFunc(m.Func)
+	}
+}
+
+func (p *printer) printModifiers(visibility ir.Visibility, static bool) {
+	if visibility != ir.VisibilityNone {
+		p.w.WriteString(p.keyword(visibility.String() + " "))
+	}
+	if static {
+		p.w.WriteString(p.keyword("static "))
+	}
+}
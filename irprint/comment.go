@@ -0,0 +1,100 @@
+package irprint
+
+import (
+	"strings"
+
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// commentTexts are the comment bodies that are known
+// to confuse sloppy PHP lexers.
+var commentTexts = []string{
+	"comment",
+	"TODO: fix me",
+	"*/",
+	"/*",
+	"//",
+	"# not an attribute",
+	"#[Attr]",
+	"<?php",
+	"'unterminated",
+	`"unterminated`,
+	"{$x}",
+	`\`,
+	"<<<EOT",
+	"?",
+	"",
+}
+
+// dangerousCommentTexts close the PHP tag inside a line comment
+// and change the program output.
+var dangerousCommentTexts = []string{
+	"?>",
+	"?> <?php",
+}
+
+func (p *printer) useComment() bool {
+	return p.config.Rand != nil &&
+		p.config.CommentProbability != 0 &&
+		randutil.Chance(p.config.Rand, p.config.CommentProbability)
+}
+
+func (p *printer) commentText() string {
+	if p.config.DangerousComments && randutil.Bool(p.config.Rand) {
+		return randutil.Elem(p.config.Rand, dangerousCommentTexts)
+	}
+	return randutil.Elem(p.config.Rand, commentTexts)
+}
+
+// printStmtComment maybe prints a comment line before a statement.
+func (p *printer) printStmtComment() {
+	if !p.useComment() {
+		return
+	}
+	p.indent()
+	switch p.config.Rand.Intn(4) {
+	case 0:
+		p.w.WriteString("// " + p.commentText())
+	case 1:
+		// The space is required: #[ starts an attribute.
+		p.w.WriteString("# " + p.commentText())
+	case 2:
+		p.w.WriteString("/* " + blockCommentText(p.commentText()) + " */")
+	case 3:
+		p.w.WriteString("/*\n")
+		for i := randutil.IntRange(p.config.Rand, 1, 3); i > 0; i-- {
+			p.indent()
+			p.w.WriteString(" * " + blockCommentText(p.commentText()) + "\n")
+		}
+		p.indent()
+		p.w.WriteString(" */")
+	}
+	p.w.WriteByte('\n')
+}
+
+// printExprComment maybe prints a comment between expression tokens.
+// Line comments are followed by a continuation line.
+func (p *printer) printExprComment() {
+	if !p.useComment() {
+		return
+	}
+	if p.singleLine {
+		p.w.WriteString("/* " + blockCommentText(randutil.Elem(p.config.Rand, commentTexts)) + " */ ")
+		return
+	}
+	switch p.config.Rand.Intn(3) {
+	case 0:
+		p.w.WriteString("// " + p.commentText())
+		p.newlineContinuation()
+	case 1:
+		p.w.WriteString("# " + p.commentText())
+		p.newlineContinuation()
+	case 2:
+		p.w.WriteString("/* " + blockCommentText(p.commentText()) + " */ ")
+	}
+}
+
+// blockCommentText makes s safe to be put inside a /* */ comment.
+func blockCommentText(s string) string {
+	return strings.ReplaceAll(s, "*/", "* /")
+}
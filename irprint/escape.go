@@ -0,0 +1,66 @@
+package irprint
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// namedEscapes are the double-quoted string escapes of control characters.
+// Note that PHP has no \a and \b escapes, they're printed as is.
+var namedEscapes = [32]string{
+	'\t': `\t`,
+	'\n': `\n`,
+	'\v': `\v`,
+	'\f': `\f`,
+	'\r': `\r`,
+}
+
+// writeByteEscape writes a single byte of a double-quoted string,
+// escaping it if it's a non-printable one.
+func (p *printer) writeByteEscape(buf *bytes.Buffer, ch byte) {
+	control := ch < 32
+	if !control && ch != 0x7f && ch < utf8.RuneSelf {
+		buf.WriteByte(ch)
+		return
+	}
+
+	switch {
+	case p.useHexEscape():
+		const digits = "0123456789abcdef"
+		buf.WriteString(`\x`)
+		buf.WriteByte(digits[ch/16])
+		buf.WriteByte(digits[ch%16])
+	case !control:
+		buf.WriteByte(ch)
+	case namedEscapes[ch] != "":
+		buf.WriteString(namedEscapes[ch])
+	default:
+		// Always using 3 digits, so the next digit is not consumed.
+		buf.WriteByte('\\')
+		buf.WriteByte('0' + ch/64)
+		buf.WriteByte('0' + ch/8%8)
+		buf.WriteByte('0' + ch%8)
+	}
+}
+
+func (p *printer) useHexEscape() bool {
+	if !p.config.HexEscapes {
+		return false
+	}
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return true
+}
+
+func (p *printer) useUnicodeEscape() bool {
+	if !p.config.UnicodeEscapes {
+		return false
+	}
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return true
+}
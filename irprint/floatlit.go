@@ -0,0 +1,25 @@
+package irprint
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// printFloatLit prints a finite v using the shortest representation
+// that is parsed back to the same value.
+func (p *printer) printFloatLit(v float64) {
+	format := byte('g')
+	if p.config.Rand != nil {
+		format = randutil.Elem(p.config.Rand, []byte{'f', 'e'})
+	} else if p.config.ExponentFloats {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(v, format, -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		// Make sure that the literal is not parsed as int.
+		s += ".0"
+	}
+	p.w.WriteString(s)
+}
@@ -0,0 +1,92 @@
+package irprint
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+var heredocLabels = []string{"EOT", "EOS", "TXT", "STR", "END"}
+
+func (p *printer) useHeredoc() bool {
+	return p.config.Rand != nil &&
+		p.config.HeredocProbability != 0 &&
+		randutil.Chance(p.config.Rand, p.config.HeredocProbability)
+}
+
+// canNowdoc reports whether s can be printed as a nowdoc body.
+// Nowdoc has no escapes, so only newlines are permitted
+// among the control characters.
+func canNowdoc(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 32 && s[i] != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// printHeredoc prints the string parts (see OpInterpolatedString)
+// as a heredoc literal or, if nowdoc is true, as a nowdoc literal.
+// Nowdoc can't contain interpolated parts.
+func (p *printer) printHeredoc(parts []*ir.Node, nowdoc bool) {
+	var body bytes.Buffer
+	for i, part := range parts {
+		switch {
+		case part.Op != ir.OpStringLit:
+			body.WriteString(p.sprintInterpolation(parts, i))
+		case nowdoc:
+			body.WriteString(part.Value.(string))
+		default:
+			body.Write(p.escapeString(part.Value.(string), true))
+		}
+	}
+
+	label := p.heredocLabel(body.Bytes())
+	p.w.WriteString("<<<")
+	if nowdoc {
+		p.w.WriteString("'" + label + "'")
+	} else {
+		p.w.WriteString(label)
+	}
+	p.w.WriteByte('\n')
+
+	// Flexible heredoc strips the closing marker indentation
+	// from every body line, so the body is indented along with it.
+	// The body newlines are a part of the value, so they're
+	// not replaced by the Config.Newline.
+	indent := 0
+	if p.config.FlexibleHeredoc {
+		indent = p.depth + 1
+	}
+	for _, line := range bytes.Split(body.Bytes(), []byte("\n")) {
+		if len(line) != 0 {
+			p.writeIndent(indent)
+		}
+		p.w.Write(line)
+		p.w.WriteRaw("\n")
+	}
+	p.writeIndent(indent)
+	p.w.WriteString(label)
+	if !p.config.FlexibleHeredoc {
+		// The closing marker should be the only thing on its line.
+		p.w.WriteByte('\n')
+		p.indent()
+	}
+}
+
+// heredocLabel returns a terminator label that can't be confused
+// with any part of the body.
+func (p *printer) heredocLabel(body []byte) string {
+	label := heredocLabels[0]
+	if p.config.Rand != nil {
+		label = randutil.Elem(p.config.Rand, heredocLabels)
+	}
+	candidate := label
+	for i := 1; bytes.Contains(body, []byte(candidate)); i++ {
+		candidate = label + strconv.Itoa(i)
+	}
+	return candidate
+}
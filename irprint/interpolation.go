@@ -0,0 +1,127 @@
+package irprint
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// sprintInterpolation returns the printed form of the parts[i]
+// interpolated string part, it should not be a string literal.
+//
+// The braced form, like {$arr['key']}, can contain any variable expression.
+// The simple braceless form, like $arr[key], is used only if it's
+// permitted by the part and its neighbour parts.
+func (p *printer) sprintInterpolation(parts []*ir.Node, i int) string {
+	var prev, next *ir.Node
+	if i > 0 {
+		prev = parts[i-1]
+	}
+	if i+1 < len(parts) {
+		next = parts[i+1]
+	}
+	part := parts[i]
+	if canSimpleInterpolate(prev, part, next) && p.useSimpleInterpolation() {
+		return sprintSimpleInterpolation(part)
+	}
+
+	// The braced expression is printed in the regular code syntax,
+	// the default configuration is used to keep it as simple as possible.
+	var buf bytes.Buffer
+	sub := &printer{
+		config:     &Config{},
+		w:          newColumnWriter(&buf),
+		singleLine: true,
+	}
+	sub.printNode(part)
+	sub.w.Flush()
+	return "{" + buf.String() + "}"
+}
+
+func (p *printer) useSimpleInterpolation() bool {
+	return p.config.Rand != nil && randutil.Bool(p.config.Rand)
+}
+
+// canSimpleInterpolate reports whether part can be printed using
+// the simple syntax. It only supports a single array dimension
+// or a single property fetch, array keys are printed unquoted.
+//
+// Since a property name is not terminated, the next string part
+// can't start with a character that would continue the name.
+// The previous string part can't end with "{", PHP would parse
+// it as the start of the braced form.
+func canSimpleInterpolate(prev, part, next *ir.Node) bool {
+	if prev != nil && prev.Op == ir.OpStringLit && strings.HasSuffix(prev.Value.(string), "{") {
+		return false
+	}
+	switch part.Op {
+	case ir.OpIndex:
+		if curly, _ := part.Value.(bool); curly || part.Args[0].Op != ir.OpVar {
+			return false
+		}
+		key := part.Args[1]
+		switch key.Op {
+		case ir.OpVar:
+			return true
+		case ir.OpIntLit:
+			// Negative numbers are only permitted since PHP 7.1.
+			return key.Value.(int64) >= 0
+		case ir.OpStringLit:
+			return isSimpleKey(key.Value.(string))
+		default:
+			return false
+		}
+	case ir.OpProp:
+		if part.Args[0].Op != ir.OpVar || part.Value.(string) == "" {
+			return false
+		}
+		if next == nil || next.Op != ir.OpStringLit || next.Value.(string) == "" {
+			return true
+		}
+		return !isLabelChar(next.Value.(string)[0])
+	default:
+		return false
+	}
+}
+
+func sprintSimpleInterpolation(part *ir.Node) string {
+	v := "$" + part.Args[0].Value.(string)
+	if part.Op == ir.OpProp {
+		return v + "->" + part.Value.(string)
+	}
+	key := part.Args[1]
+	switch key.Op {
+	case ir.OpVar:
+		return v + "[$" + key.Value.(string) + "]"
+	case ir.OpIntLit:
+		return v + "[" + strconv.FormatInt(key.Value.(int64), 10) + "]"
+	default:
+		return v + "[" + key.Value.(string) + "]"
+	}
+}
+
+// isSimpleKey reports whether s can be used as an unquoted array key.
+// Numeric strings are not permitted as they're converted to ints.
+func isSimpleKey(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isLabelChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLabelChar reports whether ch can be a part of PHP identifier.
+func isLabelChar(ch byte) bool {
+	return ch == '_' ||
+		(ch >= 'a' && ch <= 'z') ||
+		(ch >= 'A' && ch <= 'Z') ||
+		(ch >= '0' && ch <= '9') ||
+		ch >= 0x80
+}
@@ -0,0 +1,93 @@
+package irprint
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+const (
+	// php71 introduced [] destructuring and keys in list().
+	php71 = 70100
+
+	// php73 introduced trailing commas in call arguments.
+	php73 = 70300
+
+	// php74 introduced numeric literal separators.
+	php74 = 70400
+
+	// php80 introduced trailing commas in parameter lists.
+	php80 = 80000
+
+	// php81 introduced explicit 0o octal prefix.
+	php81 = 80100
+)
+
+func (p *printer) phpVersionAtLeast(version int) bool {
+	return p.config.MinPHPVersion >= version
+}
+
+// printIntLit prints v as a decimal literal if Rand is nil.
+// Otherwise, it selects a random base and digit separators;
+// the sign is always printed outside of the literal.
+func (p *printer) printIntLit(v int64) {
+	if v == math.MinInt64 {
+		// PHP parses -9223372036854775808 as a negated float literal,
+		// since the positive part overflows int.
+		p.w.WriteString("PHP_INT_MIN")
+		return
+	}
+	if p.config.Rand == nil {
+		fmt.Fprintf(p.w, "%#v", v)
+		return
+	}
+	if v < 0 {
+		p.w.WriteByte('-')
+		v = -v
+	}
+
+	var prefix, digits string
+	switch p.config.Rand.Intn(4) {
+	case 0:
+		digits = strconv.FormatInt(v, 10)
+	case 1:
+		prefix = randutil.Elem(p.config.Rand, []string{"0x", "0X"})
+		digits = strconv.FormatInt(v, 16)
+		if randutil.Bool(p.config.Rand) {
+			digits = strings.ToUpper(digits)
+		}
+	case 2:
+		prefix = "0"
+		if p.phpVersionAtLeast(php81) && randutil.Bool(p.config.Rand) {
+			prefix = randutil.Elem(p.config.Rand, []string{"0o", "0O"})
+		}
+		digits = strconv.FormatInt(v, 8)
+	case 3:
+		prefix = randutil.Elem(p.config.Rand, []string{"0b", "0B"})
+		digits = strconv.FormatInt(v, 2)
+	}
+
+	if p.phpVersionAtLeast(php74) && randutil.Bool(p.config.Rand) {
+		digits = p.insertDigitSeparators(digits)
+	}
+	p.w.WriteString(prefix + digits)
+}
+
+// insertDigitSeparators splits digits into the groups of a random size, like 1_000_000.
+func (p *printer) insertDigitSeparators(digits string) string {
+	groupSize := randutil.IntRange(p.config.Rand, 1, 4)
+	if len(digits) <= groupSize {
+		return digits
+	}
+	var b strings.Builder
+	for i := 0; i < len(digits); i++ {
+		if i != 0 && (len(digits)-i)%groupSize == 0 {
+			b.WriteByte('_')
+		}
+		b.WriteByte(digits[i])
+	}
+	return b.String()
+}
@@ -1,16 +1,18 @@
 package irprint
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/quasilyte/phpsmith/ir"
 	"github.com/quasilyte/phpsmith/phpdoc"
+	"github.com/quasilyte/phpsmith/randutil"
 )
 
 // TODO:
@@ -21,53 +23,209 @@ type Config struct {
 	// Rand is used to add randomized formatting to the output.
 	// If nil, no randomization will be used and the output will look like pretty-printed.
 	Rand *rand.Rand
+
+	// Strict makes the Fprint functions return a *NodeError for the nodes
+	// that can't be printed instead of panicking with it.
+	Strict bool
+
+	// MinPHPVersion is the oldest PHP version the output should be valid for,
+	// in the PHP_VERSION_ID format (like 80100 for PHP 8.1).
+	// Randomized formatting only uses the syntax supported by this version.
+	MinPHPVersion int
+
+	// ExponentFloats makes float literals print in the exponent notation, like 1.5e-7.
+	// Otherwise, the shortest of the decimal and exponent forms is used.
+	// If Rand is set, the decimal or exponent notation is selected randomly for every literal.
+	ExponentFloats bool
+
+	// DoubleQuotes forces all string literals to be printed with double quotes.
+	// Otherwise, strings that don't need double-quote-only escapes
+	// can be printed with single quotes: always if Rand is nil,
+	// randomly if it's set.
+	DoubleQuotes bool
+
+	// HexEscapes makes non-printable bytes in double-quoted strings print
+	// as \xNN escapes: control characters, DEL and non-ASCII bytes.
+	// If Rand is set, the escape is used randomly for every such byte.
+	HexEscapes bool
+
+	// UnicodeEscapes makes non-ASCII characters in double-quoted strings
+	// print as \u{XXXX} escapes. If Rand is set, the escape is used
+	// randomly for every character.
+	UnicodeEscapes bool
+
+	// HeredocProbability is a chance of printing a string literal
+	// using the heredoc or nowdoc syntax. Only used if Rand is set.
+	HeredocProbability float64
+
+	// FlexibleHeredoc enables the PHP 7.3+ flexible heredoc syntax:
+	// the closing marker is indented and can be followed by other tokens.
+	// Without it, the closing marker is printed at the start of the line
+	// and the rest of the expression continues on the next line.
+	FlexibleHeredoc bool
+
+	// ShortArraySyntax makes array literals print as [...] instead of array(...)
+	// and destructuring targets print as [...] instead of list(...).
+	// If Rand is set, the syntax is selected randomly for every literal.
+	ShortArraySyntax bool
+
+	// TrailingCommas makes non-empty call argument lists (PHP 7.3+),
+	// parameter lists and closure use lists (PHP 8.0+) end with a comma.
+	// If Rand is set, the comma is added randomly for every list
+	// that is supported by MinPHPVersion, and the array literals
+	// trailing comma is omitted randomly. Otherwise, array literals
+	// are always printed with the trailing comma.
+	TrailingCommas bool
+
+	// ArrowFunctions makes arrow-eligible closures print as fn() => expr.
+	// If Rand is set, the syntax is selected randomly for every closure.
+	ArrowFunctions bool
+
+	// DefineConsts makes constant declarations print as define() calls.
+	// If Rand is set, the syntax is selected randomly for every declaration.
+	DefineConsts bool
+
+	// GroupedAttributes makes declaration attributes print as a single #[A, B]
+	// group instead of an #[A] line per attribute.
+	// If Rand is set, the syntax is selected randomly for every declaration.
+	GroupedAttributes bool
+
+	// AltSyntax enables the alternative control structures syntax,
+	// like "while ($x): ... endwhile;", for if, while, for and foreach statements.
+	// If Rand is set, the syntax is selected randomly for every statement.
+	AltSyntax bool
+
+	// RandomKeywordCase makes keywords, casts and magic constants
+	// print in a random letter case, like ReTuRn or (INT).
+	// Only used if Rand is set.
+	RandomKeywordCase bool
+
+	// Indent is a string used for a single indentation level,
+	// like "\t" or "    ". Two spaces are used if it's empty.
+	Indent string
+
+	// Newline is a line terminator, like "\n" or "\r\n".
+	// A "\n" is used if it's empty. Heredoc bodies always use "\n",
+	// so it doesn't affect the multi-line heredoc values.
+	Newline string
+
+	// WhitespaceProbability is a chance of printing trailing spaces and tabs
+	// after a statement and a chance of the following blank line.
+	// Only used if Rand is set.
+	WhitespaceProbability float64
+
+	// NextLineBraces enables the Allman brace style:
+	// opening braces of functions, classes and statements are printed on their own line.
+	NextLineBraces bool
+
+	// FlatCaseLabels makes switch case labels print
+	// at the same indentation level as the switch itself.
+	FlatCaseLabels bool
+
+	// MaxLineLength makes long call argument lists and binary expressions
+	// wrap to the continuation lines once they exceed this many columns.
+	// Zero means no limit.
+	MaxLineLength int
+
+	// CommentProbability is a chance of injecting a comment
+	// before a statement or inside an expression. Only used if Rand is set.
+	CommentProbability float64
+
+	// DangerousComments allows injected line comments to contain ?>,
+	// which closes the PHP tag and changes the program output.
+	DangerousComments bool
+
+	// ParamTypeHints enables function parameter type hints if Rand is nil.
+	ParamTypeHints bool
+
+	// ParamTypeHintProbability is a chance of printing a parameter type hint
+	// when Rand is set.
+	ParamTypeHintProbability float64
+
+	// ReturnTypeHints enables function return type hints if Rand is nil.
+	ReturnTypeHints bool
+
+	// ReturnTypeHintProbability is a chance of printing a function
+	// return type hint when Rand is set.
+	ReturnTypeHintProbability float64
+}
+
+func SprintFile(file *ir.File) string {
+	var buf strings.Builder
+	FprintFile(&buf, file, &Config{})
+	return buf.String()
 }
 
-var modifyOpLit = map[ir.Op]string{
-	ir.OpAdd:           "+",
-	ir.OpConcat:        ".",
-	ir.OpSub:           "-",
-	ir.OpDiv:           "/",
-	ir.OpMul:           "*",
-	ir.OpExp:           "**",
-	ir.OpMod:           "%",
-	ir.OpBitAnd:        "&",
-	ir.OpBitOr:         "|",
-	ir.OpBitXor:        "^",
-	ir.OpBitNot:        "~",
-	ir.OpBitShiftLeft:  "<<",
-	ir.OpBitShiftRight: ">>",
-	ir.OpNullCoalesce:  "??",
-}
-
-func FprintRootNode(w io.Writer, n ir.RootNode, config *Config) {
+// FprintFile prints a complete PHP file, starting with the open tag.
+// The declare and namespace directives come first, then go the requires
+// followed by the other file nodes in their original order.
+// The output ends with exactly one newline.
+// It returns the error that occurred while writing to w.
+func FprintFile(w io.Writer, file *ir.File, config *Config) (err error) {
+	defer recoverNodeError(config, &err)
+
+	var buf bytes.Buffer
 	p := &printer{
 		config: config,
-		w:      bufio.NewWriter(w),
+		w:      newOutputWriter(&buf, config),
 	}
-	p.printRootNode(n)
+	p.printFile(file)
 	p.w.Flush()
+	newline := []byte(p.newline())
+	out := buf.Bytes()
+	for bytes.HasSuffix(out, newline) {
+		out = out[:len(out)-len(newline)]
+	}
+	_, err = w.Write(append(out, newline...))
+	return err
+}
+
+// FprintRootNode prints n to w.
+// It returns the first error that occurred while writing to w.
+func FprintRootNode(w io.Writer, n ir.RootNode, config *Config) (err error) {
+	defer recoverNodeError(config, &err)
+
+	p := &printer{
+		config: config,
+		w:      newOutputWriter(w, config),
+	}
+	p.printRootNode(n)
+	return p.w.Flush()
 }
 
 func SprintNode(n *ir.Node) string {
-	var buf strings.Builder
-	FprintNode(&buf, n, &Config{})
-	return buf.String()
+	s := sprinterPool.Get().(*sprinter)
+	s.buf.Reset()
+	s.printer.Fprint(&s.buf, n)
+	result := s.buf.String()
+	sprinterPool.Put(s)
+	return result
 }
 
-func FprintNode(w io.Writer, n *ir.Node, config *Config) {
+// FprintNode prints n to w.
+// It returns the first error that occurred while writing to w.
+func FprintNode(w io.Writer, n *ir.Node, config *Config) (err error) {
+	defer recoverNodeError(config, &err)
+
 	p := &printer{
 		config: config,
-		w:      bufio.NewWriter(w),
+		w:      newOutputWriter(w, config),
 	}
 	p.printNode(n)
-	p.w.Flush()
+	return p.w.Flush()
 }
 
 type printer struct {
 	config *Config
-	w      *bufio.Writer
-	depth  int
+	w      *columnWriter
+
+	// depth is the current indentation level.
+	depth int
+
+	// singleLine forbids line breaks and line comments.
+	// It's set while printing attributes: PHP 7 parses
+	// a #[...] line as a comment.
+	singleLine bool
 }
 
 type printFlags int
@@ -86,109 +244,400 @@ func (flags printFlags) NeedNewline() bool {
 }
 
 func (p *printer) indent() {
-	for i := 0; i < p.depth; i++ {
+	p.writeIndent(p.depth)
+}
+
+func (p *printer) writeIndent(depth int) {
+	indent := p.indentString()
+	for i := 0; i < depth; i++ {
+		p.w.WriteString(indent)
+	}
+}
+
+func (p *printer) newline() string {
+	if p.config.Newline == "" {
+		return "\n"
+	}
+	return p.config.Newline
+}
+
+func (p *printer) indentString() string {
+	if p.config.Indent == "" {
+		return "  "
+	}
+	return p.config.Indent
+}
+
+// braceSeparator separates a brace from the adjacent statement part,
+// like "if ($x)" and "{", or "}" and "else".
+func (p *printer) braceSeparator() {
+	if p.config.NextLineBraces {
+		p.w.WriteByte('\n')
+		p.indent()
+	} else {
 		p.w.WriteByte(' ')
 	}
 }
 
+// printBody prints a statement body that follows its header, like "while ($x)".
+func (p *printer) printBody(body *ir.Node) printFlags {
+	if body.Op == ir.OpBlock {
+		p.braceSeparator()
+	} else {
+		p.w.WriteByte(' ')
+	}
+	return p.printNode(body)
+}
+
+func (p *printer) printFile(file *ir.File) {
+	p.w.WriteString("<?php\n")
+	if file.Header != "" {
+		for _, line := range strings.Split(file.Header, "\n") {
+			// The ?> closes the PHP tag even inside a line comment.
+			p.w.WriteString("// " + strings.ReplaceAll(line, "?>", "? >") + "\n")
+		}
+	}
+	if file.StrictTypes {
+		p.printRootNode(&ir.RootDeclare{Name: "strict_types", Value: ir.NewIntLit(1)})
+	}
+	if file.Namespace != "" {
+		p.printRootNode(&ir.RootNamespace{Name: file.Namespace})
+	}
+	for _, n := range file.Nodes {
+		if n, ok := n.(*ir.RootRequire); ok {
+			p.printRootNode(n)
+		}
+	}
+	for _, n := range file.Nodes {
+		if _, ok := n.(*ir.RootRequire); !ok {
+			p.printRootNode(n)
+		}
+	}
+}
+
 func (p *printer) printRootNode(n ir.RootNode) {
 	switch n := n.(type) {
 	case *ir.RootFuncDecl:
 		p.printFuncDecl(n)
+	case *ir.RootClassDecl:
+		p.printClassDecl(n)
+	case *ir.RootInterfaceDecl:
+		p.printInterfaceDecl(n)
+	case *ir.RootTraitDecl:
+		p.printTraitDecl(n)
+	case *ir.RootEnumDecl:
+		p.printEnumDecl(n)
+	case *ir.RootDeclare:
+		p.w.WriteString(p.keyword("declare(") + n.Name + "=")
+		p.printNode(n.Value)
+		p.w.WriteString(");\n")
+	case *ir.RootNamespace:
+		p.w.WriteString(p.keyword("namespace ") + n.Name + ";\n")
 	case *ir.RootRequire:
-		p.w.WriteString("require_once __DIR__ . '/" + n.Path + "';\n")
+		p.w.WriteString(p.keyword("require_once __DIR__") + " . '/" + n.Path + "';\n")
+	case *ir.RootConstDecl:
+		if p.useDefineConsts() {
+			// Note that define() always creates a global constant,
+			// but unqualified constant references fall back to it.
+			p.w.WriteString("define('" + n.Name + "', ")
+			p.printNode(n.Value)
+			p.w.WriteString(");\n")
+		} else {
+			p.w.WriteString(p.keyword("const ") + n.Name + " = ")
+			p.printNode(n.Value)
+			p.w.WriteString(";\n")
+		}
 	case *ir.RootStmt:
 		flags := p.printNode(n.X)
 		if flags.NeedSemicolon() {
 			p.w.WriteByte(';')
 		}
 		if flags.NeedNewline() {
-			p.w.WriteString("\n")
+			p.printLineEnd()
 		}
+	default:
+		panic(fmt.Sprintf("irprint: unexpected %T root node", n))
 	}
 }
 
 func (p *printer) printFuncDecl(decl *ir.RootFuncDecl) {
-	if len(decl.Tags) != 0 {
-		p.w.WriteString("/**\n")
-		for _, tag := range decl.Tags {
-			fmt.Fprintf(p.w, " * @%s %s\n", tag.Name(), tag.Value())
+	p.printDocComment(decl.Tags)
+	p.printAttributes(decl.Attributes)
+	p.printFunc(decl)
+	p.w.WriteByte('\n')
+}
+
+func (p *printer) printFunc(decl *ir.RootFuncDecl) {
+	p.printFuncSignature(decl)
+	p.braceSeparator()
+	p.printNode(decl.Body)
+}
+
+func (p *printer) printFuncSignature(decl *ir.RootFuncDecl) {
+	p.w.WriteString(p.keyword("function ") + decl.Type.Name)
+	p.printParams(decl.Type.Params)
+	hint := returnTypeHint(decl.Type.Result)
+	if decl.IsGenerator() {
+		// The declared result is the generator return value,
+		// the function itself always returns a Generator object.
+		hint = `\Generator`
+	}
+	if hint != "" && p.useReturnTypeHint() {
+		p.w.WriteString(": " + hint)
+	}
+}
+
+func (p *printer) printDocComment(tags []phpdoc.Tag) {
+	if len(tags) == 0 {
+		return
+	}
+	p.indent()
+	p.w.WriteString("/**\n")
+	for _, tag := range tags {
+		p.indent()
+		fmt.Fprintf(p.w, " * @%s %s\n", tag.Name(), tag.Value())
+	}
+	p.indent()
+	p.w.WriteString(" */\n")
+}
+
+func (p *printer) printAttributes(attrs []ir.Attribute) {
+	if len(attrs) == 0 {
+		return
+	}
+	if p.useGroupedAttributes() {
+		p.indent()
+		p.w.WriteString("#[")
+		for i, attr := range attrs {
+			if i != 0 {
+				p.w.WriteString(", ")
+			}
+			p.printAttribute(attr)
 		}
-		p.w.WriteString(" */\n")
+		p.w.WriteString("]\n")
+		return
+	}
+	for _, attr := range attrs {
+		p.indent()
+		p.w.WriteString("#[")
+		p.printAttribute(attr)
+		p.w.WriteString("]\n")
+	}
+}
+
+func (p *printer) printAttribute(attr ir.Attribute) {
+	p.w.WriteString(attr.Name)
+	if len(attr.Args) != 0 {
+		p.singleLine = true
+		p.w.WriteByte('(')
+		p.printNodes(attr.Args, ", ")
+		p.w.WriteByte(')')
+		p.singleLine = false
 	}
+}
 
-	p.w.WriteString("function " + decl.Type.Name)
+func (p *printer) printParams(params []ir.TypeField) {
 	p.w.WriteByte('(')
-	for i, param := range decl.Type.Params {
+	for i, param := range params {
 		if i != 0 {
 			p.w.WriteString(", ")
 		}
-		// TODO: print a type hint for some types, sometimes?
+		if hint := paramTypeHint(param.Type); hint != "" && p.useParamTypeHint() {
+			p.w.WriteString(hint + " ")
+		}
+		if param.ByRef {
+			p.w.WriteByte('&')
+		}
+		if param.Variadic {
+			p.w.WriteString("...")
+		}
 		p.w.WriteString("$" + param.Name)
+		if param.Default != nil {
+			p.w.WriteString(" = ")
+			p.printNode(param.Default)
+		}
 	}
-	p.w.WriteString(") ")
-	p.printNode(decl.Body)
-	p.w.WriteByte('\n')
+	if len(params) != 0 && p.useTrailingComma(php80) {
+		p.w.WriteByte(',')
+	}
+	p.w.WriteByte(')')
+}
+
+func (p *printer) printClosure(n *ir.Node) {
+	typ := n.Type.(*ir.FuncType)
+	info := n.Value.(*ir.ClosureInfo)
+	if info.ArrowFunc && p.useArrowFunction() {
+		p.printArrowFunction(n)
+		return
+	}
+
+	p.w.WriteString(p.keyword("function "))
+	p.printParams(typ.Params)
+	if uses := info.Uses; len(uses) != 0 {
+		p.w.WriteString(p.keyword(" use ("))
+		for i, u := range uses {
+			if i != 0 {
+				p.w.WriteString(", ")
+			}
+			if u.ByRef {
+				p.w.WriteByte('&')
+			}
+			p.w.WriteString("$" + u.Name)
+		}
+		if p.useTrailingComma(php80) {
+			p.w.WriteByte(',')
+		}
+		p.w.WriteByte(')')
+	}
+	if hint := closureResultHint(n); hint != "" {
+		p.w.WriteString(": " + hint)
+	}
+	p.braceSeparator()
+	p.printBlock(n.Args[0])
+}
+
+func (p *printer) printArrowFunction(n *ir.Node) {
+	typ := n.Type.(*ir.FuncType)
+	// Captured variables are bound implicitly.
+	p.w.WriteString(p.keyword("fn "))
+	p.printParams(typ.Params)
+	if hint := closureResultHint(n); hint != "" {
+		p.w.WriteString(": " + hint)
+	}
+	p.w.WriteString(" => ")
+	p.printNode(n.Args[0].Args[0].Args[0])
+}
+
+// closureResultHint returns the closure return type hint.
+// Generator closures are hinted as \Generator.
+func closureResultHint(n *ir.Node) string {
+	typ := n.Type.(*ir.FuncType)
+	switch {
+	case typ.Result == nil:
+		return ""
+	case ir.ContainsYield(n.Args[0]):
+		return `\Generator`
+	default:
+		return typeHint(typ.Result)
+	}
+}
+
+// printYield prints yield with its optional key and value.
+// The key is parenthesized unless it's an atom,
+// so the '=>' can't be attached to it.
+func (p *printer) printYield(n *ir.Node) {
+	p.w.WriteString(p.keyword("yield"))
+	switch len(n.Args) {
+	case 1:
+		p.w.WriteByte(' ')
+		p.printOperand(n.Args[0], needUnaryParens(n, n.Args[0], ""))
+	case 2:
+		p.w.WriteByte(' ')
+		p.printOperand(n.Args[0], nodeInfo(n.Args[0]).prec < ir.PrecAtom)
+		p.w.WriteString(" => ")
+		p.printOperand(n.Args[1], needUnaryParens(n, n.Args[1], ""))
+	}
+}
+
+func (p *printer) useArrowFunction() bool {
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return p.config.ArrowFunctions
 }
 
 func (p *printer) printSeq(nodes []*ir.Node) {
 	for _, stmt := range nodes {
+		p.printStmtComment()
 		p.indent()
 		flags := p.printNode(stmt)
 		if flags.NeedSemicolon() {
 			p.w.WriteByte(';')
 		}
 		if flags.NeedNewline() {
-			p.w.WriteString("\n")
+			p.printLineEnd()
 		}
 	}
 }
 
 //nolint:gocyclo
 func (p *printer) printNode(n *ir.Node) printFlags {
+	checkArgs(n)
+
 	switch n.Op {
+	case ir.OpBad:
+		p.w.WriteString(n.Value.(string))
+
 	case ir.OpBlock:
-		p.depth += 2
-		p.w.WriteString("{\n")
-		p.printSeq(n.Args)
-		p.depth -= 2
-		p.indent()
-		p.w.WriteString("}\n")
+		p.printBlock(n)
+		p.w.WriteByte('\n')
 		return 0
 
 	case ir.OpEcho:
-		p.w.WriteString("echo ")
+		p.w.WriteString(p.keyword("echo "))
+		p.printNodes(n.Args, ", ")
+
+	case ir.OpStaticVar:
+		p.w.WriteString(p.keyword("static "))
+		p.printNodes(n.Args, ", ")
+	case ir.OpGlobal:
+		p.w.WriteString(p.keyword("global "))
 		p.printNodes(n.Args, ", ")
+	case ir.OpUnset:
+		p.printSimpleCall(p.keyword("unset"), n.Args)
 
 	case ir.OpReturn:
-		p.w.WriteString("return ")
+		p.w.WriteString(p.keyword("return "))
 		p.printNode(n.Args[0])
 
+	case ir.OpTry:
+		p.w.WriteString(p.keyword("try"))
+		p.braceSeparator()
+		p.printBlock(n.Args[0])
+		for _, clause := range n.Args[1:] {
+			p.braceSeparator()
+			if clause.Op == ir.OpCatch {
+				p.w.WriteString(p.keyword("catch ("))
+				p.w.WriteString(strings.Join(clause.Value.([]string), "|"))
+				if clause.Args[0] != nil {
+					p.w.WriteByte(' ')
+					p.printNode(clause.Args[0])
+				}
+				p.w.WriteByte(')')
+				p.braceSeparator()
+				p.printBlock(clause.Args[1])
+			} else {
+				p.w.WriteString(p.keyword("finally"))
+				p.braceSeparator()
+				p.printBlock(clause.Args[0])
+			}
+		}
+		p.w.WriteByte('\n')
+		return 0
+
 	case ir.OpReturnVoid:
-		p.w.WriteString("return")
+		p.w.WriteString(p.keyword("return"))
 
 	case ir.OpContinue:
 		if n.Value.(int) == 0 {
-			p.w.WriteString("continue")
+			p.w.WriteString(p.keyword("continue"))
 		} else {
-			fmt.Fprintf(p.w, "continue %d", n.Value.(int))
+			fmt.Fprintf(p.w, "%s %d", p.keyword("continue"), n.Value.(int))
 		}
 	case ir.OpBreak:
 		if n.Value.(int) == 0 {
-			p.w.WriteString("break")
+			p.w.WriteString(p.keyword("break"))
 		} else {
-			fmt.Fprintf(p.w, "break %d", n.Value.(int))
+			fmt.Fprintf(p.w, "%s %d", p.keyword("break"), n.Value.(int))
 		}
 
 	case ir.OpBoolLit:
-		fmt.Fprintf(p.w, "%v", n.Value)
+		p.w.WriteString(p.keyword(strconv.FormatBool(n.Value.(bool))))
 	case ir.OpIntLit:
-		fmt.Fprintf(p.w, "%#v", n.Value)
+		p.printIntLit(n.Value.(int64))
 	case ir.OpFloatLit:
 		v := n.Value.(float64)
 		switch {
-		case v == 0:
-			p.w.WriteString("0.0")
 		case math.IsNaN(v):
 			p.w.WriteString("make_nan()")
 		case math.IsInf(v, 1):
@@ -196,31 +645,89 @@ func (p *printer) printNode(n *ir.Node) printFlags {
 		case math.IsInf(v, -1):
 			p.w.WriteString("make_negative_inf()")
 		default:
-			fmt.Fprintf(p.w, "%#v", n.Value)
+			p.printFloatLit(v)
 		}
 	case ir.OpStringLit:
 		p.printString(n)
 
 	case ir.OpInterpolatedString:
+		if p.useHeredoc() {
+			p.printHeredoc(n.Args, false)
+			break
+		}
 		p.w.WriteByte('"')
-		for _, part := range n.Args {
-			if part.Op == ir.OpVar {
-				p.w.WriteString("{$" + part.Value.(string) + "}")
-			} else {
+		for i, part := range n.Args {
+			if part.Op == ir.OpStringLit {
 				p.w.Write(p.getStringBytes(part.Value.(string)))
+			} else {
+				p.w.WriteString(p.sprintInterpolation(n.Args, i))
 			}
 		}
 		p.w.WriteByte('"')
 
 	case ir.OpIndex:
-		p.printNode(n.Args[0])
-		p.w.WriteByte('[')
-		p.printNode(n.Args[1])
-		p.w.WriteByte(']')
+		p.printOperand(n.Args[0], nodeInfo(n.Args[0]).prec < ir.PrecAtom)
+		if curly, _ := n.Value.(bool); curly {
+			p.w.WriteByte('{')
+			p.printNode(n.Args[1])
+			p.w.WriteByte('}')
+		} else {
+			p.w.WriteByte('[')
+			p.printNode(n.Args[1])
+			p.w.WriteByte(']')
+		}
+	case ir.OpProp:
+		p.printMemberAccess(n, "->")
+	case ir.OpNullsafeProp:
+		p.printMemberAccess(n, "?->")
+	case ir.OpMethodCall:
+		p.printMethodCall(n, "->")
+	case ir.OpNullsafeMethodCall:
+		p.printMethodCall(n, "?->")
+	case ir.OpClassConst:
+		p.printClassRef(n.Args[0])
+		p.w.WriteString("::" + n.Value.(string))
+	case ir.OpStaticProp:
+		p.printClassRef(n.Args[0])
+		p.w.WriteString("::$" + n.Value.(string))
+	case ir.OpStaticCall:
+		p.printClassRef(n.Args[0])
+		p.w.WriteString("::" + n.Value.(string))
+		p.printCallArgs(n.Args[1:])
+	case ir.OpRelativeClass:
+		p.w.WriteString(p.keyword(n.Value.(ir.RelativeClass).String()))
+	case ir.OpNew:
+		p.w.WriteString(p.keyword("new "))
+		p.printClassNameRef(n.Args[0])
+		if len(n.Args) != 1 || !p.useNewWithoutParens() {
+			p.printCallArgs(n.Args[1:])
+		}
+	case ir.OpExit:
+		keyword := "exit"
+		if p.useDie() {
+			keyword = "die"
+		}
+		keyword = p.keyword(keyword)
+		p.w.WriteString(keyword)
+		if len(n.Args) != 0 {
+			// Not a function call, so it can't have a trailing comma.
+			p.w.WriteByte('(')
+			p.printNode(n.Args[0])
+			p.w.WriteByte(')')
+		}
+	case ir.OpYield:
+		p.printYield(n)
+	case ir.OpInstanceOf:
+		p.printOperand(n.Args[0], needParens(n, n.Args[0], false))
+		p.w.WriteString(p.keyword(" instanceof "))
+		p.printClassNameRef(n.Args[1])
+
+	case ir.OpClosure:
+		p.printClosure(n)
 
 	case ir.OpVar:
 		p.w.WriteString("$" + n.Value.(string))
-	case ir.OpName:
+	case ir.OpName, ir.OpConstFetch:
 		p.w.WriteString(n.Value.(string))
 
 	case ir.OpAssign:
@@ -230,35 +737,12 @@ func (p *printer) printNode(n *ir.Node) printFlags {
 		p.printBinary(n, "=")
 
 	case ir.OpAssignModify:
-		p.printBinary(n, modifyOpLit[n.Value.(ir.Op)]+"=")
-
-	case ir.OpAdd:
-		p.printBinary(n, "+")
-	case ir.OpSub:
-		p.printBinary(n, "-")
-	case ir.OpConcat:
-		p.printBinary(n, ".")
-
-	case ir.OpNullCoalesce:
-		p.printBinary(n, "??")
-	case ir.OpBitShiftRight:
-		p.printBinary(n, ">>")
-	case ir.OpBitShiftLeft:
-		p.printBinary(n, "<<")
-	case ir.OpBitNot:
-		p.printUnaryPrefix(n, "~")
-	case ir.OpBitXor:
-		p.printBinary(n, "^")
-	case ir.OpBitOr:
-		p.printBinary(n, "|")
-	case ir.OpBitAnd:
-		p.printBinary(n, "&")
-	case ir.OpNegation:
-		p.printUnaryPrefix(n, "-")
-	case ir.OpUnaryPlus:
-		p.printUnaryPrefix(n, "+")
-	case ir.OpExp:
-		p.printBinary(n, "**")
+		op := n.Value.(ir.Op)
+		if !ir.GetOpInfo(op).CompoundAssign {
+			panic(&NodeError{Node: n, Reason: "unexpected " + op.String() + " compound assignment"})
+		}
+		p.printBinary(n, ir.GetOpInfo(op).Symbol+"=")
+
 	case ir.OpMod:
 		if n.Type == ir.FloatType {
 			p.printSimpleCall("_safe_float_mod", n.Args)
@@ -271,58 +755,14 @@ func (p *printer) printNode(n *ir.Node) printFlags {
 		} else {
 			p.printSimpleCall("_safe_int_div", n.Args)
 		}
-	case ir.OpMul:
-		p.printBinary(n, "*")
-	case ir.OpNotEqual2:
-		p.printBinary(n, "!=")
-	case ir.OpNotFloatEqual2:
-		p.printSimpleCall("float_neq2", n.Args)
-	case ir.OpNotEqual3:
-		p.printBinary(n, "!==")
-	case ir.OpNotFloatEqual3:
-		p.printSimpleCall("float_neq3", n.Args)
-	case ir.OpSpaceship:
-		p.printBinary(n, "<=>")
-	case ir.OpAndWord:
-		p.printBinary(n, "and")
-	case ir.OpAnd:
-		p.printBinary(n, "&&")
-	case ir.OpXorWord:
-		p.printBinary(n, "xor")
-	case ir.OpOrWord:
-		p.printBinary(n, "or")
-	case ir.OpOr:
-		p.printBinary(n, "||")
-
-	case ir.OpEqual2:
-		p.printBinary(n, "==")
 	case ir.OpFloatEqual2:
 		p.printSimpleCall("float_eq2", n.Args)
-	case ir.OpEqual3:
-		p.printBinary(n, "===")
 	case ir.OpFloatEqual3:
 		p.printSimpleCall("float_eq3", n.Args)
-	case ir.OpLess:
-		p.printBinary(n, "<")
-	case ir.OpLessOrEqual:
-		p.printBinary(n, "<=")
-	case ir.OpGreater:
-		p.printBinary(n, ">")
-	case ir.OpGreaterOrEqual:
-		p.printBinary(n, ">=")
-
-	case ir.OpPreInc:
-		p.printUnaryPrefix(n, "++")
-	case ir.OpPreDec:
-		p.printUnaryPrefix(n, "--")
-
-	case ir.OpPostInc:
-		p.printUnaryPostfix(n, "++")
-	case ir.OpPostDec:
-		p.printUnaryPostfix(n, "--")
-
-	case ir.OpNot:
-		p.printUnaryPrefix(n, "!")
+	case ir.OpNotFloatEqual2:
+		p.printSimpleCall("float_neq2", n.Args)
+	case ir.OpNotFloatEqual3:
+		p.printSimpleCall("float_neq3", n.Args)
 
 	case ir.OpParens:
 		p.w.WriteByte('(')
@@ -330,98 +770,396 @@ func (p *printer) printNode(n *ir.Node) printFlags {
 		p.w.WriteByte(')')
 
 	case ir.OpTernary:
-		p.printNode(n.Args[0])
-		p.w.WriteString(" ? ")
-		p.printNode(n.Args[1])
-		p.w.WriteString(" : ")
-		p.printNode(n.Args[2])
+		// PHP 8 rejects unparenthesized nested ternaries
+		// in the condition and the false branch;
+		// needParens wraps them since the ternary is non-associative.
+		p.printOperand(n.Args[0], needParens(n, n.Args[0], false))
+		if n.Args[1] == nil {
+			p.w.WriteString(" ?: ")
+		} else {
+			p.w.WriteString(" ? ")
+			p.printNode(n.Args[1])
+			p.w.WriteString(" : ")
+		}
+		p.printOperand(n.Args[2], needParens(n, n.Args[2], true))
 
 	case ir.OpArrayLit:
+		opening, closing := p.keyword("array("), ")"
+		if p.useShortArraySyntax() {
+			opening, closing = "[", "]"
+		}
 		if len(n.Args) == 0 {
-			p.w.WriteString("array()")
+			p.w.WriteString(opening + closing)
 		} else {
-			p.w.WriteString("array(\n")
-			p.depth += 2
-			for _, elem := range n.Args {
+			p.w.WriteString(opening + "\n")
+			p.depth++
+			trailingComma := p.useArrayTrailingComma()
+			for i, elem := range n.Args {
 				p.indent()
 				p.printNode(elem)
-				p.w.WriteString(",\n")
+				if i != len(n.Args)-1 || trailingComma {
+					p.w.WriteByte(',')
+				}
+				p.w.WriteByte('\n')
 			}
-			p.depth -= 2
+			p.depth--
 			p.indent()
-			p.w.WriteString(")")
+			p.w.WriteString(closing)
 		}
 
+	case ir.OpKeyedElem:
+		p.printNode(n.Args[0])
+		p.w.WriteString(" => ")
+		p.printNode(n.Args[1])
+
+	case ir.OpList:
+		p.printList(n, p.useShortListSyntax())
+	case ir.OpByRef:
+		p.w.WriteByte('&')
+		p.printNode(n.Args[0])
+
 	case ir.OpCall:
 		p.printCall(n.Args[0], n.Args[1:])
+	case ir.OpNamedArg:
+		p.w.WriteString(n.Value.(string) + ": ")
+		p.printNode(n.Args[0])
+	case ir.OpSpread:
+		p.w.WriteString("...")
+		p.printNode(n.Args[0])
+	case ir.OpIsset:
+		p.printSimpleCall(p.keyword("isset"), n.Args)
+	case ir.OpEmpty:
+		// Like exit, empty can't have a trailing comma.
+		p.w.WriteString(p.keyword("empty") + "(")
+		p.printNode(n.Args[0])
+		p.w.WriteByte(')')
 
 	case ir.OpCast:
 		p.w.WriteByte('(')
-		p.w.WriteString(n.Type.String())
+		p.w.WriteString(p.keyword(p.castKeyword(n.Type)))
 		p.w.WriteByte(')')
-		p.printNode(n.Args[0])
+		p.printOperand(n.Args[0], needUnaryParens(n, n.Args[0], ""))
 
 	case ir.OpSwitch:
-		p.w.WriteString("switch (")
+		p.w.WriteString(p.keyword("switch ("))
 		p.printNode(n.Args[0])
-		p.w.WriteString(") {\n")
-		p.depth += 2
+		p.w.WriteByte(')')
+		p.braceSeparator()
+		p.w.WriteString("{\n")
+		if !p.config.FlatCaseLabels {
+			p.depth++
+		}
 		for _, c := range n.Args[1:] {
 			var body []*ir.Node
 			p.indent()
-			p.depth += 2
+			p.depth++
 			if c.Op == ir.OpCase {
-				p.w.WriteString("case ")
+				p.w.WriteString(p.keyword("case "))
 				p.printNode(c.Args[0])
 				p.w.WriteString(":\n")
 				body = c.Args[1:]
 			} else {
 				body = c.Args
-				p.w.WriteString("default:\n")
+				p.w.WriteString(p.keyword("default:\n"))
 			}
 			p.printSeq(body)
-			p.depth -= 2
+			p.depth--
+		}
+		if !p.config.FlatCaseLabels {
+			p.depth--
 		}
-		p.depth -= 2
 		p.indent()
 		p.w.WriteString("}\n")
 		return 0
 
 	case ir.OpWhile:
-		p.w.WriteString("while (")
+		p.w.WriteString(p.keyword("while ("))
 		p.printNode(n.Args[0])
-		p.w.WriteString(") ")
-		return p.printNode(n.Args[1])
+		p.w.WriteByte(')')
+		if p.useAltSyntax() {
+			return p.printAltBody(n.Args[1], p.keyword("endwhile"))
+		}
+		return p.printBody(n.Args[1])
+
+	case ir.OpDoWhile:
+		body := n.Args[0]
+		if body.Op != ir.OpBlock {
+			body = ir.NewBlock(body)
+		}
+		p.w.WriteString(p.keyword("do"))
+		p.braceSeparator()
+		p.printBlock(body)
+		p.braceSeparator()
+		p.w.WriteString(p.keyword("while ("))
+		p.printNode(n.Args[1])
+		p.w.WriteByte(')')
 
-	case ir.OpIf:
-		p.w.WriteString("if (")
+	case ir.OpFor:
+		p.w.WriteString(p.keyword("for ("))
+		p.printNodes(n.Args[0].Args, ", ")
+		for _, clause := range n.Args[1:3] {
+			p.w.WriteByte(';')
+			if len(clause.Args) != 0 {
+				p.w.WriteByte(' ')
+				p.printNodes(clause.Args, ", ")
+			}
+		}
+		p.w.WriteByte(')')
+		if p.useAltSyntax() {
+			return p.printAltBody(n.Args[3], p.keyword("endfor"))
+		}
+		return p.printBody(n.Args[3])
+
+	case ir.OpExprList:
+		p.printNodes(n.Args, ", ")
+
+	case ir.OpForeach:
+		p.w.WriteString(p.keyword("foreach ("))
 		p.printNode(n.Args[0])
-		p.w.WriteString(") ")
-		return p.printNode(n.Args[1])
+		p.w.WriteString(p.keyword(" as "))
+		if n.Args[1] != nil {
+			p.printNode(n.Args[1])
+			p.w.WriteString(" => ")
+		}
+		if n.Value.(bool) {
+			p.w.WriteByte('&')
+		}
+		p.printNode(n.Args[2])
+		p.w.WriteByte(')')
+		if p.useAltSyntax() {
+			return p.printAltBody(n.Args[3], p.keyword("endforeach"))
+		}
+		return p.printBody(n.Args[3])
+
+	case ir.OpIf, ir.OpIfElse:
+		if p.useAltSyntax() {
+			return p.printAltIf(n)
+		}
+		return p.printIf(n)
+
+	default:
+		p.printOperator(n)
 	}
 
 	return flagNeedNewline | flagNeedSemicolon
 }
 
+// printOperator prints the n operator that has no special syntax,
+// using its ir.OpInfo symbol and notation.
+func (p *printer) printOperator(n *ir.Node) {
+	info := ir.GetOpInfo(n.Op)
+	op := p.keyword(info.Symbol)
+	switch info.Notation {
+	case ir.NotationBinary:
+		p.printBinary(n, op)
+	case ir.NotationPrefix:
+		if isWordSymbol(info.Symbol) {
+			op += " "
+		}
+		p.printUnaryPrefix(n, op)
+	case ir.NotationPostfix:
+		p.printUnaryPostfix(n, op)
+	default:
+		panic(&NodeError{Node: n, Reason: "unexpected " + n.Op.String() + " node"})
+	}
+}
+
+// isWordSymbol reports whether the operator is a keyword, like 'clone'.
+func isWordSymbol(symbol string) bool {
+	if symbol == "" {
+		return false
+	}
+	c := symbol[len(symbol)-1]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *printer) printBlock(n *ir.Node) {
+	p.depth++
+	p.w.WriteString("{\n")
+	p.printSeq(n.Args)
+	p.depth--
+	p.indent()
+	p.w.WriteString("}")
+}
+
+func (p *printer) printIf(n *ir.Node) printFlags {
+	p.w.WriteString(p.keyword("if ("))
+	p.printNode(n.Args[0])
+	p.w.WriteByte(')')
+	if n.Op == ir.OpIf {
+		return p.printBody(n.Args[1])
+	}
+
+	// A non-block body is wrapped into a block,
+	// so the else can't be attached to a nested if.
+	body := n.Args[1]
+	if body.Op != ir.OpBlock {
+		body = ir.NewBlock(body)
+	}
+	p.braceSeparator()
+	p.printBlock(body)
+	p.braceSeparator()
+
+	elseNode := n.Args[2]
+	if elseNode.Op == ir.OpIf || elseNode.Op == ir.OpIfElse {
+		p.w.WriteString(p.keyword("else"))
+		return p.printIf(elseNode)
+	}
+	p.w.WriteString(p.keyword("else"))
+	return p.printBody(elseNode)
+}
+
+func (p *printer) useGroupedAttributes() bool {
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return p.config.GroupedAttributes
+}
+
+func (p *printer) useDie() bool {
+	return p.config.Rand != nil && randutil.Bool(p.config.Rand)
+}
+
+func (p *printer) useNewWithoutParens() bool {
+	return p.config.Rand != nil && randutil.Bool(p.config.Rand)
+}
+
+func (p *printer) useDefineConsts() bool {
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return p.config.DefineConsts
+}
+
+func (p *printer) useShortArraySyntax() bool {
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return p.config.ShortArraySyntax
+}
+
+// useTrailingComma reports whether a list that allows
+// the trailing comma since the PHP version should end with it.
+func (p *printer) useTrailingComma(version int) bool {
+	if !p.config.TrailingCommas {
+		return false
+	}
+	if p.config.Rand != nil {
+		return p.phpVersionAtLeast(version) && randutil.Bool(p.config.Rand)
+	}
+	return true
+}
+
+func (p *printer) useArrayTrailingComma() bool {
+	if p.config.TrailingCommas && p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return true
+}
+
+func isSpecialFloat(v float64) bool {
+	return math.IsNaN(v) || math.IsInf(v, 0)
+}
+
 func (p *printer) printSimpleCall(name string, args []*ir.Node) {
 	p.printCall(ir.NewName(name), args)
 }
 
 func (p *printer) printCall(fn *ir.Node, args []*ir.Node) {
-	p.printNode(fn)
+	p.printOperand(fn, fn.Op == ir.OpClosure || nodeInfo(fn).prec < ir.PrecAtom)
+	p.printCallArgs(args)
+}
+
+// printMemberAccess prints a property fetch with the given access operator.
+func (p *printer) printMemberAccess(n *ir.Node, op string) {
+	obj := n.Args[0]
+	p.printOperand(obj, obj.Op == ir.OpClosure || nodeInfo(obj).prec < ir.PrecAtom)
+	p.w.WriteString(op)
+	if len(n.Args) == 2 {
+		p.w.WriteByte('{')
+		p.printNode(n.Args[1])
+		p.w.WriteByte('}')
+	} else {
+		p.w.WriteString(n.Value.(string))
+	}
+}
+
+// printClassRef prints the left side of a '::' access.
+func (p *printer) printClassRef(class *ir.Node) {
+	p.printOperand(class, class.Op == ir.OpClosure || nodeInfo(class).prec < ir.PrecAtom)
+}
+
+// printClassNameRef prints a class reference of new and instanceof.
+// Arbitrary expressions (PHP 8+) are parenthesized there.
+func (p *printer) printClassNameRef(class *ir.Node) {
+	switch {
+	case class.Op == ir.OpName || class.Op == ir.OpRelativeClass || isNewVariable(class):
+		p.printNode(class)
+	default:
+		p.printOperand(class, true)
+	}
+}
+
+// isNewVariable reports whether n can be a class reference without
+// parentheses. It's a chain of the index and property fetches
+// based on a variable, like $x->y[0]; a call in the chain
+// would be parsed as the new arguments.
+func isNewVariable(n *ir.Node) bool {
+	switch n.Op {
+	case ir.OpVar:
+		return true
+	case ir.OpProp, ir.OpNullsafeProp, ir.OpIndex:
+		return isNewVariable(n.Args[0])
+	case ir.OpStaticProp:
+		class := n.Args[0]
+		return class.Op == ir.OpName || class.Op == ir.OpRelativeClass || isNewVariable(class)
+	default:
+		return false
+	}
+}
+
+func (p *printer) printMethodCall(n *ir.Node, op string) {
+	obj := n.Args[0]
+	p.printOperand(obj, obj.Op == ir.OpClosure || nodeInfo(obj).prec < ir.PrecAtom)
+	p.w.WriteString(op + n.Value.(string))
+	p.printCallArgs(n.Args[1:])
+}
+
+func (p *printer) printCallArgs(args []*ir.Node) {
 	p.w.WriteByte('(')
+	trailingComma := ""
+	if len(args) != 0 && p.useTrailingComma(php73) {
+		trailingComma = ","
+	}
+	if p.config.MaxLineLength == 0 {
+		p.printNodes(args, ", ")
+		p.w.WriteString(trailingComma + ")")
+		return
+	}
+
+	printed := make([]string, len(args))
 	for i, arg := range args {
+		printed[i] = p.sprintContinuation(arg)
+	}
+	if flat := strings.Join(printed, ", ") + trailingComma + ")"; p.fits(flat) {
+		p.w.WriteRaw(flat)
+		return
+	}
+	for i, arg := range printed {
 		if i != 0 {
-			p.w.WriteString(", ")
+			p.w.WriteByte(',')
 		}
-		p.printNode(arg)
+		p.newlineContinuation()
+		p.w.WriteRaw(arg)
 	}
+	p.w.WriteString(trailingComma + "\n")
+	p.indent()
 	p.w.WriteByte(')')
 }
 
 func (p *printer) printUnaryPrefix(n *ir.Node, op string) {
 	p.w.WriteString(op)
-	p.printNode(n.Args[0])
+	p.printOperand(n.Args[0], needUnaryParens(n, n.Args[0], op))
 }
 
 func (p *printer) printUnaryPostfix(n *ir.Node, op string) {
@@ -430,9 +1168,38 @@ func (p *printer) printUnaryPostfix(n *ir.Node, op string) {
 }
 
 func (p *printer) printBinary(n *ir.Node, op string) {
-	p.printNode(n.Args[0])
-	p.w.WriteString(" " + op + " ")
-	p.printNode(n.Args[1])
+	// The assignment LHS is an lvalue, it can't be parenthesized.
+	isAssign := n.Op == ir.OpAssign || n.Op == ir.OpAssignModify
+	p.printOperand(n.Args[0], !isAssign && needParens(n, n.Args[0], false))
+	if p.config.MaxLineLength == 0 || isAssign {
+		p.w.WriteString(" " + op + " ")
+		p.printExprComment()
+		p.printOperand(n.Args[1], needParens(n, n.Args[1], true))
+		return
+	}
+
+	rhs := p.sprintContinuation(n.Args[1])
+	if needParens(n, n.Args[1], true) {
+		rhs = "(" + rhs + ")"
+	}
+	if p.fits(" " + op + " " + rhs) {
+		p.w.WriteString(" " + op + " ")
+	} else {
+		p.newlineContinuation()
+		p.w.WriteString(op + " ")
+	}
+	p.printExprComment()
+	p.w.WriteRaw(rhs)
+}
+
+func (p *printer) printOperand(n *ir.Node, parens bool) {
+	if parens {
+		p.w.WriteByte('(')
+		p.printNode(n)
+		p.w.WriteByte(')')
+	} else {
+		p.printNode(n)
+	}
 }
 
 func (p *printer) printNodes(nodes []*ir.Node, sep string) {
@@ -445,39 +1212,47 @@ func (p *printer) printNodes(nodes []*ir.Node, sep string) {
 }
 
 func (p *printer) getStringBytes(s string) []byte {
+	return p.escapeString(s, false)
+}
+
+// escapeString escapes s for a double-quoted string or a heredoc body.
+// Heredoc bodies can contain raw newlines and quotes.
+func (p *printer) escapeString(s string, heredoc bool) []byte {
 	var buf bytes.Buffer
 	buf.Grow(len(s))
 	for i := 0; i < len(s); i++ {
 		ch := s[i]
 		switch ch {
-		case '\r':
-			buf.WriteString(`\r`)
 		case '\n':
-			buf.WriteString(`\n`)
+			if heredoc {
+				buf.WriteByte('\n')
+			} else {
+				p.writeByteEscape(&buf, ch)
+			}
 		case '"':
-			buf.WriteString(`\"`)
+			if heredoc {
+				buf.WriteByte('"')
+			} else {
+				buf.WriteString(`\"`)
+			}
 		case '\\':
 			buf.WriteString(`\\`)
-		case 0:
-			buf.WriteString(`\000`)
-		case '\a':
-			buf.WriteString(`\a`)
-		case '\b':
-			buf.WriteString(`\b`)
-		case '\f':
-			buf.WriteString(`\f`)
-		case '\t':
-			buf.WriteString(`\t`)
-		case '\v':
-			buf.WriteString(`\v`)
+		case '$':
+			// Escaping '$' also makes "{$" sequences safe:
+			// '{' has no special meaning unless followed by '$'.
+			buf.WriteString(`\$`)
 		default:
-			if ch < 32 {
-				buf.WriteString(`\0`)
-				buf.WriteByte('0' + ch/8)
-				buf.WriteByte('0' + ch%8)
-			} else {
-				buf.WriteByte(ch)
+			if ch < utf8.RuneSelf {
+				p.writeByteEscape(&buf, ch)
+				break
+			}
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if (r != utf8.RuneError || size != 1) && p.useUnicodeEscape() {
+				buf.WriteString(`\u{` + strconv.FormatInt(int64(r), 16) + `}`)
+				i += size - 1
+				break
 			}
+			p.writeByteEscape(&buf, ch)
 		}
 	}
 	return buf.Bytes()
@@ -485,8 +1260,50 @@ func (p *printer) getStringBytes(s string) []byte {
 
 func (p *printer) printString(n *ir.Node) {
 	s := n.Value.(string)
+	if p.useHeredoc() {
+		p.printHeredoc([]*ir.Node{n}, canNowdoc(s) && randutil.Bool(p.config.Rand))
+		return
+	}
+	if p.useSingleQuotes(s) {
+		p.printSingleQuoted(s)
+		return
+	}
 	quote := byte('"')
 	p.w.WriteByte(quote)
 	p.w.Write(p.getStringBytes(s))
 	p.w.WriteByte(quote)
 }
+
+func (p *printer) useSingleQuotes(s string) bool {
+	if p.config.DoubleQuotes || !canSingleQuote(s) {
+		return false
+	}
+	if p.config.Rand != nil {
+		return randutil.Bool(p.config.Rand)
+	}
+	return true
+}
+
+// canSingleQuote reports whether s can be printed as a single-quoted
+// string literal without losing any characters.
+// Control characters can only be expressed with double-quoted escapes.
+func canSingleQuote(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 32 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *printer) printSingleQuoted(s string) {
+	p.w.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch == '\'' || ch == '\\' {
+			p.w.WriteByte('\\')
+		}
+		p.w.WriteByte(ch)
+	}
+	p.w.WriteByte('\'')
+}
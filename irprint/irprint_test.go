@@ -3,9 +3,15 @@ package irprint
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/phpdoc"
 )
 
 func TestPrintNodePretty(t *testing.T) {
@@ -24,10 +30,14 @@ func TestPrintNodePretty(t *testing.T) {
 		{ir.NewFloatLit(-1.4), `-1.4`},
 		{ir.NewAssignModify(ir.OpAdd, ir.NewVar("x", intType), ir.NewVar("y", intType)), "$x += $y"},
 		{ir.NewAssignModify(ir.OpBitShiftRight, ir.NewVar("x", intType), ir.NewVar("y", intType)), "$x >>= $y"},
-		// TODO: more string tests when printer handles them correctly.
-		{ir.NewStringLit(""), `""`},
-		{ir.NewStringLit("123"), `"123"`},
-		{ir.NewStringLit("\\n"), `"\\n"`},
+		{ir.NewStringLit(""), `''`},
+		{ir.NewStringLit("123"), `'123'`},
+		{ir.NewStringLit("\\n"), `'\\n'`},
+		{ir.NewStringLit("it's"), `'it\'s'`},
+		{ir.NewStringLit("$var"), `'$var'`},
+		{ir.NewStringLit("{$x}"), `'{$x}'`},
+		{ir.NewStringLit("1\n2"), `"1\n2"`},
+		{ir.NewStringLit("\x00"), `"\000"`},
 
 		{ir.NewEcho(ir.NewVar("foo", intType)), `echo $foo`},
 		{ir.NewEcho(ir.NewVar("foo", intType), ir.NewBoolLit(false)), `echo $foo, false`},
@@ -41,7 +51,7 @@ func TestPrintNodePretty(t *testing.T) {
 		{
 			ir.NewBlock(ir.NewEcho(ir.NewStringLit("ok"))),
 			`{
-  echo "ok";
+  echo 'ok';
 }
 `,
 		},
@@ -60,3 +70,3335 @@ func TestPrintNodePretty(t *testing.T) {
 		})
 	}
 }
+
+func TestPrintDoubleQuoted(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewStringLit(""), `""`},
+		{ir.NewStringLit("123"), `"123"`},
+		{ir.NewStringLit("\\n"), `"\\n"`},
+		{ir.NewStringLit("'"), `"'"`},
+		{ir.NewStringLit("\""), `"\""`},
+		{ir.NewStringLit("$var"), `"\$var"`},
+		{ir.NewStringLit("price is $5"), `"price is \$5"`},
+		{ir.NewStringLit("${x}"), `"\${x}"`},
+		{ir.NewStringLit("{$x}"), `"{\$x}"`},
+		{ir.NewStringLit("a$"), `"a\$"`},
+		{ir.NewStringLit("$"), `"\$"`},
+		{
+			&ir.Node{Op: ir.OpInterpolatedString, Args: []*ir.Node{
+				ir.NewStringLit("{$y} costs $"),
+				ir.NewVar("x", intType),
+				ir.NewStringLit("{"),
+				ir.NewVar("z", intType),
+			}},
+			`"{\$y} costs \${$x}{{$z}"`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			config := &Config{DoubleQuotes: true}
+			FprintNode(&buf, test.n, config)
+			have := buf.String()
+			if have != test.want {
+				t.Fatalf("print %s:\nhave: %q\nwant: %q", test.n.Op, have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRandomQuotes(t *testing.T) {
+	config := &Config{Rand: rand.New(rand.NewSource(1))}
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		FprintNode(&buf, ir.NewStringLit("a'b"), config)
+		have := buf.String()
+		if have != `'a\'b'` && have != `"a'b"` {
+			t.Fatalf("unexpected output: %q", have)
+		}
+		seen[have] = true
+
+		buf.Reset()
+		FprintNode(&buf, ir.NewStringLit("a\tb"), config)
+		if buf.String() != `"a\tb"` {
+			t.Fatalf("string with control chars is not double-quoted: %q", buf.String())
+		}
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected both quoting styles to be used, got %v", seen)
+	}
+}
+
+func TestPrintPrecedence(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	x := ir.NewVar("x", intType)
+	y := ir.NewVar("y", intType)
+	z := ir.NewVar("z", intType)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewAdd(x, ir.NewMul(y, z)), `$x + $y * $z`},
+		{ir.NewMul(ir.NewAdd(x, y), z), `($x + $y) * $z`},
+		{ir.NewMul(x, ir.NewAdd(y, z)), `$x * ($y + $z)`},
+
+		{ir.NewSub(ir.NewSub(x, y), z), `$x - $y - $z`},
+		{ir.NewSub(x, ir.NewSub(y, z)), `$x - ($y - $z)`},
+		{ir.NewSub(x, ir.NewAdd(y, z)), `$x - ($y + $z)`},
+
+		{ir.NewExp(x, ir.NewExp(y, z)), `$x ** $y ** $z`},
+		{ir.NewExp(ir.NewExp(x, y), z), `($x ** $y) ** $z`},
+		{ir.NewExp(ir.NewNegation(x), y), `(-$x) ** $y`},
+		{ir.NewNegation(ir.NewExp(x, y)), `-$x ** $y`},
+		{ir.NewExp(ir.NewIntLit(-2), y), `(-2) ** $y`},
+
+		{ir.NewConcat(ir.NewConcat(x, y), z), `$x . $y . $z`},
+		{ir.NewConcat(x, ir.NewConcat(y, z)), `$x . ($y . $z)`},
+		{ir.NewConcat(x, ir.NewAdd(y, z)), `$x . ($y + $z)`},
+		{ir.NewAdd(ir.NewConcat(x, y), z), `($x . $y) + $z`},
+		{ir.NewConcat(ir.NewBitShiftLeft(x, y), z), `($x << $y) . $z`},
+
+		{ir.NewNullCoalesce(x, ir.NewNullCoalesce(y, z)), `$x ?? $y ?? $z`},
+		{ir.NewNullCoalesce(ir.NewNullCoalesce(x, y), z), `($x ?? $y) ?? $z`},
+
+		{ir.NewAndWord(ir.NewAssign(x, y), z), `$x = $y and $z`},
+		{ir.NewAssign(x, ir.NewAndWord(y, z)), `$x = ($y and $z)`},
+		{ir.NewAssign(x, ir.NewOrWord(y, z)), `$x = ($y or $z)`},
+		{ir.NewAssign(x, ir.NewXorWord(y, z)), `$x = ($y xor $z)`},
+		{ir.NewAssign(x, ir.NewAnd(y, z)), `$x = $y && $z`},
+		{ir.NewAssign(x, ir.NewAssign(y, z)), `$x = $y = $z`},
+		{ir.NewOrWord(ir.NewAndWord(x, y), z), `$x and $y or $z`},
+		{ir.NewAndWord(ir.NewOrWord(x, y), z), `($x or $y) and $z`},
+		{ir.NewXorWord(ir.NewOrWord(x, y), z), `($x or $y) xor $z`},
+
+		{ir.NewOr(ir.NewAnd(x, y), z), `$x && $y || $z`},
+		{ir.NewAnd(ir.NewOr(x, y), z), `($x || $y) && $z`},
+
+		{ir.NewLess(ir.NewLess(x, y), z), `($x < $y) < $z`},
+		{ir.NewEqual2(x, ir.NewEqual3(y, z)), `$x == ($y === $z)`},
+		{ir.NewEqual2(ir.NewLess(x, y), z), `$x < $y == $z`},
+
+		{ir.NewNot(ir.NewAnd(x, y)), `!($x && $y)`},
+		{ir.NewAnd(ir.NewNot(x), y), `!$x && $y`},
+		{ir.NewNegation(ir.NewNegation(x)), `-(-$x)`},
+		{ir.NewNegation(ir.NewIntLit(-1)), `-(-1)`},
+		{ir.NewNegation(ir.NewPreDec(x)), `-(--$x)`},
+		{ir.NewUnaryPlus(ir.NewPreInc(x)), `+(++$x)`},
+		{ir.NewNegation(ir.NewNot(x)), `-!$x`},
+		{ir.NewBitNot(ir.NewBitAnd(x, y)), `~($x & $y)`},
+		{ir.NewSub(x, ir.NewIntLit(-1)), `$x - -1`},
+
+		{&ir.Node{Op: ir.OpCast, Type: intType, Args: []*ir.Node{ir.NewAdd(x, y)}}, `(int)($x + $y)`},
+		{ir.NewAdd(&ir.Node{Op: ir.OpCast, Type: intType, Args: []*ir.Node{x}}, y), `(int)$x + $y`},
+
+		{ir.NewBitOr(ir.NewBitXor(x, y), z), `$x ^ $y | $z`},
+		{ir.NewBitXor(ir.NewBitOr(x, y), z), `($x | $y) ^ $z`},
+		{ir.NewBitAnd(ir.NewEqual2(x, y), z), `$x == $y & $z`},
+		{ir.NewEqual2(ir.NewBitAnd(x, y), z), `($x & $y) == $z`},
+
+		{ir.NewAdd(ir.NewParens(ir.NewAdd(x, y)), z), `($x + $y) + $z`},
+		{ir.NewMul(ir.NewParens(ir.NewAdd(x, y)), z), `($x + $y) * $z`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print %s:\nhave: %q\nwant: %q", test.n.Op, have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintNestedTernary(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	a := ir.NewVar("a", intType)
+	b := ir.NewVar("b", intType)
+	c := ir.NewVar("c", intType)
+	d := ir.NewVar("d", intType)
+	e := ir.NewVar("e", intType)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewTernary(a, b, ir.NewTernary(c, d, e)), `$a ? $b : ($c ? $d : $e)`},
+		{ir.NewTernary(ir.NewTernary(a, b, c), d, e), `($a ? $b : $c) ? $d : $e`},
+		{ir.NewTernary(a, ir.NewTernary(b, c, d), e), `$a ? $b ? $c : $d : $e`},
+		{ir.NewShortTernary(a, ir.NewShortTernary(b, c)), `$a ?: ($b ?: $c)`},
+		{ir.NewShortTernary(ir.NewShortTernary(a, b), c), `($a ?: $b) ?: $c`},
+		{ir.NewTernary(a, b, ir.NewShortTernary(c, d)), `$a ? $b : ($c ?: $d)`},
+		{ir.NewTernary(ir.NewAssign(a, b), c, d), `($a = $b) ? $c : $d`},
+		{ir.NewTernary(ir.NewLess(a, b), c, ir.NewAdd(d, e)), `$a < $b ? $c : $d + $e`},
+		{ir.NewAdd(ir.NewTernary(a, b, c), d), `($a ? $b : $c) + $d`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print ternary:\nhave: %q\nwant: %q", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintHeredoc(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+
+	tests := []struct {
+		parts    []*ir.Node
+		nowdoc   bool
+		flexible bool
+		want     string
+	}{
+		{
+			parts: []*ir.Node{ir.NewStringLit("")},
+			want:  "<<<EOT\n\nEOT\n",
+		},
+		{
+			parts: []*ir.Node{ir.NewStringLit("a\n\"b\"\n$c\t")},
+			want:  "<<<EOT\na\n\"b\"\n\\$c\\t\nEOT\n",
+		},
+		{
+			parts:  []*ir.Node{ir.NewStringLit("a\n$b\\")},
+			nowdoc: true,
+			want:   "<<<'EOT'\na\n$b\\\nEOT\n",
+		},
+		{
+			parts:    []*ir.Node{ir.NewStringLit("a\n\nb")},
+			flexible: true,
+			want:     "<<<EOT\n  a\n\n  b\n  EOT",
+		},
+		{
+			parts:  []*ir.Node{ir.NewStringLit("xEOT\nEOT1")},
+			nowdoc: true,
+			want:   "<<<'EOT2'\nxEOT\nEOT1\nEOT2\n",
+		},
+		{
+			parts: []*ir.Node{
+				ir.NewStringLit("x = "),
+				ir.NewVar("x", intType),
+				ir.NewStringLit("\n"),
+			},
+			flexible: true,
+			want:     "<<<EOT\n  x = {$x}\n\n  EOT",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			p := &printer{
+				config: &Config{FlexibleHeredoc: test.flexible},
+				w:      newColumnWriter(&buf),
+			}
+			p.printHeredoc(test.parts, test.nowdoc)
+			p.w.Flush()
+			have := buf.String()
+			if have != test.want {
+				t.Fatalf("print heredoc:\nhave: %q\nwant: %q", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRandomHeredoc(t *testing.T) {
+	config := &Config{
+		Rand:               rand.New(rand.NewSource(1)),
+		HeredocProbability: 1,
+		FlexibleHeredoc:    true,
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		var buf bytes.Buffer
+		FprintNode(&buf, ir.NewStringLit("a\nb"), config)
+		have := buf.String()
+		switch {
+		case strings.HasPrefix(have, "<<<'"):
+			seen["nowdoc"] = true
+		case strings.HasPrefix(have, "<<<"):
+			seen["heredoc"] = true
+		default:
+			t.Fatalf("expected heredoc or nowdoc, got %q", have)
+		}
+
+		buf.Reset()
+		FprintNode(&buf, ir.NewStringLit("a\x00"), config)
+		if strings.HasPrefix(buf.String(), "<<<'") {
+			t.Fatalf("string with control chars is printed as nowdoc: %q", buf.String())
+		}
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected both heredoc and nowdoc to be used, got %v", seen)
+	}
+}
+
+func TestPrintArrayLit(t *testing.T) {
+	newArray := func(elems ...*ir.Node) *ir.Node {
+		return &ir.Node{Op: ir.OpArrayLit, Args: elems}
+	}
+
+	tests := []struct {
+		n     *ir.Node
+		short bool
+		want  string
+	}{
+		{newArray(), false, `array()`},
+		{newArray(), true, `[]`},
+		{newArray(ir.NewIntLit(1)), false, "array(\n  1,\n)"},
+		{newArray(ir.NewIntLit(1)), true, "[\n  1,\n]"},
+		{
+			newArray(newArray(ir.NewIntLit(1), ir.NewIntLit(2)), newArray()),
+			true,
+			"[\n  [\n    1,\n    2,\n  ],\n  [],\n]",
+		},
+		{
+			newArray(newArray(ir.NewIntLit(1), ir.NewIntLit(2)), newArray()),
+			false,
+			"array(\n  array(\n    1,\n    2,\n  ),\n  array(),\n)",
+		},
+		{
+			newArray(
+				ir.NewKeyedElem(ir.NewStringLit("a"), ir.NewIntLit(1)),
+				ir.NewIntLit(2),
+				ir.NewKeyedElem(ir.NewIntLit(10), newArray(ir.NewKeyedElem(ir.NewIntLit(-1), ir.NewBoolLit(true)))),
+			),
+			true,
+			"[\n  'a' => 1,\n  2,\n  10 => [\n    -1 => true,\n  ],\n]",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintNode(&buf, test.n, &Config{ShortArraySyntax: test.short})
+			have := buf.String()
+			if have != test.want {
+				t.Fatalf("print array:\nhave: %q\nwant: %q", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRandomArrayLit(t *testing.T) {
+	config := &Config{Rand: rand.New(rand.NewSource(1))}
+	n := &ir.Node{Op: ir.OpArrayLit}
+	for i := 0; i < 6; i++ {
+		n = &ir.Node{Op: ir.OpArrayLit, Args: []*ir.Node{n, ir.NewIntLit(int64(i))}}
+	}
+	var buf bytes.Buffer
+	FprintNode(&buf, n, config)
+	have := buf.String()
+	if !strings.Contains(have, "array(") || !strings.Contains(have, "[") {
+		t.Fatalf("expected both array syntaxes to be used:\n%s", have)
+	}
+	if strings.Count(have, "array(")+strings.Count(have, "[") != 7 {
+		t.Fatalf("unbalanced array literals:\n%s", have)
+	}
+	if strings.Count(have, "(") != strings.Count(have, ")") || strings.Count(have, "[") != strings.Count(have, "]") {
+		t.Fatalf("unbalanced brackets:\n%s", have)
+	}
+}
+
+func TestPrintIf(t *testing.T) {
+	boolType := &ir.ScalarType{Kind: ir.ScalarBool}
+	a := ir.NewVar("a", boolType)
+	b := ir.NewVar("b", boolType)
+	c := ir.NewVar("c", boolType)
+	echo := func(s string) *ir.Node {
+		return ir.NewEcho(ir.NewStringLit(s))
+	}
+	nested := func(n *ir.Node) *ir.Node {
+		return ir.NewBlock(ir.NewBlock(n))
+	}
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			nested(ir.NewIf(a, ir.NewBlock(echo("x")))),
+			`{
+  {
+    if ($a) {
+      echo 'x';
+    }
+  }
+}
+`,
+		},
+		{
+			nested(ir.NewIfElse(a, ir.NewBlock(echo("x")), ir.NewBlock(echo("y")))),
+			`{
+  {
+    if ($a) {
+      echo 'x';
+    } else {
+      echo 'y';
+    }
+  }
+}
+`,
+		},
+		{
+			nested(ir.NewIfElse(a, ir.NewBlock(echo("x")),
+				ir.NewIfElse(b, ir.NewBlock(echo("y")),
+					ir.NewIfElse(c, ir.NewBlock(echo("z")),
+						ir.NewBlock(echo("w")))))),
+			`{
+  {
+    if ($a) {
+      echo 'x';
+    } elseif ($b) {
+      echo 'y';
+    } elseif ($c) {
+      echo 'z';
+    } else {
+      echo 'w';
+    }
+    echo 'after';
+  }
+}
+`,
+		},
+		{
+			nested(ir.NewIfElse(a, ir.NewBlock(echo("x")),
+				ir.NewIf(b, ir.NewBlock(echo("y"))))),
+			`{
+  {
+    if ($a) {
+      echo 'x';
+    } elseif ($b) {
+      echo 'y';
+    }
+  }
+}
+`,
+		},
+		{
+			nested(ir.NewIfElse(a, ir.NewIf(b, echo("x")), echo("y"))),
+			`{
+  {
+    if ($a) {
+      if ($b) echo 'x';
+    } else echo 'y';
+  }
+}
+`,
+		},
+	}
+	// Check that the statement following the if chain is printed correctly.
+	tests[2].n.Args[0].Args = append(tests[2].n.Args[0].Args, echo("after"))
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print if:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintForeach(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	arr := ir.NewVar("arr", &ir.ArrayType{Elem: intType})
+	k := ir.NewVar("k", intType)
+	v := ir.NewVar("v", intType)
+	body := func() *ir.Node {
+		return ir.NewBlock(ir.NewEcho(v))
+	}
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewForeach(arr, nil, v, body(), false),
+			"foreach ($arr as $v) {\n  echo $v;\n}\n",
+		},
+		{
+			ir.NewForeach(arr, k, v, body(), false),
+			"foreach ($arr as $k => $v) {\n  echo $v;\n}\n",
+		},
+		{
+			ir.NewForeach(arr, nil, v, body(), true),
+			"foreach ($arr as &$v) {\n  echo $v;\n}\n",
+		},
+		{
+			ir.NewForeach(arr, k, v, body(), true),
+			"foreach ($arr as $k => &$v) {\n  echo $v;\n}\n",
+		},
+		{
+			ir.NewBlock(ir.NewForeach(arr, k, v, ir.NewBlock(ir.NewForeach(arr, nil, v, body(), false)), false)),
+			`{
+  foreach ($arr as $k => $v) {
+    foreach ($arr as $v) {
+      echo $v;
+    }
+  }
+}
+`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print foreach:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintFor(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	i := ir.NewVar("i", intType)
+	j := ir.NewVar("j", intType)
+	body := func() *ir.Node {
+		return ir.NewBlock(ir.NewEcho(i))
+	}
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewFor(nil, nil, nil, body()),
+			"for (;;) {\n  echo $i;\n}\n",
+		},
+		{
+			ir.NewFor(
+				[]*ir.Node{ir.NewAssign(i, ir.NewIntLit(0))},
+				[]*ir.Node{ir.NewLess(i, ir.NewIntLit(10))},
+				[]*ir.Node{ir.NewPostInc(i)},
+				body()),
+			"for ($i = 0; $i < 10; $i++) {\n  echo $i;\n}\n",
+		},
+		{
+			ir.NewFor(
+				[]*ir.Node{ir.NewAssign(i, ir.NewIntLit(0)), ir.NewAssign(j, ir.NewIntLit(10))},
+				[]*ir.Node{ir.NewLess(i, j)},
+				[]*ir.Node{ir.NewPostInc(i), ir.NewPostDec(j)},
+				body()),
+			"for ($i = 0, $j = 10; $i < $j; $i++, $j--) {\n  echo $i;\n}\n",
+		},
+		{
+			ir.NewFor(
+				[]*ir.Node{ir.NewAssign(i, ir.NewIntLit(0))},
+				nil,
+				[]*ir.Node{ir.NewPreInc(i)},
+				body()),
+			"for ($i = 0;; ++$i) {\n  echo $i;\n}\n",
+		},
+		{
+			ir.NewBlock(ir.NewFor(nil, []*ir.Node{ir.NewBoolLit(true)}, nil, ir.NewBlock(ir.NewBreak(0)))),
+			"{\n  for (; true;) {\n    break;\n  }\n}\n",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print for:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintDoWhile(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	i := ir.NewVar("i", intType)
+	cond := ir.NewLess(ir.NewPostInc(i), ir.NewIntLit(3))
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewDoWhile(ir.NewBlock(ir.NewEcho(i)), cond),
+			"do {\n  echo $i;\n} while ($i++ < 3)",
+		},
+		{
+			ir.NewDoWhile(ir.NewEcho(i), cond),
+			"do {\n  echo $i;\n} while ($i++ < 3)",
+		},
+		{
+			ir.NewBlock(
+				ir.NewWhile(cond, ir.NewBlock(
+					ir.NewDoWhile(ir.NewBlock(ir.NewEcho(i)), cond),
+					ir.NewEcho(i),
+				)),
+				ir.NewDoWhile(ir.NewBlock(ir.NewDoWhile(ir.NewBlock(ir.NewBreak(0)), cond)), cond),
+			),
+			`{
+  while ($i++ < 3) {
+    do {
+      echo $i;
+    } while ($i++ < 3);
+    echo $i;
+  }
+  do {
+    do {
+      break;
+    } while ($i++ < 3);
+  } while ($i++ < 3);
+}
+`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print do-while:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintTry(t *testing.T) {
+	exceptionType := &ir.ClassType{Name: "Exception"}
+	e := ir.NewVar("e", exceptionType)
+	x := ir.NewVar("x", &ir.ScalarType{Kind: ir.ScalarInt})
+	newException := ir.NewCall(ir.NewName("make_exception"))
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewThrow(e), `throw $e`},
+		{ir.NewThrow(ir.NewNullCoalesce(x, e)), `throw $x ?? $e`},
+		{ir.NewNullCoalesce(x, ir.NewThrow(newException)), `$x ?? (throw make_exception())`},
+		{ir.NewAdd(ir.NewNegation(ir.NewThrow(e)), x), `-(throw $e) + $x`},
+		{
+			ir.NewBlock(ir.NewTry(
+				ir.NewBlock(ir.NewThrow(e)),
+				ir.NewCatch([]string{"LogicException"}, e, ir.NewBlock(ir.NewEcho(x))),
+				ir.NewCatch([]string{"RuntimeException", "Error"}, e, ir.NewBlock()),
+				ir.NewCatch([]string{"Throwable"}, nil, ir.NewBlock()),
+				ir.NewFinally(ir.NewBlock(ir.NewEcho(x))),
+			)),
+			`{
+  try {
+    throw $e;
+  } catch (LogicException $e) {
+    echo $x;
+  } catch (RuntimeException|Error $e) {
+  } catch (Throwable) {
+  } finally {
+    echo $x;
+  }
+}
+`,
+		},
+		{
+			ir.NewTry(
+				ir.NewBlock(ir.NewAssign(x, ir.NewNullCoalesce(x, ir.NewThrow(newException)))),
+				ir.NewFinally(ir.NewBlock()),
+			),
+			`try {
+  $x = $x ?? (throw make_exception());
+} finally {
+}
+`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			have := SprintNode(test.n)
+			if have != test.want {
+				t.Fatalf("print try:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintArrowFunction(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	x := ir.NewVar("x", intType)
+	y := ir.NewVar("y", intType)
+	arr := ir.NewVar("arr", &ir.ArrayType{Elem: intType})
+	paramX := []ir.TypeField{{Name: "x", Type: intType}}
+
+	tests := []struct {
+		n     *ir.Node
+		arrow bool
+		want  string
+	}{
+		{
+			ir.NewArrowClosure(&ir.FuncType{Params: paramX}, []ir.ClosureUse{{Name: "y"}}, ir.NewAdd(x, y)),
+			true,
+			"fn ($x) => $x + $y",
+		},
+		{
+			ir.NewArrowClosure(&ir.FuncType{Params: paramX}, []ir.ClosureUse{{Name: "y"}}, ir.NewAdd(x, y)),
+			false,
+			"function ($x) use ($y) {\n  return $x + $y;\n}",
+		},
+		{
+			ir.NewArrowClosure(&ir.FuncType{Params: paramX, Result: intType}, nil, x),
+			true,
+			"fn ($x): int => $x",
+		},
+		{
+			ir.NewCall(ir.NewName("array_map"), ir.NewArrowClosure(&ir.FuncType{Params: paramX}, nil, x), arr),
+			true,
+			"array_map(fn ($x) => $x, $arr)",
+		},
+		{
+			ir.NewNullCoalesce(y, ir.NewArrowClosure(&ir.FuncType{}, nil, x)),
+			true,
+			"$y ?? (fn () => $x)",
+		},
+		{
+			// Not arrow-eligible.
+			ir.NewClosure(&ir.FuncType{}, nil, ir.NewBlock(ir.NewReturn(x))),
+			true,
+			"function () {\n  return $x;\n}",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintNode(&buf, test.n, &Config{ArrowFunctions: test.arrow})
+			have := buf.String()
+			if have != test.want {
+				t.Fatalf("print arrow function:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintParamTypeHints(t *testing.T) {
+	newDecl := func() *ir.RootFuncDecl {
+		return &ir.RootFuncDecl{
+			Type: &ir.FuncType{
+				Name: "f",
+				Params: []ir.TypeField{
+					{Name: "b", Type: ir.BoolType},
+					{Name: "i", Type: ir.IntType},
+					{Name: "f", Type: ir.FloatType},
+					{Name: "s", Type: ir.StringType},
+					{Name: "a", Type: &ir.ArrayType{Elem: ir.IntType}},
+					{Name: "t", Type: &ir.TupleType{Elems: []ir.Type{ir.IntType}}},
+					{Name: "e", Type: &ir.EnumType{ValueType: ir.StringType}},
+					{Name: "m", Type: ir.MixedType},
+				},
+				Result: ir.VoidType,
+			},
+			Body: ir.NewBlock(),
+		}
+	}
+
+	tests := []struct {
+		config *Config
+		want   string
+	}{
+		{
+			&Config{},
+			"function f($b, $i, $f, $s, $a, $t, $e, $m) {\n}\n\n",
+		},
+		{
+			&Config{ParamTypeHints: true},
+			"function f(bool $b, int $i, float $f, string $s, array $a, $t, string $e, $m) {\n}\n\n",
+		},
+		{
+			&Config{Rand: rand.New(rand.NewSource(1))},
+			"function f($b, $i, $f, $s, $a, $t, $e, $m) {\n}\n\n",
+		},
+		{
+			&Config{Rand: rand.New(rand.NewSource(1)), ParamTypeHintProbability: 1},
+			"function f(bool $b, int $i, float $f, string $s, array $a, $t, string $e, $m) {\n}\n\n",
+		},
+		{
+			&Config{Rand: rand.New(rand.NewSource(1)), ParamTypeHintProbability: 0.5},
+			"function f($b, $i, $f, string $s, array $a, $t, $e, $m) {\n}\n\n",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintRootNode(&buf, newDecl(), test.config)
+			have := buf.String()
+			if have != test.want {
+				t.Fatalf("print func decl:\nhave: %q\nwant: %q", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintNullable(t *testing.T) {
+	nullableInt := &ir.NullableType{X: ir.IntType}
+	x := ir.NewVar("x", nullableInt)
+
+	decl := &ir.RootFuncDecl{
+		Type: &ir.FuncType{
+			Name:   "f",
+			Params: []ir.TypeField{{Name: "x", Type: nullableInt}},
+			Result: ir.IntType,
+		},
+		Body: ir.NewBlock(ir.NewReturn(ir.NewNullCoalesce(x, ir.NewIntLit(0)))),
+	}
+	call := &ir.RootStmt{X: ir.NewEcho(ir.NewCall(ir.NewName("f"), ir.NewName("null")))}
+
+	var buf bytes.Buffer
+	config := &Config{ParamTypeHints: true}
+	FprintRootNode(&buf, decl, config)
+	FprintRootNode(&buf, call, config)
+	want := `function f(?int $x) {
+  return $x ?? 0;
+}
+
+echo f(null);
+`
+	if have := buf.String(); have != want {
+		t.Fatalf("print nullable:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	cast := &ir.Node{Op: ir.OpCast, Type: nullableInt, Args: []*ir.Node{ir.NewStringLit("1")}}
+	if have := SprintNode(cast); have != `(int)'1'` {
+		t.Fatalf("print nullable cast: have %q", have)
+	}
+
+	if s := nullableInt.String(); s != "?int" {
+		t.Fatalf("nullable type string: have %q", s)
+	}
+	if hint := typeHint(&ir.NullableType{X: ir.MixedType}); hint != "" {
+		t.Fatalf("?mixed type hint is printed: %q", hint)
+	}
+}
+
+func TestPrintUnionTypeHints(t *testing.T) {
+	union := func(types ...ir.Type) *ir.UnionType {
+		return &ir.UnionType{Types: types}
+	}
+
+	tests := []struct {
+		typ  ir.Type
+		want string
+	}{
+		{union(ir.IntType, ir.StringType), "int|string"},
+		{union(ir.IntType, ir.StringType, ir.IntType), "int|string"},
+		{union(ir.IntType, ir.NullType), "?int"},
+		{union(ir.NullType, ir.FloatType), "?float"},
+		{union(ir.IntType, ir.IntType, ir.NullType), "?int"},
+		{union(ir.IntType, ir.StringType, ir.NullType), "int|string|null"},
+		{union(&ir.NullableType{X: ir.IntType}, ir.StringType), "int|null|string"},
+		{union(&ir.ArrayType{Elem: ir.IntType}, ir.BoolType), "array|bool"},
+		{union(ir.IntType, ir.MixedType), ""},
+		{union(ir.IntType, &ir.TupleType{Elems: []ir.Type{ir.IntType}}), ""},
+		{union(ir.IntType), "int"},
+		{union(ir.NullType), ""},
+		{union(), ""},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			decl := &ir.RootFuncDecl{
+				Type: &ir.FuncType{
+					Name:   "f",
+					Params: []ir.TypeField{{Name: "x", Type: test.typ}},
+					Result: test.typ,
+				},
+				Body: ir.NewBlock(),
+			}
+			want := "function f($x) {\n}\n\n"
+			if test.want != "" {
+				want = "function f(" + test.want + " $x): " + test.want + " {\n}\n\n"
+			}
+			var buf bytes.Buffer
+			FprintRootNode(&buf, decl, &Config{ParamTypeHints: true, ReturnTypeHints: true})
+			if have := buf.String(); have != want {
+				t.Fatalf("print %s type:\nhave: %q\nwant: %q", test.typ, have, want)
+			}
+		})
+	}
+
+	if s := union(ir.IntType, ir.StringType).String(); s != "int|string" {
+		t.Fatalf("union type string: have %q", s)
+	}
+	if hint := typeHint(union(&ir.ObjectType{}, ir.NullType)); hint != "?object" {
+		t.Fatalf("?object type hint: have %q", hint)
+	}
+	if hint := paramTypeHint(&ir.ObjectType{}); hint != "" {
+		t.Fatalf("object param type hint is printed: %q", hint)
+	}
+}
+
+func TestPrintDeclare(t *testing.T) {
+	var buf bytes.Buffer
+	n := &ir.RootDeclare{Name: "strict_types", Value: ir.NewIntLit(1)}
+	FprintRootNode(&buf, n, &Config{})
+	if have := buf.String(); have != "declare(strict_types=1);\n" {
+		t.Fatalf("print declare: have %q", have)
+	}
+}
+
+func TestPrintNamespace(t *testing.T) {
+	var buf bytes.Buffer
+	config := &Config{}
+	FprintRootNode(&buf, &ir.RootNamespace{Name: `Foo\Bar`}, config)
+	FprintRootNode(&buf, &ir.RootStmt{X: ir.NewCall(ir.NewFullyQualifiedName("strlen"), ir.NewStringLit("x"))}, config)
+	FprintRootNode(&buf, &ir.RootStmt{X: ir.NewCall(ir.NewName("strlen"), ir.NewStringLit("x"))}, config)
+	want := "namespace Foo\\Bar;\n\\strlen('x');\nstrlen('x');\n"
+	if have := buf.String(); have != want {
+		t.Fatalf("print namespace:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestPrintClassDecl(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	stringType := &ir.ScalarType{Kind: ir.ScalarString}
+	this := ir.NewVar("this", nil)
+	name := ir.NewVar("name", stringType)
+
+	decl := &ir.RootClassDecl{
+		Name: "Counter",
+		Consts: []*ir.ClassConst{
+			{Name: "STEP", Value: ir.NewIntLit(1)},
+			{Name: "LIMIT", Visibility: ir.VisibilityPrivate, Value: ir.NewIntLit(10)},
+		},
+		Props: []*ir.ClassProp{
+			{
+				Name:       "count",
+				Type:       intType,
+				Visibility: ir.VisibilityPublic,
+				Static:     true,
+				Default:    ir.NewIntLit(0),
+			},
+			{
+				Name:       "name",
+				Visibility: ir.VisibilityProtected,
+				Tags:       []phpdoc.Tag{&phpdoc.VarTag{Type: "string"}},
+			},
+			{Name: "step", Type: intType},
+			{Name: "total", Static: true},
+		},
+		Methods: []*ir.ClassMethod{
+			{
+				Visibility: ir.VisibilityPublic,
+				Func: &ir.RootFuncDecl{
+					Type: &ir.FuncType{
+						Name:   "__construct",
+						Params: []ir.TypeField{{Name: "name", Type: stringType}},
+					},
+					Tags: []phpdoc.Tag{&phpdoc.ParamTag{Type: "string", VarName: "$name"}},
+					Body: ir.NewBlock(ir.NewAssign(ir.NewProp(this, "name"), name)),
+				},
+			},
+			{
+				Visibility: ir.VisibilityPrivate,
+				Static:     true,
+				Func: &ir.RootFuncDecl{
+					Type: &ir.FuncType{Name: "next", Result: intType},
+					Body: ir.NewBlock(ir.NewReturn(ir.NewIntLit(1))),
+				},
+			},
+		},
+	}
+
+	want := `class Counter {
+  const STEP = 1;
+  private const LIMIT = 10;
+
+  public static int $count = 0;
+  /**
+   * @var string
+   */
+  protected $name;
+  public int $step;
+  static $total;
+
+  /**
+   * @param string $name
+   */
+  public function __construct($name) {
+    $this->name = $name;
+  }
+
+  private static function next(): int {
+    return 1;
+  }
+}
+`
+	var buf bytes.Buffer
+	FprintRootNode(&buf, decl, &Config{ReturnTypeHints: true})
+	if have := buf.String(); have != want {
+		t.Fatalf("print class:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintInterfaceDecl(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+
+	iface := &ir.RootInterfaceDecl{
+		Name:    "Shape",
+		Extends: []string{"Countable", "Stringable"},
+		Consts:  []*ir.ClassConst{{Name: "SIDES", Visibility: ir.VisibilityPublic, Value: ir.NewIntLit(0)}},
+		Methods: []*ir.ClassMethod{
+			{
+				Visibility: ir.VisibilityPublic,
+				Func:       &ir.RootFuncDecl{Type: &ir.FuncType{Name: "area", Result: intType}},
+			},
+			{
+				Visibility: ir.VisibilityPublic,
+				Static:     true,
+				Func: &ir.RootFuncDecl{
+					Type: &ir.FuncType{Name: "make", Params: []ir.TypeField{{Name: "n", Type: intType}}},
+				},
+			},
+		},
+	}
+	class := &ir.RootClassDecl{
+		Name:       "Square",
+		Abstract:   true,
+		Extends:    "Base",
+		Implements: []string{"Shape", "JsonSerializable"},
+		Methods: []*ir.ClassMethod{
+			{
+				Visibility: ir.VisibilityProtected,
+				Abstract:   true,
+				Func:       &ir.RootFuncDecl{Type: &ir.FuncType{Name: "side", Result: intType}},
+			},
+			{
+				Visibility: ir.VisibilityPublic,
+				Func: &ir.RootFuncDecl{
+					Type: &ir.FuncType{Name: "area", Result: intType},
+					Body: ir.NewBlock(ir.NewReturn(ir.NewIntLit(4))),
+				},
+			},
+		},
+	}
+
+	want := `interface Shape extends Countable, Stringable {
+  public const SIDES = 0;
+
+  public function area(): int;
+
+  public static function make($n);
+}
+abstract class Square extends Base implements Shape, JsonSerializable {
+  abstract protected function side(): int;
+
+  public function area(): int {
+    return 4;
+  }
+}
+`
+	var buf bytes.Buffer
+	config := &Config{ReturnTypeHints: true}
+	FprintRootNode(&buf, iface, config)
+	FprintRootNode(&buf, class, config)
+	if have := buf.String(); have != want {
+		t.Fatalf("print interface:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintTraitDecl(t *testing.T) {
+	stringType := &ir.ScalarType{Kind: ir.ScalarString}
+	hello := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "hello", Result: stringType},
+		Body: ir.NewBlock(ir.NewReturn(ir.NewStringLit("hello"))),
+	}
+
+	trait := &ir.RootTraitDecl{
+		Name: "Greeter",
+		Uses: []*ir.TraitUse{{Traits: []string{"Logger"}}},
+		Props: []*ir.ClassProp{
+			{Name: "greeting", Type: stringType, Visibility: ir.VisibilityPrivate, Default: ir.NewStringLit("hi")},
+		},
+		Methods: []*ir.ClassMethod{{Visibility: ir.VisibilityPublic, Func: hello}},
+	}
+	class := &ir.RootClassDecl{
+		Name: "Person",
+		Uses: []*ir.TraitUse{
+			{
+				Traits: []string{"Greeter", "Polite"},
+				Rules: []ir.TraitRule{
+					{Trait: "Greeter", Method: "hello", Insteadof: []string{"Polite"}},
+					{Trait: "Polite", Method: "hello", Alias: "politeHello"},
+					{Method: "bye", Visibility: ir.VisibilityProtected},
+				},
+			},
+			{Traits: []string{"Counter"}},
+		},
+		Consts: []*ir.ClassConst{{Name: "KIND", Value: ir.NewStringLit("person")}},
+	}
+
+	want := `trait Greeter {
+  use Logger;
+
+  private string $greeting = 'hi';
+
+  public function hello(): string {
+    return 'hello';
+  }
+}
+class Person {
+  use Greeter, Polite {
+    Greeter::hello insteadof Polite;
+    Polite::hello as politeHello;
+    bye as protected;
+  }
+  use Counter;
+
+  const KIND = 'person';
+}
+`
+	var buf bytes.Buffer
+	config := &Config{ReturnTypeHints: true}
+	FprintRootNode(&buf, trait, config)
+	FprintRootNode(&buf, class, config)
+	if have := buf.String(); have != want {
+		t.Fatalf("print trait:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintEnumDecl(t *testing.T) {
+	stringType := &ir.ScalarType{Kind: ir.ScalarString}
+	pure := &ir.RootEnumDecl{
+		Name:  "Status",
+		Cases: []*ir.EnumCase{{Name: "Active"}, {Name: "Inactive"}},
+	}
+	backed := &ir.RootEnumDecl{
+		Name:        "Suit",
+		BackingType: stringType,
+		Implements:  []string{"HasLabel"},
+		Cases: []*ir.EnumCase{
+			{Name: "Hearts", Value: ir.NewStringLit("H")},
+			{Name: "Spades", Value: ir.NewStringLit("S")},
+		},
+		Consts: []*ir.ClassConst{{Name: "Wild", Value: ir.NewClassConst(ir.NewName("self"), "Spades")}},
+		Methods: []*ir.ClassMethod{
+			{
+				Visibility: ir.VisibilityPublic,
+				Func: &ir.RootFuncDecl{
+					Type: &ir.FuncType{Name: "label", Result: stringType},
+					Body: ir.NewBlock(ir.NewReturn(ir.NewProp(ir.NewVar("this", nil), "name"))),
+				},
+			},
+		},
+	}
+	stmt := &ir.RootStmt{X: ir.NewEcho(ir.NewProp(ir.NewClassConst(ir.NewName("Suit"), "Hearts"), "value"))}
+
+	want := `enum Status {
+  case Active;
+  case Inactive;
+}
+enum Suit: string implements HasLabel {
+  case Hearts = 'H';
+  case Spades = 'S';
+
+  const Wild = self::Spades;
+
+  public function label(): string {
+    return $this->name;
+  }
+}
+echo Suit::Hearts->value;
+`
+	var buf bytes.Buffer
+	config := &Config{ReturnTypeHints: true}
+	FprintRootNode(&buf, pure, config)
+	FprintRootNode(&buf, backed, config)
+	FprintRootNode(&buf, stmt, config)
+	if have := buf.String(); have != want {
+		t.Fatalf("print enum:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintConstDecl(t *testing.T) {
+	decl := &ir.RootConstDecl{Name: "LIMIT", Value: ir.NewAdd(ir.NewIntLit(10), ir.NewIntLit(5))}
+	fetch := &ir.RootStmt{X: ir.NewEcho(ir.NewConcat(ir.NewConstFetch("LIMIT"), ir.NewStringLit("\n")))}
+
+	tests := []struct {
+		define bool
+		want   string
+	}{
+		{false, "const LIMIT = 10 + 5;\necho LIMIT . \"\\n\";\n"},
+		{true, "define('LIMIT', 10 + 5);\necho LIMIT . \"\\n\";\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		config := &Config{DefineConsts: test.define}
+		FprintRootNode(&buf, decl, config)
+		FprintRootNode(&buf, fetch, config)
+		if have := buf.String(); have != test.want {
+			t.Errorf("print const (define=%v):\nhave: %q\nwant: %q", test.define, have, test.want)
+		}
+	}
+}
+
+func TestReservedConstName(t *testing.T) {
+	for _, name := range []string{"class", "NULL", "__LINE__", "Fn"} {
+		if !ir.IsReservedName(name) {
+			t.Errorf("%s is not reported as reserved", name)
+		}
+	}
+	if ir.IsReservedName("LIMIT") {
+		t.Errorf("LIMIT is reported as reserved")
+	}
+}
+
+func TestPrintStaticVar(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	a := ir.NewVar("a", intType)
+	b := ir.NewVar("b", intType)
+	c := ir.NewVar("c", intType)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewStaticVar(ir.NewAssign(a, ir.NewIntLit(0))),
+			"static $a = 0;",
+		},
+		{
+			ir.NewStaticVar(ir.NewAssign(a, ir.NewIntLit(1)), ir.NewAssign(b, ir.NewIntLit(2)), c),
+			"static $a = 1, $b = 2, $c;",
+		},
+		{
+			ir.NewStaticVar(ir.NewAssign(a, ir.NewMul(ir.NewConstFetch("LIMIT"), ir.NewNegation(ir.NewIntLit(2))))),
+			"static $a = LIMIT * -2;",
+		},
+		{
+			ir.NewStaticVar(ir.NewAssign(a, ir.NewConcat(ir.NewStringLit("x"), ir.NewClassConst(ir.NewName("Foo"), "BAR")))),
+			"static $a = 'x' . Foo::BAR;",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintRootNode(&buf, &ir.RootStmt{X: test.n}, &Config{})
+			have := strings.TrimSuffix(buf.String(), "\n")
+			if have != test.want {
+				t.Fatalf("print static:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestStaticVarNonConstInit(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	a := ir.NewVar("a", intType)
+	inits := []*ir.Node{
+		ir.NewVar("b", intType),
+		ir.NewCall(ir.NewName("f")),
+		ir.NewAdd(ir.NewIntLit(1), ir.NewVar("b", intType)),
+		ir.NewFloatLit(math.NaN()),
+	}
+	for _, init := range inits {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s initializer is accepted", init.Op)
+				}
+			}()
+			ir.NewStaticVar(ir.NewAssign(a, init))
+		}()
+	}
+}
+
+func TestPrintGlobal(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	x := ir.NewVar("x", intType)
+	y := ir.NewVar("y", intType)
+
+	fn := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "bump"},
+		Body: ir.NewBlock(
+			ir.NewGlobal(x, y),
+			ir.NewAssignModify(ir.OpAdd, x, y),
+			ir.NewAssign(ir.NewGlobalsIndex("y", intType), ir.NewIntLit(0)),
+		),
+	}
+
+	want := `$x = 1;
+function bump() {
+  global $x, $y;
+  $x += $y;
+  $GLOBALS['y'] = 0;
+}
+
+`
+	var buf bytes.Buffer
+	config := &Config{}
+	FprintRootNode(&buf, &ir.RootStmt{X: ir.NewAssign(x, ir.NewIntLit(1))}, config)
+	FprintRootNode(&buf, fn, config)
+	if have := buf.String(); have != want {
+		t.Fatalf("print global:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintUnsetIssetEmpty(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	a := ir.NewVar("a", intType)
+	b := ir.NewVar("b", &ir.ArrayType{Elem: intType})
+	x := ir.NewVar("x", nil)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewUnset(a, ir.NewIndex(b, ir.NewIntLit(0))), "unset($a, $b[0]);"},
+		{ir.NewUnset(ir.NewProp(x, "y")), "unset($x->y);"},
+		{ir.NewEcho(ir.NewIsset(x)), "echo isset($x);"},
+		{ir.NewEcho(ir.NewIsset(x, ir.NewIndex(ir.NewCall(ir.NewName("f")), ir.NewStringLit("k")))), "echo isset($x, f()['k']);"},
+		{ir.NewEcho(ir.NewNot(ir.NewEmpty(ir.NewIndex(b, ir.NewIntLit(3))))), "echo !empty($b[3]);"},
+		{ir.NewEcho(ir.NewEmpty(ir.NewAdd(a, ir.NewIntLit(1)))), "echo empty($a + 1);"},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintRootNode(&buf, &ir.RootStmt{X: test.n}, &Config{})
+			have := strings.TrimSuffix(buf.String(), "\n")
+			if have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestUnsetIssetArgs(t *testing.T) {
+	a := ir.NewVar("a", nil)
+	call := ir.NewCall(ir.NewName("f"))
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"unset of call", func() { ir.NewUnset(call) }},
+		{"unset of call element", func() { ir.NewUnset(ir.NewIndex(call, ir.NewIntLit(0))) }},
+		{"unset of literal", func() { ir.NewUnset(ir.NewIntLit(1)) }},
+		{"isset of call", func() { ir.NewIsset(call) }},
+		{"isset of expression", func() { ir.NewIsset(ir.NewAdd(a, a)) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s is accepted", test.name)
+				}
+			}()
+			test.fn()
+		}()
+	}
+}
+
+func TestPrintAttributes(t *testing.T) {
+	attrs := []ir.Attribute{
+		{Name: "Pure"},
+		{Name: "Deprecated", Args: []*ir.Node{ir.NewIntLit(1), ir.NewStringLit("x")}},
+	}
+	fn := &ir.RootFuncDecl{
+		Type:       &ir.FuncType{Name: "f"},
+		Tags:       []phpdoc.Tag{&phpdoc.ReturnTag{Type: "void"}},
+		Attributes: attrs,
+		Body:       ir.NewBlock(),
+	}
+	class := &ir.RootClassDecl{
+		Name:       "C",
+		Attributes: attrs[:1],
+		Methods: []*ir.ClassMethod{
+			{
+				Visibility: ir.VisibilityPublic,
+				Func:       &ir.RootFuncDecl{Type: &ir.FuncType{Name: "m"}, Attributes: attrs, Body: ir.NewBlock()},
+			},
+		},
+	}
+
+	tests := []struct {
+		grouped bool
+		want    string
+	}{
+		{
+			false,
+			`/**
+ * @return void
+ */
+#[Pure]
+#[Deprecated(1, 'x')]
+function f() {
+}
+
+#[Pure]
+class C {
+  #[Pure]
+  #[Deprecated(1, 'x')]
+  public function m() {
+  }
+}
+`,
+		},
+		{
+			true,
+			`/**
+ * @return void
+ */
+#[Pure, Deprecated(1, 'x')]
+function f() {
+}
+
+#[Pure]
+class C {
+  #[Pure, Deprecated(1, 'x')]
+  public function m() {
+  }
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		config := &Config{GroupedAttributes: test.grouped}
+		FprintRootNode(&buf, fn, config)
+		FprintRootNode(&buf, class, config)
+		if have := buf.String(); have != test.want {
+			t.Errorf("print attributes (grouped=%v):\nhave:\n%s\nwant:\n%s", test.grouped, have, test.want)
+		}
+	}
+}
+
+func TestPrintRandomIntLit(t *testing.T) {
+	values := []int64{0, 1, 7, 8, 255, 1000000, -15, math.MaxInt64}
+
+	tests := []struct {
+		version    int
+		separators bool
+		octal0o    bool
+	}{
+		{0, false, false},
+		{70400, true, false},
+		{80100, true, true},
+	}
+
+	for _, test := range tests {
+		config := &Config{Rand: rand.New(rand.NewSource(1)), MinPHPVersion: test.version}
+		var haveSeparators, have0o bool
+		for i := 0; i < 100; i++ {
+			for _, v := range values {
+				var buf bytes.Buffer
+				FprintNode(&buf, ir.NewIntLit(v), config)
+				lit := buf.String()
+				haveSeparators = haveSeparators || strings.Contains(lit, "_")
+				have0o = have0o || strings.Contains(strings.ToLower(lit), "0o")
+				// Go integer literal syntax is compatible with PHP's one.
+				parsed, err := strconv.ParseInt(lit, 0, 64)
+				if err != nil || parsed != v {
+					t.Fatalf("version %d: %d is printed as %s", test.version, v, lit)
+				}
+			}
+		}
+		if haveSeparators != test.separators {
+			t.Errorf("version %d: separators=%v, expected %v", test.version, haveSeparators, test.separators)
+		}
+		if have0o != test.octal0o {
+			t.Errorf("version %d: 0o=%v, expected %v", test.version, have0o, test.octal0o)
+		}
+	}
+}
+
+func TestPrintFloatLit(t *testing.T) {
+	negativeZero := math.Copysign(0, -1)
+
+	tests := []struct {
+		v        float64
+		want     string
+		exponent string
+	}{
+		{0, "0.0", "0e+00"},
+		{negativeZero, "-0.0", "-0e+00"},
+		{100, "100.0", "1e+02"},
+		{-1.5, "-1.5", "-1.5e+00"},
+		{1.5e-7, "1.5e-07", "1.5e-07"},
+		{1e308, "1e+308", "1e+308"},
+		{5e-324, "5e-324", "5e-324"},
+		{0.30000000000000004, "0.30000000000000004", "3.0000000000000004e-01"},
+		{math.MaxFloat64, "1.7976931348623157e+308", "1.7976931348623157e+308"},
+	}
+
+	for _, test := range tests {
+		have := SprintNode(ir.NewFloatLit(test.v))
+		if have != test.want {
+			t.Errorf("print %v:\nhave: %s\nwant: %s", test.v, have, test.want)
+		}
+		var buf bytes.Buffer
+		FprintNode(&buf, ir.NewFloatLit(test.v), &Config{ExponentFloats: true})
+		if have := buf.String(); have != test.exponent {
+			t.Errorf("print %v with exponent:\nhave: %s\nwant: %s", test.v, have, test.exponent)
+		}
+	}
+
+	config := &Config{Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 10; i++ {
+		for _, test := range tests {
+			var buf bytes.Buffer
+			FprintNode(&buf, ir.NewFloatLit(test.v), config)
+			lit := buf.String()
+			parsed, err := strconv.ParseFloat(lit, 64)
+			if err != nil || parsed != test.v || math.Signbit(parsed) != math.Signbit(test.v) {
+				t.Fatalf("%v is printed as %s", test.v, lit)
+			}
+			if !strings.ContainsAny(lit, ".e") {
+				t.Fatalf("%v is printed as int literal %s", test.v, lit)
+			}
+		}
+	}
+
+	if have := SprintNode(ir.NewNegation(ir.NewFloatLit(negativeZero))); have != "-(-0.0)" {
+		t.Errorf("print negated -0.0: have %s", have)
+	}
+}
+
+func TestPrintIntMin(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	x := ir.NewVar("x", intType)
+	arr := ir.NewVar("arr", &ir.ArrayType{Elem: intType})
+	intMin := ir.NewIntLit(math.MinInt64)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{intMin, `PHP_INT_MIN`},
+		{ir.NewIntLit(math.MinInt64 + 1), `-9223372036854775807`},
+		{ir.NewNegation(intMin), `-PHP_INT_MIN`},
+		{ir.NewSub(x, intMin), `$x - PHP_INT_MIN`},
+		{ir.NewExp(intMin, x), `PHP_INT_MIN ** $x`},
+		{ir.NewExp(ir.NewIntLit(-3), x), `(-3) ** $x`},
+		{ir.NewExp(x, ir.NewIntLit(-3)), `$x ** (-3)`},
+		{ir.NewIndex(arr, ir.NewIntLit(-1)), `$arr[-1]`},
+		{ir.NewIndex(arr, intMin), `$arr[PHP_INT_MIN]`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+
+	// The random spelling should not affect PHP_INT_MIN.
+	var buf bytes.Buffer
+	FprintNode(&buf, intMin, &Config{Rand: rand.New(rand.NewSource(1)), MinPHPVersion: 80100})
+	if have := buf.String(); have != "PHP_INT_MIN" {
+		t.Fatalf("random print of min int: have %s", have)
+	}
+}
+
+func TestPrintCurlyIndex(t *testing.T) {
+	s := ir.NewVar("s", nil)
+	curly := func(x, key *ir.Node) *ir.Node {
+		return &ir.Node{Op: ir.OpIndex, Args: []*ir.Node{x, key}, Value: true}
+	}
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{curly(s, ir.NewIntLit(0)), `$s{0}`},
+		{curly(s, ir.NewAdd(s, ir.NewIntLit(1))), `$s{$s + 1}`},
+		{&ir.Node{Op: ir.OpIndex, Args: []*ir.Node{s, ir.NewIntLit(0)}, Value: false}, `$s[0]`},
+		{ir.NewInterpolatedString(ir.NewStringLit("a"), curly(s, ir.NewIntLit(0))), `"a{$s{0}}"`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintIndentStyle(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	x := ir.NewVar("x", intType)
+
+	switchNode := &ir.Node{
+		Op: ir.OpSwitch,
+		Args: []*ir.Node{
+			x,
+			{Op: ir.OpCase, Args: []*ir.Node{ir.NewIntLit(1), ir.NewEcho(ir.NewStringLit("one")), ir.NewBreak(0)}},
+			{Op: ir.OpDefaultCase, Args: []*ir.Node{ir.NewEcho(ir.NewStringLit("other"))}},
+		},
+	}
+	fn := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "f", Params: []ir.TypeField{{Name: "x", Type: intType}}},
+		Body: ir.NewBlock(
+			ir.NewIfElse(ir.NewLess(x, ir.NewIntLit(0)), ir.NewReturnVoid(), ir.NewPostInc(x)),
+			ir.NewWhile(x, ir.NewBlock(ir.NewPostDec(x))),
+			switchNode,
+		),
+	}
+	class := &ir.RootClassDecl{
+		Name: "C",
+		Methods: []*ir.ClassMethod{
+			{Visibility: ir.VisibilityPublic, Func: &ir.RootFuncDecl{Type: &ir.FuncType{Name: "m"}, Body: ir.NewBlock(ir.NewEcho(x))}},
+		},
+	}
+
+	want := "function f($x)\n" +
+		"{\n" +
+		"\tif ($x < 0)\n" +
+		"\t{\n" +
+		"\t\treturn;\n" +
+		"\t}\n" +
+		"\telse $x++;\n" +
+		"\twhile ($x)\n" +
+		"\t{\n" +
+		"\t\t$x--;\n" +
+		"\t}\n" +
+		"\tswitch ($x)\n" +
+		"\t{\n" +
+		"\tcase 1:\n" +
+		"\t\techo 'one';\n" +
+		"\t\tbreak;\n" +
+		"\tdefault:\n" +
+		"\t\techo 'other';\n" +
+		"\t}\n" +
+		"}\n" +
+		"\n" +
+		"class C\n" +
+		"{\n" +
+		"\tpublic function m()\n" +
+		"\t{\n" +
+		"\t\techo $x;\n" +
+		"\t}\n" +
+		"}\n"
+
+	var buf bytes.Buffer
+	config := &Config{Indent: "\t", NextLineBraces: true, FlatCaseLabels: true}
+	FprintRootNode(&buf, fn, config)
+	FprintRootNode(&buf, class, config)
+	if have := buf.String(); have != want {
+		t.Fatalf("print with tabs:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	buf.Reset()
+	FprintRootNode(&buf, &ir.RootStmt{X: switchNode}, &Config{Indent: "    "})
+	want = "switch ($x) {\n" +
+		"    case 1:\n" +
+		"        echo 'one';\n" +
+		"        break;\n" +
+		"    default:\n" +
+		"        echo 'other';\n" +
+		"}\n"
+	if have := buf.String(); have != want {
+		t.Fatalf("print with 4 spaces:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintMaxLineLength(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	stringType := &ir.ScalarType{Kind: ir.ScalarString}
+	a := ir.NewVar("alpha", intType)
+	b := ir.NewVar("beta", intType)
+	c := ir.NewVar("gamma", intType)
+	s := ir.NewVar("s", stringType)
+	longString := ir.NewStringLit("a string literal that is too long to fit")
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewCall(ir.NewName("f"), a, b),
+			"f($alpha, $beta);",
+		},
+		{
+			ir.NewCall(ir.NewName("some_function"), a, b, c, ir.NewAdd(a, b)),
+			"some_function(\n  $alpha,\n  $beta,\n  $gamma,\n  $alpha + $beta\n);",
+		},
+		{
+			ir.NewCall(ir.NewName("outer"), ir.NewCall(ir.NewName("inner_function"), a, b, c), c),
+			"outer(\n  inner_function($alpha, $beta, $gamma),\n  $gamma\n);",
+		},
+		{
+			ir.NewAssign(a, ir.NewAdd(ir.NewAdd(ir.NewMul(a, b), ir.NewMul(b, c)), ir.NewMul(a, c))),
+			"$alpha = $alpha * $beta + $beta * $gamma\n  + $alpha * $gamma;",
+		},
+		{
+			ir.NewAssign(s, ir.NewConcat(s, longString)),
+			"$s = $s\n  . 'a string literal that is too long to fit';",
+		},
+		{
+			ir.NewEcho(ir.NewMul(ir.NewAdd(a, b), ir.NewAdd(ir.NewAdd(a, b), ir.NewAdd(c, c)))),
+			"echo ($alpha + $beta)\n  * ($alpha + $beta + ($gamma + $gamma));",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintRootNode(&buf, &ir.RootStmt{X: test.n}, &Config{MaxLineLength: 40})
+			have := strings.TrimSuffix(buf.String(), "\n")
+			if have != test.want {
+				t.Fatalf("print:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintComments(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	a := ir.NewVar("a", intType)
+	b := ir.NewVar("b", intType)
+
+	fn := &ir.RootFuncDecl{
+		Type:       &ir.FuncType{Name: "f"},
+		Attributes: []ir.Attribute{{Name: "A", Args: []*ir.Node{ir.NewAdd(ir.NewConstFetch("X"), ir.NewConstFetch("Y"))}}},
+		Body: ir.NewBlock(
+			ir.NewAssign(a, ir.NewAdd(ir.NewMul(a, b), b)),
+			ir.NewIf(ir.NewLess(a, b), ir.NewBlock(ir.NewEcho(ir.NewConcat(a, b)))),
+			ir.NewReturn(ir.NewSub(a, ir.NewNegation(b))),
+		),
+	}
+
+	// stripComments removes comments from the code that has no string literals.
+	stripComments := func(s string) string {
+		var out strings.Builder
+		for i := 0; i < len(s); i++ {
+			switch {
+			case strings.HasPrefix(s[i:], "/*"):
+				i += strings.Index(s[i:], "*/") + 1
+			case strings.HasPrefix(s[i:], "//"), strings.HasPrefix(s[i:], "# "):
+				i += strings.IndexByte(s[i:], '\n') - 1
+			default:
+				out.WriteByte(s[i])
+			}
+		}
+		return strings.Join(strings.Fields(out.String()), " ")
+	}
+
+	var plain bytes.Buffer
+	FprintRootNode(&plain, fn, &Config{})
+	want := strings.Join(strings.Fields(plain.String()), " ")
+
+	for seed := int64(0); seed < 20; seed++ {
+		var buf bytes.Buffer
+		config := &Config{
+			Rand:               rand.New(rand.NewSource(seed)),
+			CommentProbability: 0.7,
+			GroupedAttributes:  true,
+		}
+		FprintRootNode(&buf, fn, config)
+		have := buf.String()
+		if strings.Contains(have, "?>") {
+			t.Fatalf("seed %d: ?> is printed without DangerousComments:\n%s", seed, have)
+		}
+		attrLine := have[strings.Index(have, "#["):]
+		attrLine = attrLine[:strings.IndexByte(attrLine, '\n')]
+		if !strings.HasSuffix(attrLine, ")]") {
+			t.Fatalf("seed %d: attribute is split:\n%s", seed, have)
+		}
+		if stripped := stripComments(have); stripped != want {
+			t.Fatalf("seed %d: comments changed the code:\nhave: %s\nwant: %s\n%s", seed, stripped, want, have)
+		}
+	}
+}
+
+func TestPrintNamedArgs(t *testing.T) {
+	x := ir.NewVar("x", &ir.ScalarType{Kind: ir.ScalarInt})
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewCall(ir.NewName("foo"), ir.NewNamedArg("limit", ir.NewIntLit(10)), ir.NewNamedArg("name", ir.NewStringLit("x"))),
+			`foo(limit: 10, name: 'x')`,
+		},
+		{
+			ir.NewCall(ir.NewName("str_pad"), x, ir.NewIntLit(5), ir.NewNamedArg("pad_type", ir.NewConstFetch("STR_PAD_LEFT"))),
+			`str_pad($x, 5, pad_type: STR_PAD_LEFT)`,
+		},
+		{
+			ir.NewCall(ir.NewName("f"), ir.NewNamedArg("array", ir.NewAdd(x, x))),
+			`f(array: $x + $x)`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("positional argument after named argument is accepted")
+		}
+	}()
+	ir.NewCall(ir.NewName("f"), ir.NewNamedArg("a", x), x)
+}
+
+func TestPrintSpread(t *testing.T) {
+	intArray := &ir.ArrayType{Elem: &ir.ScalarType{Kind: ir.ScalarInt}}
+	args := ir.NewVar("args", intArray)
+	rest := ir.NewVar("rest", intArray)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{
+			ir.NewCall(ir.NewName("max"), ir.NewSpread(args)),
+			`max(...$args)`,
+		},
+		{
+			ir.NewCall(ir.NewName("f"), ir.NewIntLit(1), ir.NewSpread(args), ir.NewSpread(rest), ir.NewNamedArg("x", ir.NewIntLit(2))),
+			`f(1, ...$args, ...$rest, x: 2)`,
+		},
+		{
+			ir.NewCall(ir.NewName("f"), ir.NewSpread(ir.NewCall(ir.NewName("g")))),
+			`f(...g())`,
+		},
+		{
+			&ir.Node{Op: ir.OpArrayLit, Args: []*ir.Node{ir.NewIntLit(1), ir.NewSpread(rest), ir.NewIntLit(2)}},
+			"[\n  1,\n  ...$rest,\n  2,\n]",
+		},
+		{
+			&ir.Node{Op: ir.OpArrayLit, Args: []*ir.Node{
+				ir.NewKeyedElem(ir.NewStringLit("a"), ir.NewIntLit(1)),
+				ir.NewSpread(rest),
+			}},
+			"[\n  'a' => 1,\n  ...$rest,\n]",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintNode(&buf, test.n, &Config{ShortArraySyntax: true})
+			if have := buf.String(); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+
+	invalid := [][]*ir.Node{
+		{ir.NewSpread(args), ir.NewIntLit(1)},
+		{ir.NewNamedArg("x", ir.NewIntLit(1)), ir.NewSpread(args)},
+	}
+	for _, callArgs := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("invalid argument order is accepted")
+				}
+			}()
+			ir.NewCall(ir.NewName("f"), callArgs...)
+		}()
+	}
+}
+
+func TestPrintParamFlags(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+
+	tests := []struct {
+		param ir.TypeField
+		want  string
+	}{
+		{ir.TypeField{Name: "x", Type: intType}, "function f(int $x)"},
+		{ir.TypeField{Name: "x", Type: intType, ByRef: true}, "function f(int &$x)"},
+		{ir.TypeField{Name: "xs", Type: intType, Variadic: true}, "function f(int ...$xs)"},
+		{ir.TypeField{Name: "xs", Type: intType, ByRef: true, Variadic: true}, "function f(int &...$xs)"},
+		{ir.TypeField{Name: "xs", Type: ir.MixedType, ByRef: true, Variadic: true}, "function f(&...$xs)"},
+	}
+
+	for _, test := range tests {
+		decl := &ir.RootFuncDecl{
+			Type: &ir.FuncType{Name: "f", Params: []ir.TypeField{test.param}},
+			Body: ir.NewBlock(),
+		}
+		if err := decl.Type.CheckParams(); err != nil {
+			t.Fatalf("check %s: %v", test.want, err)
+		}
+		var buf bytes.Buffer
+		FprintRootNode(&buf, decl, &Config{ParamTypeHints: true})
+		have := buf.String()
+		have = have[:strings.IndexByte(have, ')')+1]
+		if have != test.want {
+			t.Errorf("print param:\nhave: %s\nwant: %s", have, test.want)
+		}
+	}
+
+	invalid := []*ir.FuncType{
+		{Name: "f", Params: []ir.TypeField{{Name: "xs", Variadic: true}, {Name: "y"}}},
+		{Name: "f", Params: []ir.TypeField{{Name: "xs", Variadic: true, Default: ir.NewIntLit(1)}}},
+	}
+	for _, typ := range invalid {
+		if typ.CheckParams() == nil {
+			t.Errorf("invalid params %v are accepted", typ.Params)
+		}
+	}
+}
+
+func TestPrintParamDefaults(t *testing.T) {
+	intType := &ir.ScalarType{Kind: ir.ScalarInt}
+	stringType := &ir.ScalarType{Kind: ir.ScalarString}
+
+	typ := &ir.FuncType{
+		Name: "f",
+		Params: []ir.TypeField{
+			{Name: "a", Type: intType},
+			{Name: "b", Type: &ir.NullableType{X: intType}, Default: ir.NewName("null")},
+			{Name: "c", Type: stringType},
+			{Name: "d", Type: intType, Default: ir.NewMul(ir.NewConstFetch("LIMIT"), ir.NewIntLit(2))},
+			{Name: "e", Type: stringType, ByRef: true, Default: ir.NewStringLit("x")},
+			{Name: "rest", Type: intType, Variadic: true},
+		},
+	}
+	if err := typ.CheckParams(); err != nil {
+		t.Fatalf("check params: %v", err)
+	}
+	var buf bytes.Buffer
+	FprintRootNode(&buf, &ir.RootFuncDecl{Type: typ, Body: ir.NewBlock()}, &Config{ParamTypeHints: true})
+	want := "function f(int $a, ?int $b = null, string $c, int $d = LIMIT * 2, string &$e = 'x', int ...$rest) {\n}\n\n"
+	if have := buf.String(); have != want {
+		t.Fatalf("print defaults:\nhave: %s\nwant: %s", have, want)
+	}
+
+	invalid := [][]ir.TypeField{
+		{{Name: "a", Default: ir.NewIntLit(1)}, {Name: "b"}},
+		{{Name: "a", Default: ir.NewVar("x", intType)}},
+		{{Name: "a", Default: ir.NewCall(ir.NewName("f"))}},
+	}
+	for _, params := range invalid {
+		typ := &ir.FuncType{Name: "f", Params: params}
+		if typ.CheckParams() == nil {
+			t.Errorf("invalid params %v are accepted", params)
+		}
+	}
+}
+
+func TestPrintMemberAccess(t *testing.T) {
+	obj := ir.NewVar("obj", nil)
+	a := ir.NewVar("a", nil)
+	name := ir.NewVar("name", &ir.ScalarType{Kind: ir.ScalarString})
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewProp(obj, "prop"), `$obj->prop`},
+		{ir.NewMethodCall(obj, "method", a), `$obj->method($a)`},
+		{ir.NewNullsafeProp(obj, "prop"), `$obj?->prop`},
+		{ir.NewNullsafeMethodCall(obj, "m"), `$obj?->m()`},
+		{
+			ir.NewNullsafeProp(ir.NewNullsafeMethodCall(ir.NewMethodCall(ir.NewNullsafeProp(a, "b"), "c"), "x"), "d"),
+			`$a?->b->c()?->x()?->d`,
+		},
+		{ir.NewDynamicProp(obj, name), `$obj->{$name}`},
+		{ir.NewNullsafeDynamicProp(obj, ir.NewConcat(name, ir.NewStringLit("_x"))), `$obj?->{$name . '_x'}`},
+		{ir.NewMethodCall(ir.NewCall(ir.NewName("make")), "run", ir.NewNamedArg("n", ir.NewIntLit(1))), `make()->run(n: 1)`},
+		{ir.NewProp(ir.NewIndex(a, ir.NewIntLit(0)), "x"), `$a[0]->x`},
+		{ir.NewIndex(ir.NewMethodCall(obj, "items"), ir.NewIntLit(0)), `$obj->items()[0]`},
+		{ir.NewProp(ir.NewParens(ir.NewNullCoalesce(a, obj)), "x"), `($a ?? $obj)->x`},
+		{ir.NewProp(ir.NewNullCoalesce(a, obj), "x"), `($a ?? $obj)->x`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintStaticAccess(t *testing.T) {
+	foo := ir.NewName("Foo")
+	obj := ir.NewVar("obj", nil)
+	x := ir.NewVar("x", nil)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewClassConst(foo, "LIMIT"), `Foo::LIMIT`},
+		{ir.NewStaticProp(foo, "count"), `Foo::$count`},
+		{ir.NewStaticCall(foo, "create", x, ir.NewIntLit(1)), `Foo::create($x, 1)`},
+		{ir.NewClassConst(ir.NewRelativeClass(ir.RelativeSelf), "A"), `self::A`},
+		{ir.NewStaticCall(ir.NewRelativeClass(ir.RelativeStatic), "make"), `static::make()`},
+		{ir.NewStaticProp(ir.NewRelativeClass(ir.RelativeParent), "cache"), `parent::$cache`},
+		{ir.NewClassConst(obj, "KIND"), `$obj::KIND`},
+		{ir.NewStaticCall(ir.NewFullyQualifiedName(`App\Foo`), "f"), `\App\Foo::f()`},
+		{ir.NewIndex(ir.NewStaticProp(foo, "items"), ir.NewIntLit(0)), `Foo::$items[0]`},
+		{ir.NewMethodCall(ir.NewStaticCall(foo, "instance"), "run"), `Foo::instance()->run()`},
+		{ir.NewClassConst(ir.NewNullCoalesce(obj, x), "KIND"), `($obj ?? $x)::KIND`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintNewCloneInstanceOf(t *testing.T) {
+	foo := ir.NewName("Foo")
+	x := ir.NewVar("x", nil)
+	class := ir.NewVar("className", nil)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewNew(foo), `new Foo()`},
+		{ir.NewNew(foo, ir.NewIntLit(1), ir.NewIntLit(2)), `new Foo(1, 2)`},
+		{ir.NewNew(class), `new $className()`},
+		{ir.NewNew(ir.NewProp(x, "class")), `new $x->class()`},
+		{ir.NewNew(ir.NewIndex(ir.NewStaticProp(foo, "classes"), ir.NewIntLit(0))), `new Foo::$classes[0]()`},
+		{ir.NewNew(ir.NewProp(ir.NewCall(ir.NewName("f")), "cls")), `new (f()->cls)()`},
+		{ir.NewNew(ir.NewIndex(ir.NewProp(ir.NewMethodCall(x, "get"), "cls"), ir.NewIntLit(0))), `new ($x->get()->cls[0])()`},
+		{ir.NewNew(ir.NewRelativeClass(ir.RelativeStatic)), `new static()`},
+		{ir.NewNew(ir.NewConcat(ir.NewStringLit("Foo"), x)), `new ('Foo' . $x)()`},
+		{ir.NewMethodCall(ir.NewNew(foo), "run"), `(new Foo())->run()`},
+		{ir.NewProp(ir.NewClone(x), "y"), `(clone $x)->y`},
+		{ir.NewClone(ir.NewProp(x, "y")), `clone $x->y`},
+		{ir.NewClone(ir.NewNullCoalesce(x, class)), `clone ($x ?? $className)`},
+		{ir.NewClone(ir.NewNew(foo)), `clone new Foo()`},
+		{ir.NewInstanceOf(x, foo), `$x instanceof Foo`},
+		{ir.NewInstanceOf(x, class), `$x instanceof $className`},
+		{ir.NewInstanceOf(x, ir.NewRelativeClass(ir.RelativeSelf)), `$x instanceof self`},
+		{ir.NewInstanceOf(x, ir.NewConcat(ir.NewStringLit("Foo"), x)), `$x instanceof ('Foo' . $x)`},
+		{ir.NewNot(ir.NewInstanceOf(x, foo)), `!$x instanceof Foo`},
+		{ir.NewInstanceOf(ir.NewNot(x), foo), `(!$x) instanceof Foo`},
+		{ir.NewInstanceOf(ir.NewAssign(x, ir.NewNew(foo)), foo), `($x = new Foo()) instanceof Foo`},
+		{ir.NewAnd(ir.NewInstanceOf(x, foo), ir.NewInstanceOf(class, foo)), `$x instanceof Foo && $className instanceof Foo`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRandomNewParens(t *testing.T) {
+	config := &Config{Rand: rand.New(rand.NewSource(1))}
+	n := ir.NewMethodCall(ir.NewNew(ir.NewName("Foo")), "run")
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		FprintNode(&buf, n, config)
+		seen[buf.String()] = true
+	}
+	for _, want := range []string{`(new Foo())->run()`, `(new Foo)->run()`} {
+		if !seen[want] {
+			t.Errorf("%s is never printed", want)
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("unexpected outputs: %v", seen)
+	}
+}
+
+func TestPrintExitAndPrint(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	msg := ir.NewStringLit("msg")
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewExit(), `exit`},
+		{ir.NewExit(ir.NewIntLit(0)), `exit(0)`},
+		{ir.NewExit(msg), `exit('msg')`},
+		{ir.NewOrWord(x, ir.NewExit(msg)), `$x or exit('msg')`},
+		{ir.NewPrint(msg), `print 'msg'`},
+		{ir.NewPrint(ir.NewConcat(msg, x)), `print 'msg' . $x`},
+		{ir.NewPrint(ir.NewAssign(x, msg)), `print $x = 'msg'`},
+		{ir.NewPrint(ir.NewAndWord(x, msg)), `print ($x and 'msg')`},
+		{ir.NewAndWord(ir.NewPrint(x), msg), `print $x and 'msg'`},
+		{ir.NewAdd(ir.NewIntLit(1), ir.NewPrint(x)), `1 + (print $x)`},
+		{ir.NewTernary(x, ir.NewPrint(msg), ir.NewPrint(x)), `$x ? print 'msg' : (print $x)`},
+		{ir.NewPrint(ir.NewTernary(x, msg, x)), `print $x ? 'msg' : $x`},
+		{ir.NewPrint(ir.NewPrint(x)), `print print $x`},
+		{ir.NewEcho(ir.NewPrint(x), msg), `echo print $x, 'msg'`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRandomExit(t *testing.T) {
+	config := &Config{Rand: rand.New(rand.NewSource(1))}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		FprintNode(&buf, ir.NewExit(ir.NewVar("status", nil)), config)
+		seen[buf.String()] = true
+		buf.Reset()
+		FprintNode(&buf, ir.NewEcho(ir.NewVar("x", nil)), config)
+		if buf.String() != "echo $x" {
+			t.Fatalf("echo is printed as %s", buf.String())
+		}
+	}
+	for _, want := range []string{`exit($status)`, `die($status)`} {
+		if !seen[want] {
+			t.Errorf("%s is never printed", want)
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("unexpected outputs: %v", seen)
+	}
+}
+
+func TestPrintAltSyntax(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	y := ir.NewVar("y", nil)
+	i := ir.NewVar("i", nil)
+	echo := func(s string) *ir.Node { return ir.NewEcho(ir.NewStringLit(s)) }
+
+	fn := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "f"},
+		Body: ir.NewBlock(
+			ir.NewIfElse(x,
+				ir.NewBlock(echo("a"), ir.NewIf(y, echo("b"))),
+				ir.NewIfElse(y, ir.NewWhile(x, ir.NewIf(y, echo("c"))), echo("d"))),
+			ir.NewWhile(x, ir.NewBlock(ir.NewPostDec(x))),
+			ir.NewFor([]*ir.Node{ir.NewAssign(i, ir.NewIntLit(0))}, []*ir.Node{ir.NewLess(i, x)}, []*ir.Node{ir.NewPostInc(i)},
+				ir.NewIf(i, ir.NewBlock())),
+			ir.NewForeach(x, nil, y, ir.NewBlock(), false),
+		),
+	}
+
+	want := `function f() {
+  if ($x):
+    echo 'a';
+    {
+      if ($y):
+        echo 'b';
+      endif;
+    }
+  elseif ($y):
+    {
+      while ($x):
+        if ($y):
+          echo 'c';
+        endif;
+      endwhile;
+    }
+  else:
+    echo 'd';
+  endif;
+  while ($x):
+    $x--;
+  endwhile;
+  for ($i = 0; $i < $x; $i++):
+    if ($i):
+    endif;
+  endfor;
+  foreach ($x as $y):
+  endforeach;
+}
+
+`
+	var buf bytes.Buffer
+	FprintRootNode(&buf, fn, &Config{AltSyntax: true})
+	if have := buf.String(); have != want {
+		t.Fatalf("print:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintRandomAltSyntax(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	n := ir.NewIfElse(x, ir.NewBlock(ir.NewPostInc(x)), ir.NewIfElse(x, ir.NewBlock(ir.NewPostDec(x)), ir.NewBlock()))
+	config := &Config{Rand: rand.New(rand.NewSource(1)), AltSyntax: true}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		FprintNode(&buf, n, config)
+		have := buf.String()
+		seen[have] = true
+		// The elseif and else clauses must use the same syntax as their if.
+		if strings.Contains(have, "endif") == strings.Contains(have, "{") {
+			t.Fatalf("mixed syntax:\n%s", have)
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected both syntax forms, have %d", len(seen))
+	}
+}
+
+func TestPrintInterpolation(t *testing.T) {
+	arr := ir.NewVar("arr", nil)
+	obj := ir.NewVar("obj", nil)
+	i := ir.NewVar("i", nil)
+	lit := ir.NewStringLit
+
+	tests := []struct {
+		n      *ir.Node
+		braced string
+		simple string
+	}{
+		{
+			ir.NewInterpolatedString(lit("a "), ir.NewIndex(arr, lit("key")), lit("!")),
+			`"a {$arr['key']}!"`,
+			`"a $arr[key]!"`,
+		},
+		{
+			ir.NewInterpolatedString(ir.NewIndex(arr, ir.NewIntLit(10)), ir.NewIndex(arr, i)),
+			`"{$arr[10]}{$arr[$i]}"`,
+			`"$arr[10]$arr[$i]"`,
+		},
+		{
+			ir.NewInterpolatedString(ir.NewProp(obj, "name"), lit(" and "), ir.NewProp(obj, "x"), lit("-")),
+			`"{$obj->name} and {$obj->x}-"`,
+			`"$obj->name and $obj->x-"`,
+		},
+		{
+			// The simple form can't be followed by a name character.
+			ir.NewInterpolatedString(ir.NewProp(obj, "name"), lit("s")),
+			`"{$obj->name}s"`,
+			`"{$obj->name}s"`,
+		},
+		{
+			// Keys that can't be printed unquoted.
+			ir.NewInterpolatedString(ir.NewIndex(arr, lit("a b")), ir.NewIndex(arr, lit("15")), ir.NewIndex(arr, ir.NewIntLit(-1))),
+			`"{$arr['a b']}{$arr['15']}{$arr[-1]}"`,
+			`"{$arr['a b']}{$arr['15']}{$arr[-1]}"`,
+		},
+		{
+			// Nested accesses require braces.
+			ir.NewInterpolatedString(ir.NewIndex(ir.NewIndex(arr, ir.NewIntLit(0)), lit("x")), ir.NewProp(ir.NewIndex(arr, i), "y")),
+			`"{$arr[0]['x']}{$arr[$i]->y}"`,
+			`"{$arr[0]['x']}{$arr[$i]->y}"`,
+		},
+		{
+			ir.NewInterpolatedString(ir.NewIndex(arr, ir.NewIndex(arr, i))),
+			`"{$arr[$arr[$i]]}"`,
+			`"{$arr[$arr[$i]]}"`,
+		},
+		{
+			// "x{$arr[k]" would start the braced form.
+			ir.NewInterpolatedString(lit("x{"), ir.NewIndex(arr, lit("k")), lit("{"), ir.NewProp(obj, "y")),
+			`"x{{$arr['k']}{{$obj->y}"`,
+			`"x{{$arr['k']}{{$obj->y}"`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.braced {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.braced)
+			}
+			// Every part gets the simple form at least once.
+			seen := map[string]bool{}
+			config := &Config{Rand: rand.New(rand.NewSource(1))}
+			for j := 0; j < 100; j++ {
+				var buf bytes.Buffer
+				FprintNode(&buf, test.n, config)
+				seen[buf.String()] = true
+			}
+			if !seen[test.simple] {
+				t.Fatalf("%s is never printed, have: %v", test.simple, seen)
+			}
+			if test.simple == test.braced && len(seen) != 1 {
+				t.Fatalf("only %s should be printed, have: %v", test.braced, seen)
+			}
+		})
+	}
+}
+
+func TestInterpolatedStringParts(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"call", func() { ir.NewInterpolatedString(ir.NewCall(ir.NewName("f"))) }},
+		{"int literal", func() { ir.NewInterpolatedString(ir.NewIntLit(1)) }},
+		{"call element", func() { ir.NewInterpolatedString(ir.NewIndex(ir.NewCall(ir.NewName("f")), ir.NewIntLit(0))) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s part is accepted", test.name)
+				}
+			}()
+			test.fn()
+		}()
+	}
+}
+
+func TestStringEscapesRoundTrip(t *testing.T) {
+	var allBytes []byte
+	for i := 0; i < 256; i++ {
+		allBytes = append(allBytes, byte(i))
+	}
+	s := string(allBytes) + "7\x008 ЖЖ€\U0001F600�\xe2\x82 end"
+
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{"default", &Config{DoubleQuotes: true}},
+		{"hex", &Config{DoubleQuotes: true, HexEscapes: true}},
+		{"unicode", &Config{DoubleQuotes: true, UnicodeEscapes: true}},
+		{"hex+unicode", &Config{DoubleQuotes: true, HexEscapes: true, UnicodeEscapes: true}},
+		{"random", &Config{Rand: rand.New(rand.NewSource(1)), DoubleQuotes: true, HexEscapes: true, UnicodeEscapes: true}},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 10; i++ {
+			var buf bytes.Buffer
+			FprintNode(&buf, ir.NewStringLit(s), test.config)
+			lit := buf.String()
+			if have := unquotePHPString(t, lit); have != s {
+				t.Fatalf("%s: %q is decoded as %q", test.name, lit, have)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	FprintNode(&buf, ir.NewStringLit("\x01\n\x7fЖ"), &Config{HexEscapes: true, UnicodeEscapes: true})
+	if have, want := buf.String(), `"\x01\x0a\x7f\u{416}"`; have != want {
+		t.Fatalf("print:\nhave: %s\nwant: %s", have, want)
+	}
+}
+
+// unquotePHPString decodes a double-quoted PHP string literal
+// without interpolations the way PHP does it.
+func unquotePHPString(t *testing.T, lit string) string {
+	if len(lit) < 2 || lit[0] != '"' || lit[len(lit)-1] != '"' {
+		t.Fatalf("not a double-quoted string: %q", lit)
+	}
+	s := lit[1 : len(lit)-1]
+	isHex := func(ch byte) bool {
+		return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '$' {
+			t.Fatalf("unescaped %c in %q", s[i], lit)
+		}
+		if s[i] != '\\' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch ch := s[i]; ch {
+		case 'n':
+			buf.WriteByte('\n')
+		case 't':
+			buf.WriteByte('\t')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'v':
+			buf.WriteByte('\v')
+		case 'e':
+			buf.WriteByte(0x1b)
+		case 'f':
+			buf.WriteByte('\f')
+		case '\\', '$', '"':
+			buf.WriteByte(ch)
+		case 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && isHex(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				buf.WriteString(`\x`)
+				break
+			}
+			v, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			buf.WriteByte(byte(v))
+			i = j - 1
+		case 'u':
+			end := strings.IndexByte(s[i:], '}')
+			if i+1 == len(s) || s[i+1] != '{' || end == -1 {
+				t.Fatalf("invalid unicode escape in %q", lit)
+			}
+			v, err := strconv.ParseUint(s[i+2:i+end], 16, 32)
+			if err != nil {
+				t.Fatalf("invalid unicode escape in %q: %v", lit, err)
+			}
+			buf.WriteRune(rune(v))
+			i += end
+		default:
+			if ch >= '0' && ch <= '7' {
+				j := i
+				for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+					j++
+				}
+				v, _ := strconv.ParseUint(s[i:j], 8, 16)
+				buf.WriteByte(byte(v))
+				i = j - 1
+				break
+			}
+			buf.WriteByte('\\')
+			buf.WriteByte(ch)
+		}
+	}
+	return buf.String()
+}
+
+func TestPrintCast(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	cast := func(typ ir.Type) *ir.Node {
+		return &ir.Node{Op: ir.OpCast, Args: []*ir.Node{x}, Type: typ}
+	}
+
+	tests := []struct {
+		typ      ir.Type
+		keywords []string
+	}{
+		{ir.BoolType, []string{"bool", "boolean"}},
+		{ir.IntType, []string{"int", "integer"}},
+		{ir.FloatType, []string{"float", "double"}},
+		{ir.StringType, []string{"string", "binary"}},
+		{&ir.NullableType{X: ir.IntType}, []string{"int", "integer"}},
+		{&ir.EnumType{ValueType: ir.StringType, Values: []interface{}{"a"}}, []string{"string", "binary"}},
+		{&ir.ArrayType{Elem: ir.IntType}, []string{"array"}},
+		{&ir.TupleType{Elems: []ir.Type{ir.IntType}}, []string{"array"}},
+		{&ir.ClassType{Name: "Foo"}, []string{"object"}},
+	}
+
+	for _, test := range tests {
+		if have, want := SprintNode(cast(test.typ)), "("+test.keywords[0]+")$x"; have != want {
+			t.Errorf("print %s cast:\nhave: %s\nwant: %s", test.typ, have, want)
+		}
+		config := &Config{Rand: rand.New(rand.NewSource(1))}
+		seen := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			var buf bytes.Buffer
+			FprintNode(&buf, cast(test.typ), config)
+			seen[buf.String()] = true
+		}
+		for _, keyword := range test.keywords {
+			delete(seen, "("+keyword+")$x")
+		}
+		if len(seen) != 0 {
+			t.Errorf("unexpected %s casts: %v", test.typ, seen)
+		}
+	}
+
+	for _, typ := range []ir.Type{ir.VoidType, ir.MixedType, ir.NullType, &ir.UnionType{Types: []ir.Type{ir.IntType, ir.StringType}}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s cast is printed", typ)
+				}
+			}()
+			SprintNode(cast(typ))
+		}()
+	}
+}
+
+func TestPrintFile(t *testing.T) {
+	fn := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "f"},
+		Body: ir.NewBlock(ir.NewEcho(ir.NewIntLit(1))),
+	}
+	tests := []struct {
+		file *ir.File
+		want string
+	}{
+		{
+			&ir.File{},
+			"<?php\n",
+		},
+		{
+			&ir.File{
+				Header:      "seed: 10\nclosing ?> tag",
+				StrictTypes: true,
+				Namespace:   `App\Gen`,
+				Nodes: []ir.RootNode{
+					fn,
+					&ir.RootRequire{Path: "lib.php"},
+					&ir.RootStmt{X: ir.NewCall(ir.NewName("f"))},
+				},
+			},
+			"<?php\n" +
+				"// seed: 10\n" +
+				"// closing ? > tag\n" +
+				"declare(strict_types=1);\n" +
+				"namespace App\\Gen;\n" +
+				"require_once __DIR__ . '/lib.php';\n" +
+				"function f() {\n" +
+				"  echo 1;\n" +
+				"}\n" +
+				"\n" +
+				"f();\n",
+		},
+		{
+			&ir.File{Nodes: []ir.RootNode{fn}},
+			"<?php\n" +
+				"function f() {\n" +
+				"  echo 1;\n" +
+				"}\n",
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintFile(test.file); have != test.want {
+				t.Fatalf("print:\nhave:\n%s\nwant:\n%s", have, test.want)
+			}
+		})
+	}
+}
+
+// failingWriter fails once more than limit bytes are written.
+type failingWriter struct {
+	limit   int
+	written int
+	failed  bool
+
+	// writesAfterError counts the writes that follow the failed one.
+	writesAfterError int
+}
+
+var errWriteLimit = fmt.Errorf("write limit exceeded")
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.failed {
+		w.writesAfterError++
+	}
+	if w.written+len(b) > w.limit {
+		n := w.limit - w.written
+		w.written = w.limit
+		w.failed = true
+		return n, errWriteLimit
+	}
+	w.written += len(b)
+	return len(b), nil
+}
+
+func TestPrintWriteError(t *testing.T) {
+	var stmts []*ir.Node
+	for i := 0; i < 1000; i++ {
+		stmts = append(stmts, ir.NewEcho(ir.NewIntLit(int64(i))))
+	}
+	fn := &ir.RootFuncDecl{Type: &ir.FuncType{Name: "f"}, Body: ir.NewBlock(stmts...)}
+	file := &ir.File{Nodes: []ir.RootNode{fn}}
+	config := &Config{}
+
+	for _, limit := range []int{0, 10, 5000} {
+		w := &failingWriter{limit: limit}
+		if err := FprintRootNode(w, fn, config); err != errWriteLimit {
+			t.Errorf("limit %d: FprintRootNode error is %v", limit, err)
+		}
+		if w.writesAfterError != 0 {
+			t.Errorf("limit %d: %d writes after an error", limit, w.writesAfterError)
+		}
+
+		if err := FprintNode(&failingWriter{limit: limit}, fn.Body, config); err != errWriteLimit {
+			t.Errorf("limit %d: FprintNode error is %v", limit, err)
+		}
+		if err := FprintFile(&failingWriter{limit: limit}, file, config); err != errWriteLimit {
+			t.Errorf("limit %d: FprintFile error is %v", limit, err)
+		}
+	}
+
+	if err := FprintRootNode(&failingWriter{limit: 1 << 20}, fn, config); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPrinterReuse(t *testing.T) {
+	nodes := []*ir.Node{
+		ir.NewAdd(ir.NewIntLit(1), ir.NewVar("x", nil)),
+		ir.NewIf(ir.NewVar("x", nil), ir.NewBlock(ir.NewEcho(ir.NewStringLit("a")))),
+		ir.NewCall(ir.NewName("f"), ir.NewIntLit(2)),
+	}
+	p := NewPrinter(&Config{})
+	for i := 0; i < 3; i++ {
+		for _, n := range nodes {
+			var buf bytes.Buffer
+			if err := p.Fprint(&buf, n); err != nil {
+				t.Fatal(err)
+			}
+			if have, want := buf.String(), SprintNode(n); have != want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, want)
+			}
+		}
+	}
+
+	// A failed write doesn't affect the next one.
+	if err := p.Fprint(&failingWriter{}, nodes[0]); err != errWriteLimit {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := p.Fprint(&buf, nodes[0]); err != nil || buf.String() != "1 + $x" {
+		t.Fatalf("print after error: %q, %v", buf.String(), err)
+	}
+}
+
+func TestSprintNodeConcurrent(t *testing.T) {
+	// Run with -race to check that pooled printers are not shared.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				n := ir.NewAdd(ir.NewIntLit(int64(i)), ir.NewIntLit(int64(j)))
+				if have, want := SprintNode(n), fmt.Sprintf("%d + %d", i, j); have != want {
+					t.Errorf("print:\nhave: %s\nwant: %s", have, want)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func benchmarkNode() *ir.Node {
+	x := ir.NewVar("x", nil)
+	return ir.NewAssign(x, ir.NewAdd(ir.NewMul(x, ir.NewIntLit(2)), ir.NewCall(ir.NewName("f"), x)))
+}
+
+func BenchmarkSprintNode(b *testing.B) {
+	n := benchmarkNode()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = SprintNode(n)
+	}
+}
+
+// BenchmarkFprintNode is a baseline that allocates a new printer for every call.
+func BenchmarkFprintNode(b *testing.B) {
+	n := benchmarkNode()
+	config := &Config{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf strings.Builder
+		_ = FprintNode(&buf, n, config)
+		_ = buf.String()
+	}
+}
+
+func TestPrintMalformedNode(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{&ir.Node{Op: ir.OpInvalid}, `irprint: unexpected Invalid node: Invalid`},
+		{&ir.Node{Op: ir.OpCase, Args: []*ir.Node{x}}, `irprint: unexpected Case node: Case(Var[x])`},
+		{
+			&ir.Node{Op: ir.OpTernary, Args: []*ir.Node{x, x}},
+			`irprint: Ternary node has 2 args, expected 3: Ternary(Var[x], Var[x])`,
+		},
+		{
+			&ir.Node{Op: ir.OpIndex, Args: []*ir.Node{x}},
+			`irprint: Index node has 1 args, expected 2: Index(Var[x])`,
+		},
+		{
+			&ir.Node{Op: ir.OpCall},
+			`irprint: Call node has 0 args, expected at least 1: Call`,
+		},
+		{
+			&ir.Node{Op: ir.OpProp, Value: "p", Args: []*ir.Node{x, x, x}},
+			`irprint: Prop node has 3 args, expected 1..2: Prop[p](Var[x], Var[x], Var[x])`,
+		},
+		{
+			&ir.Node{Op: ir.OpAssignModify, Value: ir.OpBitNot, Args: []*ir.Node{x, x}},
+			`irprint: unexpected BitNot compound assignment: AssignModify[BitNot](Var[x], Var[x])`,
+		},
+		{
+			// A malformed node is reported even if it's deeply nested.
+			ir.NewAdd(ir.NewNegation(ir.NewParens(ir.NewAdd(x, &ir.Node{Op: ir.OpNot}))), x),
+			`irprint: Not node has 0 args, expected 1: Not`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := FprintNode(&buf, test.n, &Config{Strict: true})
+			if err == nil || err.Error() != test.want {
+				t.Fatalf("error:\nhave: %v\nwant: %s", err, test.want)
+			}
+			if _, ok := err.(*NodeError); !ok {
+				t.Fatalf("unexpected %T error", err)
+			}
+
+			defer func() {
+				r := recover()
+				if err, ok := r.(*NodeError); !ok || err.Error() != test.want {
+					t.Fatalf("panic:\nhave: %v\nwant: %s", r, test.want)
+				}
+			}()
+			SprintNode(test.n)
+		})
+	}
+
+	fn := &ir.RootFuncDecl{Type: &ir.FuncType{Name: "f"}, Body: ir.NewBlock(&ir.Node{Op: ir.OpWhile})}
+	if err := FprintRootNode(&bytes.Buffer{}, fn, &Config{Strict: true}); err == nil {
+		t.Fatal("malformed func body is printed")
+	}
+	if err := NewPrinter(&Config{Strict: true}).Fprint(&bytes.Buffer{}, &ir.Node{Op: ir.OpInvalid}); err == nil {
+		t.Fatal("invalid node is printed")
+	}
+}
+
+func TestPrintYield(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	k := ir.NewVar("k", nil)
+	gen := ir.NewVar("gen", nil)
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewYield(), `yield`},
+		{ir.NewYield(x), `yield $x`},
+		{ir.NewYield(k, x), `yield $k => $x`},
+		{ir.NewYieldFrom(gen), `yield from $gen`},
+		{ir.NewYieldFrom(ir.NewCall(ir.NewName("f"))), `yield from f()`},
+		{ir.NewYield(ir.NewAdd(x, ir.NewIntLit(1))), `yield $x + 1`},
+		{ir.NewYield(ir.NewAdd(k, x), ir.NewNullCoalesce(x, k)), `yield ($k + $x) => $x ?? $k`},
+		{ir.NewYield(ir.NewIntLit(-1), ir.NewNegation(x)), `yield (-1) => -$x`},
+		{ir.NewYield(ir.NewAssign(x, k)), `yield $x = $k`},
+		{ir.NewYield(ir.NewAndWord(x, k)), `yield ($x and $k)`},
+		{ir.NewAssign(x, ir.NewYield(k)), `$x = (yield $k)`},
+		{ir.NewAssign(x, ir.NewYield()), `$x = (yield)`},
+		{ir.NewAdd(ir.NewYieldFrom(gen), ir.NewIntLit(1)), `(yield from $gen) + 1`},
+		{ir.NewCall(ir.NewName("f"), ir.NewYield(x)), `f(yield $x)`},
+		{ir.NewYield(ir.NewYieldFrom(gen)), `yield yield from $gen`},
+		{ir.NewYieldFrom(ir.NewYield(x)), `yield from (yield $x)`},
+		{ir.NewPrint(ir.NewYield(x)), `print yield $x`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintGeneratorFunc(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	closure := ir.NewClosure(&ir.FuncType{Result: ir.IntType}, nil, ir.NewBlock(ir.NewYield(x)))
+	gen := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "gen", Result: ir.IntType},
+		Body: ir.NewBlock(ir.NewEcho(ir.NewYield(x)), ir.NewReturn(ir.NewIntLit(1))),
+	}
+	notGen := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "f", Result: ir.IntType},
+		Body: ir.NewBlock(ir.NewReturn(ir.NewCall(closure))),
+	}
+	if !gen.IsGenerator() || notGen.IsGenerator() {
+		t.Fatal("IsGenerator: nested closures should be ignored")
+	}
+
+	var buf bytes.Buffer
+	config := &Config{ReturnTypeHints: true}
+	FprintRootNode(&buf, gen, config)
+	FprintRootNode(&buf, notGen, config)
+	want := "function gen(): \\Generator {\n" +
+		"  echo yield $x;\n" +
+		"  return 1;\n" +
+		"}\n" +
+		"\n" +
+		"function f(): int {\n" +
+		"  return (function (): \\Generator {\n" +
+		"    yield $x;\n" +
+		"  })();\n" +
+		"}\n" +
+		"\n"
+	if have := buf.String(); have != want {
+		t.Fatalf("print:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestPrintDestructuring(t *testing.T) {
+	a := ir.NewVar("a", nil)
+	b := ir.NewVar("b", nil)
+	c := ir.NewVar("c", nil)
+	arr := ir.NewVar("arr", nil)
+	key := func(s string, x *ir.Node) *ir.Node {
+		return ir.NewKeyedElem(ir.NewStringLit(s), x)
+	}
+
+	tests := []struct {
+		n     *ir.Node
+		want  string
+		short string
+	}{
+		{
+			ir.NewAssign(ir.NewList(a, b), arr),
+			`list($a, $b) = $arr`,
+			`[$a, $b] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(a, nil, c), arr),
+			`list($a, , $c) = $arr`,
+			`[$a, , $c] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(nil, nil, c), arr),
+			`list(, , $c) = $arr`,
+			`[, , $c] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(key("x", a), key("y", b)), arr),
+			`list('x' => $a, 'y' => $b) = $arr`,
+			`['x' => $a, 'y' => $b] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(a, ir.NewList(b, nil, c)), arr),
+			`list($a, list($b, , $c)) = $arr`,
+			`[$a, [$b, , $c]] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(key("x", ir.NewList(key("y", a))), ir.NewKeyedElem(ir.NewIntLit(1), b)), arr),
+			`list('x' => list('y' => $a), 1 => $b) = $arr`,
+			`['x' => ['y' => $a], 1 => $b] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(ir.NewByRef(a), ir.NewIndex(b, ir.NewIntLit(0)), ir.NewProp(c, "d")), arr),
+			`list(&$a, $b[0], $c->d) = $arr`,
+			`[&$a, $b[0], $c->d] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(key("x", ir.NewByRef(a))), arr),
+			`list('x' => &$a) = $arr`,
+			`['x' => &$a] = $arr`,
+		},
+		{
+			ir.NewAssign(ir.NewList(a, b), ir.NewAssign(ir.NewList(b, a), arr)),
+			`list($a, $b) = list($b, $a) = $arr`,
+			`[$a, $b] = [$b, $a] = $arr`,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+			var buf bytes.Buffer
+			FprintNode(&buf, test.n, &Config{ShortArraySyntax: true})
+			if have := buf.String(); have != test.short {
+				t.Fatalf("print short:\nhave: %s\nwant: %s", have, test.short)
+			}
+		})
+	}
+}
+
+func TestPrintRandomDestructuring(t *testing.T) {
+	a := ir.NewVar("a", nil)
+	b := ir.NewVar("b", nil)
+	n := ir.NewAssign(ir.NewList(a, ir.NewList(nil, b)), ir.NewVar("arr", nil))
+
+	tests := []struct {
+		version int
+		want    []string
+	}{
+		{70000, []string{`list($a, list(, $b)) = $arr`}},
+		{70100, []string{`list($a, list(, $b)) = $arr`, `[$a, [, $b]] = $arr`}},
+	}
+
+	for _, test := range tests {
+		config := &Config{Rand: rand.New(rand.NewSource(1)), MinPHPVersion: test.version}
+		seen := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			var buf bytes.Buffer
+			FprintNode(&buf, n, config)
+			seen[buf.String()] = true
+		}
+		// Nested lists should never mix the spellings.
+		if len(seen) != len(test.want) {
+			t.Fatalf("PHP %d: unexpected outputs: %v", test.version, seen)
+		}
+		for _, want := range test.want {
+			if !seen[want] {
+				t.Fatalf("PHP %d: %s is never printed", test.version, want)
+			}
+		}
+	}
+}
+
+func TestListElements(t *testing.T) {
+	a := ir.NewVar("a", nil)
+	keyed := ir.NewKeyedElem(ir.NewStringLit("x"), a)
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"empty", func() { ir.NewList() }},
+		{"skipped only", func() { ir.NewList(nil, nil) }},
+		{"mixed keys", func() { ir.NewList(keyed, a) }},
+		{"keyed skip", func() { ir.NewList(keyed, nil) }},
+		{"call", func() { ir.NewList(ir.NewCall(ir.NewName("f"))) }},
+		{"keyed literal", func() { ir.NewList(ir.NewKeyedElem(ir.NewStringLit("x"), ir.NewIntLit(1))) }},
+		{"reference to list", func() { ir.NewList(ir.NewByRef(ir.NewList(a))) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s list is accepted", test.name)
+				}
+			}()
+			test.fn()
+		}()
+	}
+}
+
+func TestPrintOperators(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	y := ir.NewVar("y", nil)
+	for op := ir.OpBad; op <= ir.OpNullCoalesce; op++ {
+		info := ir.GetOpInfo(op)
+		n := &ir.Node{Op: op}
+		var want string
+		switch info.Notation {
+		case ir.NotationBinary:
+			n.Args = []*ir.Node{x, y}
+			want = "$x " + info.Symbol + " $y"
+		case ir.NotationPrefix:
+			n.Args = []*ir.Node{x}
+			want = info.Symbol + "$x"
+			if isWordSymbol(info.Symbol) {
+				want = info.Symbol + " $x"
+			}
+		case ir.NotationPostfix:
+			n.Args = []*ir.Node{x}
+			want = "$x" + info.Symbol
+		default:
+			continue
+		}
+		switch op {
+		case ir.OpAssignModify, ir.OpCast, ir.OpInstanceOf:
+			// They're covered by the other tests.
+			continue
+		}
+		if isPrintedAsCall(n) {
+			continue
+		}
+		if have := SprintNode(n); have != want {
+			t.Errorf("print %s:\nhave: %s\nwant: %s", op, have, want)
+		}
+	}
+}
+
+func TestPrintAssignModify(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	y := ir.NewVar("y", nil)
+	for op := ir.OpBad; op <= ir.OpNullCoalesce; op++ {
+		info := ir.GetOpInfo(op)
+		if !info.CompoundAssign {
+			continue
+		}
+		have := SprintNode(ir.NewAssignModify(op, x, y))
+		if want := "$x " + info.Symbol + "= $y"; have != want {
+			t.Errorf("print %s assignment:\nhave: %s\nwant: %s", op, have, want)
+		}
+	}
+
+	z := ir.NewVar("z", nil)
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewAssignModify(ir.OpNullCoalesce, x, ir.NewIntLit(1)), `$x ??= 1`},
+		{ir.NewAssignModify(ir.OpNullCoalesce, x, ir.NewNullCoalesce(y, z)), `$x ??= $y ?? $z`},
+		{ir.NewAssignModify(ir.OpNullCoalesce, x, ir.NewAssignModify(ir.OpNullCoalesce, y, z)), `$x ??= $y ??= $z`},
+		{ir.NewNullCoalesce(x, ir.NewAssignModify(ir.OpNullCoalesce, y, z)), `$x ?? ($y ??= $z)`},
+		{ir.NewAssignModify(ir.OpNullCoalesce, ir.NewIndex(x, ir.NewStringLit("k")), y), `$x['k'] ??= $y`},
+		{
+			ir.NewAssignModify(ir.OpConcat, x, ir.NewInterpolatedString(ir.NewStringLit("a"), y, ir.NewStringLit("b"))),
+			`$x .= "a{$y}b"`,
+		},
+		{
+			ir.NewAssignModify(ir.OpConcat, x, ir.NewConcat(ir.NewInterpolatedString(y), z)),
+			`$x .= "{$y}" . $z`,
+		},
+		{ir.NewAssignModify(ir.OpExp, x, ir.NewExp(y, z)), `$x **= $y ** $z`},
+		{ir.NewAssignModify(ir.OpExp, x, ir.NewNegation(y)), `$x **= -$y`},
+		{ir.NewExp(x, ir.NewAssignModify(ir.OpExp, y, z)), `$x ** ($y **= $z)`},
+		{ir.NewNegation(ir.NewAssignModify(ir.OpExp, x, y)), `-($x **= $y)`},
+		{ir.NewAssignModify(ir.OpExp, x, ir.NewAssignModify(ir.OpMul, y, z)), `$x **= $y *= $z`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("~= assignment is accepted")
+		}
+	}()
+	ir.NewAssignModify(ir.OpBitNot, x, y)
+}
+
+func TestPrintErrorSuppress(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	f := ir.NewCall(ir.NewName("f"))
+	foo := ir.NewName("Foo")
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewErrorSuppress(f), `@f()`},
+		{ir.NewErrorSuppress(ir.NewIndex(x, ir.NewStringLit("k"))), `@$x['k']`},
+		{ir.NewErrorSuppress(ir.NewProp(x, "y")), `@$x->y`},
+		{ir.NewErrorSuppress(ir.NewErrorSuppress(f)), `@@f()`},
+		{ir.NewErrorSuppress(ir.NewNegation(x)), `@-$x`},
+		{ir.NewNegation(ir.NewErrorSuppress(x)), `-@$x`},
+		{ir.NewNot(ir.NewErrorSuppress(f)), `!@f()`},
+		{ir.NewErrorSuppress(&ir.Node{Op: ir.OpCast, Args: []*ir.Node{x}, Type: ir.IntType}), `@(int)$x`},
+		{ir.NewErrorSuppress(ir.NewNew(foo)), `@new Foo()`},
+		{ir.NewErrorSuppress(ir.NewAdd(x, ir.NewIntLit(1))), `@($x + 1)`},
+		{ir.NewAdd(ir.NewErrorSuppress(x), ir.NewIntLit(1)), `@$x + 1`},
+		{ir.NewErrorSuppress(ir.NewAssign(x, f)), `@($x = f())`},
+		{ir.NewAssign(x, ir.NewErrorSuppress(f)), `$x = @f()`},
+		{ir.NewErrorSuppress(ir.NewExp(x, ir.NewIntLit(2))), `@$x ** 2`},
+		{ir.NewExp(ir.NewErrorSuppress(x), ir.NewIntLit(2)), `(@$x) ** 2`},
+		{ir.NewInstanceOf(ir.NewErrorSuppress(x), foo), `@$x instanceof Foo`},
+		{ir.NewErrorSuppress(ir.NewInstanceOf(x, foo)), `@($x instanceof Foo)`},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			if have := SprintNode(test.n); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRandomKeywordCase(t *testing.T) {
+	// Identifiers look like keywords, but their case should be preserved.
+	v := ir.NewVar("while", nil)
+	foo := ir.NewName("foo")
+	decl := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "echo_return", Params: []ir.TypeField{{Name: "while"}}},
+		Body: ir.NewBlock(
+			ir.NewIfElse(
+				ir.NewAndWord(ir.NewInstanceOf(v, ir.NewRelativeClass(ir.RelativeSelf)), ir.NewBoolLit(true)),
+				ir.NewBlock(ir.NewEcho(ir.NewClone(v))),
+				ir.NewBlock(ir.NewThrow(ir.NewNew(foo, v))),
+			),
+			ir.NewWhile(ir.NewNot(ir.NewIsset(v)), ir.NewBlock(ir.NewUnset(v), ir.NewBreak(0))),
+			ir.NewReturn(ir.NewCall(foo, v)),
+		),
+	}
+	var wantBuf bytes.Buffer
+	FprintRootNode(&wantBuf, decl, &Config{})
+	want := wantBuf.String()
+
+	config := &Config{Rand: rand.New(rand.NewSource(1)), RandomKeywordCase: true}
+	changed := false
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		FprintRootNode(&buf, decl, config)
+		have := buf.String()
+		if strings.ToLower(have) != want {
+			t.Fatalf("print:\nhave:\n%s\nwant (case-insensitive):\n%s", have, want)
+		}
+		for _, ident := range []string{"echo_return(", "$while", "foo("} {
+			if !strings.Contains(have, ident) {
+				t.Fatalf("%s identifier case is changed:\n%s", ident, have)
+			}
+		}
+		changed = changed || have != want
+	}
+	if !changed {
+		t.Fatal("keywords are always printed in lower case")
+	}
+
+	// Without the flag, the keywords are not affected by Rand.
+	var buf bytes.Buffer
+	FprintRootNode(&buf, decl, &Config{Rand: rand.New(rand.NewSource(1))})
+	if have := buf.String(); have != want {
+		t.Fatalf("print:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	cast := &ir.Node{Op: ir.OpCast, Type: ir.IntType, Args: []*ir.Node{v}}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		FprintNode(&buf, cast, config)
+		have := buf.String()
+		if lower := strings.ToLower(have); lower != `(int)$while` && lower != `(integer)$while` {
+			t.Fatalf("print cast: have %s", have)
+		}
+		seen[have] = true
+	}
+	if !seen[`(INT)$while`] {
+		t.Fatalf("(INT) cast is never printed: %v", seen)
+	}
+}
+
+func TestPrintNewline(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	file := &ir.File{
+		Header: "line 1\nline 2",
+		Nodes: []ir.RootNode{
+			&ir.RootFuncDecl{
+				Type: &ir.FuncType{Name: "f"},
+				Body: ir.NewBlock(
+					ir.NewWhile(x, ir.NewBlock(ir.NewEcho(ir.NewStringLit("a\nb")))),
+					ir.NewReturn(x),
+				),
+			},
+			&ir.RootStmt{X: ir.NewCall(ir.NewName("f"))},
+		},
+	}
+	want := strings.ReplaceAll(SprintFile(file), "\n", "\r\n")
+	var buf bytes.Buffer
+	FprintFile(&buf, file, &Config{Newline: "\r\n"})
+	if have := buf.String(); have != want {
+		t.Fatalf("print:\nhave: %q\nwant: %q", have, want)
+	}
+
+	// Multi-line heredoc bodies keep the "\n" line terminators,
+	// so the string value is the same, but the heredoc markers lines
+	// are terminated with the config newline.
+	heredoc := ir.NewEcho(ir.NewInterpolatedString(ir.NewStringLit("a\n\nb"), x, ir.NewStringLit("\n")))
+	call := ir.NewCall(ir.NewName("f"), ir.NewStringLit(strings.Repeat("a", 30)), heredoc.Args[0])
+	for _, n := range []*ir.Node{heredoc, call} {
+		for _, flexible := range []bool{false, true} {
+			sprint := func(newline string) string {
+				config := &Config{
+					Rand:               rand.New(rand.NewSource(1)),
+					HeredocProbability: 1,
+					FlexibleHeredoc:    flexible,
+					MaxLineLength:      20,
+					Newline:            newline,
+				}
+				buf.Reset()
+				FprintNode(&buf, n, config)
+				return buf.String()
+			}
+			have, plain := sprint("\r\n"), sprint("")
+			if !strings.Contains(have, "<<<") || strings.ReplaceAll(have, "\r\n", "\n") != plain {
+				t.Fatalf("print heredoc (flexible=%v):\nhave: %q\nplain: %q", flexible, have, plain)
+			}
+			for _, line := range []string{"\n", "a", "b{$x}", strings.Repeat("a", 30)} {
+				if strings.Contains(have, line+"\r\n") {
+					t.Fatalf("print heredoc (flexible=%v): %q body line is terminated with \\r\\n: %q", flexible, line, have)
+				}
+			}
+		}
+	}
+
+	// Continuation lines are printed by a separate printer,
+	// but their newlines are replaced only once.
+	long := ir.NewEcho(ir.NewConcat(ir.NewStringLit(strings.Repeat("a", 20)), ir.NewStringLit(strings.Repeat("b", 20))))
+	buf.Reset()
+	NewPrinter(&Config{MaxLineLength: 30, Newline: "\r\n"}).Fprint(&buf, long)
+	if have, want := buf.String(), "echo 'aaaaaaaaaaaaaaaaaaaa'\r\n  . 'bbbbbbbbbbbbbbbbbbbb'"; have != want {
+		t.Fatalf("print continuation:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestPrintRandomWhitespace(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	decl := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "f"},
+		Body: ir.NewBlock(
+			ir.NewEcho(x),
+			ir.NewIf(x, ir.NewBlock(ir.NewEcho(x), ir.NewBreak(0))),
+			ir.NewReturn(x),
+		),
+	}
+	// normalize removes the trailing whitespace and the blank lines.
+	normalize := func(s string) string {
+		var lines []string
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimRight(line, " \t"); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	var buf bytes.Buffer
+	FprintRootNode(&buf, decl, &Config{})
+	want := normalize(buf.String())
+
+	config := &Config{Rand: rand.New(rand.NewSource(1)), WhitespaceProbability: 0.5}
+	var haveTrailing, haveBlank bool
+	for i := 0; i < 20; i++ {
+		buf.Reset()
+		FprintRootNode(&buf, decl, config)
+		have := buf.String()
+		if normalize(have) != want {
+			t.Fatalf("print:\nhave:\n%s\nwant (normalized):\n%s", have, want)
+		}
+		haveTrailing = haveTrailing || strings.Contains(have, " \n") || strings.Contains(have, "\t\n")
+		haveBlank = haveBlank || strings.Contains(have, ";\n\n")
+	}
+	if !haveTrailing || !haveBlank {
+		t.Fatalf("trailing whitespace: %v, blank lines: %v", haveTrailing, haveBlank)
+	}
+}
+
+func TestPrintTrailingCommas(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	y := ir.NewVar("y", nil)
+	f := ir.NewName("f")
+	paramX := []ir.TypeField{{Name: "x"}}
+
+	tests := []struct {
+		n    *ir.Node
+		want string
+	}{
+		{ir.NewCall(f), `f()`},
+		{ir.NewCall(f, x, y), `f($x, $y,)`},
+		{ir.NewCall(f, ir.NewSpread(x)), `f(...$x,)`},
+		{ir.NewNew(ir.NewName("Foo"), x), `new Foo($x,)`},
+		{ir.NewMethodCall(x, "m", y), `$x->m($y,)`},
+		{ir.NewExit(ir.NewIntLit(1)), `exit(1)`},
+		{ir.NewIsset(x), `isset($x,)`},
+		{ir.NewEmpty(x), `empty($x)`},
+		{ir.NewArrowClosure(&ir.FuncType{Params: paramX}, nil, x), `fn ($x,) => $x`},
+		{
+			ir.NewClosure(&ir.FuncType{Params: paramX}, []ir.ClosureUse{{Name: "y"}}, ir.NewBlock(ir.NewReturn(y))),
+			"function ($x,) use ($y,) {\n  return $y;\n}",
+		},
+		{&ir.Node{Op: ir.OpArrayLit, Args: []*ir.Node{x, y}}, "array(\n  $x,\n  $y,\n)"},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(fmt.Sprintf("test%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			FprintNode(&buf, test.n, &Config{TrailingCommas: true, ArrowFunctions: true})
+			if have := buf.String(); have != test.want {
+				t.Fatalf("print:\nhave: %s\nwant: %s", have, test.want)
+			}
+		})
+	}
+
+	decl := &ir.RootFuncDecl{
+		Type: &ir.FuncType{Name: "f", Params: []ir.TypeField{{Name: "x"}, {Name: "y", Variadic: true}}},
+		Body: ir.NewBlock(),
+	}
+	var buf bytes.Buffer
+	FprintRootNode(&buf, decl, &Config{TrailingCommas: true})
+	if have, want := buf.String(), "function f($x, ...$y,) {\n}\n\n"; have != want {
+		t.Fatalf("print func:\nhave: %q\nwant: %q", have, want)
+	}
+
+	// The multi-line call puts the trailing comma after the last argument.
+	long := ir.NewCall(f, ir.NewStringLit(strings.Repeat("a", 20)), ir.NewStringLit(strings.Repeat("b", 20)))
+	buf.Reset()
+	FprintNode(&buf, long, &Config{TrailingCommas: true, MaxLineLength: 30})
+	if have, want := buf.String(), "f(\n  'aaaaaaaaaaaaaaaaaaaa',\n  'bbbbbbbbbbbbbbbbbbbb',\n)"; have != want {
+		t.Fatalf("print multi-line call:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestPrintRandomTrailingCommas(t *testing.T) {
+	x := ir.NewVar("x", nil)
+	call := ir.NewCall(ir.NewName("f"), x)
+	closure := ir.NewClosure(&ir.FuncType{Params: []ir.TypeField{{Name: "x"}}}, nil, ir.NewBlock())
+	arr := &ir.Node{Op: ir.OpArrayLit, Args: []*ir.Node{x}}
+
+	tests := []struct {
+		version int
+		want    []string
+	}{
+		{70200, []string{`f($x)`, "function ($x) {\n}", "[\n  $x\n]", "[\n  $x,\n]"}},
+		{70300, []string{`f($x)`, `f($x,)`, "function ($x) {\n}", "[\n  $x\n]", "[\n  $x,\n]"}},
+		{80000, []string{`f($x)`, `f($x,)`, "function ($x) {\n}", "function ($x,) {\n}", "[\n  $x\n]", "[\n  $x,\n]"}},
+	}
+
+	for _, test := range tests {
+		config := &Config{
+			Rand:             rand.New(rand.NewSource(1)),
+			MinPHPVersion:    test.version,
+			TrailingCommas:   true,
+			ShortArraySyntax: true,
+		}
+		seen := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			for _, n := range []*ir.Node{call, closure, arr} {
+				var buf bytes.Buffer
+				FprintNode(&buf, n, config)
+				if have := buf.String(); !strings.HasPrefix(have, "array(") {
+					seen[have] = true
+				}
+			}
+		}
+		if len(seen) != len(test.want) {
+			t.Fatalf("PHP %d: unexpected outputs: %v", test.version, seen)
+		}
+		for _, want := range test.want {
+			if !seen[want] {
+				t.Fatalf("PHP %d: %q is never printed", test.version, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package irprint
+
+import "github.com/quasilyte/phpsmith/randutil"
+
+// keyword returns s with a random letter case if RandomKeywordCase is enabled.
+// Keywords are case-insensitive in PHP, so s can only contain keywords,
+// magic constants and punctuation.
+func (p *printer) keyword(s string) string {
+	if p.config.Rand == nil || !p.config.RandomKeywordCase {
+		return s
+	}
+	b := []byte(s)
+	for i, c := range b {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if isLetter && randutil.Bool(p.config.Rand) {
+			b[i] = c ^ 0x20 // Swap the ASCII letter case.
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,44 @@
+package irprint
+
+import (
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+// printList prints a destructuring target.
+// Nested lists use the same spelling, since PHP doesn't allow
+// to mix [] and list() in one destructuring.
+func (p *printer) printList(n *ir.Node, short bool) {
+	opening, closing := p.keyword("list("), ")"
+	if short {
+		opening, closing = "[", "]"
+	}
+	p.w.WriteString(opening)
+	for i, elem := range n.Args {
+		if i != 0 {
+			p.w.WriteString(", ")
+		}
+		if elem == nil {
+			continue
+		}
+		if elem.Op == ir.OpKeyedElem {
+			p.printNode(elem.Args[0])
+			p.w.WriteString(" => ")
+			elem = elem.Args[1]
+		}
+		if elem.Op == ir.OpList {
+			p.printList(elem, short)
+		} else {
+			p.printNode(elem)
+		}
+	}
+	p.w.WriteString(closing)
+}
+
+func (p *printer) useShortListSyntax() bool {
+	if p.config.Rand != nil {
+		// The [] destructuring is not available before PHP 7.1.
+		return p.phpVersionAtLeast(php71) && randutil.Bool(p.config.Rand)
+	}
+	return p.config.ShortArraySyntax
+}
@@ -0,0 +1,86 @@
+package irprint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// NodeError describes an IR node that can't be printed.
+//
+// The printer panics with a *NodeError when it meets such node.
+// The Fprint functions return it as an error instead if Config.Strict is set.
+type NodeError struct {
+	Node   *ir.Node
+	Reason string
+}
+
+func (e *NodeError) Error() string {
+	return "irprint: " + e.Reason + ": " + dumpNode(e.Node, 3)
+}
+
+// checkArgs panics with a *NodeError if n has unexpected number of args.
+func checkArgs(n *ir.Node) {
+	info := ir.GetOpInfo(n.Op)
+	if len(n.Args) < info.MinArgs || (info.MaxArgs != -1 && len(n.Args) > info.MaxArgs) {
+		want := fmt.Sprintf("%d..%d", info.MinArgs, info.MaxArgs)
+		switch {
+		case info.MinArgs == info.MaxArgs:
+			want = fmt.Sprint(info.MinArgs)
+		case info.MaxArgs == -1:
+			want = fmt.Sprintf("at least %d", info.MinArgs)
+		}
+		panic(&NodeError{
+			Node:   n,
+			Reason: fmt.Sprintf("%s node has %d args, expected %s", n.Op, len(n.Args), want),
+		})
+	}
+}
+
+// recoverNodeError turns a *NodeError panic into the err result
+// if the strict mode is enabled.
+// It should be called directly by defer.
+func recoverNodeError(config *Config, err *error) {
+	if !config.Strict {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	if nodeErr, ok := r.(*NodeError); ok {
+		*err = nodeErr
+		return
+	}
+	panic(r)
+}
+
+// dumpNode returns a compact n tree representation for the error messages,
+// like Add(Var[x], IntLit[1]). Nodes below the depth are printed as "...".
+func dumpNode(n *ir.Node, depth int) string {
+	if n == nil {
+		return "nil"
+	}
+	var sb strings.Builder
+	sb.WriteString(n.Op.String())
+	if n.Value != nil {
+		fmt.Fprintf(&sb, "[%v]", n.Value)
+	}
+	if len(n.Args) == 0 {
+		return sb.String()
+	}
+	if depth == 0 {
+		sb.WriteString("(...)")
+		return sb.String()
+	}
+	sb.WriteByte('(')
+	for i, arg := range n.Args {
+		if i != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(dumpNode(arg, depth-1))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
@@ -0,0 +1,145 @@
+package irprint
+
+import (
+	"math"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// opInfo is the operator binding used to place the parentheses.
+// It comes from ir.GetOpInfo, but some nodes are printed differently,
+// see nodeInfo.
+type opInfo struct {
+	prec  ir.Precedence
+	assoc ir.Assoc
+}
+
+func nodeInfo(n *ir.Node) opInfo {
+	if isNegativeLit(n) {
+		// A negative literal is printed as a unary minus expression.
+		return opInfo{ir.PrecUnary, ir.AssocRight}
+	}
+	if n.Op == ir.OpClosure && n.Value.(*ir.ClosureInfo).ArrowFunc {
+		// The arrow function body extends as far to the right as possible.
+		// It's unknown whether it will be printed as an arrow function,
+		// so arrow-eligible closures are treated as such.
+		return opInfo{ir.PrecThrow, ir.AssocRight}
+	}
+	if isPrintedAsCall(n) {
+		return opInfo{ir.PrecAtom, ir.AssocNone}
+	}
+	info := ir.GetOpInfo(n.Op)
+	if info.Precedence == ir.PrecNone {
+		// Statements and aux ops are never operands.
+		return opInfo{ir.PrecAtom, ir.AssocNone}
+	}
+	return opInfo{info.Precedence, info.Assoc}
+}
+
+// isPrintedAsCall reports whether the n operator is printed as
+// a runtime library function call, so it's an atom from the
+// precedence point of view, see fuzzlib.php.
+func isPrintedAsCall(n *ir.Node) bool {
+	switch n.Op {
+	case ir.OpDiv, ir.OpMod,
+		ir.OpFloatEqual2, ir.OpFloatEqual3, ir.OpNotFloatEqual2, ir.OpNotFloatEqual3:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNegativeLit(n *ir.Node) bool {
+	switch n.Op {
+	case ir.OpIntLit:
+		// The min int64 value is printed as PHP_INT_MIN constant.
+		return n.Value.(int64) < 0 && n.Value.(int64) != math.MinInt64
+	case ir.OpFloatLit:
+		// NaN and infinities are printed as calls.
+		// Signbit is checked to include the negative zero.
+		return math.Signbit(n.Value.(float64)) && !isSpecialFloat(n.Value.(float64))
+	default:
+		return false
+	}
+}
+
+func isPrefixUnary(n *ir.Node) bool {
+	switch n.Op {
+	case ir.OpNot, ir.OpNegation, ir.OpUnaryPlus, ir.OpBitNot, ir.OpPreInc, ir.OpPreDec, ir.OpCast,
+		ir.OpErrorSuppress:
+		return true
+	default:
+		return isNegativeLit(n)
+	}
+}
+
+// prefixChar returns the first character of the printed n
+// if it's a sign that could be merged with a preceding sign.
+func prefixChar(n *ir.Node) byte {
+	switch n.Op {
+	case ir.OpNegation, ir.OpPreDec:
+		return '-'
+	case ir.OpUnaryPlus, ir.OpPreInc:
+		return '+'
+	}
+	if isNegativeLit(n) {
+		return '-'
+	}
+	return 0
+}
+
+// isConcatAmbiguous reports whether a mix of x and y operators
+// is parsed differently by PHP 7 and PHP 8.
+//
+// PHP 7 gives '.' the same precedence as '+' and '-',
+// while PHP 8 makes it bind looser than '+', '-', '<<' and '>>'.
+func isConcatAmbiguous(x, y ir.Op) bool {
+	if x == ir.OpConcat {
+		x, y = y, x
+	}
+	if y != ir.OpConcat {
+		return false
+	}
+	switch x {
+	case ir.OpAdd, ir.OpSub, ir.OpBitShiftLeft, ir.OpBitShiftRight:
+		return true
+	default:
+		return false
+	}
+}
+
+// needParens reports whether child operand of the binary parent
+// should be wrapped into parentheses to preserve the tree structure.
+// The right argument tells whether the child is the right operand.
+func needParens(parent, child *ir.Node, right bool) bool {
+	parentInfo := nodeInfo(parent)
+	childInfo := nodeInfo(child)
+	if isConcatAmbiguous(parent.Op, child.Op) {
+		return true
+	}
+	if childInfo.prec != parentInfo.prec {
+		return childInfo.prec < parentInfo.prec
+	}
+	switch parentInfo.assoc {
+	case ir.AssocLeft:
+		return right
+	case ir.AssocRight:
+		return !right
+	default:
+		return true
+	}
+}
+
+// needUnaryParens reports whether child operand of the prefix unary
+// parent should be wrapped into parentheses.
+func needUnaryParens(parent, child *ir.Node, op string) bool {
+	if op != "" && prefixChar(child) == op[len(op)-1] {
+		// Avoid "- -$x" turning into "--$x".
+		return true
+	}
+	if isPrefixUnary(child) {
+		// Prefix operators can be nested without parentheses.
+		return false
+	}
+	return nodeInfo(child).prec < nodeInfo(parent).prec
+}
@@ -0,0 +1,59 @@
+package irprint
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// Printer prints IR nodes like FprintNode does,
+// but it reuses its buffers between the calls.
+//
+// A Printer is not safe for concurrent use.
+// Note that Config.Rand is not safe for concurrent use as well.
+type Printer struct {
+	p printer
+}
+
+func NewPrinter(config *Config) *Printer {
+	return &Printer{
+		p: printer{
+			config: config,
+			w:      newOutputWriter(nil, config),
+		},
+	}
+}
+
+// Fprint prints n to w.
+// It returns the first error that occurred while writing to w.
+func (p *Printer) Fprint(w io.Writer, n *ir.Node) (err error) {
+	defer recoverNodeError(p.p.config, &err)
+
+	p.Reset()
+	p.p.w.Reset(w)
+	p.p.printNode(n)
+	err = p.p.w.Flush()
+	p.p.w.Reset(nil)
+	return err
+}
+
+// Reset discards the printer state, keeping its buffers.
+func (p *Printer) Reset() {
+	p.p.w.Reset(nil)
+	p.p.depth = 0
+	p.p.singleLine = false
+}
+
+// sprinter is a pooled SprintNode state.
+type sprinter struct {
+	printer *Printer
+	buf     bytes.Buffer
+}
+
+var sprinterPool = sync.Pool{
+	New: func() interface{} {
+		return &sprinter{printer: NewPrinter(&Config{})}
+	},
+}
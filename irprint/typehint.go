@@ -0,0 +1,125 @@
+package irprint
+
+import (
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+	"github.com/quasilyte/phpsmith/randutil"
+)
+
+func (p *printer) useParamTypeHint() bool {
+	return p.chance(p.config.ParamTypeHintProbability, p.config.ParamTypeHints)
+}
+
+func (p *printer) useReturnTypeHint() bool {
+	return p.chance(p.config.ReturnTypeHintProbability, p.config.ReturnTypeHints)
+}
+
+// chance rolls the probability if Rand is set.
+// Otherwise, it returns the enabled value.
+func (p *printer) chance(probability float64, enabled bool) bool {
+	if p.config.Rand != nil {
+		return probability != 0 && randutil.Chance(p.config.Rand, probability)
+	}
+	return enabled
+}
+
+// typeHint returns a PHP type declaration for typ.
+// An empty string is returned for types that can't be expressed as a type hint.
+func typeHint(typ ir.Type) string {
+	return formatTypeHint(typ, false)
+}
+
+// paramTypeHint is like typeHint, but only permits the types
+// that are matched exactly by the generated arguments.
+func paramTypeHint(typ ir.Type) string {
+	return formatTypeHint(typ, true)
+}
+
+// returnTypeHint is like paramTypeHint, but also permits void.
+func returnTypeHint(typ ir.Type) string {
+	if typ, ok := typ.(*ir.ScalarType); ok && typ.Kind == ir.ScalarVoid {
+		return "void"
+	}
+	return paramTypeHint(typ)
+}
+
+func formatTypeHint(typ ir.Type, exact bool) string {
+	members, ok := typeHintMembers(nil, typ, exact)
+	if !ok {
+		return ""
+	}
+
+	unique := members[:0]
+	hasNull := false
+	for _, m := range members {
+		if !containsString(unique, m) {
+			unique = append(unique, m)
+		}
+		hasNull = hasNull || m == "null"
+	}
+
+	switch {
+	case len(unique) == 1:
+		if unique[0] == "null" {
+			// Standalone null type requires PHP 8.2.
+			return ""
+		}
+		return unique[0]
+	case containsString(unique, "mixed") || containsString(unique, "void"):
+		// These types can't be a part of a union.
+		return ""
+	case len(unique) == 2 && hasNull:
+		if unique[0] == "null" {
+			return "?" + unique[1]
+		}
+		return "?" + unique[0]
+	default:
+		return strings.Join(unique, "|")
+	}
+}
+
+// typeHintMembers appends the flattened union members of typ to dst.
+func typeHintMembers(dst []string, typ ir.Type, exact bool) ([]string, bool) {
+	switch typ := typ.(type) {
+	case *ir.ScalarType:
+		switch typ.Kind {
+		case ir.ScalarBool, ir.ScalarInt, ir.ScalarFloat, ir.ScalarString, ir.ScalarNull:
+			return append(dst, typ.Kind.String()), true
+		case ir.ScalarMixed:
+			return append(dst, "mixed"), !exact
+		case ir.ScalarVoid:
+			return append(dst, "void"), !exact
+		}
+	case *ir.EnumType:
+		return append(dst, typ.ValueType.Kind.String()), true
+	case *ir.ArrayType:
+		return append(dst, "array"), true
+	case *ir.ClassType:
+		return append(dst, typ.Name), !exact
+	case *ir.ObjectType:
+		return append(dst, "object"), !exact
+	case *ir.NullableType:
+		dst, ok := typeHintMembers(dst, typ.X, exact)
+		return append(dst, "null"), ok
+	case *ir.UnionType:
+		for _, x := range typ.Types {
+			var ok bool
+			dst, ok = typeHintMembers(dst, x, exact)
+			if !ok {
+				return dst, false
+			}
+		}
+		return dst, len(typ.Types) != 0
+	}
+	return dst, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package irprint
+
+import "github.com/quasilyte/phpsmith/randutil"
+
+// printLineEnd ends a statement line.
+// It maybe adds trailing whitespace and a blank line.
+func (p *printer) printLineEnd() {
+	if p.useWhitespace() {
+		p.printTrailingWhitespace()
+	}
+	p.w.WriteByte('\n')
+	if p.useWhitespace() {
+		if randutil.Bool(p.config.Rand) {
+			p.printTrailingWhitespace()
+		}
+		p.w.WriteByte('\n')
+	}
+}
+
+func (p *printer) printTrailingWhitespace() {
+	for i := randutil.IntRange(p.config.Rand, 1, 4); i > 0; i-- {
+		if randutil.Bool(p.config.Rand) {
+			p.w.WriteByte(' ')
+		} else {
+			p.w.WriteByte('\t')
+		}
+	}
+}
+
+func (p *printer) useWhitespace() bool {
+	return p.config.Rand != nil &&
+		p.config.WhitespaceProbability != 0 &&
+		randutil.Chance(p.config.Rand, p.config.WhitespaceProbability)
+}
@@ -0,0 +1,157 @@
+package irprint
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/quasilyte/phpsmith/ir"
+)
+
+// columnWriter is a bufio.Writer that tracks the current output column.
+// Columns are counted in bytes, so a tab is a single column.
+//
+// The first write error is recorded, all subsequent writes are skipped.
+type columnWriter struct {
+	w      *bufio.Writer
+	column int
+	err    error
+
+	// newline replaces every written '\n' if it's not empty.
+	newline string
+}
+
+func newColumnWriter(w io.Writer) *columnWriter {
+	return &columnWriter{w: bufio.NewWriter(w)}
+}
+
+// newOutputWriter returns a columnWriter that writes
+// the final output with the config line terminators.
+// The intermediate outputs should use the newColumnWriter.
+func newOutputWriter(w io.Writer, config *Config) *columnWriter {
+	cw := newColumnWriter(w)
+	if config.Newline != "\n" {
+		cw.newline = config.Newline
+	}
+	return cw
+}
+
+// Reset discards the buffered data and the recorded error,
+// and makes w write to dst.
+func (w *columnWriter) Reset(dst io.Writer) {
+	w.w.Reset(dst)
+	w.column = 0
+	w.err = nil
+}
+
+func (w *columnWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	i := bytes.LastIndexByte(b, '\n')
+	if i != -1 {
+		w.column = len(b) - i - 1
+	} else {
+		w.column += len(b)
+	}
+	if w.newline != "" && i != -1 {
+		_, w.err = w.w.Write(bytes.ReplaceAll(b, []byte("\n"), []byte(w.newline)))
+		return len(b), w.err
+	}
+	n, err := w.w.Write(b)
+	w.err = err
+	return n, err
+}
+
+func (w *columnWriter) WriteString(s string) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	i := strings.LastIndexByte(s, '\n')
+	if i != -1 {
+		w.column = len(s) - i - 1
+	} else {
+		w.column += len(s)
+	}
+	if w.newline != "" && i != -1 {
+		_, w.err = w.w.WriteString(strings.ReplaceAll(s, "\n", w.newline))
+		return len(s), w.err
+	}
+	n, err := w.w.WriteString(s)
+	w.err = err
+	return n, err
+}
+
+// WriteRaw is like WriteString, but it never replaces the '\n'.
+// It's used for the outputs that already have the final line terminators,
+// like the printed continuations, and for the heredoc bodies,
+// where the line terminators are a part of the string value.
+func (w *columnWriter) WriteRaw(s string) {
+	newline := w.newline
+	w.newline = ""
+	w.WriteString(s)
+	w.newline = newline
+}
+
+func (w *columnWriter) WriteByte(b byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	if b == '\n' {
+		w.column = 0
+		if w.newline != "" {
+			_, w.err = w.w.WriteString(w.newline)
+			return w.err
+		}
+	} else {
+		w.column++
+	}
+	w.err = w.w.WriteByte(b)
+	return w.err
+}
+
+// Flush writes the buffered data and returns the first write error.
+func (w *columnWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// fits reports whether s can be printed at the current line.
+// Multi-line parts never fit, since they're not wrapped as a whole.
+func (p *printer) fits(s string) bool {
+	if p.config.MaxLineLength == 0 || p.singleLine {
+		return true
+	}
+	return !strings.Contains(s, "\n") && p.w.column+len(s) <= p.config.MaxLineLength
+}
+
+// sprintContinuation prints n into a string as if it was
+// the start of a continuation line at the next indentation level.
+// The result should be written with WriteRaw.
+func (p *printer) sprintContinuation(n *ir.Node) string {
+	var buf bytes.Buffer
+	sub := &printer{
+		config: p.config,
+		w:      newColumnWriter(&buf),
+		depth:  p.depth + 1,
+
+		singleLine: p.singleLine,
+	}
+	// The result is written with WriteRaw, so the line terminators
+	// are replaced here, keeping the heredoc bodies intact.
+	sub.w.newline = p.w.newline
+	sub.w.column = sub.depth * len(p.indentString())
+	sub.printNode(n)
+	sub.w.Flush()
+	return buf.String()
+}
+
+// newlineContinuation starts a continuation line.
+func (p *printer) newlineContinuation() {
+	p.w.WriteByte('\n')
+	p.writeIndent(p.depth + 1)
+}
@@ -13,7 +13,7 @@ func init() {
 		minArgsNum := len(f.Params)
 		for i := len(f.Params) - 1; i > 0; i-- {
 			p := f.Params[i]
-			if p.Init != nil {
+			if p.Default != nil {
 				minArgsNum--
 			}
 		}
@@ -41,7 +41,7 @@ var funcList = []*ir.FuncType{
 		Name: "rtrim",
 		Params: []ir.TypeField{
 			{Name: "s", Type: ir.StringType},
-			{Name: "what", Type: ir.StringType, Init: " \x0a\x0d\x09\x0b\x00"},
+			{Name: "what", Type: ir.StringType, Default: ir.NewStringLit(" \x0a\x0d\x09\x0b\x00")},
 		},
 		Result: ir.StringType,
 	},
@@ -71,7 +71,7 @@ var funcList = []*ir.FuncType{
 		Name: "ltrim",
 		Params: []ir.TypeField{
 			{Name: "s", Type: ir.StringType},
-			{Name: "what", Type: ir.StringType, Init: " \x0a\x0d\x09\x0b\x00"},
+			{Name: "what", Type: ir.StringType, Default: ir.NewStringLit(" \x0a\x0d\x09\x0b\x00")},
 		},
 		Result: ir.StringType,
 	},
@@ -104,14 +104,15 @@ var funcList = []*ir.FuncType{
 		},
 		Result: ir.StringType,
 	},
-	// {
-	// 	Name: "str_starts_with",
-	// 	Params: []ir.TypeField{
-	// 		{Name: "haystack", Type: ir.StringType},
-	// 		{Name: "needle", Type: ir.StringType},
-	// 	},
-	// 	Result: ir.BoolType,
-	// },
+	{
+		Name: "str_starts_with",
+		Params: []ir.TypeField{
+			{Name: "haystack", Type: ir.StringType},
+			{Name: "needle", Type: ir.StringType},
+		},
+		Result:        ir.BoolType,
+		MinPHPVersion: 80000,
+	},
 	// {
 	// 	Name: "vprintf",
 	// 	Params: []ir.TypeField{
@@ -140,7 +141,7 @@ var funcList = []*ir.FuncType{
 			{Name: "str", Type: ir.StringType},
 			{Name: "replacement", Type: ir.StringType},
 			{Name: "start", Type: ir.IntType, Strict: true},
-			{Name: "length", Type: ir.IntType, Init: 9223372036854775807, Strict: true},
+			{Name: "length", Type: ir.IntType, Default: ir.NewIntLit(9223372036854775807), Strict: true},
 		},
 		Result: ir.StringType,
 	},
@@ -148,7 +149,7 @@ var funcList = []*ir.FuncType{
 		Name: "trim",
 		Params: []ir.TypeField{
 			{Name: "s", Type: ir.StringType},
-			{Name: "what", Type: ir.StringType, Init: " \x0a\x0d\x09\x0b\x00"},
+			{Name: "what", Type: ir.StringType, Default: ir.NewStringLit(" \x0a\x0d\x09\x0b\x00")},
 		},
 		Result: ir.StringType,
 	},
@@ -164,7 +165,7 @@ var funcList = []*ir.FuncType{
 		Name: "str_split",
 		Params: []ir.TypeField{
 			{Name: "str", Type: ir.StringType},
-			{Name: "split_length", Type: ir.IntType, Init: 1},
+			{Name: "split_length", Type: ir.IntType, Default: ir.NewIntLit(1), Min: 1, Max: 8},
 		},
 		Result: &ir.ArrayType{Elem: ir.StringType},
 	},
@@ -174,6 +175,7 @@ var funcList = []*ir.FuncType{
 			{Name: "name", Type: ir.StringType},
 		},
 		Result: ir.BoolType,
+		Impure: true,
 	},
 	{
 		Name: "getimagesize",
@@ -181,35 +183,97 @@ var funcList = []*ir.FuncType{
 			{Name: "name", Type: ir.StringType},
 		},
 		Result: ir.MixedType,
+		Impure: true,
+	},
+	{
+		Name: "str_ends_with",
+		Params: []ir.TypeField{
+			{Name: "haystack", Type: ir.StringType},
+			{Name: "needle", Type: ir.StringType},
+		},
+		Result:        ir.BoolType,
+		MinPHPVersion: 80000,
 	},
-	// {
-	// 	Name: "str_ends_with",
-	// 	Params: []ir.TypeField{
-	// 		{Name: "haystack", Type: ir.StringType},
-	// 		{Name: "needle", Type: ir.StringType},
-	// 	},
-	// 	Result: ir.BoolType,
-	// },
 	{
 		Name: "is_writeable",
 		Params: []ir.TypeField{
 			{Name: "name", Type: ir.StringType},
 		},
 		Result: ir.BoolType,
+		Impure: true,
+	},
+	{
+		Name: "str_repeat",
+		Params: []ir.TypeField{
+			{Name: "s", Type: ir.StringType},
+			{Name: "multiplier", Type: ir.IntType, Max: 16},
+		},
+		Result: ir.StringType,
+	},
+	{
+		Name: "str_pad",
+		Params: []ir.TypeField{
+			{Name: "s", Type: ir.StringType},
+			{Name: "length", Type: ir.IntType, Max: 32},
+		},
+		Result: ir.StringType,
+	},
+	{
+		Name: "substr",
+		Params: []ir.TypeField{
+			{Name: "s", Type: ir.StringType},
+			{Name: "start", Type: ir.IntType, Strict: true},
+			{Name: "length", Type: ir.IntType, Strict: true, Default: ir.NewIntLit(0)},
+		},
+		Result: ir.StringType,
+		// PHP 7 returns false for the out of range start.
+		MinPHPVersion: 80000,
+	},
+	{
+		Name: "number_format",
+		Params: []ir.TypeField{
+			{Name: "num", Type: ir.FloatType},
+			{Name: "decimals", Type: ir.IntType, Default: ir.NewIntLit(0), Max: 6},
+		},
+		Result: ir.StringType,
+	},
+	{
+		Name: "abs",
+		Params: []ir.TypeField{
+			{Name: "num", Type: ir.IntType, Strict: true},
+		},
+		Result:   ir.IntType,
+		NeedCast: true,
+	},
+	{
+		Name: "intdiv",
+		Params: []ir.TypeField{
+			{Name: "num1", Type: ir.IntType, Strict: true},
+			{Name: "num2", Type: ir.IntType, Min: 1, Max: 1000},
+		},
+		Result: ir.IntType,
+	},
+	{
+		Name: "max",
+		Params: []ir.TypeField{
+			{Name: "value1", Type: ir.IntType, Strict: true},
+			{Name: "value2", Type: ir.IntType, Strict: true},
+		},
+		Result: ir.IntType,
+	},
+	{
+		Name: "min",
+		Params: []ir.TypeField{
+			{Name: "value1", Type: ir.IntType, Strict: true},
+			{Name: "value2", Type: ir.IntType, Strict: true},
+		},
+		Result: ir.IntType,
 	},
-	// {
-	// 	Name: "str_repeat",
-	// 	Params: []ir.TypeField{
-	// 		{Name: "s", Type: ir.StringType},
-	// 		{Name: "multiplier", Type: ir.IntType},
-	// 	},
-	// 	Result: ir.StringType,
-	// },
 	{
 		Name: "basename",
 		Params: []ir.TypeField{
 			{Name: "name", Type: ir.StringType},
-			{Name: "suffix", Type: ir.StringType, Init: ""},
+			{Name: "suffix", Type: ir.StringType, Default: ir.NewStringLit("")},
 		},
 		Result: ir.StringType,
 	},
@@ -234,6 +298,7 @@ var funcList = []*ir.FuncType{
 			{Name: "name", Type: ir.StringType},
 		},
 		Result: ir.BoolType,
+		Impure: true,
 	},
 	{
 		Name: "chr",
@@ -248,6 +313,7 @@ var funcList = []*ir.FuncType{
 			{Name: "name", Type: ir.StringType},
 		},
 		Result: ir.BoolType,
+		Impure: true,
 	},
 	{
 		Name: "parse_str",
@@ -266,7 +332,7 @@ var funcList = []*ir.FuncType{
 	// 	Name: "htmlspecialchars",
 	// 	Params: []ir.TypeField{
 	// 		{Name: "str", Type: ir.StringType},
-	// 		{Name: "flags", Type: ir.IntType, Init: 0},
+	// 		{Name: "flags", Type: ir.IntType, Default: ir.NewIntLit(0)},
 	// 	},
 	// 	Result: ir.StringType,
 	// },
@@ -284,6 +350,7 @@ var funcList = []*ir.FuncType{
 			{Name: "name", Type: ir.StringType},
 		},
 		Result: ir.BoolType,
+		Impure: true,
 	},
 	{
 		Name: "long2ip",
@@ -303,7 +370,7 @@ var funcList = []*ir.FuncType{
 	// 	Name: "log",
 	// 	Params: []ir.TypeField{
 	// 		{Name: "v", Type: ir.FloatType},
-	// 		{Name: "base", Type: ir.FloatType, Init: 2.7182818284590452353602874713527},
+	// 		{Name: "base", Type: ir.FloatType, Default: ir.NewFloatLit(2.7182818284590452353602874713527)},
 	// 	},
 	// 	Result: ir.FloatType,
 	// },
@@ -318,9 +385,9 @@ var funcList = []*ir.FuncType{
 	// 	Name: "wordwrap",
 	// 	Params: []ir.TypeField{
 	// 		{Name: "str", Type: ir.StringType},
-	// 		{Name: "width", Type: ir.IntType, Init: 75},
-	// 		{Name: "break", Type: ir.StringType, Init: "\n"},
-	// 		{Name: "cut", Type: ir.BoolType, Init: false},
+	// 		{Name: "width", Type: ir.IntType, Default: ir.NewIntLit(75)},
+	// 		{Name: "break", Type: ir.StringType, Default: ir.NewStringLit("\n")},
+	// 		{Name: "cut", Type: ir.BoolType, Default: ir.NewBoolLit(false)},
 	// 	},
 	// 	Result: ir.StringType,
 	// },
@@ -434,8 +501,8 @@ var funcList = []*ir.FuncType{
 	// 	Name: "html_entity_decode",
 	// 	Params: []ir.TypeField{
 	// 		{Name: "str", Type: ir.StringType},
-	// 		{Name: "flags", Type: ir.IntType, Init: 0, Strict: true},
-	// 		{Name: "encoding", Type: ir.StringType, Init: "1251"},
+	// 		{Name: "flags", Type: ir.IntType, Default: ir.NewIntLit(0), Strict: true},
+	// 		{Name: "encoding", Type: ir.StringType, Default: ir.NewStringLit("1251")},
 	// 	},
 	// 	Result: ir.StringType,
 	// },
@@ -464,7 +531,7 @@ var funcList = []*ir.FuncType{
 		Name: "round",
 		Params: []ir.TypeField{
 			{Name: "v", Type: ir.FloatType},
-			{Name: "precision", Type: ir.IntType, Init: 0, Strict: true},
+			{Name: "precision", Type: ir.IntType, Default: ir.NewIntLit(0), Strict: true},
 		},
 		Result: ir.FloatType,
 	},
@@ -480,7 +547,7 @@ var funcList = []*ir.FuncType{
 		Name: "count_chars",
 		Params: []ir.TypeField{
 			{Name: "str", Type: ir.StringType},
-			{Name: "mode", Type: ir.IntType, Init: 0},
+			{Name: "mode", Type: ir.IntType, Default: ir.NewIntLit(0)},
 		},
 		Result: ir.MixedType,
 	},
@@ -502,7 +569,7 @@ var funcList = []*ir.FuncType{
 	// 	Name: "htmlspecialchars_decode",
 	// 	Params: []ir.TypeField{
 	// 		{Name: "str", Type: ir.StringType},
-	// 		{Name: "flags", Type: ir.IntType, Init: 0, Strict: true},
+	// 		{Name: "flags", Type: ir.IntType, Default: ir.NewIntLit(0), Strict: true},
 	// 	},
 	// 	Result: ir.StringType,
 	// },
@@ -519,7 +586,7 @@ var funcList = []*ir.FuncType{
 		Name: "parse_url",
 		Params: []ir.TypeField{
 			{Name: "str", Type: ir.StringType},
-			{Name: "component", Type: ir.IntType, Init: -1},
+			{Name: "component", Type: ir.IntType, Default: ir.NewIntLit(-1)},
 		},
 		Result: ir.MixedType,
 	},
@@ -598,7 +665,7 @@ var funcList = []*ir.FuncType{
 		Name: "sha1",
 		Params: []ir.TypeField{
 			{Name: "s", Type: ir.StringType},
-			{Name: "raw_output", Type: ir.BoolType, Init: false},
+			{Name: "raw_output", Type: ir.BoolType, Default: ir.NewBoolLit(false)},
 		},
 		Result: ir.StringType,
 	},
@@ -620,7 +687,7 @@ var funcList = []*ir.FuncType{
 		Name: "md5",
 		Params: []ir.TypeField{
 			{Name: "s", Type: ir.StringType},
-			{Name: "raw_output", Type: ir.BoolType, Init: false},
+			{Name: "raw_output", Type: ir.BoolType, Default: ir.NewBoolLit(false)},
 		},
 		Result: ir.StringType,
 	},
@@ -637,6 +704,7 @@ var funcList = []*ir.FuncType{
 			{Name: "a", Type: &ir.ArrayType{Elem: ir.MixedType}},
 		},
 		Result: ir.VoidType,
+		Impure: true,
 	},
 	{
 		Name: "crc32",
@@ -649,7 +717,7 @@ var funcList = []*ir.FuncType{
 		Name: "preg_quote",
 		Params: []ir.TypeField{
 			{Name: "str", Type: ir.StringType},
-			{Name: "delimiter", Type: ir.StringType, Init: ""},
+			{Name: "delimiter", Type: ir.StringType, Default: ir.NewStringLit("")},
 		},
 		Result: ir.StringType,
 	},
@@ -799,9 +867,10 @@ var funcList = []*ir.FuncType{
 		Name: "array_rand",
 		Params: []ir.TypeField{
 			{Name: "a", Type: &ir.ArrayType{Elem: ir.MixedType}},
-			{Name: "num", Type: ir.IntType, Init: 1},
+			{Name: "num", Type: ir.IntType, Default: ir.NewIntLit(1)},
 		},
 		Result: ir.MixedType,
+		Impure: true,
 	},
 	{
 		Name: "array_flip",
@@ -815,7 +884,7 @@ var funcList = []*ir.FuncType{
 	// 	Params: []ir.TypeField{
 	// 		{Name: "value", Type: ir.MixedType},
 	// 		{Name: "a", Type: &ir.ArrayType{Elem: ir.MixedType}},
-	// 		{Name: "strict", Type: ir.BoolType, Init: false},
+	// 		{Name: "strict", Type: ir.BoolType, Default: ir.NewBoolLit(false)},
 	// 	},
 	// 	Result: ir.BoolType,
 	// },
@@ -831,7 +900,7 @@ var funcList = []*ir.FuncType{
 		Params: []ir.TypeField{
 			{Name: "val", Type: ir.MixedType},
 			{Name: "a", Type: &ir.ArrayType{Elem: ir.MixedType}},
-			{Name: "strict", Type: ir.BoolType, Init: false},
+			{Name: "strict", Type: ir.BoolType, Default: ir.NewBoolLit(false)},
 		},
 		Result: ir.MixedType,
 	},
@@ -847,7 +916,7 @@ var funcList = []*ir.FuncType{
 		Params: []ir.TypeField{
 			{Name: "delimiter", Type: ir.StringType},
 			{Name: "str", Type: ir.StringType},
-			{Name: "limit", Type: ir.IntType, Init: 9223372036854775807},
+			{Name: "limit", Type: ir.IntType, Default: ir.NewIntLit(9223372036854775807)},
 		},
 		Result: &ir.ArrayType{Elem: ir.StringType},
 	},